@@ -15,7 +15,8 @@ import (
 
 func main() {
 	var (
-		flagFile = flag.String("backfill_file", "", "file with rows to backfill")
+		flagFile    = flag.String("backfill_file", "", "file with rows to backfill")
+		flagDataDir = flag.String("data_dir", "", "directory for persisting ingested rows, in memory only if empty")
 	)
 	flag.Parse()
 
@@ -30,6 +31,11 @@ func main() {
 		backfillFile = flagFile
 	}
 
+	var dataDir *string = nil
+	if *flagDataDir != "" {
+		dataDir = flagDataDir
+	}
+
 	lis, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", port))
 	if err != nil {
 		ctx.Logger.Fatalf("failed to listen: %v", err)
@@ -38,7 +44,7 @@ func main() {
 	s := grpc.NewServer()
 
 	reflection.Register(s)
-	pb.RegisterBapiServer(s, server.NewServer(ctx, backfillFile))
+	pb.RegisterBapiServer(s, server.NewServer(ctx, backfillFile, dataDir))
 
 	ctx.Logger.Infof("server listening at %v", lis.Addr())
 
@@ -56,8 +56,13 @@ func main() {
 		g.GET("/rows", runRowsQuery)
 		g.GET("/table", runTableQuery)
 		g.GET("/timeline", runTimelineQuery)
+		g.GET("/sql", runSqlQuery)
 		g.GET("/table_info", getTableInfo)
 		g.GET("/string_values", searchStrValues)
+		g.GET("/tables", listTables)
+		g.POST("/create_table", createTable)
+		g.POST("/drop_table", dropTable)
+		g.POST("/table_retention", setTableRetention)
 	}
 
 	port := os.Getenv("PORT")
@@ -135,6 +140,11 @@ type timelineQueryWrapper struct {
 	Q pb.TimelineQuery `form:"q"`
 }
 
+// The SQL is the plain text of `q`, like `?q=SELECT count(*) FROM events`.
+type sqlQueryWrapper struct {
+	Q string `form:"q" json:"q"`
+}
+
 func runRowsQuery(c *gin.Context) {
 	request := rowsQueryWrapper{}
 	//	allow passing as Json body (for testing locally) or url params
@@ -219,6 +229,34 @@ func runTimelineQuery(c *gin.Context) {
 	c.JSON(http.StatusOK, &reply)
 }
 
+func runSqlQuery(c *gin.Context) {
+	request := sqlQueryWrapper{}
+	//	allow passing as Json body (for testing locally) or url params
+	if err := c.ShouldBindJSON(&request); err != nil {
+		if err := c.ShouldBindQuery(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	conn, ok := getServiceConnection()
+	if !ok {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewBapiClient(conn)
+
+	reply, e := client.RunSqlQuery(context.Background(), &pb.SqlQuery{Query: request.Q})
+	if e != nil {
+		logger.Warnf("fail to get service reply: %v", e)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, &reply)
+}
+
 func getTableInfo(c *gin.Context) {
 	tableName, ok := getSingleParam(c, "table")
 	if !ok {
@@ -277,6 +315,100 @@ func searchStrValues(c *gin.Context) {
 	c.JSON(http.StatusOK, &reply)
 }
 
+func listTables(c *gin.Context) {
+	conn, ok := getServiceConnection()
+	if !ok {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewBapiClient(conn)
+
+	reply, e := client.ListTables(context.Background(), &pb.ListTablesRequest{})
+	if e != nil {
+		logger.Warnf("fail to get service reply: %v", e)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, &reply)
+}
+
+func createTable(c *gin.Context) {
+	request := pb.CreateTableRequest{}
+	if err := c.BindJSON(&request); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	conn, ok := getServiceConnection()
+	if !ok {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewBapiClient(conn)
+
+	reply, e := client.CreateTable(context.Background(), &request)
+	if e != nil {
+		logger.Warnf("fail to get service reply: %v", e)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, &reply)
+}
+
+func dropTable(c *gin.Context) {
+	request := pb.DropTableRequest{}
+	if err := c.BindJSON(&request); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	conn, ok := getServiceConnection()
+	if !ok {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewBapiClient(conn)
+
+	reply, e := client.DropTable(context.Background(), &request)
+	if e != nil {
+		logger.Warnf("fail to get service reply: %v", e)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, &reply)
+}
+
+func setTableRetention(c *gin.Context) {
+	request := pb.SetTableRetentionRequest{}
+	if err := c.BindJSON(&request); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	conn, ok := getServiceConnection()
+	if !ok {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewBapiClient(conn)
+
+	reply, e := client.SetTableRetention(context.Background(), &request)
+	if e != nil {
+		logger.Warnf("fail to get service reply: %v", e)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, &reply)
+}
+
 func getSingleParam(c *gin.Context, param string) (string, bool) {
 	vals, ok := c.Request.URL.Query()[param]
 	if !ok || len(vals) != 1 {
@@ -13,15 +13,25 @@ type BapiCfg struct {
 	maxRowsPerBlock            uint16
 	maxParitialBlocks          uint16
 	partialBlocksFlushInterval time.Duration
+	snapshotInterval           time.Duration
+	coldBlockAge               time.Duration
+	retentionInterval          time.Duration
+	compactionInterval         time.Duration
+	strGcInterval              time.Duration
 }
 
 func NewDefaultCfg() *BapiCfg {
 	return &BapiCfg{
 		maxColumn:                  512,     // should be enough for common product use cases
-		maxStrCount:                0xFFFFF, //1048575
+		maxStrCount:                0xFFFFF, //1048575, per str column
 		maxRowsPerBlock:            0xFFF,   // an arbitrary number...
 		maxParitialBlocks:          0xF,     // max number of partial blocks in partialBlockQueue
 		partialBlocksFlushInterval: 5 * time.Second,
+		snapshotInterval:           10 * time.Minute, // how often tables are persisted when data_dir is set
+		coldBlockAge:               24 * time.Hour,   // older blocks are served from the mapped snapshot files
+		retentionInterval:          time.Minute,      // how often expired blocks are dropped
+		compactionInterval:         time.Minute,      // how often small blocks are merged
+		strGcInterval:              10 * time.Minute, // how often unused strings are removed
 	}
 }
 
@@ -63,3 +73,23 @@ func (ctx *BapiCtx) GetMaxPartialBlocks() int {
 func (ctx *BapiCtx) GetPartialBlockFlushInterval() time.Duration {
 	return ctx.cfg.partialBlocksFlushInterval
 }
+
+func (ctx *BapiCtx) GetSnapshotInterval() time.Duration {
+	return ctx.cfg.snapshotInterval
+}
+
+func (ctx *BapiCtx) GetColdBlockAge() time.Duration {
+	return ctx.cfg.coldBlockAge
+}
+
+func (ctx *BapiCtx) GetRetentionInterval() time.Duration {
+	return ctx.cfg.retentionInterval
+}
+
+func (ctx *BapiCtx) GetCompactionInterval() time.Duration {
+	return ctx.cfg.compactionInterval
+}
+
+func (ctx *BapiCtx) GetStrGcInterval() time.Duration {
+	return ctx.cfg.strGcInterval
+}
@@ -0,0 +1,328 @@
+package server
+
+import (
+	common "bapi/internal/common"
+	"bapi/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The table used when a request doesn't specify one. It's created on startup if missing.
+const defaultTableName = "test_table"
+
+// The suffix of the directory of a table being dropped, which is not a valid table name.
+const droppedTableDirSuffix = ".dropped"
+
+const tableConfigFileName = "config.json"
+
+var validTableName = regexp.MustCompile(`^[a-zA-Z0-9_]{1,64}$`)
+
+var (
+	errInvalidTableName = errors.New("table name should be 1 to 64 letters, digits or underscores")
+	errTableExists      = errors.New("table already exists")
+	errTableNotFound    = errors.New("table not found")
+	errInvalidRetention = errors.New("retention should not be negative")
+	errDropDefaultTable = errors.New("the default table can't be dropped")
+)
+
+/**
+ * The registry of the tables hosted by the server.
+ * When dataDir is set, each table is persisted to `<dataDir>/<tableName>`, which holds the
+ * snapshot, the write-ahead log and the tableConfig of the table, and all the tables in
+ * dataDir are restored on startup.
+ */
+type catalog struct {
+	ctx     *common.BapiCtx
+	dataDir *string
+
+	lock   *sync.RWMutex
+	tables map[string]*store.Table
+}
+
+// The settings of a table, which are persisted along with the table.
+type tableConfig struct {
+	RetentionSeconds int64 `json:"retention_seconds"`
+}
+
+func newCatalog(ctx *common.BapiCtx, dataDir *string) *catalog {
+	return &catalog{
+		ctx:     ctx,
+		dataDir: dataDir,
+		lock:    &sync.RWMutex{},
+		tables:  make(map[string]*store.Table),
+	}
+}
+
+// Restores all the tables persisted in dataDir.
+func (c *catalog) restoreTables() error {
+	if c.dataDir == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(*c.dataDir, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(*c.dataDir)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer func() {
+		c.lock.Unlock()
+	}()
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		if strings.HasSuffix(name, droppedTableDirSuffix) {
+			// the server crashed in the middle of dropping the table
+			if err := os.RemoveAll(filepath.Join(*c.dataDir, name)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !validTableName.MatchString(name) {
+			c.ctx.Logger.Warnf("ignoring unknown directory in data_dir: %s", name)
+			continue
+		}
+
+		config, err := c.readTableConfig(name)
+		if err != nil {
+			return fmt.Errorf("failed to restore table %s: %v", name, err)
+		}
+		table, err := c.openTable(name, config)
+		if err != nil {
+			return fmt.Errorf("failed to restore table %s: %v", name, err)
+		}
+		c.tables[name] = table
+	}
+	return nil
+}
+
+func (c *catalog) createTable(name string, config *tableConfig) (*store.Table, error) {
+	if !validTableName.MatchString(name) {
+		return nil, errInvalidTableName
+	}
+	if config.RetentionSeconds < 0 {
+		return nil, errInvalidRetention
+	}
+
+	c.lock.Lock()
+	defer func() {
+		c.lock.Unlock()
+	}()
+
+	if _, ok := c.tables[name]; ok {
+		return nil, errTableExists
+	}
+
+	table, err := c.openTable(name, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.writeTableConfig(name, config); err != nil {
+		table.Close()
+		return nil, err
+	}
+	c.tables[name] = table
+	c.ctx.Logger.Infof("created table %s", name)
+	return table, nil
+}
+
+/**
+ * Closes the table and deletes its data. The default table is never dropped, as the requests
+ * without a table name go to it.
+ * Only the removal from the tables and the rename of its directory hold the lock, so closing and
+ * deleting the table don't block the requests of the other tables.
+ */
+func (c *catalog) dropTable(name string) error {
+	if name == defaultTableName {
+		return errDropDefaultTable
+	}
+
+	table, droppedDir, err := c.detachTable(name)
+	if err != nil {
+		return err
+	}
+
+	if err := table.Close(); err != nil {
+		c.ctx.Logger.Warnf("failed to close table %s: %v", name, err)
+	}
+	if droppedDir != "" {
+		if err := os.RemoveAll(droppedDir); err != nil {
+			return err
+		}
+	}
+
+	c.ctx.Logger.Infof("dropped table %s", name)
+	return nil
+}
+
+func (c *catalog) setTableRetention(name string, retentionSeconds int64) error {
+	if retentionSeconds < 0 {
+		return errInvalidRetention
+	}
+
+	c.lock.Lock()
+	defer func() {
+		c.lock.Unlock()
+	}()
+
+	table, ok := c.tables[name]
+	if !ok {
+		return errTableNotFound
+	}
+
+	if err := c.writeTableConfig(name, &tableConfig{RetentionSeconds: retentionSeconds}); err != nil {
+		return err
+	}
+	table.SetRetention(time.Duration(retentionSeconds) * time.Second)
+	return nil
+}
+
+func (c *catalog) getTable(name string) (*store.Table, bool) {
+	c.lock.RLock()
+	defer func() {
+		c.lock.RUnlock()
+	}()
+
+	table, ok := c.tables[name]
+	return table, ok
+}
+
+// Returns all the tables sorted by name.
+func (c *catalog) listTables() []*store.Table {
+	c.lock.RLock()
+	names := make([]string, 0, len(c.tables))
+	for name := range c.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tables := make([]*store.Table, len(names))
+	for i, name := range names {
+		tables[i] = c.tables[name]
+	}
+	c.lock.RUnlock()
+
+	return tables
+}
+
+// Persists all the tables if dataDir is set.
+func (c *catalog) snapshotTables() {
+	if c.dataDir == nil {
+		return
+	}
+
+	for _, table := range c.listTables() {
+		name := table.GetTableInfo().TableName
+		if err := table.Snapshot(filepath.Join(c.getTableDir(name), "snapshot")); err != nil {
+			c.ctx.Logger.Errorf("failed to snapshot table %s: %v", name, err)
+		}
+	}
+}
+
+// --------------------------- internal ----------------------------
+/**
+ * Removes the table from the tables and, if dataDir is set, renames its directory to a unique
+ * dropped one to be deleted, which is returned. The directory is renamed first so a table of the
+ * same name created right after starts empty, and a partially deleted table is never restored.
+ */
+func (c *catalog) detachTable(name string) (*store.Table, string, error) {
+	c.lock.Lock()
+	defer func() {
+		c.lock.Unlock()
+	}()
+
+	table, ok := c.tables[name]
+	if !ok {
+		return nil, "", errTableNotFound
+	}
+
+	droppedDir := ""
+	if c.dataDir != nil {
+		tableDir := c.getTableDir(name)
+		droppedDir = fmt.Sprintf("%s.%d%s", tableDir, time.Now().UnixNano(), droppedTableDirSuffix)
+		if err := os.Rename(tableDir, droppedDir); err != nil {
+			return nil, "", err
+		}
+	}
+	delete(c.tables, name)
+	return table, droppedDir, nil
+}
+
+// Creates the table and, if dataDir is set, restores it from its directory.
+func (c *catalog) openTable(name string, config *tableConfig) (*store.Table, error) {
+	table := store.NewTable(c.ctx, name)
+	table.SetRetention(time.Duration(config.RetentionSeconds) * time.Second)
+	if c.dataDir == nil {
+		return table, nil
+	}
+
+	tableDir := c.getTableDir(name)
+	if err := os.MkdirAll(tableDir, 0755); err != nil {
+		table.Close()
+		return nil, err
+	}
+
+	if err := table.LoadSnapshot(filepath.Join(tableDir, "snapshot")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		table.Close()
+		return nil, fmt.Errorf("failed to load snapshot: %v", err)
+	}
+
+	if err := table.OpenWal(filepath.Join(tableDir, "wal")); err != nil {
+		table.Close()
+		return nil, fmt.Errorf("failed to open wal: %v", err)
+	}
+	return table, nil
+}
+
+func (c *catalog) getTableDir(name string) string {
+	return filepath.Join(*c.dataDir, name)
+}
+
+// Reads the config of a persisted table. Returns the default config if there is none.
+func (c *catalog) readTableConfig(name string) (*tableConfig, error) {
+	config := &tableConfig{}
+	content, err := os.ReadFile(filepath.Join(c.getTableDir(name), tableConfigFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *catalog) writeTableConfig(name string, config *tableConfig) error {
+	if c.dataDir == nil {
+		return nil
+	}
+
+	content, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(c.getTableDir(name), tableConfigFileName)
+	if err := os.WriteFile(path+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -5,27 +5,59 @@ import (
 	pb "bapi/internal/pb"
 	"bapi/internal/store"
 	context "context"
+	"errors"
+	"time"
 )
 
 type server struct {
 	pb.UnimplementedBapiServer
-	ctx   *common.BapiCtx
-	table *store.Table
+	ctx     *common.BapiCtx
+	catalog *catalog
 }
 
-func NewServer(ctx *common.BapiCtx, backfillFile *string) *server {
+func NewServer(ctx *common.BapiCtx, backfillFile *string, dataDir *string) *server {
 	s := &server{}
 	s.ctx = ctx
-	// TODO: properly set up the table
-	s.table = store.NewTable(ctx, "test_table")
+	s.catalog = newCatalog(ctx, dataDir)
+	if err := s.catalog.restoreTables(); err != nil {
+		ctx.Logger.Fatalf("failed to restore tables: %v", err)
+	}
+
+	defaultTable, ok := s.catalog.getTable(defaultTableName)
+	if !ok {
+		table, err := s.catalog.createTable(defaultTableName, &tableConfig{})
+		if err != nil {
+			ctx.Logger.Fatalf("failed to create table %s: %v", defaultTableName, err)
+		}
+		defaultTable = table
+	}
+
+	if dataDir != nil {
+		go s.snapshotPeriodically()
+	}
 
 	if backfillFile != nil {
-		s.table.IngestFile(*backfillFile, true /*useServerTs*/)
+		defaultTable.IngestFile(*backfillFile, true /*useServerTs*/)
 	}
 
 	return s
 }
 
+// Gets the table by name, or the default table if the name is empty.
+func (s *server) getTable(tableName string) (*store.Table, bool) {
+	if tableName == "" {
+		tableName = defaultTableName
+	}
+	return s.catalog.getTable(tableName)
+}
+
+func (s *server) snapshotPeriodically() {
+	ticker := time.NewTicker(s.ctx.GetSnapshotInterval())
+	for range ticker.C {
+		s.catalog.snapshotTables()
+	}
+}
+
 func (s *server) Ping(ctx context.Context, in *pb.PingRequest) (*pb.PingReply, error) {
 	s.ctx.Logger.Infof("Received: %v", in.GetName())
 	message := "Hello " + in.GetName()
@@ -37,6 +69,7 @@ func (s *server) Ping(ctx context.Context, in *pb.PingRequest) (*pb.PingReply, e
 
 func (s *server) InitiateShutdown(ctx context.Context, in *pb.InitiateShutdownRequest) (*pb.InitiateShutdownReply, error) {
 	s.ctx.Logger.Info("Received: InitiateShutdown, reason: %d", in.GetReason())
+	s.catalog.snapshotTables()
 	return &pb.InitiateShutdownReply{
 		Status:  pb.Status_OK,
 		Message: nil,
@@ -44,7 +77,16 @@ func (s *server) InitiateShutdown(ctx context.Context, in *pb.InitiateShutdownRe
 }
 
 func (s *server) IngestRawRows(ctx context.Context, in *pb.IngestRawRowsRequset) (*pb.IngestRawRowsReply, error) {
-	s.table.IngestJsonRows(
+	table, ok := s.getTable(in.TableName)
+	if !ok {
+		message := errTableNotFound.Error()
+		return &pb.IngestRawRowsReply{
+			Status:  pb.Status_BAD_REQUEST,
+			Message: &message,
+		}, nil
+	}
+
+	table.IngestJsonRows(
 		in.Rows,
 		in.UseServerTs,
 	)
@@ -57,7 +99,16 @@ func (s *server) IngestRawRows(ctx context.Context, in *pb.IngestRawRowsRequset)
 
 func (s *server) RunRowsQuery(ctx context.Context, in *pb.RowsQuery) (*pb.RowsQueryReply, error) {
 	s.ctx.Logger.Info(in)
-	result, hasValue := s.table.RowsQuery(in)
+	table, ok := s.getTable(in.TableName)
+	if !ok {
+		message := errTableNotFound.Error()
+		return &pb.RowsQueryReply{
+			Status:  pb.Status_BAD_REQUEST,
+			Message: &message,
+		}, nil
+	}
+
+	result, hasValue := table.RowsQuery(in)
 	if !hasValue {
 		return &pb.RowsQueryReply{
 			Status:  pb.Status_NO_CONTENT,
@@ -75,7 +126,16 @@ func (s *server) RunRowsQuery(ctx context.Context, in *pb.RowsQuery) (*pb.RowsQu
 
 func (s *server) RunTableQuery(ctx context.Context, in *pb.TableQuery) (*pb.TableQueryReply, error) {
 	s.ctx.Logger.Info(in)
-	result, hasValue := s.table.TableQuery(in)
+	table, ok := s.getTable(in.TableName)
+	if !ok {
+		message := errTableNotFound.Error()
+		return &pb.TableQueryReply{
+			Status:  pb.Status_BAD_REQUEST,
+			Message: &message,
+		}, nil
+	}
+
+	result, hasValue := table.TableQuery(in)
 	if !hasValue {
 		return &pb.TableQueryReply{
 			Status:  pb.Status_NO_CONTENT,
@@ -93,7 +153,23 @@ func (s *server) RunTableQuery(ctx context.Context, in *pb.TableQuery) (*pb.Tabl
 
 func (s *server) RunTimelineQuery(ctx context.Context, in *pb.TimelineQuery) (*pb.TimelineQueryReply, error) {
 	s.ctx.Logger.Info(in)
-	result, hasValue := s.table.TimeilneQuery(in)
+	table, ok := s.getTable(in.TableName)
+	if !ok {
+		message := errTableNotFound.Error()
+		return &pb.TimelineQueryReply{
+			Status:  pb.Status_BAD_REQUEST,
+			Message: &message,
+		}, nil
+	}
+
+	result, hasValue, err := table.TimeilneQuery(in)
+	if err != nil {
+		message := err.Error()
+		return &pb.TimelineQueryReply{
+			Status:  pb.Status_BAD_REQUEST,
+			Message: &message,
+		}, nil
+	}
 	if !hasValue {
 		return &pb.TimelineQueryReply{
 			Status:  pb.Status_NO_CONTENT,
@@ -109,10 +185,46 @@ func (s *server) RunTimelineQuery(ctx context.Context, in *pb.TimelineQuery) (*p
 	}, nil
 }
 
+func (s *server) RunSqlQuery(ctx context.Context, in *pb.SqlQuery) (*pb.SqlQueryReply, error) {
+	s.ctx.Logger.Info(in)
+	stmt, err := store.ParseSql(in.Query)
+	if err != nil {
+		return newSqlErrorReply(err), nil
+	}
+
+	table, ok := s.getTable(stmt.TableName)
+	if !ok {
+		message := errTableNotFound.Error()
+		return &pb.SqlQueryReply{
+			Status:  pb.Status_BAD_REQUEST,
+			Message: &message,
+		}, nil
+	}
+
+	result, hasValue, err := table.SqlQuery(stmt)
+	if err != nil {
+		return newSqlErrorReply(err), nil
+	}
+	if !hasValue {
+		// still with the planned query, to tell why there is no row
+		return &pb.SqlQueryReply{
+			Status:  pb.Status_NO_CONTENT,
+			Message: nil,
+			Result:  result,
+		}, nil
+	}
+
+	return &pb.SqlQueryReply{
+		Status:  pb.Status_OK,
+		Message: nil,
+		Result:  result,
+	}, nil
+}
+
 func (s *server) GetTableInfo(ctx context.Context, in *pb.GetTableInfoRequest) (*pb.GetTableInfoReply, error) {
 	s.ctx.Logger.Info(in)
-	tableInfo := s.table.GetTableInfo()
-	if tableInfo.TableName != in.TableName {
+	table, ok := s.getTable(in.TableName)
+	if !ok {
 		return &pb.GetTableInfoReply{
 			Status: pb.Status_NO_CONTENT,
 		}, nil
@@ -120,20 +232,20 @@ func (s *server) GetTableInfo(ctx context.Context, in *pb.GetTableInfoRequest) (
 
 	return &pb.GetTableInfoReply{
 		Status:    pb.Status_OK,
-		TableInfo: tableInfo,
+		TableInfo: table.GetTableInfo(),
 	}, nil
 }
 
 func (s *server) SearchStrValues(ctx context.Context, in *pb.SearchStrValuesRequest) (*pb.SearchStrValuesReply, error) {
 	s.ctx.Logger.Info(in)
-	tableInfo := s.table.GetTableInfo()
-	if tableInfo.TableName != in.TableName {
+	table, ok := s.getTable(in.TableName)
+	if !ok {
 		return &pb.SearchStrValuesReply{
 			Status: pb.Status_NO_CONTENT,
 		}, nil
 	}
 
-	if vals, ok := s.table.SearchStrValues(in.ColumnName, in.SearchString); ok {
+	if vals, ok := table.SearchStrValues(in.ColumnName, in.SearchString); ok {
 		return &pb.SearchStrValuesReply{
 			Status: pb.Status_OK,
 			Values: vals,
@@ -143,3 +255,88 @@ func (s *server) SearchStrValues(ctx context.Context, in *pb.SearchStrValuesRequ
 		Status: pb.Status_NO_CONTENT,
 	}, nil
 }
+
+func (s *server) CreateTable(ctx context.Context, in *pb.CreateTableRequest) (*pb.CreateTableReply, error) {
+	s.ctx.Logger.Info(in)
+	if _, err := s.catalog.createTable(in.TableName, &tableConfig{RetentionSeconds: in.RetentionSeconds}); err != nil {
+		message := err.Error()
+		status := pb.Status_SERVER_ERROR
+		if errors.Is(err, errInvalidTableName) || errors.Is(err, errTableExists) || errors.Is(err, errInvalidRetention) {
+			status = pb.Status_BAD_REQUEST
+		}
+		return &pb.CreateTableReply{
+			Status:  status,
+			Message: &message,
+		}, nil
+	}
+
+	return &pb.CreateTableReply{
+		Status: pb.Status_OK,
+	}, nil
+}
+
+func (s *server) DropTable(ctx context.Context, in *pb.DropTableRequest) (*pb.DropTableReply, error) {
+	s.ctx.Logger.Info(in)
+	if err := s.catalog.dropTable(in.TableName); err != nil {
+		message := err.Error()
+		status := pb.Status_SERVER_ERROR
+		if errors.Is(err, errTableNotFound) || errors.Is(err, errDropDefaultTable) {
+			status = pb.Status_BAD_REQUEST
+		}
+		return &pb.DropTableReply{
+			Status:  status,
+			Message: &message,
+		}, nil
+	}
+
+	return &pb.DropTableReply{
+		Status: pb.Status_OK,
+	}, nil
+}
+
+func (s *server) SetTableRetention(ctx context.Context, in *pb.SetTableRetentionRequest) (*pb.SetTableRetentionReply, error) {
+	s.ctx.Logger.Info(in)
+	if err := s.catalog.setTableRetention(in.TableName, in.RetentionSeconds); err != nil {
+		message := err.Error()
+		status := pb.Status_SERVER_ERROR
+		if errors.Is(err, errTableNotFound) || errors.Is(err, errInvalidRetention) {
+			status = pb.Status_BAD_REQUEST
+		}
+		return &pb.SetTableRetentionReply{
+			Status:  status,
+			Message: &message,
+		}, nil
+	}
+
+	return &pb.SetTableRetentionReply{
+		Status: pb.Status_OK,
+	}, nil
+}
+
+func (s *server) ListTables(ctx context.Context, in *pb.ListTablesRequest) (*pb.ListTablesReply, error) {
+	tables := s.catalog.listTables()
+	tableInfos := make([]*pb.TableInfo, len(tables))
+	for i, table := range tables {
+		tableInfos[i] = table.GetTableInfo()
+	}
+
+	return &pb.ListTablesReply{
+		Status:     pb.Status_OK,
+		TableInfos: tableInfos,
+	}, nil
+}
+
+// --------------------------- internal ----------------------------
+// The BAD_REQUEST of an invalid SQL query, with the offset of the offending token.
+func newSqlErrorReply(err error) *pb.SqlQueryReply {
+	message := err.Error()
+	reply := &pb.SqlQueryReply{
+		Status:  pb.Status_BAD_REQUEST,
+		Message: &message,
+	}
+	if sqlErr, ok := err.(*store.SqlError); ok {
+		offset := int32(sqlErr.Offset)
+		reply.ErrorOffset = &offset
+	}
+	return reply
+}
@@ -13,50 +13,95 @@ type accumulator[T numeric] interface {
 	debugGetType() string
 }
 
+// Implemented by the accumulators whose result depends on the ts of the values, e.g. FIRST.
+type tsAccumulator[T numeric] interface {
+	accumulator[T]
+	addValueAt(v T, ts int64)
+}
+
 // The type of the accumulated value for a col.
 const (
-	accInvalidRes       = iota
-	accIntRes           = iota
-	accFloatRes         = iota
-	accTimelineCountRes = iota
-	accGenericRes       = iota
+	accInvalidRes  = iota
+	accIntRes      = iota
+	accFloatRes    = iota
+	accBucketedRes = iota
+	accGenericRes  = iota
 )
 
 // Wraps the return value of a accumulator due to the generic appOp interface
 type accResult[T numeric] struct {
-	intVal           int64
-	floatVal         float64
-	genericVal       T
-	timelintCountVal map[int64]int
-	valType          int
-	hasValue         bool
-}
+	intVal     int64
+	floatVal   float64
+	genericVal T
+	bucketVals map[int64]accResult[T]
+	valType    int
+	hasValue   bool
+}
+
+// The parameters of the accumulators of some ops, e.g. the quantile of PERCENTILE.
+type accParams struct {
+	quantile     float64
+	hllPrecision uint8
+	// for timelines: the values are accumulated by ts bucket, @see accumulatorBucketed
+	bucketer tsBucketer
+}
+
+// Creates an accumulator for the given pb.AggOp, of each ts bucket if the params have a bucketer.
+func newAccumulator[T numeric](op pb.AggOp, params accParams) (accumulator[T], bool) {
+	if params.bucketer != nil {
+		bucketParams := params
+		bucketParams.bucketer = nil
+		proto, ok := newAccumulator[T](op, bucketParams)
+		if !ok {
+			return nil, false
+		}
+		return newAccumulatorBucketed(proto, params.bucketer), true
+	}
 
-// Creates a slice of accumulator for the given pb.AggOp and the number of cols
-func getAccumulatorSlice[T numeric](op pb.AggOp, colCount int) ([]accumulator[T], bool) {
-	var templteAccumulator accumulator[T]
 	switch op {
 	case pb.AggOp_COUNT:
-		templteAccumulator = newAccumulatorCount[T]()
+		return newAccumulatorCount[T](), true
 	case pb.AggOp_COUNT_DISTINCT:
-		templteAccumulator = newAccumulatorCountDistinct[T]()
+		return newAccumulatorCountDistinct[T](), true
 	case pb.AggOp_SUM:
-		templteAccumulator = newAccumulatorSum[T]()
+		return newAccumulatorSum[T](), true
 	case pb.AggOp_AVG:
-		templteAccumulator = newAccumulatorAvg[T]()
-	case pb.AggOp_TIMELINE_COUNT:
-		templteAccumulator = newAccumulatorTimelineCount[T]()
+		return newAccumulatorAvg[T](), true
+	case pb.AggOp_MIN:
+		return newAccumulatorMin[T](), true
+	case pb.AggOp_MAX:
+		return newAccumulatorMax[T](), true
+	case pb.AggOp_FIRST:
+		return newAccumulatorFirst[T](), true
+	case pb.AggOp_LAST:
+		return newAccumulatorLast[T](), true
+	case pb.AggOp_PERCENTILE:
+		return newAccumulatorPercentile[T](params.quantile), true
+	case pb.AggOp_APPROX_COUNT_DISTINCT:
+		return newAccumulatorApproxCountDistinct[T](params.hllPrecision), true
 	default:
 		return nil, false
 	}
+}
 
-	s := make([]accumulator[T], colCount)
-	for i := 0; i < colCount; i++ {
-		s[i] = templteAccumulator.new()
+// Creates a slice of accumulator for the given aggSpecs, which may have different ops
+func getAccumulatorSlice[T numeric](specs []aggSpec) ([]accumulator[T], bool) {
+	s := make([]accumulator[T], len(specs))
+	for i, spec := range specs {
+		acc, ok := newAccumulator[T](spec.op, spec.params)
+		if !ok {
+			return nil, false
+		}
+		s[i] = acc
 	}
 	return s, true
 }
 
+// Whether the accumulators of the op are tsAccumulators, which need the ts of the values.
+func isTsOrderedAggOp(op pb.AggOp) bool {
+	return op == pb.AggOp_FIRST || op == pb.AggOp_LAST
+}
+
 // --------------------------- constructors for accResult ---------------------------
 func newAccIntResult[T numeric](intVal int64, hasValue bool) accResult[T] {
 	return accResult[T]{intVal: intVal, valType: accIntRes, hasValue: hasValue}
@@ -70,8 +115,8 @@ func newAccGenericResult[T numeric](genericVal T, hasValue bool) accResult[T] {
 	return accResult[T]{genericVal: genericVal, valType: accGenericRes, hasValue: hasValue}
 }
 
-func newAccTimelineCountResult[T numeric](timelintCountVal map[int64]int, hasValue bool) accResult[T] {
-	return accResult[T]{timelintCountVal: timelintCountVal, valType: accTimelineCountRes, hasValue: hasValue}
+func newAccBucketedResult[T numeric](bucketVals map[int64]accResult[T], hasValue bool) accResult[T] {
+	return accResult[T]{bucketVals: bucketVals, valType: accBucketedRes, hasValue: hasValue}
 }
 
 // --------------------------- accumulatorCount ---------------------------
@@ -134,6 +179,36 @@ func (op *accumulatorCountDistinct[T]) debugGetType() string {
 	return "accumulatorCountDistinct"
 }
 
+// --------------------------- accumulatorApproxCountDistinct ---------------------------
+// Estimates the count of the distinct values with a hyperLogLog, instead of keeping them all.
+type accumulatorApproxCountDistinct[T numeric] struct {
+	hll *hyperLogLog
+}
+
+func newAccumulatorApproxCountDistinct[T numeric](precision uint8) *accumulatorApproxCountDistinct[T] {
+	return &accumulatorApproxCountDistinct[T]{hll: newHyperLogLog(precision)}
+}
+
+func (op *accumulatorApproxCountDistinct[T]) new() accumulator[T] {
+	return newAccumulatorApproxCountDistinct[T](op.hll.precision)
+}
+
+func (op *accumulatorApproxCountDistinct[T]) addValue(v T) {
+	op.hll.addHash(hashNumeric(v))
+}
+
+func (op *accumulatorApproxCountDistinct[T]) consume(other accumulator[T]) {
+	op.hll.merge(other.(*accumulatorApproxCountDistinct[T]).hll)
+}
+
+func (op *accumulatorApproxCountDistinct[T]) finalize() accResult[T] {
+	return newAccIntResult[T](op.hll.estimate(), true /*hasValue*/)
+}
+
+func (op *accumulatorApproxCountDistinct[T]) debugGetType() string {
+	return "accumulatorApproxCountDistinct"
+}
+
 // --------------------------- accumulatorSum ---------------------------
 type accumulatorSum[T numeric] struct {
 	sum      T
@@ -203,42 +278,260 @@ func (op *accumulatorAvg[T]) debugGetType() string {
 	return "accumulatorAvg"
 }
 
-// --------------------------- accumulatorTimelineCount ---------------------------
-type accumulatorTimelineCount[T numeric] struct {
-	m map[int64]int
+// --------------------------- accumulatorBucketed ---------------------------
+/**
+ * Accumulates the values of each ts bucket of a timeline with an accumulator of its own, which is
+ * created from the proto one, e.g. the p95 of each 5 minutes.
+ */
+type accumulatorBucketed[T numeric] struct {
+	proto    accumulator[T]
+	bucketer tsBucketer
+	m        map[int64]accumulator[T]
 }
 
-func newAccumulatorTimelineCount[T numeric]() *accumulatorTimelineCount[T] {
-	return &accumulatorTimelineCount[T]{m: make(map[int64]int)}
+func newAccumulatorBucketed[T numeric](proto accumulator[T], bucketer tsBucketer) *accumulatorBucketed[T] {
+	return &accumulatorBucketed[T]{
+		proto:    proto,
+		bucketer: bucketer,
+		m:        make(map[int64]accumulator[T]),
+	}
+}
+
+func (op *accumulatorBucketed[T]) new() accumulator[T] {
+	return newAccumulatorBucketed(op.proto, op.bucketer)
 }
 
-func (op *accumulatorTimelineCount[T]) new() accumulator[T] {
-	return newAccumulatorTimelineCount[T]()
+// Without the ts, the value is in the first bucket.
+func (op *accumulatorBucketed[T]) addValue(v T) {
+	op.addValueAt(v, op.bucketer.getBucketStartTs(0))
 }
 
-// The caller is responsible to make sure v is the ts bucket
-func (op *accumulatorTimelineCount[T]) addValue(v T) {
-	// https://github.com/golang/go/issues/49206
-	bucket := (interface{})(v).(int64)
-	if _, ok := op.m[bucket]; !ok {
-		op.m[bucket] = 0
+func (op *accumulatorBucketed[T]) addValueAt(v T, ts int64) {
+	bucket := op.bucketer.getBucket(ts)
+	acc, ok := op.m[bucket]
+	if !ok {
+		acc = op.proto.new()
+		op.m[bucket] = acc
+	}
+
+	if tsAcc, ok := acc.(tsAccumulator[T]); ok {
+		tsAcc.addValueAt(v, ts)
+	} else {
+		acc.addValue(v)
 	}
-	op.m[bucket] += 1
 }
 
-func (op *accumulatorTimelineCount[T]) consume(other accumulator[T]) {
-	for bucket, count := range other.(*accumulatorTimelineCount[T]).m {
-		if _, ok := op.m[bucket]; !ok {
-			op.m[bucket] = 0
+func (op *accumulatorBucketed[T]) consume(other accumulator[T]) {
+	for bucket, otherAcc := range other.(*accumulatorBucketed[T]).m {
+		if acc, ok := op.m[bucket]; ok {
+			acc.consume(otherAcc)
+		} else {
+			op.m[bucket] = otherAcc
 		}
-		op.m[bucket] += count
 	}
 }
 
-func (op *accumulatorTimelineCount[T]) finalize() accResult[T] {
-	return newAccTimelineCountResult[T](op.m, len(op.m) != 0)
+func (op *accumulatorBucketed[T]) finalize() accResult[T] {
+	bucketVals := make(map[int64]accResult[T], len(op.m))
+	for bucket, acc := range op.m {
+		bucketVals[bucket] = acc.finalize()
+	}
+	return newAccBucketedResult(bucketVals, len(op.m) != 0)
+}
+
+func (op *accumulatorBucketed[T]) debugGetType() string {
+	return "accumulatorBucketed"
+}
+
+// --------------------------- accumulatorMin ---------------------------
+type accumulatorMin[T numeric] struct {
+	min      T
+	hasValue bool
+}
+
+func newAccumulatorMin[T numeric]() *accumulatorMin[T] {
+	return &accumulatorMin[T]{}
+}
+
+func (op *accumulatorMin[T]) new() accumulator[T] {
+	return newAccumulatorMin[T]()
+}
+
+func (op *accumulatorMin[T]) addValue(v T) {
+	if !op.hasValue || v < op.min {
+		op.min = v
+	}
+	op.hasValue = true
+}
+
+func (op *accumulatorMin[T]) consume(other accumulator[T]) {
+	if otherMin := other.(*accumulatorMin[T]); otherMin.hasValue {
+		op.addValue(otherMin.min)
+	}
+}
+
+func (op *accumulatorMin[T]) finalize() accResult[T] {
+	return newAccGenericResult(op.min, op.hasValue)
+}
+
+func (op *accumulatorMin[T]) debugGetType() string {
+	return "accumulatorMin"
+}
+
+// --------------------------- accumulatorMax ---------------------------
+type accumulatorMax[T numeric] struct {
+	max      T
+	hasValue bool
+}
+
+func newAccumulatorMax[T numeric]() *accumulatorMax[T] {
+	return &accumulatorMax[T]{}
+}
+
+func (op *accumulatorMax[T]) new() accumulator[T] {
+	return newAccumulatorMax[T]()
+}
+
+func (op *accumulatorMax[T]) addValue(v T) {
+	if !op.hasValue || v > op.max {
+		op.max = v
+	}
+	op.hasValue = true
+}
+
+func (op *accumulatorMax[T]) consume(other accumulator[T]) {
+	if otherMax := other.(*accumulatorMax[T]); otherMax.hasValue {
+		op.addValue(otherMax.max)
+	}
+}
+
+func (op *accumulatorMax[T]) finalize() accResult[T] {
+	return newAccGenericResult(op.max, op.hasValue)
+}
+
+func (op *accumulatorMax[T]) debugGetType() string {
+	return "accumulatorMax"
+}
+
+// --------------------------- accumulatorFirst ---------------------------
+// Keeps the value with the smallest ts; of the values with the same ts, the first added is kept.
+type accumulatorFirst[T numeric] struct {
+	value    T
+	ts       int64
+	hasValue bool
+}
+
+func newAccumulatorFirst[T numeric]() *accumulatorFirst[T] {
+	return &accumulatorFirst[T]{}
+}
+
+func (op *accumulatorFirst[T]) new() accumulator[T] {
+	return newAccumulatorFirst[T]()
+}
+
+// Without the ts, the values are ordered as they are added.
+func (op *accumulatorFirst[T]) addValue(v T) {
+	op.addValueAt(v, 0)
+}
+
+func (op *accumulatorFirst[T]) addValueAt(v T, ts int64) {
+	if !op.hasValue || ts < op.ts {
+		op.value = v
+		op.ts = ts
+	}
+	op.hasValue = true
+}
+
+// The other is expected to be of a later block, so it's added after the values of op.
+func (op *accumulatorFirst[T]) consume(other accumulator[T]) {
+	if otherFirst := other.(*accumulatorFirst[T]); otherFirst.hasValue {
+		op.addValueAt(otherFirst.value, otherFirst.ts)
+	}
+}
+
+func (op *accumulatorFirst[T]) finalize() accResult[T] {
+	return newAccGenericResult(op.value, op.hasValue)
+}
+
+func (op *accumulatorFirst[T]) debugGetType() string {
+	return "accumulatorFirst"
+}
+
+// --------------------------- accumulatorLast ---------------------------
+// Keeps the value with the largest ts; of the values with the same ts, the last added is kept.
+type accumulatorLast[T numeric] struct {
+	value    T
+	ts       int64
+	hasValue bool
+}
+
+func newAccumulatorLast[T numeric]() *accumulatorLast[T] {
+	return &accumulatorLast[T]{}
+}
+
+func (op *accumulatorLast[T]) new() accumulator[T] {
+	return newAccumulatorLast[T]()
+}
+
+// Without the ts, the values are ordered as they are added.
+func (op *accumulatorLast[T]) addValue(v T) {
+	op.addValueAt(v, 0)
+}
+
+func (op *accumulatorLast[T]) addValueAt(v T, ts int64) {
+	if !op.hasValue || ts >= op.ts {
+		op.value = v
+		op.ts = ts
+	}
+	op.hasValue = true
+}
+
+// The other is expected to be of a later block, so it's added after the values of op.
+func (op *accumulatorLast[T]) consume(other accumulator[T]) {
+	if otherLast := other.(*accumulatorLast[T]); otherLast.hasValue {
+		op.addValueAt(otherLast.value, otherLast.ts)
+	}
+}
+
+func (op *accumulatorLast[T]) finalize() accResult[T] {
+	return newAccGenericResult(op.value, op.hasValue)
+}
+
+func (op *accumulatorLast[T]) debugGetType() string {
+	return "accumulatorLast"
+}
+
+// --------------------------- accumulatorPercentile ---------------------------
+// Estimates the value at the quantile with a quantileSketch.
+type accumulatorPercentile[T numeric] struct {
+	quantile float64
+	sketch   *quantileSketch
+}
+
+func newAccumulatorPercentile[T numeric](quantile float64) *accumulatorPercentile[T] {
+	return &accumulatorPercentile[T]{
+		quantile: quantile,
+		sketch:   newQuantileSketch(sketchRelativeAccuracy),
+	}
+}
+
+func (op *accumulatorPercentile[T]) new() accumulator[T] {
+	return newAccumulatorPercentile[T](op.quantile)
+}
+
+func (op *accumulatorPercentile[T]) addValue(v T) {
+	op.sketch.add(float64(v))
+}
+
+func (op *accumulatorPercentile[T]) consume(other accumulator[T]) {
+	op.sketch.merge(other.(*accumulatorPercentile[T]).sketch)
+}
+
+func (op *accumulatorPercentile[T]) finalize() accResult[T] {
+	value, hasValue := op.sketch.quantile(op.quantile)
+	return newAccFloatResult[T](value, hasValue)
 }
 
-func (op *accumulatorTimelineCount[T]) debugGetType() string {
-	return "accumulatorTimelineCount"
+func (op *accumulatorPercentile[T]) debugGetType() string {
+	return "accumulatorPercentile"
 }
@@ -10,44 +10,106 @@ import (
 
 type aggCtx struct {
 	logger           *zap.SugaredLogger
-	op               pb.AggOp
 	groupbyIntColCnt int
 	intColCnt        int
 	groupbyStrColCnt int
 	strColCnt        int
+	// all float cols are aggregated
+	floatColCnt int
+	// the aggregations of the aggCols, each an accumulator of every bucket
+	aggSpecs []aggSpec
 	// for assemble result
 	groupbyIntColumnNames []string
 	groupbyStrColumnNames []string
-	aggIntColumnNames     []string
-	strStore              strStore
-	// for timeline query
-	isTimelineQuery bool
-	startTs         int64
-	gran            uint64
+	strStore              readOnlyStrStore
+	// for ts ordered or bucketed aggs, e.g. FIRST or the ones of a timeline: the ts col is in
+	// the int results after the aggIntCols, @see aggSpec.needsTs
+	aggByTs bool
+	// for ordering the groups, @see aggregator.orderAndLimit
+	orderBy     []orderByCol
+	limit       int
+	rollupOther bool
+	having      []havingFilter
+}
+
+// An aggregation of an aggCol, whose result column is named by the alias. @see pb.Aggregation
+type aggSpec struct {
+	op     pb.AggOp
+	params accParams
+	// whether the col is an aggFloatCol or an aggIntCol, and its index in them
+	isFloat bool
+	colIdx  int
+	alias   string
+}
+
+// Splits the aggSpecs into the ones of the aggIntCols and of the aggFloatCols, whose
+// accumulators are in the same order.
+func (c *aggCtx) getAggSpecsByType() ([]aggSpec, []aggSpec) {
+	intSpecs := make([]aggSpec, 0, len(c.aggSpecs))
+	floatSpecs := make([]aggSpec, 0)
+	for _, spec := range c.aggSpecs {
+		if spec.isFloat {
+			floatSpecs = append(floatSpecs, spec)
+		} else {
+			intSpecs = append(intSpecs, spec)
+		}
+	}
+	return intSpecs, floatSpecs
+}
+
+// Whether the accumulators of the spec need the ts of the values, i.e. ts ordered or bucketed.
+func (spec *aggSpec) needsTs() bool {
+	return isTsOrderedAggOp(spec.op) || spec.params.bucketer != nil
+}
+
+// Whether the results of the spec are floats, e.g. the avg of an int col. For the bucketed ones,
+// it's whether the results of the ts buckets are.
+func (spec *aggSpec) hasFloatResult() bool {
+	params := spec.params
+	params.bucketer = nil
+	if spec.isFloat {
+		acc, _ := newAccumulator[float64](spec.op, params)
+		_, _, isFloat, _ := accResultValue(acc.finalize())
+		return isFloat
+	}
+	acc, _ := newAccumulator[int64](spec.op, params)
+	_, _, isFloat, _ := accResultValue(acc.finalize())
+	return isFloat
+}
+
+// The standard error of the results of the spec relative to the values, 0 for the exact ones.
+func (spec *aggSpec) relativeError() float64 {
+	if spec.op == pb.AggOp_APPROX_COUNT_DISTINCT {
+		return hllRelativeError(spec.params.hllPrecision)
+	}
+	return 0
 }
 
 type aggregator struct {
 	ctx        *aggCtx
 	aggBuckets sync.Map // map[uint64]*aggBucket
+	// the accumulators of all blocks, for rolling up the groups after the limit
+	tableIntAccSliceMap   accSliceMap[int64]
+	tableFloatAccSliceMap accSliceMap[float64]
 }
 
 type aggResult[T numeric] struct {
-	m                  map[uint64][]accResult[T]
-	intResIdxes        []int
-	floatResIdxes      []int
-	genericResIdxes    []int
-	timelineCountIdxes []int
+	m                map[uint64][]accResult[T]
+	intResIdxes      []int
+	floatResIdxes    []int
+	genericResIdxes  []int
+	bucketedResIdxes []int
 }
 
 type accSliceMap[T numeric] map[uint64][]accumulator[T]
 
 func (accMap accSliceMap[T]) finalize() (aggResult[T], bool) {
 	aggRes := aggResult[T]{
-		m:                  make(map[uint64][]accResult[T]),
-		intResIdxes:        make([]int, 0),
-		floatResIdxes:      make([]int, 0),
-		genericResIdxes:    make([]int, 0),
-		timelineCountIdxes: make([]int, 0),
+		m:                make(map[uint64][]accResult[T]),
+		intResIdxes:      make([]int, 0),
+		floatResIdxes:    make([]int, 0),
+		genericResIdxes:  make([]int, 0),
+		bucketedResIdxes: make([]int, 0),
 	}
 
 	if len(accMap) == 0 {
@@ -56,10 +118,7 @@ func (accMap accSliceMap[T]) finalize() (aggResult[T], bool) {
 
 	init := false
 	for hash, accSlice := range accMap {
-		aggRes.m[hash] = make([]accResult[T], len(accSlice))
-		for i, accumulator := range accSlice {
-			aggRes.m[hash][i] = accumulator.finalize()
-		}
+		aggRes.m[hash] = finalizeAccumulators(accSlice)
 
 		if !init {
 			// assign accRes of each col base on the type. just need to do this once
@@ -72,8 +131,8 @@ func (accMap accSliceMap[T]) finalize() (aggResult[T], bool) {
 					aggRes.floatResIdxes = append(aggRes.floatResIdxes, i)
 				case accGenericRes:
 					aggRes.genericResIdxes = append(aggRes.genericResIdxes, i)
-				case accTimelineCountRes:
-					aggRes.timelineCountIdxes = append(aggRes.timelineCountIdxes, i)
+				case accBucketedRes:
+					aggRes.bucketedResIdxes = append(aggRes.bucketedResIdxes, i)
 				default:
 					// abort: invalid result type
 					return aggRes, false
@@ -85,6 +144,31 @@ func (accMap accSliceMap[T]) finalize() (aggResult[T], bool) {
 	return aggRes, true
 }
 
+func finalizeAccumulators[T numeric](accSlice []accumulator[T]) []accResult[T] {
+	results := make([]accResult[T], len(accSlice))
+	for i, acc := range accSlice {
+		results[i] = acc.finalize()
+	}
+	return results
+}
+
+// Merges the block level accumulators into the table level's.
+func (accMap accSliceMap[T]) merge(blockAccMap accSliceMap[T]) {
+	for hash, blockAccSlice := range blockAccMap {
+		tableAccSlice, ok := accMap[hash]
+		if !ok {
+			// if this is the first time seeing this hash, we just initialize the table level
+			// accumulator with the block level accumulator
+			accMap[hash] = blockAccSlice
+			continue
+		}
+
+		for i, tableAccumulator := range tableAccSlice {
+			tableAccumulator.consume(blockAccSlice[i])
+		}
+	}
+}
+
 func newAggregator(c *aggCtx) *aggregator {
 	return &aggregator{
 		ctx:        c,
@@ -93,47 +177,55 @@ func newAggregator(c *aggCtx) *aggregator {
 }
 
 func (a *aggregator) aggregateForTimeline(filterResults []*BlockQueryResult) (*pb.TimelineQueryResult, bool) {
-	buckets, intAggResult, ok := a.doAggregate(filterResults)
+	buckets, intAggResult, floatAggResult, ok := a.doAggregate(filterResults)
 	if !ok {
 		return nil, false
 	}
 
-	return a.toPbTimelineQueryResult(buckets, intAggResult), true
+	return a.toPbTimelineQueryResult(buckets, intAggResult, floatAggResult), true
 }
 
 func (a *aggregator) aggregateForTableQuery(filterResults []*BlockQueryResult) (*pb.TableQueryResult, bool) {
-	buckets, intAggResult, ok := a.doAggregate(filterResults)
+	buckets, intAggResult, floatAggResult, ok := a.doAggregate(filterResults)
 	if !ok {
 		return nil, false
 	}
 
-	return a.toPbTableQueryResult(buckets, intAggResult), true
+	buckets = a.filterHaving(buckets, intAggResult, floatAggResult)
+	hasOther := false
+	if len(a.ctx.orderBy) != 0 || a.ctx.limit != 0 {
+		var dropped []*aggBucket
+		buckets, dropped = a.orderAndLimit(buckets, intAggResult, floatAggResult)
+		if a.ctx.rollupOther && len(dropped) != 0 {
+			buckets = append(buckets, a.rollupBuckets(dropped, intAggResult, floatAggResult))
+			hasOther = true
+		}
+	}
+
+	result := a.toPbTableQueryResult(buckets, intAggResult, floatAggResult)
+	result.HasOther = hasOther
+	return result, true
 }
 
-func (a *aggregator) doAggregate(filterResults []*BlockQueryResult) ([]*aggBucket, aggResult[int64], bool) {
+func (a *aggregator) doAggregate(filterResults []*BlockQueryResult) ([]*aggBucket, aggResult[int64], aggResult[float64], bool) {
 	tableIntAccSliceMap := make(accSliceMap[int64])
+	tableFloatAccSliceMap := make(accSliceMap[float64])
 
 	for _, result := range filterResults {
-		blockIntAccSliceMap := a.aggregateBlock(result)
-		for hash, blockAccSlice := range blockIntAccSliceMap {
-			tableAccSlice, ok := tableIntAccSliceMap[hash]
-			if !ok {
-				// if this is the first time seeing this hash, we just initialize the table level
-				// accumulator with the block level accumulator
-				tableIntAccSliceMap[hash] = blockAccSlice
-				continue
-			}
-
-			// merge block level accumulators into table level's
-			for i, tableAccumulator := range tableAccSlice {
-				tableAccumulator.consume(blockAccSlice[i])
-			}
-		}
+		blockIntAccSliceMap, blockFloatAccSliceMap := a.aggregateBlock(result)
+		tableIntAccSliceMap.merge(blockIntAccSliceMap)
+		tableFloatAccSliceMap.merge(blockFloatAccSliceMap)
 	}
+	a.tableIntAccSliceMap = tableIntAccSliceMap
+	a.tableFloatAccSliceMap = tableFloatAccSliceMap
 
 	aggRes, ok := tableIntAccSliceMap.finalize()
 	if !ok {
-		return nil, aggRes, false
+		return nil, aggRes, aggResult[float64]{}, false
+	}
+	floatAggRes, ok := tableFloatAccSliceMap.finalize()
+	if !ok {
+		return nil, aggRes, floatAggRes, false
 	}
 
 	buckets := make([]*aggBucket, 0)
@@ -143,43 +235,69 @@ func (a *aggregator) doAggregate(filterResults []*BlockQueryResult) ([]*aggBucke
 			return true
 		})
 
-	return buckets, aggRes, true
+	return buckets, aggRes, floatAggRes, true
 }
 
-func (a *aggregator) toPbTimelineGroups(buckets []*aggBucket, intAggResult aggResult[int64]) []*pb.TimelineGroup {
-	groups := make([]*pb.TimelineGroup, 0)
-
+/**
+ * Builds a line of the timeline of each bucket from the results of its ts buckets, which are in the
+ * int or float values depending on the result type of the aggregation. The counts are also set
+ * for COUNT, as the timelines only had counts before.
+ */
+func (a *aggregator) toPbTimelineGroups(
+	buckets []*aggBucket,
+	intAggResult aggResult[int64],
+	floatAggResult aggResult[float64],
+) []*pb.TimelineGroup {
+	// a timeline has a single aggregation
+	spec := a.ctx.aggSpecs[0]
+	isFloatResult := spec.hasFloatResult()
+	isCount := spec.op == pb.AggOp_COUNT
+
+	groups := make([]*pb.TimelineGroup, 0, len(buckets))
 	for _, bucket := range buckets {
-		// `line` represents a line in the result timeline UI; it's a map from a ts bucket to
-		// number of rows in that ts bucket. We want to get 2 slices:
-		//	- tsBuckets: the sorted ts buckets
-		//	- counts: the counts of those ts buckets in the same order
-		line := intAggResult.m[bucket.hash][intAggResult.timelineCountIdxes[0]].timelintCountVal
-
-		tsBuckets := make([]uint32, 0, len(line))
-		for tsBucket := range line {
-			tsBuckets = append(tsBuckets, uint32(tsBucket))
+		if spec.isFloat {
+			groups = append(groups, toPbTimelineGroup(floatAggResult.m[bucket.hash][0], isFloatResult, isCount))
+		} else {
+			groups = append(groups, toPbTimelineGroup(intAggResult.m[bucket.hash][0], isFloatResult, isCount))
 		}
+	}
+	return groups
+}
 
-		sort.Slice(tsBuckets, func(i, j int) bool {
-			return tsBuckets[i] < tsBuckets[j]
-		})
+// A line of a timeline from the results of its ts buckets, in the order of the ts buckets.
+func toPbTimelineGroup[T numeric](result accResult[T], isFloatResult bool, isCount bool) *pb.TimelineGroup {
+	tsBuckets := make([]uint32, 0, len(result.bucketVals))
+	for tsBucket := range result.bucketVals {
+		tsBuckets = append(tsBuckets, uint32(tsBucket))
+	}
+	sort.Slice(tsBuckets, func(i, j int) bool {
+		return tsBuckets[i] < tsBuckets[j]
+	})
 
-		counts := make([]uint32, 0, len(line))
-		for _, tsBucket := range tsBuckets {
-			counts = append(counts, uint32(line[int64(tsBucket)]))
+	group := &pb.TimelineGroup{
+		TsBuckets: tsBuckets,
+		HasValue:  make([]bool, 0, len(tsBuckets)),
+	}
+	for _, tsBucket := range tsBuckets {
+		intVal, floatVal, _, hasValue := accResultValue(result.bucketVals[int64(tsBucket)])
+		group.HasValue = append(group.HasValue, hasValue)
+		if isFloatResult {
+			group.FloatValues = append(group.FloatValues, floatVal)
+		} else {
+			group.IntValues = append(group.IntValues, intVal)
+		}
+		if isCount {
+			group.Counts = append(group.Counts, uint32(intVal))
 		}
-
-		groups = append(groups, &pb.TimelineGroup{
-			TsBuckets: tsBuckets,
-			Counts:    counts,
-		})
 	}
-
-	return groups
+	return group
 }
 
-func (a *aggregator) toPbTimelineQueryResult(buckets []*aggBucket, intAggResult aggResult[int64]) *pb.TimelineQueryResult {
+func (a *aggregator) toPbTimelineQueryResult(
+	buckets []*aggBucket,
+	intAggResult aggResult[int64],
+	floatAggResult aggResult[float64],
+) *pb.TimelineQueryResult {
 	bucketCount := len(buckets)
 	groupbyRes := a.toPbGroupbyQueryResult(buckets, intAggResult)
 
@@ -193,7 +311,9 @@ func (a *aggregator) toPbTimelineQueryResult(buckets []*aggBucket, intAggResult
 		StrResult:      groupbyRes.strResult,
 		StrHasValue:    groupbyRes.strHasValue,
 
-		TimelineGroups: a.toPbTimelineGroups(buckets, intAggResult),
+		TimelineGroups: a.toPbTimelineGroups(buckets, intAggResult, floatAggResult),
+		AggColumnName:  a.ctx.aggSpecs[0].alias,
+		AggIsFloat:     a.ctx.aggSpecs[0].hasFloatResult(),
 	}
 }
 
@@ -245,54 +365,36 @@ func (a *aggregator) toPbGroupbyQueryResult(buckets []*aggBucket, intAggResult a
 	}
 }
 
-func (a *aggregator) toPbTableQueryResult(buckets []*aggBucket, intAggResult aggResult[int64]) *pb.TableQueryResult {
+func (a *aggregator) toPbTableQueryResult(
+	buckets []*aggBucket,
+	intAggResult aggResult[int64],
+	floatAggResult aggResult[float64],
+) *pb.TableQueryResult {
 	bucketCount := len(buckets)
 	groupbyRes := a.toPbGroupbyQueryResult(buckets, intAggResult)
 
-	// fills values for aggregated columns that have int results
-	colCnt := len(intAggResult.intResIdxes) + len(intAggResult.genericResIdxes)
-	aggIntColumnNames := make([]string, 0)
-	aggIntResultLen := bucketCount * colCnt
-	aggIntResult := make([]int64, aggIntResultLen)
-	aggIntHasValue := make([]bool, aggIntResultLen)
-
-	colIdxOffset := 0
-	for colIdx, accIdx := range intAggResult.intResIdxes {
-		aggIntColumnNames = append(aggIntColumnNames, a.ctx.aggIntColumnNames[accIdx])
-
-		for i, bucket := range buckets {
-			idx := (colIdxOffset+colIdx)*bucketCount + i
-			accRes := intAggResult.m[bucket.hash][accIdx]
-			aggIntResult[idx] = accRes.intVal
-			aggIntHasValue[idx] = accRes.hasValue
-		}
-	}
-
-	colIdxOffset += len(intAggResult.intResIdxes)
-	for colIdx, accIdx := range intAggResult.genericResIdxes {
-		aggIntColumnNames = append(aggIntColumnNames, a.ctx.aggIntColumnNames[accIdx])
-
-		for i, bucket := range buckets {
-			idx := (colIdxOffset+colIdx)*bucketCount + i
-			accRes := intAggResult.m[bucket.hash][accIdx]
-			aggIntResult[idx] = accRes.genericVal
-			aggIntHasValue[idx] = accRes.hasValue
-		}
+	// fills values for aggregated columns in the order of the aggSpecs, each in the int or float
+	// results depending on its result type, e.g. the count of a float column is an int and the
+	// avg of an int column is a float
+	aggRes := &pbAggQueryResult{
+		intColumnNames:      make([]string, 0),
+		intResult:           make([]int64, 0),
+		intHasValue:         make([]bool, 0),
+		intRelativeErrors:   make([]float64, 0),
+		floatColumnNames:    make([]string, 0),
+		floatResult:         make([]float64, 0),
+		floatHasValue:       make([]bool, 0),
+		floatRelativeErrors: make([]float64, 0),
 	}
-
-	colCnt = len(intAggResult.floatResIdxes)
-	aggFloatColumnNames := make([]string, 0)
-	aggFloatResultLen := bucketCount * colCnt
-	aggFloatResult := make([]float64, aggFloatResultLen)
-	aggFloatHasValue := make([]bool, aggFloatResultLen)
-	for colIdx, accIdx := range intAggResult.floatResIdxes {
-		aggFloatColumnNames = append(aggFloatColumnNames, a.ctx.aggIntColumnNames[accIdx])
-
-		for i, bucket := range buckets {
-			idx := (colIdx)*bucketCount + i
-			accRes := intAggResult.m[bucket.hash][accIdx]
-			aggFloatResult[idx] = accRes.floatVal
-			aggFloatHasValue[idx] = accRes.hasValue
+	intAccIdx := 0
+	floatAccIdx := 0
+	for _, spec := range a.ctx.aggSpecs {
+		if spec.isFloat {
+			appendAggResult(aggRes, spec, buckets, floatAggResult, floatAccIdx)
+			floatAccIdx++
+		} else {
+			appendAggResult(aggRes, spec, buckets, intAggResult, intAccIdx)
+			intAccIdx++
 		}
 	}
 
@@ -306,21 +408,68 @@ func (a *aggregator) toPbTableQueryResult(buckets []*aggBucket, intAggResult agg
 		StrResult:      groupbyRes.strResult,
 		StrHasValue:    groupbyRes.strHasValue,
 
-		AggIntColumnNames: aggIntColumnNames,
-		AggIntResult:      aggIntResult,
-		AggIntHasValue:    aggIntHasValue,
+		AggIntColumnNames: aggRes.intColumnNames,
+		AggIntResult:      aggRes.intResult,
+		AggIntHasValue:    aggRes.intHasValue,
+
+		AggFloatColumnNames: aggRes.floatColumnNames,
+		AggFloatResult:      aggRes.floatResult,
+		AggFloatHasValue:    aggRes.floatHasValue,
+
+		AggIntRelativeErrors:   aggRes.intRelativeErrors,
+		AggFloatRelativeErrors: aggRes.floatRelativeErrors,
+	}
+}
+
+type pbAggQueryResult struct {
+	intColumnNames      []string
+	intResult           []int64
+	intHasValue         []bool
+	intRelativeErrors   []float64
+	floatColumnNames    []string
+	floatResult         []float64
+	floatHasValue       []bool
+	floatRelativeErrors []float64
+}
+
+// Appends the results of the accumulator at accIdx of the buckets as a column of the int or
+// float results, depending on the type of the results.
+func appendAggResult[T numeric](
+	aggRes *pbAggQueryResult,
+	spec aggSpec,
+	buckets []*aggBucket,
+	result aggResult[T],
+	accIdx int,
+) {
+	// the result type is the same for all buckets, even if there is none
+	isFloatResult := spec.hasFloatResult()
+	if isFloatResult {
+		aggRes.floatColumnNames = append(aggRes.floatColumnNames, spec.alias)
+		aggRes.floatRelativeErrors = append(aggRes.floatRelativeErrors, spec.relativeError())
+	} else {
+		aggRes.intColumnNames = append(aggRes.intColumnNames, spec.alias)
+		aggRes.intRelativeErrors = append(aggRes.intRelativeErrors, spec.relativeError())
+	}
 
-		AggFloatColumnNames: aggFloatColumnNames,
-		AggFloatResult:      aggFloatResult,
-		AggFloatHasValue:    aggFloatHasValue,
+	for _, bucket := range buckets {
+		intVal, floatVal, _, hasValue := accResultValue(result.m[bucket.hash][accIdx])
+		if isFloatResult {
+			aggRes.floatResult = append(aggRes.floatResult, floatVal)
+			aggRes.floatHasValue = append(aggRes.floatHasValue, hasValue)
+		} else {
+			aggRes.intResult = append(aggRes.intResult, intVal)
+			aggRes.intHasValue = append(aggRes.intHasValue, hasValue)
+		}
 	}
 }
 
-func (a *aggregator) aggregateBlock(r *BlockQueryResult) accSliceMap[int64] {
+func (a *aggregator) aggregateBlock(r *BlockQueryResult) (accSliceMap[int64], accSliceMap[float64]) {
 	hasher := buildHasherForBlock(a.ctx, r)
 	hashes := hasher.getHashes()
 
 	intAccSliceMap := make(accSliceMap[int64], 0)
+	floatAccSliceMap := make(accSliceMap[float64], 0)
+	intSpecs, floatSpecs := a.ctx.getAggSpecsByType()
 
 	for _, hash := range hashes {
 		_, ok := intAccSliceMap[hash]
@@ -328,7 +477,8 @@ func (a *aggregator) aggregateBlock(r *BlockQueryResult) accSliceMap[int64] {
 			continue
 		}
 		// First time seeting this hash in this block, so initialize the aggResult for it.
-		intAccSliceMap[hash], _ = getAccumulatorSlice[int64](a.ctx.op, a.ctx.intColCnt-a.ctx.groupbyIntColCnt)
+		intAccSliceMap[hash], _ = getAccumulatorSlice[int64](intSpecs)
+		floatAccSliceMap[hash], _ = getAccumulatorSlice[float64](floatSpecs)
 
 		// Also initialize the global aggbucket for it if needed. we do this here instead of
 		// when all blocks are aggregated since the hasher knows the row of the hash.
@@ -338,33 +488,53 @@ func (a *aggregator) aggregateBlock(r *BlockQueryResult) accSliceMap[int64] {
 		}
 	}
 
-	if a.ctx.isTimelineQuery {
-		// timelineQuery: aggregate only the ts col (first after groupbyCols) with the tsBucket
-		tsColIdx := a.ctx.groupbyIntColCnt
-		tsHasRes := r.IntResult.hasValue[tsColIdx]
-		tsVals := r.IntResult.matrix[tsColIdx]
+	// aggregates the aggCols (stored after groupbyCols) with the vals of each spec
+	var tsVals []int64
+	if a.ctx.aggByTs {
+		tsVals = r.IntResult.matrix[a.ctx.intColCnt]
+	}
+	specTsVals := func(spec aggSpec) []int64 {
+		if spec.needsTs() {
+			return tsVals
+		}
+		return nil
+	}
+
+	for accIdx, spec := range intSpecs {
+		colIdx := a.ctx.groupbyIntColCnt + spec.colIdx
+		intHasVal := r.IntResult.hasValue[colIdx]
+		intVals := r.IntResult.matrix[colIdx]
+		tsVals := specTsVals(spec)
 
 		for rowIdx, hash := range hashes {
-			if !tsHasRes[rowIdx] {
-				a.ctx.logger.Panic("missing ts")
+			if !intHasVal[rowIdx] {
+				continue
 			}
-			tsBucket := (tsVals[rowIdx] - a.ctx.startTs) / int64(a.ctx.gran)
-			intAccSliceMap[hash][tsColIdx-a.ctx.groupbyIntColCnt].addValue(tsBucket)
+			addValue(intAccSliceMap[hash][accIdx], intVals[rowIdx], tsVals, rowIdx)
 		}
-	} else {
-		// tableQuery: aggregate the aggCols (stored after groupbyCols) with the vals
-		for colIdx := a.ctx.groupbyIntColCnt; colIdx < a.ctx.intColCnt; colIdx++ {
-			intHasVal := r.IntResult.hasValue[colIdx]
-			intVals := r.IntResult.matrix[colIdx]
-
-			for rowIdx, hash := range hashes {
-				if !intHasVal[rowIdx] {
-					continue
-				}
-				intAccSliceMap[hash][colIdx-a.ctx.groupbyIntColCnt].addValue(intVals[rowIdx])
+	}
+
+	for accIdx, spec := range floatSpecs {
+		floatHasVal := r.FloatResult.hasValue[spec.colIdx]
+		floatVals := r.FloatResult.matrix[spec.colIdx]
+		tsVals := specTsVals(spec)
+
+		for rowIdx, hash := range hashes {
+			if !floatHasVal[rowIdx] {
+				continue
 			}
+			addValue(floatAccSliceMap[hash][accIdx], floatVals[rowIdx], tsVals, rowIdx)
 		}
 	}
 
-	return intAccSliceMap
+	return intAccSliceMap, floatAccSliceMap
+}
+
+// Adds the value of the row to the accumulator, along with its ts if the accumulator needs it.
+func addValue[T numeric](acc accumulator[T], v T, tsVals []int64, rowIdx int) {
+	if tsVals == nil {
+		acc.addValue(v)
+		return
+	}
+	acc.(tsAccumulator[T]).addValueAt(v, tsVals[rowIdx])
 }
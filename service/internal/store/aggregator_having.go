@@ -0,0 +1,82 @@
+package store
+
+import "bapi/internal/pb"
+
+// A filter of the groups of a TableQuery on the result of an aggregation, @see pb.TableQuery.having
+type havingFilter struct {
+	specIdx   int
+	op        pb.FilterOp
+	intVals   []int64
+	floatVals []float64
+}
+
+// Keeps the buckets whose results of the aggregations pass all the having filters.
+func (a *aggregator) filterHaving(
+	buckets []*aggBucket,
+	intAggResult aggResult[int64],
+	floatAggResult aggResult[float64],
+) []*aggBucket {
+	if len(a.ctx.having) == 0 {
+		return buckets
+	}
+
+	accIdxes := make([]int, len(a.ctx.having))
+	for i, filter := range a.ctx.having {
+		accIdxes[i] = a.ctx.getAccIdx(filter.specIdx)
+	}
+
+	kept := make([]*aggBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		keep := true
+		for i, filter := range a.ctx.having {
+			if a.ctx.aggSpecs[filter.specIdx].isFloat {
+				keep = filter.matches(accResultValue(floatAggResult.m[bucket.hash][accIdxes[i]]))
+			} else {
+				keep = filter.matches(accResultValue(intAggResult.m[bucket.hash][accIdxes[i]]))
+			}
+			if !keep {
+				break
+			}
+		}
+
+		if keep {
+			kept = append(kept, bucket)
+		}
+	}
+	return kept
+}
+
+// --------------------------- internal ----------------------------
+/**
+ * Whether the result matches any of the values of the filter, like the filters of the int
+ * columns, e.g. a result without value only matches NULL and NE. The int results are compared to
+ * the float values as floats.
+ */
+func (f *havingFilter) matches(intVal int64, floatVal float64, isFloat bool, hasValue bool) bool {
+	switch f.op {
+	case pb.FilterOp_NULL:
+		return !hasValue
+	case pb.FilterOp_NONNULL:
+		return hasValue
+	}
+	if !hasValue {
+		return f.op == pb.FilterOp_NE
+	}
+
+	if isFloat {
+		floatVals := make([]float64, 0, len(f.intVals)+len(f.floatVals))
+		for _, v := range f.intVals {
+			floatVals = append(floatVals, float64(v))
+		}
+		return matchesAny(f.op, floatVal, append(floatVals, f.floatVals...))
+	}
+	return matchesAny(f.op, intVal, f.intVals) || matchesAny(f.op, float64(intVal), f.floatVals)
+}
+
+func matchesAny[T numeric](op pb.FilterOp, value T, targetValues []T) bool {
+	_, predicate, ok := getTargetValueAndPredicate(&numericFilter[T]{op: op})
+	if !ok {
+		return false
+	}
+	return some(targetValues, func(targetValue T) bool { return predicate(value, targetValue) })
+}
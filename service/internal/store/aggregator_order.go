@@ -0,0 +1,265 @@
+package store
+
+import (
+	"container/heap"
+	"sort"
+
+	"golang.org/x/exp/constraints"
+)
+
+// The kinds of the cols to order the groups by
+const (
+	orderByGroupbyInt = iota
+	orderByGroupbyStr = iota
+	orderByAgg        = iota
+)
+
+// A col to order the groups of a TableQuery by, @see pb.OrderBy
+type orderByCol struct {
+	kind int
+	// the index of the col in the groupby int or str cols, or of the aggSpec
+	colIdx int
+	desc   bool
+}
+
+// Compares 2 buckets, negative if left is ordered before right
+type bucketComparator func(left *aggBucket, right *aggBucket) int
+
+/**
+ * Orders the buckets by the orderBy cols and keeps the first `limit` ones if set. Returns the
+ * kept buckets and the dropped ones.
+ *
+ * With a limit smaller than the bucket count, the kept buckets are selected with a bounded heap
+ * in O(n log(limit)) instead of sorting all of them, as high cardinality groupbys usually only
+ * need the top ones. The buckets of the same values are ordered by their hashes, so the result is
+ * deterministic.
+ */
+func (a *aggregator) orderAndLimit(
+	buckets []*aggBucket,
+	intAggResult aggResult[int64],
+	floatAggResult aggResult[float64],
+) ([]*aggBucket, []*aggBucket) {
+	compare := a.newBucketComparator(intAggResult, floatAggResult)
+
+	limit := a.ctx.limit
+	if limit == 0 || limit >= len(buckets) {
+		sort.Slice(buckets, func(i, j int) bool {
+			return compare(buckets[i], buckets[j]) < 0
+		})
+		return buckets, make([]*aggBucket, 0)
+	}
+
+	h := &bucketHeap{buckets: make([]*aggBucket, 0, limit), compare: compare}
+	dropped := make([]*aggBucket, 0, len(buckets)-limit)
+	for _, bucket := range buckets {
+		if h.Len() < limit {
+			heap.Push(h, bucket)
+			continue
+		}
+
+		// replaces the last one to keep if the bucket is before it
+		if compare(bucket, h.buckets[0]) < 0 {
+			dropped = append(dropped, h.buckets[0])
+			h.buckets[0] = bucket
+			heap.Fix(h, 0)
+		} else {
+			dropped = append(dropped, bucket)
+		}
+	}
+
+	kept := make([]*aggBucket, h.Len())
+	for i := len(kept) - 1; i >= 0; i-- {
+		kept[i] = heap.Pop(h).(*aggBucket)
+	}
+	return kept, dropped
+}
+
+/**
+ * Rolls up the accumulators of the buckets into the ones of a new bucket, which has no value in
+ * the groupby cols. The results of the new bucket are added to the aggResults.
+ */
+func (a *aggregator) rollupBuckets(
+	buckets []*aggBucket,
+	intAggResult aggResult[int64],
+	floatAggResult aggResult[float64],
+) *aggBucket {
+	intSpecs, floatSpecs := a.ctx.getAggSpecsByType()
+	intAccSlice, _ := getAccumulatorSlice[int64](intSpecs)
+	floatAccSlice, _ := getAccumulatorSlice[float64](floatSpecs)
+	for _, bucket := range buckets {
+		for i, acc := range intAccSlice {
+			acc.consume(a.tableIntAccSliceMap[bucket.hash][i])
+		}
+		for i, acc := range floatAccSlice {
+			acc.consume(a.tableFloatAccSliceMap[bucket.hash][i])
+		}
+	}
+
+	// any hash not of a group
+	hash := uint64(0)
+	for _, ok := intAggResult.m[hash]; ok; _, ok = intAggResult.m[hash] {
+		hash++
+	}
+	intAggResult.m[hash] = finalizeAccumulators(intAccSlice)
+	floatAggResult.m[hash] = finalizeAccumulators(floatAccSlice)
+
+	return &aggBucket{
+		hash:      hash,
+		intVals:   make([]int64, a.ctx.groupbyIntColCnt),
+		intHasVal: make([]bool, a.ctx.groupbyIntColCnt),
+		strVals:   make([]strId, a.ctx.groupbyStrColCnt),
+		strHasVal: make([]bool, a.ctx.groupbyStrColCnt),
+	}
+}
+
+// --------------------------- internal ----------------------------
+// Compares the buckets by each orderBy col in order, then by their hashes.
+func (a *aggregator) newBucketComparator(
+	intAggResult aggResult[int64],
+	floatAggResult aggResult[float64],
+) bucketComparator {
+	compares := make([]bucketComparator, 0, len(a.ctx.orderBy)+1)
+	for _, col := range a.ctx.orderBy {
+		colIdx := col.colIdx
+		desc := col.desc
+
+		switch col.kind {
+		case orderByGroupbyInt:
+			compares = append(compares, func(left *aggBucket, right *aggBucket) int {
+				return compareNullable(
+					left.intVals[colIdx], left.intHasVal[colIdx],
+					right.intVals[colIdx], right.intHasVal[colIdx],
+					desc)
+			})
+		case orderByGroupbyStr:
+			// the strs are looked up once, since they are compared many times
+			strs := make(map[strId]string)
+			getStr := func(sid strId) string {
+				str, ok := strs[sid]
+				if !ok {
+					str, _ = a.ctx.strStore.getStr(sid)
+					strs[sid] = str
+				}
+				return str
+			}
+			compares = append(compares, func(left *aggBucket, right *aggBucket) int {
+				return compareNullable(
+					getStr(left.strVals[colIdx]), left.strHasVal[colIdx],
+					getStr(right.strVals[colIdx]), right.strHasVal[colIdx],
+					desc)
+			})
+		case orderByAgg:
+			var getValue func(bucket *aggBucket) (int64, float64, bool, bool)
+			accIdx := a.ctx.getAccIdx(colIdx)
+			if a.ctx.aggSpecs[colIdx].isFloat {
+				getValue = func(bucket *aggBucket) (int64, float64, bool, bool) {
+					return accResultValue(floatAggResult.m[bucket.hash][accIdx])
+				}
+			} else {
+				getValue = func(bucket *aggBucket) (int64, float64, bool, bool) {
+					return accResultValue(intAggResult.m[bucket.hash][accIdx])
+				}
+			}
+			compares = append(compares, func(left *aggBucket, right *aggBucket) int {
+				leftInt, leftFloat, isFloat, leftHasValue := getValue(left)
+				rightInt, rightFloat, _, rightHasValue := getValue(right)
+				if isFloat {
+					return compareNullable(leftFloat, leftHasValue, rightFloat, rightHasValue, desc)
+				}
+				return compareNullable(leftInt, leftHasValue, rightInt, rightHasValue, desc)
+			})
+		}
+	}
+	compares = append(compares, func(left *aggBucket, right *aggBucket) int {
+		return compareNullable(left.hash, true, right.hash, true, false /*desc*/)
+	})
+
+	return func(left *aggBucket, right *aggBucket) int {
+		for _, compare := range compares {
+			if result := compare(left, right); result != 0 {
+				return result
+			}
+		}
+		return 0
+	}
+}
+
+// The index of the accumulator of the aggSpec in the int or float accumulators.
+func (c *aggCtx) getAccIdx(specIdx int) int {
+	accIdx := 0
+	for _, spec := range c.aggSpecs[:specIdx] {
+		if spec.isFloat == c.aggSpecs[specIdx].isFloat {
+			accIdx++
+		}
+	}
+	return accIdx
+}
+
+// Returns the value of the result as an int64 or a float64 depending on its type, e.g. a count
+// is an int64 and the sum of a float col is a float64, and whether it has value.
+func accResultValue[T numeric](result accResult[T]) (int64, float64, bool, bool) {
+	var zero T
+	_, isFloat := (interface{})(zero).(float64)
+
+	switch {
+	case result.valType == accIntRes:
+		return result.intVal, 0, false, result.hasValue
+	case result.valType == accFloatRes:
+		return 0, result.floatVal, true, result.hasValue
+	case isFloat:
+		return 0, float64(result.genericVal), true, result.hasValue
+	default:
+		return int64(result.genericVal), 0, false, result.hasValue
+	}
+}
+
+// Compares the values, the ones without value are the last ones in both directions.
+func compareNullable[T constraints.Ordered](left T, leftHasValue bool, right T, rightHasValue bool, desc bool) int {
+	switch {
+	case !leftHasValue && !rightHasValue:
+		return 0
+	case !leftHasValue:
+		return 1
+	case !rightHasValue:
+		return -1
+	}
+
+	result := 0
+	if left < right {
+		result = -1
+	} else if left > right {
+		result = 1
+	}
+	if desc {
+		return -result
+	}
+	return result
+}
+
+// A max heap of the buckets by the comparator, i.e. the last one of them is on the top.
+type bucketHeap struct {
+	buckets []*aggBucket
+	compare bucketComparator
+}
+
+func (h *bucketHeap) Len() int {
+	return len(h.buckets)
+}
+
+func (h *bucketHeap) Less(i, j int) bool {
+	return h.compare(h.buckets[i], h.buckets[j]) > 0
+}
+
+func (h *bucketHeap) Swap(i, j int) {
+	h.buckets[i], h.buckets[j] = h.buckets[j], h.buckets[i]
+}
+
+func (h *bucketHeap) Push(x interface{}) {
+	h.buckets = append(h.buckets, x.(*aggBucket))
+}
+
+func (h *bucketHeap) Pop() interface{} {
+	last := h.buckets[len(h.buckets)-1]
+	h.buckets = h.buckets[:len(h.buckets)-1]
+	return last
+}
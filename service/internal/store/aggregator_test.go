@@ -45,24 +45,80 @@ func TestAggregator(t *testing.T) {
 		{{2, "ok"}, {3.0}},
 		{{1, "ok2"}, {4.0}},
 	})
+
+	assertAggregatorForTableQuery(t, pb.AggOp_MIN, setup, [][][]interface{}{
+		{{1, "ok"}, {2}},
+		{{2, "ok"}, {3}},
+		{{1, "ok2"}, {4}},
+	})
+
+	assertAggregatorForTableQuery(t, pb.AggOp_MAX, setup, [][][]interface{}{
+		{{1, "ok"}, {5}},
+		{{2, "ok"}, {3}},
+		{{1, "ok2"}, {4}},
+	})
+}
+
+func TestTsOrderedAccumulators(t *testing.T) {
+	first := newAccumulatorFirst[int64]()
+	first.addValueAt(3, 20)
+	first.addValueAt(1, 10)
+	first.addValueAt(2, 10)
+	last := newAccumulatorLast[int64]()
+	last.addValueAt(1, 10)
+	last.addValueAt(3, 30)
+	last.addValueAt(2, 20)
+
+	assert.Equal(t, newAccGenericResult[int64](1, true), first.finalize())
+	assert.Equal(t, newAccGenericResult[int64](3, true), last.finalize())
+
+	// the values of the same ts are ordered as they are consumed
+	otherFirst := newAccumulatorFirst[int64]()
+	otherFirst.addValueAt(4, 10)
+	first.consume(otherFirst)
+	otherLast := newAccumulatorLast[int64]()
+	otherLast.addValueAt(4, 30)
+	last.consume(otherLast)
+	assert.Equal(t, newAccGenericResult[int64](1, true), first.finalize())
+	assert.Equal(t, newAccGenericResult[int64](4, true), last.finalize())
+
+	// consuming an accumulator without value keeps the result
+	first.consume(newAccumulatorFirst[int64]())
+	assert.Equal(t, newAccGenericResult[int64](1, true), first.finalize())
+	assert.False(t, newAccumulatorLast[int64]().finalize().hasValue)
 }
 
 func TestAggregatorForTimelineQuery(t *testing.T) {
 	setup := debugAggregatorSetup{
 		rows: [][]interface{}{
-			{1, 2},
-			{1, 500},
+			{1, 10, 2},
+			{1, 20, 500},
+			{1, 30, 550},
+			{2, 40, 2},
 		},
 		groupbyIntCols: []string{"groupbyIntCol"},
 		groupbyStrCols: []string{},
+		aggIntCols:     []string{"aggCol"},
 	}
 
-	assertAggregatorForTimelineQuery(t, pb.TimeGran_MIN_5, setup, [][][]interface{}{
-		{{1}, {0, 1, 1, 1}},
+	assertAggregatorForTimelineQuery(t, pb.AggOp_COUNT, pb.TimeGran_MIN_5, setup, [][][]interface{}{
+		{{1}, {0, 1, 1, 2}},
+		{{2}, {0, 1}},
+	})
+
+	assertAggregatorForTimelineQuery(t, pb.AggOp_COUNT, pb.TimeGran_MIN_15, setup, [][][]interface{}{
+		{{1}, {0, 3}},
+		{{2}, {0, 1}},
+	})
+
+	assertAggregatorForTimelineQuery(t, pb.AggOp_SUM, pb.TimeGran_MIN_5, setup, [][][]interface{}{
+		{{1}, {0, 10, 1, 50}},
+		{{2}, {0, 40}},
 	})
 
-	assertAggregatorForTimelineQuery(t, pb.TimeGran_MIN_15, setup, [][][]interface{}{
-		{{1}, {0, 2}},
+	assertAggregatorForTimelineQuery(t, pb.AggOp_AVG, pb.TimeGran_MIN_5, setup, [][][]interface{}{
+		{{1}, {0, 10.0, 1, 25.0}},
+		{{2}, {0, 40.0}},
 	})
 }
 
@@ -76,39 +132,38 @@ type debugAggregatorSetup struct {
 
 /**
  * Helper for asserting that the timelineQuery aggregation result matches the expected.
- * StartTs is 0.
+ * The op aggregates the first aggIntCol, and the ts col is after the aggIntCols. StartTs is 0.
  * The `expected` is in the format of:
  *	 [
- *	 	([...groupbyIntCols, ...groupbyStrCols], [tsBuckets[0], counts[0], tsBuckets[1], counts[1], ...]),
+ *	 	([...groupbyIntCols, ...groupbyStrCols], [tsBuckets[0], values[0], tsBuckets[1], values[1], ...]),
  *	 	...
  *	 ]
  */
 func assertAggregatorForTimelineQuery(
 	t *testing.T,
+	op pb.AggOp,
 	gran pb.TimeGran,
 	s debugAggregatorSetup,
 	expected [][][]interface{}) {
 	blockRes, strStore := debugNewBlockQueryResult(s.rows)
 
-	aggIntCols := []string{TS_COLUMN_NAME}
-	intColCnt := len(s.groupbyIntCols) + len(aggIntCols)
-
 	aggregator := newAggregator(&aggCtx{
 		logger:           common.NewTestBapiCtx().Logger,
-		op:               pb.AggOp_TIMELINE_COUNT,
 		groupbyIntColCnt: len(s.groupbyIntCols),
-		intColCnt:        intColCnt,
+		intColCnt:        len(s.groupbyIntCols) + len(s.aggIntCols),
 		groupbyStrColCnt: len(s.groupbyStrCols),
 		strColCnt:        len(s.groupbyStrCols),
+		aggSpecs: []aggSpec{{
+			op:     op,
+			params: accParams{bucketer: newFixedTsBucketer(0, int64(gran))},
+			alias:  s.aggIntCols[0],
+		}},
 
 		groupbyIntColumnNames: s.groupbyIntCols,
 		groupbyStrColumnNames: s.groupbyStrCols,
-		aggIntColumnNames:     aggIntCols,
 		strStore:              strStore,
 
-		isTimelineQuery: true,
-		startTs:         0,
-		gran:            uint64(gran),
+		aggByTs: true,
 	})
 
 	res, _ := aggregator.aggregateForTimeline([]*BlockQueryResult{blockRes})
@@ -144,10 +199,13 @@ func assertAggregatorForTimelineQuery(
 			}
 		}
 
-		for _, timelineGroup := range res.TimelineGroups {
-			for tsBucketIdx := 0; tsBucketIdx < len(timelineGroup.TsBuckets); tsBucketIdx++ {
-				actual[i][1] = append(actual[i][1], int(timelineGroup.TsBuckets[tsBucketIdx]))
-				actual[i][1] = append(actual[i][1], int(timelineGroup.Counts[tsBucketIdx]))
+		timelineGroup := res.TimelineGroups[i]
+		for tsBucketIdx := 0; tsBucketIdx < len(timelineGroup.TsBuckets); tsBucketIdx++ {
+			actual[i][1] = append(actual[i][1], int(timelineGroup.TsBuckets[tsBucketIdx]))
+			if res.AggIsFloat {
+				actual[i][1] = append(actual[i][1], timelineGroup.FloatValues[tsBucketIdx])
+			} else {
+				actual[i][1] = append(actual[i][1], int(timelineGroup.IntValues[tsBucketIdx]))
 			}
 		}
 	}
@@ -170,17 +228,20 @@ func assertAggregatorForTableQuery(
 	s debugAggregatorSetup,
 	expected [][][]interface{}) {
 	blockRes, strStore := debugNewBlockQueryResult(s.rows)
+	aggSpecs := make([]aggSpec, len(s.aggIntCols))
+	for colIdx, colName := range s.aggIntCols {
+		aggSpecs[colIdx] = aggSpec{op: op, colIdx: colIdx, alias: colName}
+	}
 	aggregator := newAggregator(&aggCtx{
 		logger:           common.NewTestBapiCtx().Logger,
-		op:               op,
 		groupbyIntColCnt: len(s.groupbyIntCols),
 		intColCnt:        len(s.groupbyIntCols) + len(s.aggIntCols),
 		groupbyStrColCnt: len(s.groupbyStrCols),
 		strColCnt:        len(s.groupbyStrCols),
+		aggSpecs:         aggSpecs,
 
 		groupbyIntColumnNames: s.groupbyIntCols,
 		groupbyStrColumnNames: s.groupbyStrCols,
-		aggIntColumnNames:     s.aggIntCols,
 		strStore:              strStore,
 	})
 
@@ -244,3 +305,50 @@ func assertAggregatorForTableQuery(
 
 	assert.ElementsMatch(t, expected, actual)
 }
+
+func TestOrderAndLimit(t *testing.T) {
+	buckets := make([]*aggBucket, 0)
+	for i := 0; i < 100; i++ {
+		// the values repeat, so the ties are ordered by the hashes
+		buckets = append(buckets, &aggBucket{
+			hash:      uint64(i),
+			intVals:   []int64{int64((i * 37) % 20)},
+			intHasVal: []bool{i%10 != 0},
+		})
+	}
+
+	sorted := func(desc bool) []*aggBucket {
+		aggregator := newAggregator(&aggCtx{
+			groupbyIntColCnt: 1,
+			orderBy:          []orderByCol{{kind: orderByGroupbyInt, colIdx: 0, desc: desc}},
+		})
+		kept, dropped := aggregator.orderAndLimit(append([]*aggBucket{}, buckets...), aggResult[int64]{}, aggResult[float64]{})
+		assert.Empty(t, dropped)
+		return kept
+	}
+
+	for _, desc := range []bool{false, true} {
+		// the buckets without value are the last ones
+		all := sorted(desc)
+		assert.True(t, all[89].intHasVal[0])
+		assert.False(t, all[90].intHasVal[0])
+		for i := 1; i < 90; i++ {
+			if desc {
+				assert.GreaterOrEqual(t, all[i-1].intVals[0], all[i].intVals[0])
+			} else {
+				assert.LessOrEqual(t, all[i-1].intVals[0], all[i].intVals[0])
+			}
+		}
+
+		for _, limit := range []int{1, 7, 99} {
+			aggregator := newAggregator(&aggCtx{
+				groupbyIntColCnt: 1,
+				orderBy:          []orderByCol{{kind: orderByGroupbyInt, colIdx: 0, desc: desc}},
+				limit:            limit,
+			})
+			kept, dropped := aggregator.orderAndLimit(append([]*aggBucket{}, buckets...), aggResult[int64]{}, aggResult[float64]{})
+			assert.Equal(t, all[:limit], kept)
+			assert.ElementsMatch(t, all[limit:], dropped)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package store
 
 import (
 	"bapi/internal/common"
+	"bapi/internal/pb"
+	"unsafe"
 
 	"github.com/kelindar/bitmap"
 )
@@ -18,11 +20,19 @@ type Block struct {
 }
 
 func (b *Block) query(ctx *common.BapiCtx, query *blockQuery) (*BlockQueryResult, bool) {
-	return b.storage.query(ctx, query)
+	result, ok := b.storage.query(ctx, query)
+	if !ok || query.projection == nil {
+		return result, ok
+	}
+	return query.projection.apply(result)
 }
 
 type blockStorage interface {
 	query(*common.BapiCtx, *blockQuery) (*BlockQueryResult, bool)
+	// the estimated number of bytes used by the storage
+	size() int
+	// the strIds used by the rows in the storage
+	getStrIdSet() map[strId]bool
 }
 
 // --------------------------- basicBlockStorage ----------------------------
@@ -31,8 +41,11 @@ type basicBlockStorage struct {
 	maxTs    int64
 	rowCount int
 
-	intColsStorage *intColumnsStorage
-	strColsStorage *strColumnsStorage
+	intColsStorage    *intColumnsStorage
+	strColsStorage    *strColumnsStorage
+	floatColsStorage  *floatColumnsStorage
+	boolColsStorage   *boolColumnsStorage
+	strSetColsStorage *strSetColumnsStorage
 }
 
 func newBasicBlockStorage(pb *partialBlock) (*basicBlockStorage, error) {
@@ -46,13 +59,31 @@ func newBasicBlockStorage(pb *partialBlock) (*basicBlockStorage, error) {
 		return nil, err
 	}
 
+	floatColStorage, err := newFloatColumnsStorage(pb.floatPartialColumns, pb.rowCount)
+	if err != nil {
+		return nil, err
+	}
+
+	boolColStorage, err := newBoolColumnsStorage(pb.boolPartialColumns, pb.rowCount)
+	if err != nil {
+		return nil, err
+	}
+
+	strSetColStorage, err := newStrSetColumnsStorage(pb.strSetPartialColumns, pb.rowCount, pb.strSets)
+	if err != nil {
+		return nil, err
+	}
+
 	return &basicBlockStorage{
 		minTs:    pb.minTs,
 		maxTs:    pb.maxTs,
 		rowCount: pb.rowCount,
 
-		intColsStorage: intColStorage,
-		strColsStorage: strColStorage,
+		intColsStorage:    intColStorage,
+		strColsStorage:    strColStorage,
+		floatColsStorage:  floatColStorage,
+		boolColsStorage:   boolColStorage,
+		strSetColsStorage: strSetColStorage,
 	}, nil
 }
 
@@ -66,6 +97,17 @@ func (bbs *basicBlockStorage) query(ctx *common.BapiCtx, query *blockQuery) (*Bl
 	return bbs.buildResult(ctx, query, bitmap)
 }
 
+func (bbs *basicBlockStorage) size() int {
+	var sid strId
+	return bbs.intColsStorage.size() + bbs.strColsStorage.size() + bbs.floatColsStorage.size() +
+		bbs.boolColsStorage.size() + bbs.strSetColsStorage.size() +
+		len(bbs.strColsStorage.strIdSet)*int(unsafe.Sizeof(sid))
+}
+
+func (bbs *basicBlockStorage) getStrIdSet() map[strId]bool {
+	return bbs.strColsStorage.strIdSet
+}
+
 // --------------------------- build result ----------------------------
 func (bbs *basicBlockStorage) buildResult(ctx *common.BapiCtx, query *blockQuery, bitmap *bitmap.Bitmap) (*BlockQueryResult, bool) {
 	intResult := bbs.intColsStorage.get(&getCtx{
@@ -78,11 +120,29 @@ func (bbs *basicBlockStorage) buildResult(ctx *common.BapiCtx, query *blockQuery
 		bitmap:  bitmap,
 		columns: query.strColumns,
 	})
+	floatResult := bbs.floatColsStorage.get(&getCtx{
+		ctx:     ctx,
+		bitmap:  bitmap,
+		columns: query.floatColumns,
+	})
+	boolResult := bbs.boolColsStorage.get(&getCtx{
+		ctx:     ctx,
+		bitmap:  bitmap,
+		columns: query.boolColumns,
+	})
+	strSetResult := bbs.strSetColsStorage.get(&getCtx{
+		ctx:     ctx,
+		bitmap:  bitmap,
+		columns: query.strSetColumns,
+	})
 
 	return &BlockQueryResult{
-		Count:     bitmap.Count(),
-		IntResult: intResult,
-		StrResult: strResult,
+		Count:        bitmap.Count(),
+		IntResult:    intResult,
+		StrResult:    strResult,
+		FloatResult:  floatResult,
+		BoolResult:   boolResult,
+		StrSetResult: strSetResult,
 	}, true
 }
 
@@ -99,8 +159,10 @@ func (bbs *basicBlockStorage) filterBlock(
 	ctx.Logger.Info("filtering block")
 
 	bbs.intColsStorage.filter(filterCtx, filter.tsFilters)
-	bbs.intColsStorage.filter(filterCtx, filter.intFilters)
-	bbs.strColsStorage.filter(filterCtx, filter.strFilters)
+	bbs.filterColumns(filterCtx, &filter.columnFilters)
+	if filter.expr != nil {
+		filterCtx.bitmap.And(*bbs.filterExpr(filterCtx, filter.expr))
+	}
 
 	if _, hasRows = filterCtx.bitmap.Min(); !hasRows {
 		return nil, false
@@ -109,6 +171,46 @@ func (bbs *basicBlockStorage) filterBlock(
 	return filterCtx.bitmap, true
 }
 
+// Removes the rows not matching the filters from the bitmap of the ctx.
+func (bbs *basicBlockStorage) filterColumns(ctx *filterCtx, filters *columnFilters) {
+	bbs.intColsStorage.filter(ctx, filters.intFilters)
+	bbs.strColsStorage.filter(ctx, filters.strFilters)
+	bbs.floatColsStorage.filter(ctx, filters.floatFilters)
+	bbs.boolColsStorage.filter(ctx, filters.boolFilters)
+	bbs.strSetColsStorage.filter(ctx, filters.strSetFilters)
+}
+
+/**
+ * Returns a new bitmap of the rows in the bitmap of the ctx matching the expression.
+ * Each leaf is evaluated on its own copy of the bitmap, then the bitmaps are combined by the op
+ * of their parent, e.g. NOT is the rows of the ctx minus the ones of the child.
+ */
+func (bbs *basicBlockStorage) filterExpr(ctx *filterCtx, expr *filterExpr) *bitmap.Bitmap {
+	matched := ctx.bitmap.Clone(nil)
+
+	switch expr.op {
+	case pb.FilterExprOp_LEAF:
+		bbs.filterColumns(&filterCtx{ctx.ctx, &matched, ctx.queryMinTs, ctx.queryMaxTs}, &expr.leaf)
+	case pb.FilterExprOp_AND:
+		for _, child := range expr.children {
+			matched.And(*bbs.filterExpr(ctx, child))
+		}
+	case pb.FilterExprOp_OR:
+		matched.Clear()
+		for _, child := range expr.children {
+			matched.Or(*bbs.filterExpr(ctx, child))
+		}
+	case pb.FilterExprOp_NOT:
+		for _, child := range expr.children {
+			matched.AndNot(*bbs.filterExpr(ctx, child))
+		}
+	default:
+		ctx.ctx.Logger.DPanicf("unexpected filter expr op: %d", expr.op)
+	}
+
+	return &matched
+}
+
 func (bbs *basicBlockStorage) getBlockFilterCtx(ctx *common.BapiCtx,
 	queryMinTs int64,
 	queryMaxTs int64) (*filterCtx, bool) {
@@ -88,7 +88,7 @@ func debugNewQuery(
 		strColumns = append(strColumns, colInfo)
 	}
 
-	return &blockQuery{filter, intColumns, strColumns}
+	return &blockQuery{filter, intColumns, strColumns, make([]*ColumnInfo, 0), make([]*ColumnInfo, 0), make([]*ColumnInfo, 0), nil}
 }
 
 func debugToRawJson(table *Table, query *blockQuery, result *BlockQueryResult) []RawJson {
@@ -224,7 +224,7 @@ func debugNewBlockFilter(
 		colInfo, ok := table.colInfoMap.getColumnInfo(filter.colName)
 		assert.True(t, ok)
 
-		sid, _ := table.strStore.getStrId(filter.value)
+		sid, _ := table.strStore.getStrId(colInfo.id, filter.value)
 		strFilters = append(strFilters, columnFilter[strId]{
 			col:    colInfo,
 			op:     filter.op,
@@ -236,8 +236,14 @@ func debugNewBlockFilter(
 		minTs,
 		maxTs,
 		tsColInfo,
-		intFilters,
-		strFilters,
+		columnFilters{
+			intFilters:    intFilters,
+			strFilters:    strFilters,
+			floatFilters:  make([]columnFilter[float64], 0),
+			boolFilters:   make([]columnFilter[uint8], 0),
+			strSetFilters: make([]columnFilter[strId], 0),
+		},
+		nil, /*expr*/
 	)
 }
 
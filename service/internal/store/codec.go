@@ -0,0 +1,176 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errCorrupted = errors.New("corrupted data")
+
+/**
+ * A minimal binary encoder used for the on-disk formats (e.g. the write-ahead log).
+ * Integers are written as varints and strings are length prefixed.
+ */
+type encoder struct {
+	buf []byte
+}
+
+func newEncoder() *encoder {
+	return &encoder{buf: make([]byte, 0, 64)}
+}
+
+func (e *encoder) bytes() []byte {
+	return e.buf
+}
+
+func (e *encoder) putUvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *encoder) putVarint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *encoder) putUint8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *encoder) putUint32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) putUint64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) putFloat64(v float64) {
+	e.putUint64(math.Float64bits(v))
+}
+
+func (e *encoder) putString(s string) {
+	e.putUvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+/**
+ * The counterpart of encoder.
+ * The first error is sticky: once the input is found to be corrupted or truncated, all the
+ * following reads return zero values and `err()` returns the error.
+ */
+type decoder struct {
+	buf    []byte
+	offset int
+	e      error
+}
+
+func newDecoder(buf []byte) *decoder {
+	return &decoder{buf: buf}
+}
+
+func (d *decoder) err() error {
+	return d.e
+}
+
+func (d *decoder) remaining() int {
+	return len(d.buf) - d.offset
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.e != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf[d.offset:])
+	if n <= 0 {
+		d.e = errCorrupted
+		return 0
+	}
+	d.offset += n
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.e != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf[d.offset:])
+	if n <= 0 {
+		d.e = errCorrupted
+		return 0
+	}
+	d.offset += n
+	return v
+}
+
+func (d *decoder) uint8() uint8 {
+	b, ok := d.next(1)
+	if !ok {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) uint32() uint32 {
+	b, ok := d.next(4)
+	if !ok {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (d *decoder) uint64() uint64 {
+	b, ok := d.next(8)
+	if !ok {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (d *decoder) float64() float64 {
+	return math.Float64frombits(d.uint64())
+}
+
+func (d *decoder) string() string {
+	size := d.uvarint()
+	if d.e != nil {
+		return ""
+	}
+	if size > uint64(d.remaining()) {
+		d.e = errCorrupted
+		return ""
+	}
+	b, _ := d.next(int(size))
+	return string(b)
+}
+
+// Reads a length which is used for allocating a slice. A length larger than the remaining
+// bytes is treated as corruption to avoid allocating a huge slice for a garbage input.
+func (d *decoder) length() int {
+	size := d.uvarint()
+	if size > uint64(d.remaining()) {
+		d.e = errCorrupted
+		return 0
+	}
+	return int(size)
+}
+
+func (d *decoder) next(n int) ([]byte, bool) {
+	if d.e != nil {
+		return nil, false
+	}
+	if d.remaining() < n {
+		d.e = errCorrupted
+		return nil, false
+	}
+	b := d.buf[d.offset : d.offset+n]
+	d.offset += n
+	return b, true
+}
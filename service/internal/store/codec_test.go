@@ -0,0 +1,53 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodec(t *testing.T) {
+	e := newEncoder()
+	e.putUvarint(300)
+	e.putVarint(-12)
+	e.putUint8(7)
+	e.putUint32(0xDEADBEEF)
+	e.putUint64(1 << 40)
+	e.putFloat64(1.5)
+	e.putString("hello")
+	e.putString("")
+
+	d := newDecoder(e.bytes())
+	assert.Equal(t, uint64(300), d.uvarint())
+	assert.Equal(t, int64(-12), d.varint())
+	assert.Equal(t, uint8(7), d.uint8())
+	assert.Equal(t, uint32(0xDEADBEEF), d.uint32())
+	assert.Equal(t, uint64(1<<40), d.uint64())
+	assert.Equal(t, 1.5, d.float64())
+	assert.Equal(t, "hello", d.string())
+	assert.Equal(t, "", d.string())
+	assert.Nil(t, d.err())
+	assert.Equal(t, 0, d.remaining())
+}
+
+func TestCodecTruncated(t *testing.T) {
+	e := newEncoder()
+	e.putString("hello")
+	e.putUint64(42)
+
+	truncated := e.bytes()[:len(e.bytes())-1]
+	d := newDecoder(truncated)
+	assert.Equal(t, "hello", d.string())
+	assert.Equal(t, uint64(0), d.uint64())
+	assert.Equal(t, errCorrupted, d.err())
+	// the error is sticky
+	assert.Equal(t, "", d.string())
+	assert.Equal(t, errCorrupted, d.err())
+
+	// a length larger than the input is rejected
+	e = newEncoder()
+	e.putUvarint(1000)
+	d = newDecoder(e.bytes())
+	assert.Equal(t, 0, d.length())
+	assert.Equal(t, errCorrupted, d.err())
+}
@@ -9,6 +9,7 @@ import (
 type colInfoStore struct {
 	ctx       *common.BapiCtx
 	colMap    sync.Map // map[string]*ColumnInfo
+	colIdMap  sync.Map // map[columnId]*ColumnInfo
 	m         sync.Mutex
 	nextColId columnId
 }
@@ -17,28 +18,25 @@ func newColInfoStore(ctx *common.BapiCtx) *colInfoStore {
 	return &colInfoStore{
 		ctx:       ctx,
 		colMap:    sync.Map{},
+		colIdMap:  sync.Map{},
 		m:         sync.Mutex{},
 		nextColId: columnId(0),
 	}
 }
 
-func (s *colInfoStore) getColumns() ([]*ColumnInfo, []*ColumnInfo) {
-	intCols := make([]*ColumnInfo, 0)
-	strCols := make([]*ColumnInfo, 0)
+// Returns the columns by type.
+func (s *colInfoStore) getColumns() map[ColumnType][]*ColumnInfo {
+	columns := make(map[ColumnType][]*ColumnInfo)
 
 	s.colMap.Range(
 		func(_colName, val interface{}) bool {
 			colInfo := val.(*ColumnInfo)
-			if colInfo.ColumnType == IntColumnType {
-				intCols = append(intCols, colInfo)
-			} else if colInfo.ColumnType == StrColumnType {
-				strCols = append(strCols, colInfo)
-			}
+			columns[colInfo.ColumnType] = append(columns[colInfo.ColumnType], colInfo)
 			return true
 		},
 	)
 
-	return intCols, strCols
+	return columns
 }
 
 func (s *colInfoStore) getColumnInfo(colName string) (*ColumnInfo, bool) {
@@ -48,6 +46,13 @@ func (s *colInfoStore) getColumnInfo(colName string) (*ColumnInfo, bool) {
 	return nil, false
 }
 
+func (s *colInfoStore) getColumnInfoById(colId columnId) (*ColumnInfo, bool) {
+	if colInfo, ok := s.colIdMap.Load(colId); ok {
+		return colInfo.(*ColumnInfo), true
+	}
+	return nil, false
+}
+
 // Gets or creates a column of the given name and type
 func (s *colInfoStore) getOrRegisterColumnId(colName string, colType ColumnType) (columnId, error) {
 	if columnInfo, ok := s.getColumnInfo(colName); ok {
@@ -124,6 +129,43 @@ func (s *colInfoStore) registerNewColumn(colName string, colType ColumnType) (co
 		return colInfo.(*ColumnInfo).id, false, nil
 	}
 
+	s.colIdMap.Store(s.nextColId, colInfo)
 	s.nextColId++
 	return colInfo.(*ColumnInfo).id, true, nil
 }
+
+// Registers a column with a known id, e.g. when replaying the write-ahead log.
+// Returns an error if the name or the id is already taken by a different column.
+func (s *colInfoStore) restoreColumn(colName string, colType ColumnType, colId columnId) error {
+	if uint16(colId) >= s.ctx.GetMaxColumn() {
+		return fmt.Errorf("invalid column id for %s: %d", colName, colId)
+	}
+
+	s.m.Lock()
+	defer func() {
+		s.m.Unlock()
+	}()
+
+	if colInfo, ok := s.getColumnInfo(colName); ok {
+		if colInfo.id != colId || colInfo.ColumnType != colType {
+			return fmt.Errorf("conflicting column %s, existing id: %d, type: %d", colName, colInfo.id, colInfo.ColumnType)
+		}
+		return nil
+	}
+
+	if colInfo, ok := s.getColumnInfoById(colId); ok {
+		return fmt.Errorf("column id %d is taken by %s", colId, colInfo.Name)
+	}
+
+	colInfo := &ColumnInfo{
+		id:         colId,
+		Name:       colName,
+		ColumnType: colType,
+	}
+	s.colMap.Store(colName, colInfo)
+	s.colIdMap.Store(colId, colInfo)
+	if colId >= s.nextColId {
+		s.nextColId = colId + 1
+	}
+	return nil
+}
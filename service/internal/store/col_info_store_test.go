@@ -136,3 +136,26 @@ func TestColInfoStoreStressWrite(t *testing.T) {
 	assert.True(t, allSuccess)
 	assert.Equal(t, columnId(1), s.nextColId)
 }
+
+func TestRestoreColumn(t *testing.T) {
+	s := newColInfoStore(common.NewBapiCtx())
+	assert.Nil(t, s.restoreColumn("col1", StrColumnType, columnId(3)))
+	// restoring the same column again is fine
+	assert.Nil(t, s.restoreColumn("col1", StrColumnType, columnId(3)))
+
+	assert.NotNil(t, s.restoreColumn("col1", IntColumnType, columnId(3)))
+	assert.NotNil(t, s.restoreColumn("col1", StrColumnType, columnId(4)))
+	assert.NotNil(t, s.restoreColumn("col2", StrColumnType, columnId(3)))
+
+	colInfo, ok := s.getColumnInfoById(columnId(3))
+	assert.True(t, ok)
+	assert.Equal(t, "col1", colInfo.Name)
+
+	// new columns are registered after the restored ones
+	colId, err := s.getOrRegisterColumnId("col2", IntColumnType)
+	assert.Nil(t, err)
+	assert.Equal(t, columnId(4), colId)
+	colInfo, ok = s.getColumnInfoById(colId)
+	assert.True(t, ok)
+	assert.Equal(t, "col2", colInfo.Name)
+}
@@ -3,6 +3,8 @@ package store
 import (
 	"bapi/internal/pb"
 	"errors"
+	"sort"
+	"unsafe"
 )
 
 // --------------------------- intColumnsStorage ----------------------------
@@ -69,6 +71,10 @@ func newStrColumnsStorage(
 	rowCount int,
 	strIdSet map[strId]bool,
 ) (*strColumnsStorage, error) {
+	if len(partialColumns) == 0 {
+		return &strColumnsStorage{strIdSet: strIdSet, numericStore: *newEmptyNumericStore[strId]()}, nil
+	}
+
 	storage, err := fromPartialColumns(partialColumns, rowCount)
 	if err != nil {
 		return nil, err
@@ -103,6 +109,16 @@ func (scs *strColumnsStorage) filter(ctx *filterCtx, filters []columnFilter[strI
 			}
 		}
 
+		// a pattern op, @see columnFilter.valueSet
+		if filter.valueSet != nil {
+			if !scs.filterByStrIdSet(ctx, localColumnId, filter.valueSet) {
+				// no str of the column matches
+				ctx.bitmap.Clear()
+				return
+			}
+			continue
+		}
+
 		containsStrValues := false
 		for _, sid := range filter.values {
 			_, containsStr := scs.strIdSet[sid]
@@ -140,3 +156,279 @@ func (scs *strColumnsStorage) filter(ctx *filterCtx, filters []columnFilter[strI
 		)
 	}
 }
+
+/**
+ * Keeps the rows having any of the strs of the set in the column. Each distinct str of the column
+ * is looked up once, so the cost doesn't depend on the number of strs to match. Returns false if
+ * none of them is in the set, without filtering the rows.
+ */
+func (scs *strColumnsStorage) filterByStrIdSet(ctx *filterCtx, localColId localColumnId, strIdSet map[strId]bool) bool {
+	values := scs.values[localColId]
+	matched := make([]bool, len(values))
+	anyMatched := false
+	for valueIdx := 1; valueIdx < len(values); valueIdx++ {
+		matched[valueIdx] = strIdSet[values[valueIdx]]
+		anyMatched = anyMatched || matched[valueIdx]
+	}
+	if !anyMatched {
+		return false
+	}
+
+	for rowIdx, valueIdx := range scs.matrix[localColId] {
+		if ctx.bitmap.Contains(uint32(rowIdx)) && !matched[valueIdx] {
+			ctx.bitmap.Remove(uint32(rowIdx))
+		}
+	}
+	return true
+}
+
+// --------------------------- floatColumnsStorage ----------------------------
+type floatColumnsStorage struct {
+	numericStore[float64]
+}
+
+// Unlike the int columns, which always have ts, a block may have no float column at all.
+func newFloatColumnsStorage(
+	partialColumns partialColumns[float64],
+	rowCount int,
+) (*floatColumnsStorage, error) {
+	if len(partialColumns) == 0 {
+		return &floatColumnsStorage{numericStore: *newEmptyNumericStore[float64]()}, nil
+	}
+
+	storage, err := fromPartialColumns(partialColumns, rowCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &floatColumnsStorage{
+		numericStore: *storage,
+	}, nil
+}
+
+func (fcs *floatColumnsStorage) get(
+	ctx *getCtx,
+) FloatResult {
+	storageResult, _ := fcs.numericStore.get(ctx, false /*recordValues*/)
+	return FloatResult{matrix: storageResult.matrix, hasValue: storageResult.hasValue}
+}
+
+func (fcs *floatColumnsStorage) filter(ctx *filterCtx, filters []columnFilter[float64]) {
+	for _, filter := range filters {
+		localColumnId, ok := fcs.getLocalColumnId(filter.col)
+		if !ok {
+			if canContinueElseStopForColNotExist(ctx, filter.op) {
+				continue
+			} else {
+				return
+			}
+		}
+
+		fcs.filterNumericStore(
+			ctx,
+			numericFilter[float64]{
+				localColId: localColumnId,
+				op:         filter.op,
+				values:     filter.values,
+			},
+		)
+	}
+}
+
+// --------------------------- boolColumnsStorage ----------------------------
+// The values are stored as 0 and 1 since bool is not numeric.
+type boolColumnsStorage struct {
+	numericStore[uint8]
+}
+
+func newBoolColumnsStorage(
+	partialColumns partialColumns[uint8],
+	rowCount int,
+) (*boolColumnsStorage, error) {
+	if len(partialColumns) == 0 {
+		return &boolColumnsStorage{numericStore: *newEmptyNumericStore[uint8]()}, nil
+	}
+
+	storage, err := fromPartialColumns(partialColumns, rowCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &boolColumnsStorage{
+		numericStore: *storage,
+	}, nil
+}
+
+func (bcs *boolColumnsStorage) get(
+	ctx *getCtx,
+) BoolResult {
+	storageResult, _ := bcs.numericStore.get(ctx, false /*recordValues*/)
+
+	matrix := make([][]bool, len(storageResult.matrix))
+	for colIdx, values := range storageResult.matrix {
+		matrix[colIdx] = make([]bool, len(values))
+		for rowIdx, value := range values {
+			matrix[colIdx][rowIdx] = value != 0
+		}
+	}
+	return BoolResult{matrix: matrix, hasValue: storageResult.hasValue}
+}
+
+func (bcs *boolColumnsStorage) filter(ctx *filterCtx, filters []columnFilter[uint8]) {
+	for _, filter := range filters {
+		localColumnId, ok := bcs.getLocalColumnId(filter.col)
+		if !ok {
+			if canContinueElseStopForColNotExist(ctx, filter.op) {
+				continue
+			} else {
+				return
+			}
+		}
+
+		bcs.filterNumericStore(
+			ctx,
+			numericFilter[uint8]{
+				localColId: localColumnId,
+				op:         filter.op,
+				values:     filter.values,
+			},
+		)
+	}
+}
+
+// --------------------------- strSetColumnsStorage ----------------------------
+/**
+ * The values of the numericStore are the indexes of the sets, which are shared by the columns.
+ * The set of index i is `setStrIds[setOffsets[i]:setOffsets[i+1]]`, whose strIds are sorted.
+ */
+type strSetColumnsStorage struct {
+	numericStore[uint32]
+	setOffsets []uint32
+	setStrIds  []strId
+}
+
+func newStrSetColumnsStorage(
+	partialColumns partialColumns[uint32],
+	rowCount int,
+	sets [][]strId,
+) (*strSetColumnsStorage, error) {
+	setOffsets := make([]uint32, 0, len(sets)+1)
+	setStrIds := make([]strId, 0)
+	for _, set := range sets {
+		setOffsets = append(setOffsets, uint32(len(setStrIds)))
+		setStrIds = append(setStrIds, set...)
+	}
+	setOffsets = append(setOffsets, uint32(len(setStrIds)))
+
+	if len(partialColumns) == 0 {
+		return &strSetColumnsStorage{
+			numericStore: *newEmptyNumericStore[uint32](),
+			setOffsets:   setOffsets,
+			setStrIds:    setStrIds,
+		}, nil
+	}
+
+	storage, err := fromPartialColumns(partialColumns, rowCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &strSetColumnsStorage{
+		numericStore: *storage,
+		setOffsets:   setOffsets,
+		setStrIds:    setStrIds,
+	}, nil
+}
+
+// The result has copies of the sets, so it's still valid after the storage is unmapped.
+func (sss *strSetColumnsStorage) get(
+	ctx *getCtx,
+) StrSetResult {
+	storageResult, _ := sss.numericStore.get(ctx, false /*recordValues*/)
+
+	strIdSet := make(map[strId]bool)
+	matrix := make([][][]strId, len(storageResult.matrix))
+	for colIdx, setIdxes := range storageResult.matrix {
+		matrix[colIdx] = make([][]strId, len(setIdxes))
+		for rowIdx, setIdx := range setIdxes {
+			if !storageResult.hasValue[colIdx][rowIdx] {
+				continue
+			}
+
+			set := append([]strId{}, sss.getSet(setIdx)...)
+			for _, sid := range set {
+				strIdSet[sid] = true
+			}
+			matrix[colIdx][rowIdx] = set
+		}
+	}
+
+	return StrSetResult{
+		strIdSet: strIdSet,
+		matrix:   matrix,
+		hasValue: storageResult.hasValue,
+	}
+}
+
+func (sss *strSetColumnsStorage) filter(ctx *filterCtx, filters []columnFilter[strId]) {
+	for _, filter := range filters {
+		localColumnId, ok := sss.getLocalColumnId(filter.col)
+		if !ok {
+			if canContinueElseStopForColNotExist(ctx, filter.op) {
+				continue
+			} else {
+				return
+			}
+		}
+
+		rows := sss.matrix[localColumnId]
+		switch filter.op {
+		case pb.FilterOp_NULL, pb.FilterOp_NONNULL:
+			filterByNullable(ctx, &numericFilter[uint32]{localColId: localColumnId, op: filter.op}, rows)
+			continue
+		case pb.FilterOp_CONTAINS, pb.FilterOp_CONTAINS_ANY:
+			{
+				// handled below
+			}
+		default:
+			ctx.ctx.Logger.DPanicf("unexpected str set filter op: %d", filter.op)
+			continue
+		}
+
+		// a set is shared by many rows, so it's only matched once
+		values := sss.values[localColumnId]
+		matched := make([]bool, len(values))
+		for valueIdx := 1; valueIdx < len(values); valueIdx++ {
+			matched[valueIdx] = matchStrSet(sss.getSet(values[valueIdx]), filter.op, filter.values)
+		}
+
+		for rowIdx, valueIdx := range rows {
+			if ctx.bitmap.Contains(uint32(rowIdx)) && !matched[valueIdx] {
+				ctx.bitmap.Remove(uint32(rowIdx))
+			}
+		}
+	}
+}
+
+func (sss *strSetColumnsStorage) size() int {
+	var sid strId
+	return sss.numericStore.size() +
+		len(sss.setOffsets)*int(unsafe.Sizeof(uint32(0))) + len(sss.setStrIds)*int(unsafe.Sizeof(sid))
+}
+
+func (sss *strSetColumnsStorage) getSet(setIdx uint32) []strId {
+	return sss.setStrIds[sss.setOffsets[setIdx]:sss.setOffsets[setIdx+1]]
+}
+
+// CONTAINS matches a set having all the values, CONTAINS_ANY matches one having any of them.
+func matchStrSet(set []strId, op pb.FilterOp, values []strId) bool {
+	contains := func(value strId) bool {
+		idx := sort.Search(len(set), func(i int) bool { return set[i] >= value })
+		return idx < len(set) && set[idx] == value
+	}
+
+	if op == pb.FilterOp_CONTAINS {
+		return every(values, contains)
+	}
+	return some(values, contains)
+}
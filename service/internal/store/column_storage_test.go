@@ -473,7 +473,7 @@ func assertStrFilterHasResult(
 
 	filters := make([]columnFilter[strId], 0)
 	for _, df := range s.filters {
-		sid, _ := tableStrStore.getStrId(df.value)
+		sid, _ := tableStrStore.getStrId(df.colId, df.value)
 		filter := columnFilter[strId]{
 			col: &ColumnInfo{
 				Name:       strconv.Itoa(int(df.colId)),
@@ -560,7 +560,7 @@ type testReadOnlyStrStore struct {
 	strValueMap map[string]strId
 }
 
-func (s *testReadOnlyStrStore) getStrId(str string) (strId, bool) {
+func (s *testReadOnlyStrStore) getStrId(colId columnId, str string) (strId, bool) {
 	if id, loaded := s.strValueMap[str]; loaded {
 		return id, true
 	}
@@ -577,3 +577,13 @@ func (s *testReadOnlyStrStore) getStr(id strId) (string, bool) {
 func (s *testReadOnlyStrStore) search(colId columnId, searchStr string) ([]string, bool) {
 	return nil, false
 }
+
+func (s *testReadOnlyStrStore) matchStrIds(colId columnId, match func(str string) bool) []strId {
+	matched := make([]strId, 0)
+	for str, id := range s.strValueMap {
+		if match(str) {
+			matched = append(matched, id)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,253 @@
+package store
+
+import (
+	"errors"
+	"sort"
+)
+
+/**
+ * Merges runs of adjacent small blocks into blocks of up to GetMaxRowsPerBlock rows.
+ *
+ * With low-rate ingestion, every flush of the partialBlocks creates a tiny block, and all of
+ * them are scanned separately by the queries. A block is small if it has less than half of
+ * GetMaxRowsPerBlock rows. Only in memory blocks are merged; mapped blocks are left as is.
+ *
+ * The merged blocks are built without holding blocksLock, then swapped in atomically, so the
+ * queries are not blocked by the compaction. A run is skipped if any of its blocks was removed
+ * (e.g. by retention) in the meantime.
+ * Called periodically by the table. Returns the number of blocks merged and created.
+ */
+func (t *Table) Compact() (int, int) {
+	t.blocksLock.RLock()
+	runs := t.getCompactionRuns(t.blocks)
+	t.blocksLock.RUnlock()
+
+	if len(runs) == 0 {
+		return 0, 0
+	}
+
+	mergedBlocks := make(map[*Block]*Block)
+	for _, run := range runs {
+		merged, err := mergeBlocks(run)
+		if err != nil {
+			t.ctx.Logger.Errorf("failed to merge blocks: %v", err)
+			continue
+		}
+
+		for _, block := range run {
+			mergedBlocks[block] = merged
+		}
+	}
+
+	t.blocksLock.Lock()
+	defer func() {
+		t.blocksLock.Unlock()
+	}()
+
+	present := make(map[*Block]bool, len(t.blocks))
+	for _, block := range t.blocks {
+		present[block] = true
+	}
+
+	removed := make(map[*Block]bool)
+	blocks := make([]*Block, 0, len(t.blocks))
+	mergedCount := 0
+	createdCount := 0
+	for _, run := range runs {
+		if !every(run, func(block *Block) bool { return present[block] }) {
+			continue
+		}
+		merged, ok := mergedBlocks[run[0]]
+		if !ok {
+			continue
+		}
+
+		for _, block := range run {
+			removed[block] = true
+		}
+		blocks = append(blocks, merged)
+		mergedCount += len(run)
+		createdCount++
+	}
+	for _, block := range t.blocks {
+		if !removed[block] {
+			blocks = append(blocks, block)
+		}
+	}
+
+	sortBlocks(blocks)
+	t.blocks = blocks
+	if mergedCount != 0 {
+		t.ctx.Logger.Infof("compacted %d blocks into %d blocks in table %s", mergedCount, createdCount, t.tableInfo.name)
+	}
+	return mergedCount, createdCount
+}
+
+// --------------------------- internal ----------------------------
+// Groups the adjacent small blocks into runs of at least 2 blocks to be merged.
+func (t *Table) getCompactionRuns(blocks []*Block) [][]*Block {
+	maxRows := t.ctx.GetMaxRowsPerBlock()
+	isSmall := func(block *Block) bool {
+		_, inMemory := block.storage.(*basicBlockStorage)
+		return inMemory && block.rowCount < maxRows/2
+	}
+
+	runs := make([][]*Block, 0)
+	run := make([]*Block, 0)
+	runRows := 0
+	endRun := func() {
+		if len(run) > 1 {
+			runs = append(runs, run)
+		}
+		run = make([]*Block, 0)
+		runRows = 0
+	}
+
+	for _, block := range blocks {
+		if !isSmall(block) {
+			endRun()
+			continue
+		}
+		if runRows+block.rowCount > maxRows {
+			endRun()
+		}
+
+		run = append(run, block)
+		runRows += block.rowCount
+	}
+	endRun()
+
+	return runs
+}
+
+// Merges the in memory blocks into one, whose rows are sorted by ts.
+func mergeBlocks(blocks []*Block) (*Block, error) {
+	storages := make([]*basicBlockStorage, len(blocks))
+	for idx, block := range blocks {
+		storage, ok := block.storage.(*basicBlockStorage)
+		if !ok {
+			return nil, errors.New("only in memory blocks can be merged")
+		}
+		storages[idx] = storage
+	}
+
+	rows := make([]mergedRow, 0)
+	rowTs := make([]int64, 0)
+	intStores := make([]*numericStore[int64], len(storages))
+	strStores := make([]*numericStore[strId], len(storages))
+	floatStores := make([]*numericStore[float64], len(storages))
+	boolStores := make([]*numericStore[uint8], len(storages))
+	strSetStorages := make([]*strSetColumnsStorage, len(storages))
+	strIdSet := make(map[strId]bool)
+	merged := &basicBlockStorage{
+		minTs: storages[0].minTs,
+		maxTs: storages[0].maxTs,
+	}
+	for storeIdx, storage := range storages {
+		intStores[storeIdx] = &storage.intColsStorage.numericStore
+		strStores[storeIdx] = &storage.strColsStorage.numericStore
+		floatStores[storeIdx] = &storage.floatColsStorage.numericStore
+		boolStores[storeIdx] = &storage.boolColsStorage.numericStore
+		strSetStorages[storeIdx] = storage.strSetColsStorage
+		for sid := range storage.strColsStorage.strIdSet {
+			strIdSet[sid] = true
+		}
+
+		merged.minTs = min(merged.minTs, storage.minTs)
+		merged.maxTs = max(merged.maxTs, storage.maxTs)
+		merged.rowCount += storage.rowCount
+
+		// ts is always at the first local column
+		tsValues := storage.intColsStorage.values[0]
+		for rowIdx, valueIdx := range storage.intColsStorage.matrix[0] {
+			rows = append(rows, mergedRow{storeIdx: storeIdx, rowIdx: rowIdx})
+			rowTs = append(rowTs, tsValues[valueIdx])
+		}
+	}
+
+	order := make([]int, len(rows))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return rowTs[order[i]] < rowTs[order[j]]
+	})
+	sortedRows := make([]mergedRow, len(rows))
+	for idx, rowIdx := range order {
+		sortedRows[idx] = rows[rowIdx]
+	}
+
+	intStore, err := mergeNumericStores(intStores, sortedRows)
+	if err != nil {
+		return nil, err
+	}
+	strStore, err := mergeNumericStores(strStores, sortedRows)
+	if err != nil {
+		return nil, err
+	}
+	floatStore, err := mergeNumericStores(floatStores, sortedRows)
+	if err != nil {
+		return nil, err
+	}
+	boolStore, err := mergeNumericStores(boolStores, sortedRows)
+	if err != nil {
+		return nil, err
+	}
+	strSetStorage, err := mergeStrSetColumnsStorages(strSetStorages, sortedRows)
+	if err != nil {
+		return nil, err
+	}
+	merged.intColsStorage = &intColumnsStorage{numericStore: *intStore}
+	merged.strColsStorage = &strColumnsStorage{numericStore: *strStore, strIdSet: strIdSet}
+	merged.floatColsStorage = &floatColumnsStorage{numericStore: *floatStore}
+	merged.boolColsStorage = &boolColumnsStorage{numericStore: *boolStore}
+	merged.strSetColsStorage = strSetStorage
+
+	return &Block{
+		minTs:    merged.minTs,
+		maxTs:    merged.maxTs,
+		rowCount: merged.rowCount,
+		storage:  merged,
+	}, nil
+}
+
+// Concatenates the set tables of the storages, with the set indexes shifted accordingly.
+func mergeStrSetColumnsStorages(storages []*strSetColumnsStorage, rows []mergedRow) (*strSetColumnsStorage, error) {
+	setOffsets := []uint32{0}
+	setStrIds := make([]strId, 0)
+	stores := make([]*numericStore[uint32], len(storages))
+	for storeIdx, storage := range storages {
+		setBase := uint32(len(setOffsets) - 1)
+		strIdBase := uint32(len(setStrIds))
+		for _, offset := range storage.setOffsets[1:] {
+			setOffsets = append(setOffsets, strIdBase+offset)
+		}
+		setStrIds = append(setStrIds, storage.setStrIds...)
+
+		// the matrix is shared, only the values are shifted
+		shifted := &numericStore[uint32]{
+			matrix:    storage.matrix,
+			values:    make([][]uint32, len(storage.values)),
+			columnIds: storage.columnIds,
+		}
+		for localColId, values := range storage.values {
+			shifted.values[localColId] = make([]uint32, len(values))
+			for valueIdx, setIdx := range values {
+				if valueIdx != int(nullValueIndex) {
+					shifted.values[localColId][valueIdx] = setBase + setIdx
+				}
+			}
+		}
+		stores[storeIdx] = shifted
+	}
+
+	store, err := mergeNumericStores(stores, rows)
+	if err != nil {
+		return nil, err
+	}
+	return &strSetColumnsStorage{
+		numericStore: *store,
+		setOffsets:   setOffsets,
+		setStrIds:    setStrIds,
+	}, nil
+}
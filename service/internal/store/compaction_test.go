@@ -0,0 +1,214 @@
+package store
+
+import (
+	"bapi/internal/common"
+	"bapi/internal/pb"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompact(t *testing.T) {
+	blockRows := [][]RawJson{
+		{
+			{
+				Int: map[string]int64{"ts": 1643175609, "count": 1},
+				Str: map[string]string{"event": "publish"},
+			},
+			{
+				Int: map[string]int64{"ts": 1643175607},
+				Str: map[string]string{"event": "init_app"},
+			},
+		},
+		{
+			{
+				Int:   map[string]int64{"ts": 1643175608, "count": 1},
+				Str:   map[string]string{"event": "init_app", "source": "modal"},
+				Float: map[string]float64{"latency": 0.5},
+			},
+		},
+		{
+			{
+				Int: map[string]int64{"ts": 1643175612},
+				Str: map[string]string{"event": "publish", "source": "toolbar"},
+			},
+		},
+	}
+	table := NewTable(common.NewBapiCtx(), "asd")
+	uncompacted := NewTable(common.NewBapiCtx(), "asd")
+	for _, rows := range blockRows {
+		debugIngestRows(table, rows)
+		debugIngestRows(uncompacted, rows)
+	}
+
+	merged, created := table.Compact()
+	assert.Equal(t, 3, merged)
+	assert.Equal(t, 1, created)
+	assert.Equal(t, 1, len(table.blocks))
+
+	block := table.blocks[0]
+	storage := block.storage.(*basicBlockStorage)
+	assert.Equal(t, int64(1643175607), block.minTs)
+	assert.Equal(t, int64(1643175612), block.maxTs)
+	assert.Equal(t, 4, block.rowCount)
+	assert.Nil(t, storage.intColsStorage.debugInvariantCheck())
+	assert.Nil(t, storage.strColsStorage.debugInvariantCheck())
+	assert.Nil(t, storage.floatColsStorage.debugInvariantCheck())
+	assert.Equal(t, 4, len(storage.strColsStorage.strIdSet))
+
+	// rows are sorted by ts, the results are column by column
+	result, ok := table.RowsQuery(&pb.RowsQuery{
+		MinTs:          1643175607,
+		TsAscending:    true,
+		IntColumnNames: []string{"ts", "count"},
+		StrColumnNames: []string{"event", "source"},
+
+		FloatColumnNames: []string{"latency"},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, []float64{0, 0.5, 0, 0}, result.FloatResult)
+	assert.Equal(t, []bool{false, true, false, false}, result.FloatHasValue)
+	assert.Equal(t, []int64{1643175607, 1643175608, 1643175609, 1643175612, 0, 1, 1, 0}, result.IntResult)
+	assert.Equal(t, []bool{true, true, true, true, false, true, true, false}, result.IntHasValue)
+	strs := make([]string, len(result.StrResult))
+	for i, sid := range result.StrResult {
+		if result.StrHasValue[i] {
+			strs[i] = result.StrIdMap[sid]
+		}
+	}
+	assert.Equal(t, []string{"init_app", "init_app", "publish", "publish", "", "modal", "", "toolbar"}, strs)
+
+	// the same rows are returned by the aggregations
+	tableQuery := &pb.TableQuery{
+		MinTs:                 1643175607,
+		GroupbyStrColumnNames: []string{"event"},
+		AggOp:                 pb.AggOp_COUNT_DISTINCT,
+		AggIntColumnNames:     []string{"count"},
+	}
+	expected, _ := uncompacted.TableQuery(tableQuery)
+	actual, _ := table.TableQuery(tableQuery)
+	assert.Equal(t, debugTableQueryResultByGroup(expected), debugTableQueryResultByGroup(actual))
+
+	// nothing left to compact
+	merged, created = table.Compact()
+	assert.Equal(t, 0, merged)
+	assert.Equal(t, 0, created)
+}
+
+func TestCompactBoolAndStrSets(t *testing.T) {
+	blockRows := [][]RawJson{
+		{
+			{
+				Int:    map[string]int64{"ts": 1643175609},
+				Bool:   map[string]bool{"logged_in": true},
+				StrSet: map[string][]string{"tags": {"a", "b"}},
+			},
+		},
+		{
+			{
+				Int: map[string]int64{"ts": 1643175607},
+				Str: map[string]string{"event": "init_app"},
+			},
+		},
+		{
+			{
+				Int:    map[string]int64{"ts": 1643175608},
+				Bool:   map[string]bool{"logged_in": false},
+				StrSet: map[string][]string{"tags": {"c"}},
+			},
+			{
+				Int:    map[string]int64{"ts": 1643175610},
+				StrSet: map[string][]string{"tags": {"b", "a"}},
+			},
+		},
+	}
+	table := NewTable(common.NewBapiCtx(), "asd")
+	for _, rows := range blockRows {
+		debugIngestRows(table, rows)
+	}
+
+	merged, _ := table.Compact()
+	assert.Equal(t, 3, merged)
+	storage := table.blocks[0].storage.(*basicBlockStorage)
+	assert.Nil(t, storage.boolColsStorage.debugInvariantCheck())
+	assert.Nil(t, storage.strSetColsStorage.debugInvariantCheck())
+
+	actual, ok := table.RowsQuery(&pb.RowsQuery{
+		MinTs:             1643175607,
+		TsAscending:       true,
+		IntColumnNames:    []string{"ts"},
+		BoolColumnNames:   []string{"logged_in"},
+		StrSetColumnNames: []string{"tags"},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, []int64{1643175607, 1643175608, 1643175609, 1643175610}, actual.IntResult)
+	assert.Equal(t, []bool{false, false, true, false}, actual.BoolResult)
+	assert.Equal(t, []bool{false, true, true, false}, actual.BoolHasValue)
+	assert.Equal(t, []bool{false, true, true, true}, actual.StrSetHasValue)
+	// the same set of different blocks
+	assert.Equal(t, 2, len(actual.StrSetResult[2].StrIds))
+	assert.Equal(t, actual.StrSetResult[2].StrIds, actual.StrSetResult[3].StrIds)
+	assert.Equal(t, "c", actual.StrIdMap[actual.StrSetResult[1].StrIds[0]])
+}
+
+func TestGetCompactionRuns(t *testing.T) {
+	table := NewTable(common.NewBapiCtx(), "asd")
+	maxRows := table.ctx.GetMaxRowsPerBlock()
+	inMemory := func(rowCount int) *Block {
+		return &Block{rowCount: rowCount, storage: &basicBlockStorage{}}
+	}
+	mapped := &Block{rowCount: 1, storage: &mmapBlockStorage{}}
+
+	blocks := []*Block{
+		inMemory(1), inMemory(2), // merged
+		inMemory(maxRows / 2), // not small
+		inMemory(3),           // single small block
+		mapped,
+		inMemory(maxRows/2 - 1), inMemory(maxRows/2 - 1), inMemory(maxRows/2 - 1), // exceeds maxRows
+	}
+	runs := table.getCompactionRuns(blocks)
+	assert.Equal(t, [][]*Block{
+		{blocks[0], blocks[1]},
+		{blocks[5], blocks[6]},
+	}, runs)
+}
+
+func TestCompactSkipsRemovedBlocks(t *testing.T) {
+	table := NewTable(common.NewBapiCtx(), "asd")
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app"},
+		},
+	})
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175608},
+			Str: map[string]string{"event": "publish"},
+		},
+	})
+
+	// cold blocks are mapped after a snapshot and are not merged
+	assert.Nil(t, table.Snapshot(filepath.Join(t.TempDir(), "snapshot")))
+	merged, _ := table.Compact()
+	assert.Equal(t, 0, merged)
+	assert.Equal(t, 2, len(table.blocks))
+}
+
+// --------------------------- test util ----------------------------
+// Maps the str groups to the int aggregation results, since the order of the groups is not stable.
+func debugTableQueryResultByGroup(result *pb.TableQueryResult) map[string][]int64 {
+	groups := make(map[string][]int64)
+	groupCount := int(result.Count)
+	for groupIdx := 0; groupIdx < groupCount; groupIdx++ {
+		group := ""
+		for colIdx := range result.StrColumnNames {
+			group += result.StrIdMap[result.StrResult[colIdx*groupCount+groupIdx]] + ","
+		}
+		for colIdx := range result.AggIntColumnNames {
+			groups[group] = append(groups[group], result.AggIntResult[colIdx*groupCount+groupIdx])
+		}
+	}
+	return groups
+}
@@ -0,0 +1,248 @@
+package store
+
+import (
+	"bapi/internal/pb"
+	"strings"
+)
+
+/**
+ * An expression over the columns of the rows of a block result, @see pb.Expr.
+ * Its colType is the type of its values, i.e. IntColumnType, FloatColumnType or StrColumnType,
+ * which is checked against the ones of its args when it's built.
+ */
+type expr struct {
+	op      pb.ExprOp
+	colType ColumnType
+	// for COLUMN: the column and its index in the results of its type, @see computedProjection
+	col    *ColumnInfo
+	srcIdx int
+	// for the literals
+	intVal   int64
+	floatVal float64
+	strVal   string
+	args     []*expr
+}
+
+// The values of an expr of the rows of a block result, in ints, floats or strs by its colType.
+type exprValues struct {
+	ints     []int64
+	floats   []float64
+	strs     []string
+	hasValue []bool
+}
+
+func (t *Table) newExpr(pbExpr *pb.Expr) (*expr, bool) {
+	if pbExpr == nil {
+		t.ctx.Logger.Warn("fail to build expr. missing expr")
+		return nil, false
+	}
+
+	e := &expr{op: pbExpr.Op, args: make([]*expr, 0, len(pbExpr.Args))}
+	for _, pbArg := range pbExpr.Args {
+		arg, ok := t.newExpr(pbArg)
+		if !ok {
+			return nil, false
+		}
+		e.args = append(e.args, arg)
+	}
+
+	isNumeric := func(arg *expr) bool {
+		return arg.colType == IntColumnType || arg.colType == FloatColumnType
+	}
+	hasArgs := func(cnt int, valid func(*expr) bool) bool {
+		if len(e.args) != cnt || !every(e.args, valid) {
+			t.ctx.Logger.Warnf("fail to build expr. invalid args of %s", pbExpr.Op)
+			return false
+		}
+		return true
+	}
+
+	switch pbExpr.Op {
+	case pb.ExprOp_COLUMN:
+		colInfo, ok := t.colInfoMap.getColumnInfo(pbExpr.ColumnName)
+		if !ok {
+			t.ctx.Logger.Warnf("fail to build expr. column not found: %s", pbExpr.ColumnName)
+			return nil, false
+		}
+		switch colInfo.ColumnType {
+		case IntColumnType, FloatColumnType, StrColumnType:
+		default:
+			t.ctx.Logger.Warnf("fail to build expr. not an int, float or str column: %s", pbExpr.ColumnName)
+			return nil, false
+		}
+		e.col = colInfo
+		e.colType = colInfo.ColumnType
+	case pb.ExprOp_INT_LITERAL:
+		e.colType = IntColumnType
+		e.intVal = pbExpr.IntVal
+	case pb.ExprOp_FLOAT_LITERAL:
+		e.colType = FloatColumnType
+		e.floatVal = pbExpr.FloatVal
+	case pb.ExprOp_STR_LITERAL:
+		e.colType = StrColumnType
+		e.strVal = pbExpr.StrVal
+	case pb.ExprOp_ADD, pb.ExprOp_SUB, pb.ExprOp_MUL:
+		if !hasArgs(2, isNumeric) {
+			return nil, false
+		}
+		e.colType = IntColumnType
+		if some(e.args, func(arg *expr) bool { return arg.colType == FloatColumnType }) {
+			e.colType = FloatColumnType
+		}
+	case pb.ExprOp_DIV:
+		if !hasArgs(2, isNumeric) {
+			return nil, false
+		}
+		e.colType = FloatColumnType
+	case pb.ExprOp_MOD:
+		if !hasArgs(2, func(arg *expr) bool { return arg.colType == IntColumnType }) {
+			return nil, false
+		}
+		e.colType = IntColumnType
+	case pb.ExprOp_ABS:
+		if !hasArgs(1, isNumeric) {
+			return nil, false
+		}
+		e.colType = e.args[0].colType
+	case pb.ExprOp_LOWER, pb.ExprOp_UPPER:
+		if !hasArgs(1, func(arg *expr) bool { return arg.colType == StrColumnType }) {
+			return nil, false
+		}
+		e.colType = StrColumnType
+	case pb.ExprOp_SUBSTR:
+		if len(e.args) != 2 && len(e.args) != 3 {
+			t.ctx.Logger.Warn("fail to build expr. SUBSTR must have 2 or 3 args")
+			return nil, false
+		}
+		if e.args[0].colType != StrColumnType ||
+			!every(e.args[1:], func(arg *expr) bool { return arg.colType == IntColumnType }) {
+			t.ctx.Logger.Warn("fail to build expr. invalid args of SUBSTR")
+			return nil, false
+		}
+		e.colType = StrColumnType
+	default:
+		t.ctx.Logger.Warnf("fail to build expr. unexpected expr op: %d", pbExpr.Op)
+		return nil, false
+	}
+	return e, true
+}
+
+// Calls f on each COLUMN of the expr.
+func (e *expr) forEachColumn(f func(*expr)) {
+	if e.op == pb.ExprOp_COLUMN {
+		f(e)
+	}
+	for _, arg := range e.args {
+		arg.forEachColumn(f)
+	}
+}
+
+// Evaluates the expr over the rows of the result, whose strs are in the strStore.
+func (e *expr) eval(r *BlockQueryResult, strStore readOnlyStrStore) exprValues {
+	args := make([]exprValues, 0, len(e.args))
+	for _, arg := range e.args {
+		args = append(args, arg.eval(r, strStore))
+	}
+
+	values := exprValues{hasValue: make([]bool, r.Count)}
+	switch e.colType {
+	case IntColumnType:
+		values.ints = make([]int64, r.Count)
+	case FloatColumnType:
+		values.floats = make([]float64, r.Count)
+	case StrColumnType:
+		values.strs = make([]string, r.Count)
+	}
+
+	for i := 0; i < r.Count; i++ {
+		values.hasValue[i] = every(args, func(arg exprValues) bool { return arg.hasValue[i] })
+		if !values.hasValue[i] && e.op != pb.ExprOp_COLUMN {
+			continue
+		}
+
+		switch e.op {
+		case pb.ExprOp_COLUMN:
+			switch e.colType {
+			case IntColumnType:
+				values.ints[i] = r.IntResult.matrix[e.srcIdx][i]
+				values.hasValue[i] = r.IntResult.hasValue[e.srcIdx][i]
+			case FloatColumnType:
+				values.floats[i] = r.FloatResult.matrix[e.srcIdx][i]
+				values.hasValue[i] = r.FloatResult.hasValue[e.srcIdx][i]
+			case StrColumnType:
+				values.hasValue[i] = r.StrResult.hasValue[e.srcIdx][i]
+				if values.hasValue[i] {
+					values.strs[i], values.hasValue[i] = strStore.getStr(r.StrResult.matrix[e.srcIdx][i])
+				}
+			}
+		case pb.ExprOp_INT_LITERAL:
+			values.ints[i] = e.intVal
+		case pb.ExprOp_FLOAT_LITERAL:
+			values.floats[i] = e.floatVal
+		case pb.ExprOp_STR_LITERAL:
+			values.strs[i] = e.strVal
+		case pb.ExprOp_ADD, pb.ExprOp_SUB, pb.ExprOp_MUL, pb.ExprOp_DIV:
+			if e.colType == IntColumnType {
+				values.ints[i] = evalArithmetic(e.op, args[0].ints[i], args[1].ints[i])
+			} else if e.op == pb.ExprOp_DIV && args[1].floatAt(i) == 0 {
+				values.hasValue[i] = false
+			} else {
+				values.floats[i] = evalArithmetic(e.op, args[0].floatAt(i), args[1].floatAt(i))
+			}
+		case pb.ExprOp_MOD:
+			if args[1].ints[i] == 0 {
+				values.hasValue[i] = false
+			} else {
+				values.ints[i] = args[0].ints[i] % args[1].ints[i]
+			}
+		case pb.ExprOp_ABS:
+			if e.colType == IntColumnType {
+				values.ints[i] = abs(args[0].ints[i])
+			} else {
+				values.floats[i] = abs(args[0].floats[i])
+			}
+		case pb.ExprOp_LOWER:
+			values.strs[i] = strings.ToLower(args[0].strs[i])
+		case pb.ExprOp_UPPER:
+			values.strs[i] = strings.ToUpper(args[0].strs[i])
+		case pb.ExprOp_SUBSTR:
+			runes := []rune(args[0].strs[i])
+			start := min(max(args[1].ints[i]-1, 0), int64(len(runes)))
+			end := int64(len(runes))
+			if len(args) == 3 {
+				end = min(start+max(args[2].ints[i], 0), end)
+			}
+			values.strs[i] = string(runes[start:end])
+		}
+	}
+	return values
+}
+
+// --------------------------- internal ----------------------------
+// The value of the row as a float, of the ints or the floats.
+func (v *exprValues) floatAt(rowIdx int) float64 {
+	if v.floats != nil {
+		return v.floats[rowIdx]
+	}
+	return float64(v.ints[rowIdx])
+}
+
+func evalArithmetic[T numeric](op pb.ExprOp, left T, right T) T {
+	switch op {
+	case pb.ExprOp_ADD:
+		return left + right
+	case pb.ExprOp_SUB:
+		return left - right
+	case pb.ExprOp_MUL:
+		return left * right
+	default:
+		return left / right
+	}
+}
+
+func abs[T numeric](v T) T {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"bapi/internal/pb"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExprEval(t *testing.T) {
+	table := debugNewPrefilledTable([]RawJson{{
+		Int:   map[string]int64{"ts": 1643175600, "bytes": 1},
+		Str:   map[string]string{"endpoint": "/a"},
+		Float: map[string]float64{"latency": 1},
+	}})
+	column := func(name string) *pb.Expr {
+		return &pb.Expr{Op: pb.ExprOp_COLUMN, ColumnName: name}
+	}
+	intLiteral := func(v int64) *pb.Expr {
+		return &pb.Expr{Op: pb.ExprOp_INT_LITERAL, IntVal: v}
+	}
+	// the rows of bytes 7, -3 and none, and of latency 2.5, 0 and 1
+	result := &BlockQueryResult{
+		Count:       3,
+		IntResult:   IntResult{matrix: [][]int64{{7, -3, 0}}, hasValue: [][]bool{{true, true, false}}},
+		FloatResult: FloatResult{matrix: [][]float64{{2.5, 0, 1}}, hasValue: [][]bool{{true, true, true}}},
+	}
+	eval := func(pbExpr *pb.Expr) exprValues {
+		e, ok := table.newExpr(pbExpr)
+		assert.True(t, ok)
+		e.forEachColumn(func(e *expr) { e.srcIdx = 0 })
+		return e.eval(result, table.strStore)
+	}
+
+	values := eval(&pb.Expr{Op: pb.ExprOp_SUB, Args: []*pb.Expr{column("bytes"), intLiteral(2)}})
+	assert.Equal(t, []int64{5, -5, 0}, values.ints)
+	assert.Equal(t, []bool{true, true, false}, values.hasValue)
+
+	// an int and a float are added as floats
+	values = eval(&pb.Expr{Op: pb.ExprOp_ADD, Args: []*pb.Expr{column("bytes"), column("latency")}})
+	assert.Equal(t, []float64{9.5, -3, 0}, values.floats)
+
+	// DIV is a float, without value if divided by 0
+	values = eval(&pb.Expr{Op: pb.ExprOp_DIV, Args: []*pb.Expr{column("bytes"), column("latency")}})
+	assert.Equal(t, []float64{2.8, 0, 0}, values.floats)
+	assert.Equal(t, []bool{true, false, false}, values.hasValue)
+
+	values = eval(&pb.Expr{Op: pb.ExprOp_MOD, Args: []*pb.Expr{column("bytes"), intLiteral(4)}})
+	assert.Equal(t, []int64{3, -3, 0}, values.ints)
+
+	values = eval(&pb.Expr{Op: pb.ExprOp_ABS, Args: []*pb.Expr{column("bytes")}})
+	assert.Equal(t, []int64{7, 3, 0}, values.ints)
+
+	values = eval(&pb.Expr{Op: pb.ExprOp_SUBSTR, Args: []*pb.Expr{
+		{Op: pb.ExprOp_UPPER, Args: []*pb.Expr{{Op: pb.ExprOp_STR_LITERAL, StrVal: "héllo"}}},
+		intLiteral(2),
+		intLiteral(3),
+	}})
+	assert.Equal(t, []string{"ÉLL", "ÉLL", "ÉLL"}, values.strs)
+
+	// the types of the args are checked
+	invalid := []*pb.Expr{
+		{Op: pb.ExprOp_MOD, Args: []*pb.Expr{column("latency"), intLiteral(2)}},
+		{Op: pb.ExprOp_ADD, Args: []*pb.Expr{column("endpoint"), intLiteral(2)}},
+		{Op: pb.ExprOp_LOWER, Args: []*pb.Expr{column("bytes")}},
+		{Op: pb.ExprOp_ABS},
+		column("nonexistent"),
+	}
+	for _, pbExpr := range invalid {
+		_, ok := table.newExpr(pbExpr)
+		assert.False(t, ok)
+	}
+}
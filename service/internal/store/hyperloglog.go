@@ -0,0 +1,152 @@
+package store
+
+import (
+	"math"
+	"math/bits"
+)
+
+const (
+	minHllPrecision     = 4
+	maxHllPrecision     = 18
+	defaultHllPrecision = 14
+)
+
+/**
+ * A HyperLogLog (https://algo.inria.fr/flajolet/Publications/FlFuGaMe07.pdf) estimating the
+ * number of distinct values added, whose standard error is 1.04 / sqrt(2^precision).
+ *
+ * A value is hashed to 64 bits, whose first `precision` bits pick one of the 2^precision
+ * registers, and the register keeps the max number of leading zeros + 1 of the rest bits. Since
+ * the registers only depend on the values, the sketches of the same precision are merged by
+ * taking the max of each register.
+ *
+ * The registers are kept sparse in a map until a dense slice is smaller, so the sketches of the
+ * groups with few values stay small.
+ */
+type hyperLogLog struct {
+	precision uint8
+	sparse    map[uint32]uint8
+	// nil while sparse
+	registers []uint8
+}
+
+func newHyperLogLog(precision uint8) *hyperLogLog {
+	return &hyperLogLog{
+		precision: precision,
+		sparse:    make(map[uint32]uint8),
+	}
+}
+
+func isValidHllPrecision(precision uint8) bool {
+	return precision >= minHllPrecision && precision <= maxHllPrecision
+}
+
+// The standard error of the estimations of the given precision.
+func hllRelativeError(precision uint8) float64 {
+	return 1.04 / math.Sqrt(float64(uint64(1)<<precision))
+}
+
+func (h *hyperLogLog) addHash(hash uint64) {
+	index := uint32(hash >> (64 - h.precision))
+	// the sentinel bit bounds the rank when the rest bits are all 0
+	rest := hash<<h.precision | 1<<(h.precision-1)
+	h.setRegister(index, uint8(bits.LeadingZeros64(rest)+1))
+}
+
+// The other is expected to have the same precision.
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	if other.registers == nil {
+		for index, rank := range other.sparse {
+			h.setRegister(index, rank)
+		}
+		return
+	}
+
+	h.toDense()
+	for index, rank := range other.registers {
+		h.registers[index] = max(h.registers[index], rank)
+	}
+}
+
+func (h *hyperLogLog) estimate() int64 {
+	m := float64(uint64(1) << h.precision)
+	sum := 0.0
+	zeros := 0
+	if h.registers == nil {
+		// the registers missing in the map are 0, i.e. 2^-0 each
+		zeros = int(m) - len(h.sparse)
+		sum = float64(zeros)
+		for _, rank := range h.sparse {
+			sum += math.Ldexp(1, -int(rank))
+		}
+	} else {
+		for _, rank := range h.registers {
+			if rank == 0 {
+				zeros++
+			}
+			sum += math.Ldexp(1, -int(rank))
+		}
+	}
+
+	estimate := hllAlpha(m) * m * m / sum
+	if estimate <= 2.5*m && zeros != 0 {
+		// linear counting is more accurate for the small cardinalities
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
+
+// --------------------------- internal ----------------------------
+func (h *hyperLogLog) setRegister(index uint32, rank uint8) {
+	if h.registers != nil {
+		h.registers[index] = max(h.registers[index], rank)
+		return
+	}
+
+	if rank > h.sparse[index] {
+		h.sparse[index] = rank
+	}
+	// a map entry takes a few times the size of a register
+	if len(h.sparse) > (1<<h.precision)/8 {
+		h.toDense()
+	}
+}
+
+func (h *hyperLogLog) toDense() {
+	if h.registers != nil {
+		return
+	}
+
+	h.registers = make([]uint8, 1<<h.precision)
+	for index, rank := range h.sparse {
+		h.registers[index] = rank
+	}
+	h.sparse = nil
+}
+
+func hllAlpha(m float64) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/m)
+	}
+}
+
+// Hashes the value by its bits with the splitmix64 finalizer, so the close values are spread.
+func hashNumeric[T numeric](v T) uint64 {
+	x := uint64(int64(v))
+	// https://github.com/golang/go/issues/49206
+	if f, ok := (interface{})(v).(float64); ok {
+		x = math.Float64bits(f)
+	}
+
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
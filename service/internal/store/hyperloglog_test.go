@@ -0,0 +1,50 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	hll := newHyperLogLog(defaultHllPrecision)
+	assert.Equal(t, int64(0), hll.estimate())
+
+	// the small cardinalities are almost exact, and the duplicates are not counted
+	for i := 0; i < 3; i++ {
+		for v := int64(0); v < 100; v++ {
+			hll.addHash(hashNumeric(v))
+		}
+	}
+	assert.InDelta(t, 100, hll.estimate(), 1)
+	assert.NotNil(t, hll.sparse)
+
+	for v := int64(100); v < 100000; v++ {
+		hll.addHash(hashNumeric(v))
+	}
+	assert.Nil(t, hll.sparse)
+	assert.InEpsilon(t, 100000, hll.estimate(), 3*hllRelativeError(defaultHllPrecision))
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	for _, count := range []int{100, 50000} {
+		all := newHyperLogLog(12)
+		even := newHyperLogLog(12)
+		odd := newHyperLogLog(12)
+		for v := 0; v < count; v++ {
+			hash := hashNumeric(float64(v) / 10)
+			all.addHash(hash)
+			if v%2 == 0 {
+				even.addHash(hash)
+			} else {
+				odd.addHash(hash)
+			}
+		}
+
+		// merging is the same as adding all the values, whether the sketches are sparse or not
+		even.merge(odd)
+		assert.Equal(t, all.estimate(), even.estimate())
+		odd.merge(all)
+		assert.Equal(t, all.estimate(), odd.estimate())
+	}
+}
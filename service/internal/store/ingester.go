@@ -3,6 +3,8 @@ package store
 import (
 	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"strings"
 	"time"
 )
@@ -56,6 +58,10 @@ func (ingester *ingester) buildPartialBlock() (*partialBlock, error) {
 
 	intPartialColumns := newPartialColumns[int64]()
 	strPartialColumns := newPartialColumns[strId]()
+	floatPartialColumns := newPartialColumns[float64]()
+	boolPartialColumns := newPartialColumns[uint8]()
+	strSetPartialColumns := newPartialColumns[uint32]()
+	strSets := newStrSetTable()
 	maxTs := int64(0)
 	minTs := int64(0xFFFFFFFF)
 
@@ -71,11 +77,26 @@ func (ingester *ingester) buildPartialBlock() (*partialBlock, error) {
 		for idx := 0; idx < len(row.strValues); idx++ {
 			strPartialColumns.insertValue(row.strColumnId[idx], rowIdx, row.strValues[idx])
 		}
+		for idx := 0; idx < len(row.floatValues); idx++ {
+			floatPartialColumns.insertValue(row.floatColumnId[idx], rowIdx, row.floatValues[idx])
+		}
+		for idx := 0; idx < len(row.boolValues); idx++ {
+			boolPartialColumns.insertValue(row.boolColumnId[idx], rowIdx, row.boolValues[idx])
+		}
+		for idx := 0; idx < len(row.strSetValues); idx++ {
+			setIdx := strSets.getOrInsert(row.strSetValues[idx])
+			strSetPartialColumns.insertValue(row.strSetColumnId[idx], rowIdx, setIdx)
+		}
 	}
 
 	return &partialBlock{
-		intPartialColumns: intPartialColumns,
-		strPartialColumns: strPartialColumns,
+		intPartialColumns:   intPartialColumns,
+		strPartialColumns:   strPartialColumns,
+		floatPartialColumns: floatPartialColumns,
+
+		boolPartialColumns:   boolPartialColumns,
+		strSetPartialColumns: strSetPartialColumns,
+		strSets:              strSets.sets,
 
 		strIdSet: ingester.strIdSet,
 
@@ -125,6 +146,63 @@ func (ingester *ingester) ingestRawJson(rawJson RawJson, useServerTs bool) error
 		row.addStr(colId, strId)
 	}
 
+	for columnName, value := range rawJson.Float {
+		// NaN can't be filtered or grouped by since it's not equal to itself
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("invalid float for %s: %f", columnName, value)
+		}
+
+		colId, err := ingester.ctx.getOrRegisterColumnId(columnName, FloatColumnType)
+		if err != nil {
+			return err
+		}
+
+		row.addFloat(colId, value)
+	}
+
+	for columnName, value := range rawJson.Bool {
+		colId, err := ingester.ctx.getOrRegisterColumnId(columnName, BoolColumnType)
+		if err != nil {
+			return err
+		}
+
+		row.addBool(colId, value)
+	}
+
+	for columnName, values := range rawJson.StrSet {
+		// an empty set is the same as a missing value
+		if len(values) == 0 {
+			continue
+		}
+
+		colId, err := ingester.ctx.getOrRegisterColumnId(columnName, StrSetColumnType)
+		if err != nil {
+			return err
+		}
+
+		set := make([]strId, 0, len(values))
+		seen := make(map[strId]bool, len(values))
+		for _, value := range values {
+			strId, _, ok := ingester.ctx.getOrInsertStrId(strings.TrimSpace(value), colId)
+			if !ok {
+				return fmt.Errorf("reached max str count: %d", strId)
+			}
+			if seen[strId] {
+				continue
+			}
+
+			seen[strId] = true
+			ingester.strIdSet[strId] = true
+			set = append(set, strId)
+		}
+
+		// sorted so the same set always has the same key in strSetTable
+		sort.Slice(set, func(i, j int) bool {
+			return set[i] < set[j]
+		})
+		row.addStrSet(colId, set)
+	}
+
 	ingester.rows = append(ingester.rows, row)
 	return nil
 }
@@ -134,6 +212,8 @@ func (ingester *ingester) ingestRawJson(rawJson RawJson, useServerTs bool) error
  * A bookkeeping data structure for processing a raw row received from an external client (e.g. website logger)
  * The first element (TS_COLUMN_ID) of intValues/intColumnId is the ts.
  * Invariant: len(intColumnId) == len(intValues) && len(strColumnId) == len(strValues)
+ * 	&& len(floatColumnId) == len(floatValues) && len(boolColumnId) == len(boolValues)
+ * 	&& len(strSetColumnId) == len(strSetValues)
  *
  * e.g. given a raw row looks like {"ts": 1642906206, "count": 12, "event": "init", },
  * 	and "event" has colId of 2, "count" has colId of 3, "init" has strId of 9,the row would look like:
@@ -145,18 +225,32 @@ func (ingester *ingester) ingestRawJson(rawJson RawJson, useServerTs bool) error
  *  }
  */
 type row struct {
-	intColumnId []columnId
-	intValues   []int64
-	strColumnId []columnId
-	strValues   []strId
+	intColumnId   []columnId
+	intValues     []int64
+	strColumnId   []columnId
+	strValues     []strId
+	floatColumnId []columnId
+	floatValues   []float64
+	boolColumnId  []columnId
+	boolValues    []uint8 // 0 or 1
+	// the strIds of a set are unique and sorted
+	strSetColumnId []columnId
+	strSetValues   [][]strId
 }
 
 func newRow() *row {
 	return &row{
-		intColumnId: make([]columnId, 0),
-		intValues:   make([]int64, 0),
-		strColumnId: make([]columnId, 0),
-		strValues:   make([]strId, 0),
+		intColumnId:   make([]columnId, 0),
+		intValues:     make([]int64, 0),
+		strColumnId:   make([]columnId, 0),
+		strValues:     make([]strId, 0),
+		floatColumnId: make([]columnId, 0),
+		floatValues:   make([]float64, 0),
+
+		boolColumnId:   make([]columnId, 0),
+		boolValues:     make([]uint8, 0),
+		strSetColumnId: make([]columnId, 0),
+		strSetValues:   make([][]strId, 0),
 	}
 }
 
@@ -170,6 +264,25 @@ func (row *row) addStr(colId columnId, value strId) {
 	row.strValues = append(row.strValues, value)
 }
 
+func (row *row) addFloat(colId columnId, value float64) {
+	row.floatColumnId = append(row.floatColumnId, colId)
+	row.floatValues = append(row.floatValues, value)
+}
+
+func (row *row) addBool(colId columnId, value bool) {
+	row.boolColumnId = append(row.boolColumnId, colId)
+	if value {
+		row.boolValues = append(row.boolValues, 1)
+	} else {
+		row.boolValues = append(row.boolValues, 0)
+	}
+}
+
+func (row *row) addStrSet(colId columnId, value []strId) {
+	row.strSetColumnId = append(row.strSetColumnId, colId)
+	row.strSetValues = append(row.strSetValues, value)
+}
+
 func (row *row) getTs() int64 {
 	return row.intValues[TS_COLUMN_ID]
 }
@@ -188,8 +301,13 @@ type partialColumns[T comparable] map[columnId]partialColumnData[T]
 
 // A bookkeeping data structure that has everything needed to create a block
 type partialBlock struct {
-	intPartialColumns partialColumns[int64]
-	strPartialColumns partialColumns[strId]
+	intPartialColumns   partialColumns[int64]
+	strPartialColumns   partialColumns[strId]
+	floatPartialColumns partialColumns[float64]
+	boolPartialColumns  partialColumns[uint8]
+	// the values are indexes into strSets
+	strSetPartialColumns partialColumns[uint32]
+	strSets              [][]strId
 
 	strIdSet map[strId]bool
 
@@ -244,6 +362,41 @@ func (partialColumns partialColumns[T]) insertValue(colId columnId, rowId uint32
 	columnData[value] = append(columnData[value], rowId)
 }
 
+// --------------------------- strSetTable ----------------------------
+/**
+ * The distinct str sets of a block. Rows with the same set share an entry, so the str set
+ * columns can be stored as the indexes into the table like the other numeric values.
+ */
+type strSetTable struct {
+	sets    [][]strId
+	indexes map[string]uint32 // the key of a set to its index in sets
+}
+
+func newStrSetTable() *strSetTable {
+	return &strSetTable{
+		sets:    make([][]strId, 0),
+		indexes: make(map[string]uint32),
+	}
+}
+
+// Returns the index of the set, which must be sorted.
+func (t *strSetTable) getOrInsert(set []strId) uint32 {
+	keyBuilder := strings.Builder{}
+	for _, sid := range set {
+		fmt.Fprintf(&keyBuilder, "%d,", sid)
+	}
+	key := keyBuilder.String()
+
+	if idx, ok := t.indexes[key]; ok {
+		return idx
+	}
+
+	idx := uint32(len(t.sets))
+	t.sets = append(t.sets, set)
+	t.indexes[key] = idx
+	return idx
+}
+
 // --------------------------- test util ----------------------------
 type debugPair[T comparable] struct {
 	colId columnId
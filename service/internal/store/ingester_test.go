@@ -71,14 +71,14 @@ func assertIntPartialColData(
 
 func assertStrPartialColData(
 	t *testing.T, colName string, expected partialColumnData[string], table *Table, ingester *ingester, strCol partialColumns[strId]) {
+	colId, found := table.colInfoMap.getOrRegisterColumnId(colName, StrColumnType)
+	assert.Nil(t, found)
+
 	expectedStrIdCol := make(partialColumnData[strId])
 	for s, rows := range expected {
-		sid, _ := table.strStore.getStrId(s)
+		sid, _ := table.strStore.getStrId(colId, s)
 		expectedStrIdCol[sid] = rows
 	}
-
-	colId, found := table.colInfoMap.getOrRegisterColumnId(colName, StrColumnType)
-	assert.Nil(t, found)
 	assertPartialColumnDataEqual(t, expectedStrIdCol, strCol[colId])
 }
 
@@ -4,11 +4,15 @@ package store
  * The schema for parsing rows received as raw Json
  * Note: row without a `ts` field will be dropped.
  * e.g.
- * {"int":{"ts":1641679041,"count":807},"str":{"event":"init_app"}}
+ * {"int":{"ts":1641679041,"count":807},"str":{"event":"init_app"},"float":{"latency":0.25},
+ * 	"bool":{"is_logged_in":true},"str_set":{"experiments":["a","b"]}}
  */
 type RawJson struct {
-	Int map[string]int64  `json:"int"`
-	Str map[string]string `json:"str"`
+	Int    map[string]int64    `json:"int"`
+	Str    map[string]string   `json:"str"`
+	Float  map[string]float64  `json:"float"`
+	Bool   map[string]bool     `json:"bool"`
+	StrSet map[string][]string `json:"str_set"`
 }
 
 type columnId uint16
@@ -28,9 +32,12 @@ type ColumnInfo struct {
 type ColumnType = uint8
 
 const (
-	NoneColumnType ColumnType = iota
-	IntColumnType  ColumnType = iota // int64
-	StrColumnType  ColumnType = iota // string
+	NoneColumnType   ColumnType = iota
+	IntColumnType    ColumnType = iota // int64
+	StrColumnType    ColumnType = iota // string
+	FloatColumnType  ColumnType = iota // float64
+	BoolColumnType   ColumnType = iota // bool
+	StrSetColumnType ColumnType = iota // a set of strings, e.g. tags
 )
 
 // Timestamp column is required and always the first column in the table and in all blocks.
@@ -5,6 +5,8 @@ import (
 	"bapi/internal/pb"
 	"bufio"
 	"encoding/json"
+	"fmt"
+	"math"
 	"strings"
 	"testing"
 
@@ -85,9 +87,895 @@ func TestQuery(t *testing.T) {
 		StrIdMap:       map[uint32]string{curStrId: "modal"},
 		StrResult:      []uint32{curStrId},
 		StrHasValue:    []bool{true},
+
+		FloatResult:   []float64{},
+		FloatHasValue: []bool{},
+
+		BoolResult:   []bool{},
+		BoolHasValue: []bool{},
+
+		StrSetResult:   []*pb.StrIdSet{},
+		StrSetHasValue: []bool{},
 	}, result)
 }
 
+func TestFloatColumns(t *testing.T) {
+	table := debugNewPrefilledTable([]RawJson{
+		{
+			Int:   map[string]int64{"ts": 1643175607},
+			Str:   map[string]string{"event": "init_app"},
+			Float: map[string]float64{"latency": 0.5, "price": 1.25},
+		},
+		{
+			Int:   map[string]int64{"ts": 1643175609},
+			Str:   map[string]string{"event": "init_app"},
+			Float: map[string]float64{"latency": 1.5},
+		},
+		{
+			Int:   map[string]int64{"ts": 1643175611},
+			Str:   map[string]string{"event": "create"},
+			Float: map[string]float64{"latency": math.NaN()},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175613},
+			Str: map[string]string{"event": "create"},
+		},
+	})
+	assert.Equal(t, int64(3), table.GetTableInfo().RowCount)
+	assert.Equal(t, 2, len(table.GetTableInfo().FloatColumns))
+
+	maxTs := int64(1643175613)
+	rowsResult, _ := table.RowsQuery(&pb.RowsQuery{
+		MinTs: 1643175607,
+		MaxTs: &maxTs,
+		FloatFilters: []*pb.Filter{
+			{
+				ColumnName: "latency",
+				FilterOp:   pb.FilterOp_GT,
+				FloatVals:  []float64{1},
+			},
+		},
+		IntColumnNames:   []string{"ts"},
+		FloatColumnNames: []string{"latency", "price"},
+	})
+	assert.Equal(t, int32(1), rowsResult.Count)
+	assert.Equal(t, []int64{1643175609}, rowsResult.IntResult)
+	assert.Equal(t, []float64{1.5, 0}, rowsResult.FloatResult)
+	assert.Equal(t, []bool{true, false}, rowsResult.FloatHasValue)
+
+	tableQuery := &pb.TableQuery{
+		MinTs:                 1643175607,
+		MaxTs:                 &maxTs,
+		GroupbyStrColumnNames: []string{"event"},
+		AggFloatColumnNames:   []string{"latency"},
+		StrFilters: []*pb.Filter{
+			{
+				ColumnName: "event",
+				FilterOp:   pb.FilterOp_EQ,
+				StrVals:    []string{"init_app"},
+			},
+		},
+	}
+
+	tableQuery.AggOp = pb.AggOp_SUM
+	tableResult, _ := table.TableQuery(tableQuery)
+	assert.Equal(t, []string{"latency"}, tableResult.AggFloatColumnNames)
+	assert.Equal(t, []float64{2}, tableResult.AggFloatResult)
+
+	tableQuery.AggOp = pb.AggOp_AVG
+	tableResult, _ = table.TableQuery(tableQuery)
+	assert.Equal(t, []float64{1}, tableResult.AggFloatResult)
+
+	tableQuery.AggOp = pb.AggOp_COUNT
+	tableResult, _ = table.TableQuery(tableQuery)
+	assert.Equal(t, []string{"latency"}, tableResult.AggIntColumnNames)
+	assert.Equal(t, []int64{2}, tableResult.AggIntResult)
+	assert.Empty(t, tableResult.AggFloatColumnNames)
+}
+
+func TestBoolAndStrSetColumns(t *testing.T) {
+	table := debugNewPrefilledTable([]RawJson{
+		{
+			Int:    map[string]int64{"ts": 1643175607},
+			Bool:   map[string]bool{"logged_in": true},
+			StrSet: map[string][]string{"tags": {"a", "b"}},
+		},
+		{
+			Int:    map[string]int64{"ts": 1643175609},
+			Bool:   map[string]bool{"logged_in": false},
+			StrSet: map[string][]string{"tags": {"b"}},
+		},
+		{
+			Int:    map[string]int64{"ts": 1643175611},
+			StrSet: map[string][]string{"tags": {}},
+		},
+		{
+			Int:    map[string]int64{"ts": 1643175613},
+			Bool:   map[string]bool{"logged_in": true},
+			StrSet: map[string][]string{"tags": {"c", "a", "a"}},
+		},
+	})
+	tableInfo := table.GetTableInfo()
+	assert.Equal(t, 1, len(tableInfo.BoolColumns))
+	assert.Equal(t, 1, len(tableInfo.StrSetColumns))
+	assert.Equal(t, int64(3), tableInfo.StrSetColumns[0].StrCount)
+
+	maxTs := int64(1643175613)
+	rowsQuery := func(boolFilters []*pb.Filter, strSetFilters []*pb.Filter) ([]int64, [][]string) {
+		result, ok := table.RowsQuery(&pb.RowsQuery{
+			MinTs:             1643175607,
+			TsAscending:       true,
+			MaxTs:             &maxTs,
+			BoolFilters:       boolFilters,
+			StrSetFilters:     strSetFilters,
+			IntColumnNames:    []string{"ts"},
+			StrSetColumnNames: []string{"tags"},
+		})
+		if !ok {
+			return nil, nil
+		}
+
+		sets := make([][]string, 0)
+		for _, set := range result.StrSetResult {
+			strs := make([]string, 0)
+			for _, sid := range set.StrIds {
+				strs = append(strs, result.StrIdMap[sid])
+			}
+			sets = append(sets, strs)
+		}
+		return result.IntResult, sets
+	}
+
+	ts, sets := rowsQuery([]*pb.Filter{{ColumnName: "logged_in", FilterOp: pb.FilterOp_EQ, BoolVals: []bool{true}}}, nil)
+	assert.Equal(t, []int64{1643175607, 1643175613}, ts)
+	assert.ElementsMatch(t, []string{"a", "b"}, sets[0])
+	assert.ElementsMatch(t, []string{"a", "c"}, sets[1])
+
+	ts, _ = rowsQuery(nil, []*pb.Filter{{ColumnName: "tags", FilterOp: pb.FilterOp_CONTAINS, StrVals: []string{"a", "b"}}})
+	assert.Equal(t, []int64{1643175607}, ts)
+
+	ts, _ = rowsQuery(nil, []*pb.Filter{{ColumnName: "tags", FilterOp: pb.FilterOp_CONTAINS_ANY, StrVals: []string{"c", "b"}}})
+	assert.Equal(t, []int64{1643175607, 1643175609, 1643175613}, ts)
+
+	ts, sets = rowsQuery(nil, []*pb.Filter{{ColumnName: "tags", FilterOp: pb.FilterOp_NULL, StrVals: []string{""}}})
+	assert.Equal(t, []int64{1643175611}, ts)
+	assert.Equal(t, [][]string{{}}, sets)
+
+	ts, _ = rowsQuery(nil, []*pb.Filter{{ColumnName: "tags", FilterOp: pb.FilterOp_CONTAINS, StrVals: []string{"a", "x"}}})
+	assert.Nil(t, ts)
+
+	// the set ops are only for the str set columns and vice versa
+	ts, _ = rowsQuery(nil, []*pb.Filter{{ColumnName: "tags", FilterOp: pb.FilterOp_EQ, StrVals: []string{"a"}}})
+	assert.Nil(t, ts)
+
+	// a row is counted in the group of each of its tags
+	tableResult, _ := table.TableQuery(&pb.TableQuery{
+		MinTs:                    1643175607,
+		MaxTs:                    &maxTs,
+		AggOp:                    pb.AggOp_COUNT,
+		AggIntColumnNames:        []string{"ts"},
+		GroupbyStrSetColumnNames: []string{"tags"},
+	})
+	assert.Equal(t, []string{"tags"}, tableResult.StrColumnNames)
+	counts := make(map[string]int64)
+	for i := 0; i < int(tableResult.Count); i++ {
+		tag := "<null>"
+		if tableResult.StrHasValue[i] {
+			tag = tableResult.StrIdMap[tableResult.StrResult[i]]
+		}
+		counts[tag] = tableResult.AggIntResult[i]
+	}
+	assert.Equal(t, map[string]int64{"a": 2, "b": 2, "c": 1, "<null>": 1}, counts)
+}
+
+func TestFilterExpr(t *testing.T) {
+	table := debugNewPrefilledTable([]RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607, "status": 200},
+			Str: map[string]string{"event": "error"},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175609, "status": 503},
+			Str: map[string]string{"event": "publish"},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175611, "status": 200},
+			Str: map[string]string{"event": "publish"},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175613},
+			Str: map[string]string{"event": "create", "source": "modal"},
+		},
+	})
+	leaf := func(filter *pb.Filter) *pb.FilterExpr {
+		return &pb.FilterExpr{Op: pb.FilterExprOp_LEAF, Filter: filter}
+	}
+	isError := leaf(&pb.Filter{ColumnName: "event", FilterOp: pb.FilterOp_EQ, StrVals: []string{"error"}})
+	is5xx := leaf(&pb.Filter{ColumnName: "status", FilterOp: pb.FilterOp_GE, IntVals: []int64{500}})
+
+	maxTs := int64(1643175613)
+	query := func(expr *pb.FilterExpr, strFilters []*pb.Filter) ([]int64, bool) {
+		result, ok := table.RowsQuery(&pb.RowsQuery{
+			MinTs:          1643175607,
+			TsAscending:    true,
+			MaxTs:          &maxTs,
+			StrFilters:     strFilters,
+			IntColumnNames: []string{"ts"},
+			FilterExpr:     expr,
+		})
+		if !ok {
+			return nil, false
+		}
+		return result.IntResult, true
+	}
+
+	ts, _ := query(&pb.FilterExpr{Op: pb.FilterExprOp_OR, Children: []*pb.FilterExpr{isError, is5xx}}, nil)
+	assert.Equal(t, []int64{1643175607, 1643175609}, ts)
+
+	// rows without value in the column are kept by NOT
+	ts, _ = query(&pb.FilterExpr{Op: pb.FilterExprOp_NOT, Children: []*pb.FilterExpr{is5xx}}, nil)
+	assert.Equal(t, []int64{1643175607, 1643175611, 1643175613}, ts)
+
+	ts, _ = query(&pb.FilterExpr{Op: pb.FilterExprOp_AND, Children: []*pb.FilterExpr{
+		{Op: pb.FilterExprOp_NOT, Children: []*pb.FilterExpr{isError}},
+		{Op: pb.FilterExprOp_OR, Children: []*pb.FilterExpr{
+			is5xx,
+			leaf(&pb.Filter{ColumnName: "source", FilterOp: pb.FilterOp_NONNULL, StrVals: []string{""}}),
+		}},
+	}}, nil)
+	assert.Equal(t, []int64{1643175609, 1643175613}, ts)
+
+	// the flat filters are ANDed with the expression
+	ts, _ = query(
+		&pb.FilterExpr{Op: pb.FilterExprOp_OR, Children: []*pb.FilterExpr{isError, is5xx}},
+		[]*pb.Filter{{ColumnName: "event", FilterOp: pb.FilterOp_EQ, StrVals: []string{"publish"}}},
+	)
+	assert.Equal(t, []int64{1643175609}, ts)
+
+	// invalid expressions
+	_, ok := query(&pb.FilterExpr{Op: pb.FilterExprOp_NOT, Children: []*pb.FilterExpr{isError, is5xx}}, nil)
+	assert.False(t, ok)
+	_, ok = query(&pb.FilterExpr{Op: pb.FilterExprOp_OR}, nil)
+	assert.False(t, ok)
+	_, ok = query(leaf(&pb.Filter{ColumnName: "missing", FilterOp: pb.FilterOp_EQ, IntVals: []int64{1}}), nil)
+	assert.False(t, ok)
+}
+
+func TestStrPatternFilters(t *testing.T) {
+	table := debugNewPrefilledTable([]RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"path": "/api/users"},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175609},
+			Str: map[string]string{"path": "/api/Orders/42"},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175611},
+			Str: map[string]string{"path": "/static/app.js"},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175613},
+		},
+	})
+
+	maxTs := int64(1643175613)
+	query := func(op pb.FilterOp, vals ...string) ([]int64, bool) {
+		result, ok := table.RowsQuery(&pb.RowsQuery{
+			MinTs:          1643175607,
+			TsAscending:    true,
+			MaxTs:          &maxTs,
+			StrFilters:     []*pb.Filter{{ColumnName: "path", FilterOp: op, StrVals: vals}},
+			IntColumnNames: []string{"ts"},
+		})
+		if !ok {
+			return nil, false
+		}
+		return result.IntResult, true
+	}
+
+	ts, _ := query(pb.FilterOp_PREFIX, "/api/")
+	assert.Equal(t, []int64{1643175607, 1643175609}, ts)
+
+	ts, _ = query(pb.FilterOp_CONTAINS, "orders", ".js")
+	assert.Equal(t, []int64{1643175611}, ts)
+
+	ts, _ = query(pb.FilterOp_IEQ, "/API/USERS")
+	assert.Equal(t, []int64{1643175607}, ts)
+
+	ts, _ = query(pb.FilterOp_REGEX, `^/api/\w+/\d+$`)
+	assert.Equal(t, []int64{1643175609}, ts)
+
+	// no str matches the pattern
+	ts, _ = query(pb.FilterOp_PREFIX, "/admin")
+	assert.Empty(t, ts)
+
+	_, ok := query(pb.FilterOp_REGEX, "(")
+	assert.False(t, ok)
+	_, ok = query(pb.FilterOp_LT, "/api")
+	assert.False(t, ok)
+
+	// the pattern is resolved to the set of the matching strs once for all the blocks
+	filters, ok := table.newColumnFilters(nil, []*pb.Filter{{ColumnName: "path", FilterOp: pb.FilterOp_PREFIX, StrVals: []string{"/api/"}}}, nil, nil, nil)
+	assert.True(t, ok)
+	matched := make([]string, 0)
+	for sid := range filters.strFilters[0].valueSet {
+		str, _ := table.strStore.getStr(sid)
+		matched = append(matched, str)
+	}
+	assert.ElementsMatch(t, []string{"/api/users", "/api/Orders/42"}, matched)
+}
+
+func TestMinMaxFirstLast(t *testing.T) {
+	table := NewTable(common.NewBapiCtx(), "asd")
+	debugIngestRows(table, []RawJson{
+		{
+			Int:   map[string]int64{"ts": 1643175610, "version": 3},
+			Str:   map[string]string{"host": "a"},
+			Float: map[string]float64{"latency": 0.3},
+		},
+		{
+			Int:   map[string]int64{"ts": 1643175611},
+			Str:   map[string]string{"host": "b"},
+			Float: map[string]float64{"latency": 0.9},
+		},
+	})
+	// the older rows are in another block, ingested later
+	debugIngestRows(table, []RawJson{
+		{
+			Int:   map[string]int64{"ts": 1643175607, "version": 5},
+			Str:   map[string]string{"host": "a"},
+			Float: map[string]float64{"latency": 0.7},
+		},
+		{
+			Int:   map[string]int64{"ts": 1643175608, "version": 2},
+			Str:   map[string]string{"host": "a"},
+			Float: map[string]float64{"latency": 0.1},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175612},
+			Str: map[string]string{"host": "b"},
+		},
+	})
+
+	query := func(op pb.AggOp) (map[string][]int64, map[string][]float64) {
+		result, ok := table.TableQuery(&pb.TableQuery{
+			MinTs:                 1643175607,
+			GroupbyStrColumnNames: []string{"host"},
+			AggOp:                 op,
+			AggIntColumnNames:     []string{"version"},
+			AggFloatColumnNames:   []string{"latency"},
+		})
+		assert.True(t, ok)
+
+		// the groups without value are left out
+		ints := make(map[string][]int64)
+		floats := make(map[string][]float64)
+		for groupIdx := 0; groupIdx < int(result.Count); groupIdx++ {
+			group := result.StrIdMap[result.StrResult[groupIdx]]
+			if result.AggIntHasValue[groupIdx] {
+				ints[group] = append(ints[group], result.AggIntResult[groupIdx])
+			}
+			if result.AggFloatHasValue[groupIdx] {
+				floats[group] = append(floats[group], result.AggFloatResult[groupIdx])
+			}
+		}
+		return ints, floats
+	}
+
+	ints, floats := query(pb.AggOp_MIN)
+	assert.Equal(t, map[string][]int64{"a": {2}}, ints)
+	assert.Equal(t, map[string][]float64{"a": {0.1}, "b": {0.9}}, floats)
+
+	ints, floats = query(pb.AggOp_MAX)
+	assert.Equal(t, map[string][]int64{"a": {5}}, ints)
+	assert.Equal(t, map[string][]float64{"a": {0.7}, "b": {0.9}}, floats)
+
+	ints, floats = query(pb.AggOp_FIRST)
+	assert.Equal(t, map[string][]int64{"a": {5}}, ints)
+	assert.Equal(t, map[string][]float64{"a": {0.7}, "b": {0.9}}, floats)
+
+	ints, floats = query(pb.AggOp_LAST)
+	assert.Equal(t, map[string][]int64{"a": {3}}, ints)
+	assert.Equal(t, map[string][]float64{"a": {0.3}, "b": {0.9}}, floats)
+}
+
+func TestPercentile(t *testing.T) {
+	table := NewTable(common.NewBapiCtx(), "asd")
+	// the latencies 1..100 of each host are in 2 blocks
+	for block := 0; block < 2; block++ {
+		rows := make([]RawJson, 0)
+		for v := block*50 + 1; v <= block*50+50; v++ {
+			rows = append(rows, RawJson{
+				Int:   map[string]int64{"ts": 1643175607 + int64(v), "latency_ms": int64(v)},
+				Str:   map[string]string{"host": "a"},
+				Float: map[string]float64{"latency": float64(v) / 1000},
+			})
+		}
+		debugIngestRows(table, rows)
+	}
+
+	result, ok := table.TableQuery(&pb.TableQuery{
+		MinTs:                 1643175607,
+		GroupbyStrColumnNames: []string{"host"},
+		AggOp:                 pb.AggOp_PERCENTILE,
+		AggIntColumnNames:     []string{"latency_ms"},
+		AggFloatColumnNames:   []string{"latency"},
+		Quantiles:             []float64{0.5, 0.999},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, int32(1), result.Count)
+	assert.Equal(t, []string{"latency_ms_p50", "latency_ms_p99.9", "latency_p50", "latency_p99.9"}, result.AggFloatColumnNames)
+	assert.Equal(t, []bool{true, true, true, true}, result.AggFloatHasValue)
+	for i, expected := range []float64{50.5, 99.9, 0.0505, 0.0999} {
+		assert.InEpsilon(t, expected, result.AggFloatResult[i], 0.02)
+	}
+
+	// the quantiles are required and must be in [0, 1]
+	_, ok = table.TableQuery(&pb.TableQuery{
+		MinTs:             1643175607,
+		AggOp:             pb.AggOp_PERCENTILE,
+		AggIntColumnNames: []string{"latency_ms"},
+	})
+	assert.False(t, ok)
+	_, ok = table.TableQuery(&pb.TableQuery{
+		MinTs:             1643175607,
+		AggOp:             pb.AggOp_PERCENTILE,
+		AggIntColumnNames: []string{"latency_ms"},
+		Quantiles:         []float64{1.5},
+	})
+	assert.False(t, ok)
+}
+
+func TestApproxCountDistinct(t *testing.T) {
+	table := NewTable(common.NewBapiCtx(), "asd")
+	// 3000 distinct users of 2 hosts, repeated in 2 blocks
+	for block := 0; block < 2; block++ {
+		rows := make([]RawJson, 0)
+		for v := 0; v < 3000; v++ {
+			rows = append(rows, RawJson{
+				Int: map[string]int64{"ts": 1643175607, "user": int64(v)},
+				Str: map[string]string{"host": []string{"a", "b"}[v%2]},
+			})
+		}
+		debugIngestRows(table, rows)
+	}
+
+	query := &pb.TableQuery{
+		MinTs:             1643175607,
+		AggOp:             pb.AggOp_APPROX_COUNT_DISTINCT,
+		AggIntColumnNames: []string{"user"},
+	}
+	result, ok := table.TableQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, hllRelativeError(defaultHllPrecision), result.ApproxRelativeError)
+	assert.InEpsilon(t, 3000, result.AggIntResult[0], 3*result.ApproxRelativeError)
+
+	query.GroupbyStrColumnNames = []string{"host"}
+	query.HllPrecision = 10
+	result, ok = table.TableQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, hllRelativeError(10), result.ApproxRelativeError)
+	for group, counts := range debugTableQueryResultByGroup(result) {
+		assert.InEpsilon(t, 1500, counts[0], 3*result.ApproxRelativeError, group)
+	}
+
+	// the error of each aggregation column, the exact ones of 0
+	query.Aggregations = []*pb.Aggregation{
+		{Op: pb.AggOp_COUNT},
+		{Op: pb.AggOp_APPROX_COUNT_DISTINCT, ColumnName: "user"},
+		{Op: pb.AggOp_AVG, ColumnName: "user"},
+	}
+	result, ok = table.TableQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, []float64{0, hllRelativeError(10)}, result.AggIntRelativeErrors)
+	assert.Equal(t, []float64{0}, result.AggFloatRelativeErrors)
+	assert.Equal(t, hllRelativeError(10), result.ApproxRelativeError)
+
+	query.Aggregations = query.Aggregations[:1]
+	result, ok = table.TableQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, []float64{0}, result.AggIntRelativeErrors)
+	assert.Zero(t, result.ApproxRelativeError)
+	query.Aggregations = nil
+
+	query.HllPrecision = 30
+	_, ok = table.TableQuery(query)
+	assert.False(t, ok)
+}
+
+func TestMultipleAggregations(t *testing.T) {
+	table := debugNewPrefilledTable([]RawJson{
+		{
+			Int:   map[string]int64{"ts": 1643175607, "bytes": 100},
+			Str:   map[string]string{"endpoint": "/a"},
+			Float: map[string]float64{"latency": 0.1},
+		},
+		{
+			Int:   map[string]int64{"ts": 1643175608, "bytes": 300},
+			Str:   map[string]string{"endpoint": "/a"},
+			Float: map[string]float64{"latency": 0.3},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175609},
+			Str: map[string]string{"endpoint": "/a"},
+		},
+	})
+
+	query := &pb.TableQuery{
+		MinTs:                 1643175607,
+		GroupbyStrColumnNames: []string{"endpoint"},
+		Aggregations: []*pb.Aggregation{
+			{Op: pb.AggOp_COUNT},
+			{Op: pb.AggOp_AVG, ColumnName: "latency"},
+			{Op: pb.AggOp_PERCENTILE, ColumnName: "latency", Quantile: 0.5},
+			{Op: pb.AggOp_SUM, ColumnName: "bytes", Alias: "total_bytes"},
+			{Op: pb.AggOp_MAX, ColumnName: "latency", Alias: "slowest"},
+			{Op: pb.AggOp_COUNT, ColumnName: "bytes"},
+		},
+	}
+	result, ok := table.TableQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, int32(1), result.Count)
+	assert.Equal(t, []string{"count()", "total_bytes", "count(bytes)"}, result.AggIntColumnNames)
+	assert.Equal(t, []int64{3, 400, 2}, result.AggIntResult)
+	assert.Equal(t, []string{"avg(latency)", "p50(latency)", "slowest"}, result.AggFloatColumnNames)
+	assert.InDeltaSlice(t, []float64{0.2, 0.1, 0.3}, result.AggFloatResult, 0.01)
+
+	invalidAggregations := [][]*pb.Aggregation{
+		// duplicate alias
+		{{Op: pb.AggOp_SUM, ColumnName: "bytes"}, {Op: pb.AggOp_MAX, ColumnName: "latency", Alias: "sum(bytes)"}},
+		// only count may have no column
+		{{Op: pb.AggOp_SUM}},
+		{{Op: pb.AggOp_SUM, ColumnName: "endpoint"}},
+		{{Op: pb.AggOp_SUM, ColumnName: "missing"}},
+		{{Op: pb.AggOp_TIMELINE_COUNT, ColumnName: "bytes"}},
+		{{Op: pb.AggOp_PERCENTILE, ColumnName: "bytes", Quantile: 2}},
+	}
+	for _, aggregations := range invalidAggregations {
+		query.Aggregations = aggregations
+		_, ok = table.TableQuery(query)
+		assert.False(t, ok)
+	}
+}
+
+func TestTableQueryOrderByAndLimit(t *testing.T) {
+	// the event i has i rows, of latency i
+	rows := make([]RawJson, 0)
+	for i := 1; i <= 5; i++ {
+		for j := 0; j < i; j++ {
+			rows = append(rows, RawJson{
+				Int:   map[string]int64{"ts": 1643175607},
+				Str:   map[string]string{"event": fmt.Sprintf("event%d", i)},
+				Float: map[string]float64{"latency": float64(i)},
+			})
+		}
+	}
+	rows = append(rows, RawJson{Int: map[string]int64{"ts": 1643175607}})
+	table := debugNewPrefilledTable(rows)
+
+	query := &pb.TableQuery{
+		MinTs:                 1643175607,
+		GroupbyStrColumnNames: []string{"event"},
+		Aggregations: []*pb.Aggregation{
+			{Op: pb.AggOp_COUNT, Alias: "count"},
+			{Op: pb.AggOp_MAX, ColumnName: "latency"},
+		},
+		OrderBy: []*pb.OrderBy{{ColumnName: "count", Desc: true}},
+		Limit:   2,
+	}
+	events := func(result *pb.TableQueryResult) []string {
+		events := make([]string, result.Count)
+		for i := range events {
+			if result.StrHasValue[i] {
+				events[i] = result.StrIdMap[result.StrResult[i]]
+			}
+		}
+		return events
+	}
+
+	result, ok := table.TableQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"event5", "event4"}, events(result))
+	assert.Equal(t, []int64{5, 4}, result.AggIntResult)
+	assert.False(t, result.HasOther)
+
+	// the other groups, including the one without event, are rolled up
+	query.RollupOther = true
+	result, _ = table.TableQuery(query)
+	assert.Equal(t, []string{"event5", "event4", ""}, events(result))
+	assert.Equal(t, []int64{5, 4, 7}, result.AggIntResult)
+	assert.Equal(t, []float64{5, 4, 3}, result.AggFloatResult)
+	assert.True(t, result.HasOther)
+
+	// the groups without value are the last ones in both directions
+	query.OrderBy = []*pb.OrderBy{{ColumnName: "event"}}
+	query.Limit = 0
+	result, _ = table.TableQuery(query)
+	assert.Equal(t, []string{"event1", "event2", "event3", "event4", "event5", ""}, events(result))
+	assert.False(t, result.HasOther)
+
+	query.OrderBy = []*pb.OrderBy{{ColumnName: "max(latency)", Desc: true}}
+	query.Limit = 3
+	result, _ = table.TableQuery(query)
+	assert.Equal(t, []string{"event5", "event4", "event3", ""}, events(result))
+	assert.Equal(t, []bool{true, true, true, true}, result.AggFloatHasValue)
+
+	query.OrderBy = []*pb.OrderBy{{ColumnName: "missing"}}
+	_, ok = table.TableQuery(query)
+	assert.False(t, ok)
+}
+
+func TestTableQueryHaving(t *testing.T) {
+	// the event i has i rows, of latency i
+	rows := make([]RawJson, 0)
+	for i := 1; i <= 5; i++ {
+		for j := 0; j < i; j++ {
+			rows = append(rows, RawJson{
+				Int:   map[string]int64{"ts": 1643175607},
+				Str:   map[string]string{"event": fmt.Sprintf("event%d", i)},
+				Float: map[string]float64{"latency": float64(i)},
+			})
+		}
+	}
+	table := debugNewPrefilledTable(rows)
+
+	query := &pb.TableQuery{
+		MinTs:                 1643175607,
+		GroupbyStrColumnNames: []string{"event"},
+		Aggregations: []*pb.Aggregation{
+			{Op: pb.AggOp_COUNT, Alias: "count"},
+			{Op: pb.AggOp_AVG, ColumnName: "latency"},
+		},
+		OrderBy: []*pb.OrderBy{{ColumnName: "count"}},
+		Having:  []*pb.Filter{{ColumnName: "count", FilterOp: pb.FilterOp_GT, IntVals: []int64{2}}},
+	}
+	result, ok := table.TableQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, []int64{3, 4, 5}, result.AggIntResult)
+
+	// the filters are ANDed, and an int result is compared to the float values
+	query.Having = append(query.Having, &pb.Filter{
+		ColumnName: "avg(latency)",
+		FilterOp:   pb.FilterOp_LT,
+		FloatVals:  []float64{4.5},
+	})
+	result, _ = table.TableQuery(query)
+	assert.Equal(t, []int64{3, 4}, result.AggIntResult)
+	assert.Equal(t, []float64{3, 4}, result.AggFloatResult)
+
+	// the limit is applied to the groups passing the filters
+	query.OrderBy = []*pb.OrderBy{{ColumnName: "count", Desc: true}}
+	query.Limit = 1
+	result, _ = table.TableQuery(query)
+	assert.Equal(t, []int64{4}, result.AggIntResult)
+
+	// no group passes the filters, but the columns are still named
+	query.Having = []*pb.Filter{{ColumnName: "count", FilterOp: pb.FilterOp_GT, FloatVals: []float64{5.5}}}
+	result, ok = table.TableQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, 0, int(result.Count))
+	assert.Equal(t, []string{"count"}, result.AggIntColumnNames)
+	assert.Equal(t, []string{"avg(latency)"}, result.AggFloatColumnNames)
+
+	query.Having = []*pb.Filter{{ColumnName: "latency", FilterOp: pb.FilterOp_GT, IntVals: []int64{1}}}
+	_, ok = table.TableQuery(query)
+	assert.False(t, ok)
+
+	query.Having = []*pb.Filter{{ColumnName: "count", FilterOp: pb.FilterOp_GT}}
+	_, ok = table.TableQuery(query)
+	assert.False(t, ok)
+}
+
+func TestRowsQueryLimitAndCursor(t *testing.T) {
+	// the blocks overlap in ts, and some rows have the same ts
+	table := NewTable(common.NewBapiCtx(), "asd")
+	for _, tsVals := range [][]int64{{1643175610, 1643175607, 1643175612}, {1643175608, 1643175612}, {1643175611, 1643175609, 1643175612}} {
+		ingester := table.ingesterPool.Get().(*ingester)
+		ingester.zeroOut()
+		for _, ts := range tsVals {
+			ingester.ingestRawJson(RawJson{Int: map[string]int64{"ts": ts}}, false /*useServerTs*/)
+		}
+		pb, _ := ingester.buildPartialBlock()
+		table.addPartialBlock(pb, true)
+	}
+
+	maxTs := int64(1643175612)
+	query := &pb.RowsQuery{MinTs: 1643175607, MaxTs: &maxTs, IntColumnNames: []string{"ts"}, Limit: 2}
+	queryAll := func() [][]int64 {
+		pages := make([][]int64, 0)
+		query.Cursor = ""
+		for {
+			result, ok := table.RowsQuery(query)
+			assert.True(t, ok)
+			pages = append(pages, result.IntResult)
+			if result.NextCursor == "" {
+				return pages
+			}
+			query.Cursor = result.NextCursor
+		}
+	}
+
+	assert.Equal(t, [][]int64{
+		{1643175612, 1643175612},
+		{1643175612, 1643175611},
+		{1643175610, 1643175609},
+		{1643175608, 1643175607},
+	}, queryAll())
+
+	query.TsAscending = true
+	query.Limit = 3
+	assert.Equal(t, [][]int64{
+		{1643175607, 1643175608, 1643175609},
+		{1643175610, 1643175611, 1643175612},
+		{1643175612, 1643175612},
+	}, queryAll())
+
+	// the rows are ts ordered without limit too
+	query.Limit = 0
+	assert.Equal(t, [][]int64{
+		{1643175607, 1643175608, 1643175609, 1643175610, 1643175611, 1643175612, 1643175612, 1643175612},
+	}, queryAll())
+
+	query.Cursor = "invalid"
+	_, ok := table.RowsQuery(query)
+	assert.False(t, ok)
+}
+
+// The blocks may be compacted between the pages, which changes the order the rows are scanned in
+func TestRowsQueryCursorAcrossCompaction(t *testing.T) {
+	table := NewTable(common.NewBapiCtx(), "asd")
+	for _, counts := range [][]int64{{3, 1, 3}, {2, 3}, {4, 1}} {
+		rows := make([]RawJson, 0)
+		for _, count := range counts {
+			rows = append(rows, RawJson{Int: map[string]int64{"ts": 1643175607, "count": count}})
+		}
+		debugIngestRows(table, rows)
+	}
+
+	query := &pb.RowsQuery{MinTs: 1643175607, IntColumnNames: []string{"count"}, Limit: 3}
+	counts := make([]int64, 0)
+	for {
+		result, ok := table.RowsQuery(query)
+		assert.True(t, ok)
+		counts = append(counts, result.IntResult...)
+		if result.NextCursor == "" {
+			break
+		}
+		query.Cursor = result.NextCursor
+
+		if merged, _ := table.Compact(); merged != 0 {
+			assert.Equal(t, 3, merged)
+		}
+	}
+	assert.ElementsMatch(t, []int64{1, 1, 2, 3, 3, 3, 4}, counts)
+}
+
+func TestTimelineQuery(t *testing.T) {
+	// a row every minute for 10 minutes, of latency i on /a and 10 * i on /b
+	rows := make([]RawJson, 0)
+	for i := 0; i < 10; i++ {
+		rows = append(rows, RawJson{
+			Int:   map[string]int64{"ts": 1643175600 + int64(i)*60, "bytes": int64(i)},
+			Str:   map[string]string{"endpoint": "/a"},
+			Float: map[string]float64{"latency": float64(i)},
+		}, RawJson{
+			Int:   map[string]int64{"ts": 1643175600 + int64(i)*60},
+			Str:   map[string]string{"endpoint": "/b"},
+			Float: map[string]float64{"latency": float64(10 * i)},
+		})
+	}
+	table := debugNewPrefilledTable(rows)
+
+	maxTs := int64(1643175600 + 600)
+	query := &pb.TimelineQuery{
+		MinTs:                 1643175600,
+		MaxTs:                 &maxTs,
+		GroupbyStrColumnNames: []string{"endpoint"},
+		Gran:                  pb.TimeGran_MIN_5,
+	}
+	groups := func(result *pb.TimelineQueryResult) map[string]*pb.TimelineGroup {
+		groups := make(map[string]*pb.TimelineGroup)
+		for i, group := range result.TimelineGroups {
+			groups[result.StrIdMap[result.StrResult[i]]] = group
+		}
+		return groups
+	}
+
+	// counts the rows by default
+	result, ok, _ := table.TimeilneQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, "count()", result.AggColumnName)
+	assert.False(t, result.AggIsFloat)
+	assert.Equal(t, []uint32{0, 1}, groups(result)["/a"].TsBuckets)
+	assert.Equal(t, []uint32{5, 5}, groups(result)["/a"].Counts)
+	assert.Equal(t, []int64{5, 5}, groups(result)["/b"].IntValues)
+
+	// the ts bucket of the max ts has no rows
+	query.Fill = pb.TimelineFill_FILL_ZERO
+	result, ok, _ = table.TimeilneQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, []uint32{0, 1, 2}, groups(result)["/a"].TsBuckets)
+	assert.Equal(t, []uint32{5, 5, 0}, groups(result)["/a"].Counts)
+	assert.Equal(t, []int64{1643175600, 1643175900, 1643176200}, result.BucketStartTs)
+
+	// the fill over the points of all the groups is an error, unlike no row
+	query.FillMaxPoints = 5
+	_, ok, err := table.TimeilneQuery(query)
+	assert.False(t, ok)
+	assert.EqualError(t, err, "the filled timeline of 2 groups has more ts buckets than fill_max_points 5, try a larger gran or fewer groups")
+	// the fill points don't limit the timelines w/o the fill
+	query.Fill = pb.TimelineFill_FILL_NONE
+	_, ok, _ = table.TimeilneQuery(query)
+	assert.True(t, ok)
+	query.FillMaxPoints = 0
+
+	// too many ts buckets from the min ts to the last row is an error, unlike no row
+	query.MaxBuckets = 1
+	_, ok, err = table.TimeilneQuery(query)
+	assert.False(t, ok)
+	assert.EqualError(t, err, "the timeline has more ts buckets than max_buckets 1, try a larger gran or min_ts")
+	query.MaxBuckets = 0
+	_, _, err = table.TimeilneQuery(&pb.TimelineQuery{MinTs: 1, GranSeconds: 1})
+	assert.NotNil(t, err)
+	_, _, err = table.TimeilneQuery(&pb.TimelineQuery{MinTs: math.MinInt64, GranSeconds: 1})
+	assert.NotNil(t, err)
+	_, ok, err = table.TimeilneQuery(&pb.TimelineQuery{MinTs: 1643176800, GranSeconds: 1})
+	assert.False(t, ok)
+	assert.Nil(t, err)
+
+	query.Aggregation = &pb.Aggregation{Op: pb.AggOp_PERCENTILE, ColumnName: "latency", Quantile: 1}
+	result, ok, _ = table.TimeilneQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, "p100(latency)", result.AggColumnName)
+	assert.True(t, result.AggIsFloat)
+	assert.InEpsilonSlice(t, []float64{4, 9}, groups(result)["/a"].FloatValues, sketchRelativeAccuracy)
+	assert.InEpsilonSlice(t, []float64{40, 90}, groups(result)["/b"].FloatValues, sketchRelativeAccuracy)
+	assert.Empty(t, groups(result)["/b"].Counts)
+
+	// the values are ts ordered in each bucket, and /b has no bytes
+	query.Aggregation = &pb.Aggregation{Op: pb.AggOp_LAST, ColumnName: "bytes", Alias: "last_bytes"}
+	result, ok, _ = table.TimeilneQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, []int64{4, 9}, groups(result)["/a"].IntValues)
+	assert.Empty(t, groups(result)["/b"].TsBuckets)
+
+	// the gran of 10 minutes
+	query.Aggregation = nil
+	query.Gran = pb.TimeGran_AUTO
+	result, ok, _ = table.TimeilneQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, pb.TimeGran_MIN_1, result.Gran)
+	assert.Equal(t, 10, len(groups(result)["/a"].TsBuckets))
+	assert.Equal(t, int64(1643175600+9*60), result.BucketStartTs[9])
+
+	query.GranSeconds = 240
+	result, ok, _ = table.TimeilneQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(240), result.GranSeconds)
+	assert.Equal(t, []uint32{4, 4, 2}, groups(result)["/a"].Counts)
+	assert.Equal(t, []int64{1643175600, 1643175840, 1643176080}, result.BucketStartTs)
+
+	// 1643175600 is 2022-01-26 05:40 UTC, i.e. 2022-01-26 14:40 in Tokyo
+	query.GranSeconds = 0
+	query.Gran = pb.TimeGran_DAY
+	query.Timezone = "Asia/Tokyo"
+	result, ok, _ = table.TimeilneQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, []uint32{10}, groups(result)["/a"].Counts)
+	assert.Equal(t, []int64{1643175600 - (5*3600 + 40*60) - 9*3600}, result.BucketStartTs)
+
+	query.Timezone = "Not/A_Timezone"
+	_, ok, _ = table.TimeilneQuery(query)
+	assert.False(t, ok)
+
+	query.Timezone = ""
+	query.Gran = pb.TimeGran_INVALID
+	_, ok, _ = table.TimeilneQuery(query)
+	assert.False(t, ok)
+}
+
 func debugNewPrefilledTable(rawRows []RawJson) *Table {
 	table := NewTable(common.NewBapiCtx(), "asd")
 	ingester := table.ingesterPool.Get().(*ingester)
@@ -99,3 +987,172 @@ func debugNewPrefilledTable(rawRows []RawJson) *Table {
 	table.addPartialBlock(pb, true)
 	return table
 }
+
+func TestCompareOffsets(t *testing.T) {
+	// /a and /b of today, /a and /c of the day before
+	today := int64(1643175600)
+	yesterday := today - 86400
+	rows := make([]RawJson, 0)
+	newRow := func(ts int64, endpoint string, latency float64) RawJson {
+		return RawJson{
+			Int:   map[string]int64{"ts": ts},
+			Str:   map[string]string{"endpoint": endpoint},
+			Float: map[string]float64{"latency": latency},
+		}
+	}
+	for i := int64(0); i < 4; i++ {
+		rows = append(rows, newRow(today+i*60, "/a", 2))
+	}
+	rows = append(rows, newRow(today, "/b", 1))
+	rows = append(rows, newRow(yesterday, "/a", 1), newRow(yesterday+400, "/a", 1))
+	for i := int64(0); i < 3; i++ {
+		rows = append(rows, newRow(yesterday, "/c", 1))
+	}
+	table := debugNewPrefilledTable(rows)
+
+	maxTs := today + 3600
+	query := &pb.TableQuery{
+		MinTs:                 today,
+		MaxTs:                 &maxTs,
+		GroupbyStrColumnNames: []string{"endpoint"},
+		Aggregations: []*pb.Aggregation{
+			{Op: pb.AggOp_COUNT},
+			{Op: pb.AggOp_AVG, ColumnName: "latency"},
+		},
+		OrderBy:        []*pb.OrderBy{{ColumnName: "endpoint"}},
+		CompareOffsets: []int64{-86400},
+	}
+	result, ok := table.TableQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, []int64{4, 1}, result.AggIntResult)
+	assert.Equal(t, 1, len(result.CompareResults))
+	compared := result.CompareResults[0]
+	assert.Equal(t, int64(-86400), compared.Offset)
+	assert.Equal(t, []int64{2, 0}, compared.AggIntResult)
+	assert.Equal(t, []bool{true, false}, compared.AggIntHasValue)
+	assert.Equal(t, []int64{2, 0}, compared.AggIntDelta)
+	assert.Equal(t, []bool{true, false}, compared.AggIntDeltaHasValue)
+	assert.Equal(t, []float64{100, 0}, compared.AggIntPctChange)
+	assert.Equal(t, []bool{true, false}, compared.AggIntPctChangeHasValue)
+	assert.Equal(t, []float64{1, 0}, compared.AggFloatResult)
+	assert.Equal(t, []float64{1, 0}, compared.AggFloatDelta)
+	assert.Equal(t, []float64{100, 0}, compared.AggFloatPctChange)
+
+	// the other group has no shifted value
+	query.Limit = 1
+	query.RollupOther = true
+	result, _ = table.TableQuery(query)
+	assert.True(t, result.HasOther)
+	assert.Equal(t, []bool{true, false}, result.CompareResults[0].AggIntHasValue)
+
+	// nothing in the shifted range
+	query.CompareOffsets = []int64{86400}
+	result, _ = table.TableQuery(query)
+	assert.Equal(t, []bool{false, false}, result.CompareResults[0].AggIntHasValue)
+
+	// the ts buckets of the day before are aligned to the ones of today
+	timelineQuery := &pb.TimelineQuery{
+		MinTs:                 today,
+		MaxTs:                 &maxTs,
+		GroupbyStrColumnNames: []string{"endpoint"},
+		Gran:                  pb.TimeGran_MIN_5,
+		CompareOffsets:        []int64{-86400},
+	}
+	timelineResult, ok, _ := table.TimeilneQuery(timelineQuery)
+	assert.True(t, ok)
+	for i, group := range timelineResult.CompareResults[0].TimelineGroups {
+		switch timelineResult.StrIdMap[timelineResult.StrResult[i]] {
+		case "/a":
+			assert.Equal(t, []uint32{0, 1}, group.TsBuckets)
+			assert.Equal(t, []int64{1, 1}, group.IntValues)
+			assert.Equal(t, []int64{3, 0}, group.IntDeltas)
+			assert.Equal(t, []bool{true, false}, group.DeltaHasValue)
+			assert.Equal(t, []float64{300, 0}, group.PctChanges)
+		case "/b":
+			assert.Equal(t, 0, len(group.TsBuckets))
+		}
+	}
+}
+
+func TestComputedColumns(t *testing.T) {
+	rows := []RawJson{
+		{Int: map[string]int64{"ts": 1643175600, "bytes_in": 10, "bytes_out": 30}, Str: map[string]string{"endpoint": "/A"}},
+		{Int: map[string]int64{"ts": 1643175660, "bytes_in": 5, "bytes_out": 10}, Str: map[string]string{"endpoint": "/a"}},
+		{Int: map[string]int64{"ts": 1643175720, "bytes_in": 1, "bytes_out": 100}, Str: map[string]string{"endpoint": "/b"}},
+		{Int: map[string]int64{"ts": 1643175780, "bytes_in": 1}, Str: map[string]string{"endpoint": "/b"}},
+	}
+	table := debugNewPrefilledTable(rows)
+
+	column := func(name string) *pb.Expr {
+		return &pb.Expr{Op: pb.ExprOp_COLUMN, ColumnName: name}
+	}
+	query := &pb.TableQuery{
+		MinTs: 1643175600,
+		ComputedColumns: []*pb.ComputedColumn{
+			{Name: "bytes", Expr: &pb.Expr{Op: pb.ExprOp_SUB, Args: []*pb.Expr{column("bytes_out"), column("bytes_in")}}},
+			{Name: "path", Expr: &pb.Expr{Op: pb.ExprOp_LOWER, Args: []*pb.Expr{column("endpoint")}}},
+			{Name: "ts_of_day", Expr: &pb.Expr{Op: pb.ExprOp_MOD, Args: []*pb.Expr{
+				column("ts"),
+				{Op: pb.ExprOp_INT_LITERAL, IntVal: 86400},
+			}}},
+		},
+		GroupbyStrColumnNames: []string{"path"},
+		Aggregations: []*pb.Aggregation{
+			{Op: pb.AggOp_SUM, ColumnName: "bytes", Alias: "bytes"},
+			{Op: pb.AggOp_COUNT},
+		},
+		OrderBy: []*pb.OrderBy{{ColumnName: "path"}},
+	}
+	result, ok := table.TableQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"/a", "/b"}, []string{result.StrIdMap[result.StrResult[0]], result.StrIdMap[result.StrResult[1]]})
+	// the row without bytes_out has no bytes
+	assert.Equal(t, []int64{25, 99, 2, 2}, result.AggIntResult)
+
+	// filters by a computed column, after the filters of the table
+	query.IntFilters = []*pb.Filter{{ColumnName: "bytes", FilterOp: pb.FilterOp_GT, IntVals: []int64{5}}}
+	query.StrFilters = []*pb.Filter{{ColumnName: "path", FilterOp: pb.FilterOp_PREFIX, StrVals: []string{"/a"}}}
+	result, ok = table.TableQuery(query)
+	assert.True(t, ok)
+	assert.Equal(t, []int64{20, 1}, result.AggIntResult)
+
+	// a computed column must be of the type where it's used
+	query.IntFilters = nil
+	query.StrFilters = nil
+	query.GroupbyIntColumnNames = []string{"path"}
+	_, ok = table.TableQuery(query)
+	assert.False(t, ok)
+	query.GroupbyIntColumnNames = nil
+
+	// the name of a computed column can't be the one of a column of the table
+	query.ComputedColumns = append(query.ComputedColumns, &pb.ComputedColumn{Name: "endpoint", Expr: column("bytes_in")})
+	_, ok = table.TableQuery(query)
+	assert.False(t, ok)
+	query.ComputedColumns = query.ComputedColumns[:3]
+
+	// the computed columns of a timeline
+	timelineQuery := &pb.TimelineQuery{
+		MinTs:                 1643175600,
+		ComputedColumns:       query.ComputedColumns,
+		GroupbyStrColumnNames: []string{"path"},
+		Aggregation:           &pb.Aggregation{Op: pb.AggOp_MAX, ColumnName: "minute"},
+		FloatFilters:          []*pb.Filter{{ColumnName: "minute", FilterOp: pb.FilterOp_GE, IntVals: []int64{41}}},
+		Gran:                  pb.TimeGran_MIN_5,
+	}
+	timelineQuery.ComputedColumns[2] = &pb.ComputedColumn{Name: "minute", Expr: &pb.Expr{
+		Op:   pb.ExprOp_DIV,
+		Args: []*pb.Expr{{Op: pb.ExprOp_MOD, Args: []*pb.Expr{column("ts"), {Op: pb.ExprOp_INT_LITERAL, IntVal: 3600}}}, {Op: pb.ExprOp_INT_LITERAL, IntVal: 60}},
+	}}
+	timelineResult, ok, _ := table.TimeilneQuery(timelineQuery)
+	assert.True(t, ok)
+	assert.True(t, timelineResult.AggIsFloat)
+	assert.Equal(t, 2, int(timelineResult.Count))
+	for i, group := range timelineResult.TimelineGroups {
+		switch timelineResult.StrIdMap[timelineResult.StrResult[i]] {
+		case "/a":
+			assert.Equal(t, []float64{41}, group.FloatValues)
+		case "/b":
+			assert.Equal(t, []float64{43}, group.FloatValues)
+		}
+	}
+}
@@ -37,3 +37,13 @@ func some[T any](s []T, f func(T) bool) bool {
 	}
 	return false
 }
+
+// Returns the index of the first v in s, -1 if not found.
+func indexOf[T comparable](s []T, v T) int {
+	for i, elem := range s {
+		if elem == v {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"bapi/internal/common"
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+/**
+ * A blockStorage backed by a segment file mapped into memory.
+ *
+ * The numericStores of the embedded basicBlockStorage are views into the mapping instead of
+ * copies on the heap, so filters and `get` read the file directly: the pages are loaded by the
+ * OS on demand and can be evicted under memory pressure. This is used for cold blocks, which are
+ * rarely queried, so only the recent blocks need to stay in memory.
+ *
+ * The mapping is released by a finalizer once the storage is unreachable, so the storage must be
+ * kept alive while its views are read, @see query.
+ * The file is never modified once it's mapped. It may be unlinked (e.g. when the snapshot it
+ * belongs to is replaced), which doesn't affect the mapping.
+ */
+type mmapBlockStorage struct {
+	*basicBlockStorage
+
+	// the segment file, which changes when the file is moved to a new snapshot
+	path string
+	data []byte
+}
+
+// Maps the segment file at the given path.
+func openMmapBlockStorage(path string) (*mmapBlockStorage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() == 0 {
+		return nil, errors.New("segment is too short")
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	bbs, err := decodeSegment(data)
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, err
+	}
+
+	storage := &mmapBlockStorage{
+		basicBlockStorage: bbs,
+		path:              path,
+		data:              data,
+	}
+	runtime.SetFinalizer(storage, func(s *mmapBlockStorage) {
+		syscall.Munmap(s.data)
+	})
+	return storage, nil
+}
+
+// The size of the mapping, which is mostly in the page cache instead of the heap.
+func (s *mmapBlockStorage) size() int {
+	return len(s.data)
+}
+
+func (s *mmapBlockStorage) query(ctx *common.BapiCtx, query *blockQuery) (*BlockQueryResult, bool) {
+	result, ok := s.basicBlockStorage.query(ctx, query)
+	// the results are copies, but the mapping must not be released while it's being read
+	runtime.KeepAlive(s)
+	return result, ok
+}
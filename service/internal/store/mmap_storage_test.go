@@ -0,0 +1,92 @@
+package store
+
+import (
+	"bapi/internal/common"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMmapBlockStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "000000.seg")
+	table, block := debugBuildTableAndBlockFromIngester([]RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607, "count": 1},
+			Str: map[string]string{"event": "init_app"},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175609, "count": 2},
+			Str: map[string]string{"event": "publish", "source": "modal"},
+		},
+	})
+	assert.Nil(t, writeSegment(path, block.storage))
+
+	storage, err := openMmapBlockStorage(path)
+	assert.Nil(t, err)
+	mappedBlock := &Block{minTs: storage.minTs, maxTs: storage.maxTs, rowCount: storage.rowCount, storage: storage}
+
+	query := debugNewQuery(t, table, 1643175607, 1643175609,
+		[]debugBlockFilter[int]{debugGe("count", 1)},
+		[]debugBlockFilter[string]{debugNe("event", "init_app")},
+		[]string{"ts", "count"},
+		[]string{"event", "source"},
+	)
+	ctx := common.NewBapiCtx()
+	expected, _ := block.query(ctx, query)
+	actual, ok := mappedBlock.query(ctx, query)
+	assert.True(t, ok)
+	assert.Equal(t, debugToRawJson(table, query, expected), debugToRawJson(table, query, actual))
+
+	// the segment file of a mapped block is linked instead of being written again
+	linkedPath := filepath.Join(t.TempDir(), "000001.seg")
+	assert.Nil(t, writeSegment(linkedPath, storage))
+	original, _ := os.Stat(path)
+	linked, _ := os.Stat(linkedPath)
+	assert.True(t, os.SameFile(original, linked))
+
+	_, err = openMmapBlockStorage(filepath.Join(t.TempDir(), "missing.seg"))
+	assert.NotNil(t, err)
+}
+
+func TestSnapshotMapsColdBlocks(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "snapshot")
+	recentTs := time.Now().Unix()
+	rows := []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app"},
+		},
+	}
+	recentRows := []RawJson{
+		{
+			Int: map[string]int64{"ts": recentTs, "count": 1},
+			Str: map[string]string{"event": "publish"},
+		},
+	}
+
+	table := NewTable(common.NewBapiCtx(), "asd")
+	debugIngestRows(table, rows)
+	debugIngestRows(table, recentRows)
+	inMemoryTable := NewTable(common.NewBapiCtx(), "asd")
+	debugIngestRows(inMemoryTable, rows)
+	debugIngestRows(inMemoryTable, recentRows)
+
+	assert.Nil(t, table.Snapshot(dir))
+	assert.IsType(t, &mmapBlockStorage{}, table.blocks[0].storage)
+	assert.IsType(t, &basicBlockStorage{}, table.blocks[1].storage)
+	assertTablesEqual(t, inMemoryTable, table)
+
+	// the mapped block is moved to the new snapshot and the old one is removed
+	assert.Nil(t, table.Snapshot(dir))
+	assert.Equal(t, filepath.Join(dir, "000000.seg"), table.blocks[0].storage.(*mmapBlockStorage).path)
+	assertTablesEqual(t, inMemoryTable, table)
+
+	loaded := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, loaded.LoadSnapshot(dir))
+	assert.IsType(t, &mmapBlockStorage{}, loaded.blocks[0].storage)
+	assert.IsType(t, &basicBlockStorage{}, loaded.blocks[1].storage)
+	assertTablesEqual(t, inMemoryTable, loaded)
+}
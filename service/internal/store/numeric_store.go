@@ -3,6 +3,9 @@ package store
 import (
 	"bapi/internal/pb"
 	"errors"
+	"fmt"
+	"sort"
+	"unsafe"
 
 	"github.com/kelindar/bitmap"
 )
@@ -78,6 +81,17 @@ func newNumericStore[T numeric](colCount int, rowCount int) (*numericStore[T], b
 	}, true
 }
 
+// Creates a storage without any column, for a block without any value of the type.
+// The created storage violates invariant #7, but can be queried like a storage whose columns
+// are all missing.
+func newEmptyNumericStore[T numeric]() *numericStore[T] {
+	return &numericStore[T]{
+		matrix:    make([][]valueIndex, 0),
+		values:    make([][]T, 0),
+		columnIds: make(map[columnId]localColumnId),
+	}
+}
+
 // Creates a numericStore from a partialColumns
 // The caller is responsible to make sure that colId and rowId are valid.
 func fromPartialColumns[T numeric](partialColumns partialColumns[T], rowCount int) (*numericStore[T], error) {
@@ -123,6 +137,79 @@ func fromPartialColumns[T numeric](partialColumns partialColumns[T], rowCount in
 	return storage, nil
 }
 
+// A row of the storages being merged: the row of `rowIdx` in the storage of `storeIdx`.
+type mergedRow struct {
+	storeIdx int
+	rowIdx   int
+}
+
+/**
+ * Merges the storages into a new one, whose rows are the given rows in order.
+ * The values are concatenated without de-duplication, so a value seen in multiple storages
+ * shows up multiple times in `values`. The caller is responsible to make sure every row of
+ * the storages is in `rows` exactly once, so the invariants still hold, and that the merged
+ * values fit in valueIndex.
+ */
+func mergeNumericStores[T numeric](stores []*numericStore[T], rows []mergedRow) (*numericStore[T], error) {
+	colIds := make([]columnId, 0)
+	seen := make(map[columnId]bool)
+	for _, store := range stores {
+		for colId := range store.columnIds {
+			if !seen[colId] {
+				seen[colId] = true
+				colIds = append(colIds, colId)
+			}
+		}
+	}
+	// ts col is always the first one, @see fromPartialColumns
+	sort.Slice(colIds, func(i, j int) bool {
+		return colIds[i] < colIds[j]
+	})
+	if len(colIds) == 0 {
+		return newEmptyNumericStore[T](), nil
+	}
+
+	merged, ok := newNumericStore[T](len(colIds), len(rows))
+	if !ok {
+		return nil, errors.New("failed to create numeric storage")
+	}
+
+	for localColId, colId := range colIds {
+		merged.columnIds[colId] = localColumnId(localColId)
+
+		// the values of a storage are appended after the values of the previous storages,
+		// `valueOffsets` is the valueIdx of the null placeholder of each storage after merging
+		values := make([]T, 1)
+		valueOffsets := make([]int, len(stores))
+		for storeIdx, store := range stores {
+			valueOffsets[storeIdx] = len(values) - 1
+			if storeLocalColId, ok := store.columnIds[colId]; ok {
+				values = append(values, store.values[storeLocalColId][1:]...)
+			}
+		}
+		if len(values) > int(^valueIndex(0)) {
+			return nil, fmt.Errorf("too many values to merge: %d", len(values))
+		}
+		merged.values[localColId] = values
+
+		matrix := merged.matrix[localColId]
+		for mergedRowIdx, row := range rows {
+			store := stores[row.storeIdx]
+			storeLocalColId, ok := store.columnIds[colId]
+			if !ok {
+				continue
+			}
+
+			valueIdx := store.matrix[storeLocalColId][row.rowIdx]
+			if valueIdx != nullValueIndex {
+				matrix[mergedRowIdx] = valueIdx + valueIndex(valueOffsets[row.storeIdx])
+			}
+		}
+	}
+
+	return merged, nil
+}
+
 // Gets the local column id
 // The column exist in the storage iff there is at least one row has value in this column.
 func (ns *numericStore[T]) getLocalColumnId(colInfo *ColumnInfo) (localColumnId, bool) {
@@ -272,6 +359,17 @@ func (ns *numericStore[T]) get(
 	return result, resultValues
 }
 
+// Returns the number of bytes used by the matrix and the values.
+func (ns *numericStore[T]) size() int {
+	var zero T
+	size := 0
+	for localColId := range ns.matrix {
+		size += len(ns.matrix[localColId]) * int(unsafe.Sizeof(nullValueIndex))
+		size += len(ns.values[localColId]) * int(unsafe.Sizeof(zero))
+	}
+	return size
+}
+
 // Returns true if the invariants hold
 // @see numericStore struct comment for details
 func (ns *numericStore[T]) debugInvariantCheck() error {
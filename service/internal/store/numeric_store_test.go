@@ -89,6 +89,47 @@ func TestFromPartialColumns(t *testing.T) {
 	assertNumericStoreMatchRows(t, rows, ns, 10)
 }
 
+func TestMergeNumericStores(t *testing.T) {
+	left, _ := fromPartialColumns(debugNewPartialColumns(debugRows[int64]{
+		0: {
+			debugNewDebugPair(columnId(22), int64(15)),
+			debugNewDebugPair(columnId(23), int64(16)),
+		},
+		1: {
+			debugNewDebugPair(columnId(22), int64(19)),
+		},
+	}), 2 /*rowCount*/)
+	right, _ := fromPartialColumns(debugNewPartialColumns(debugRows[int64]{
+		0: {
+			debugNewDebugPair(columnId(22), int64(15)),
+			debugNewDebugPair(columnId(28), int64(20)),
+		},
+	}), 1 /*rowCount*/)
+
+	ns, err := mergeNumericStores([]*numericStore[int64]{left, right}, []mergedRow{
+		{storeIdx: 1, rowIdx: 0},
+		{storeIdx: 0, rowIdx: 1},
+		{storeIdx: 0, rowIdx: 0},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, ns.debugInvariantCheck(), "storage: %v", ns)
+	assertNumericStoreMatchRows(t, debugRows[int64]{
+		0: {
+			debugNewDebugPair(columnId(22), int64(15)),
+			debugNewDebugPair(columnId(28), int64(20)),
+		},
+		1: {
+			debugNewDebugPair(columnId(22), int64(19)),
+		},
+		2: {
+			debugNewDebugPair(columnId(22), int64(15)),
+			debugNewDebugPair(columnId(23), int64(16)),
+		},
+	}, ns, 3)
+	// the values are not de-duplicated
+	assert.Equal(t, 4, len(ns.values[ns.columnIds[columnId(22)]]))
+}
+
 type debugFilter[T comparable] struct {
 	colId columnId
 	op    pb.FilterOp
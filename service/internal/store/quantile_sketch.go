@@ -0,0 +1,147 @@
+package store
+
+import (
+	"math"
+	"sort"
+)
+
+// The relative error of the quantiles estimated by the sketches of the PERCENTILE aggregation
+const sketchRelativeAccuracy = 0.01
+
+// The values whose absolute value is smaller than this are counted as 0
+const sketchMinIndexableValue = 1e-9
+
+/**
+ * A DDSketch (https://arxiv.org/abs/1908.10693) estimating the quantiles of the added values,
+ * whose relative error is at most the relativeAccuracy.
+ *
+ * The values are counted in buckets whose bounds grow exponentially by gamma, i.e. a positive
+ * value v is in the bucket ceil(log_gamma(v)), and the negative values are bucketed by their
+ * absolute value. Since the buckets only depend on gamma, the sketches of the same accuracy are
+ * merged by adding up the counts of the buckets.
+ * The non finite values are ignored.
+ */
+type quantileSketch struct {
+	gamma     float64
+	logGamma  float64
+	positives map[int]int64
+	negatives map[int]int64
+	zeroCount int64
+	count     int64
+	// the estimations are clamped to the actual min and max
+	min float64
+	max float64
+}
+
+func newQuantileSketch(relativeAccuracy float64) *quantileSketch {
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &quantileSketch{
+		gamma:     gamma,
+		logGamma:  math.Log(gamma),
+		positives: make(map[int]int64),
+		negatives: make(map[int]int64),
+	}
+}
+
+func (s *quantileSketch) add(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+
+	switch {
+	case v > sketchMinIndexableValue:
+		s.positives[s.index(v)]++
+	case v < -sketchMinIndexableValue:
+		s.negatives[s.index(-v)]++
+	default:
+		s.zeroCount++
+	}
+
+	if s.count == 0 {
+		s.min, s.max = v, v
+	} else {
+		s.min = min(s.min, v)
+		s.max = max(s.max, v)
+	}
+	s.count++
+}
+
+// The other sketch is expected to have the same relativeAccuracy.
+func (s *quantileSketch) merge(other *quantileSketch) {
+	if other.count == 0 {
+		return
+	}
+
+	for index, count := range other.positives {
+		s.positives[index] += count
+	}
+	for index, count := range other.negatives {
+		s.negatives[index] += count
+	}
+	s.zeroCount += other.zeroCount
+
+	if s.count == 0 {
+		s.min, s.max = other.min, other.max
+	} else {
+		s.min = min(s.min, other.min)
+		s.max = max(s.max, other.max)
+	}
+	s.count += other.count
+}
+
+// Returns the estimated value at the quantile q in [0, 1], false if the sketch is empty.
+func (s *quantileSketch) quantile(q float64) (float64, bool) {
+	if s.count == 0 {
+		return 0, false
+	}
+
+	// the 0-based rank of the value in the sorted values
+	rank := int64(q * float64(s.count-1))
+	seen := int64(0)
+
+	// the negative values from the smallest, i.e. the largest absolute value
+	negIndexes := sortedBucketIndexes(s.negatives)
+	for i := len(negIndexes) - 1; i >= 0; i-- {
+		seen += s.negatives[negIndexes[i]]
+		if seen > rank {
+			return s.clamp(-s.value(negIndexes[i])), true
+		}
+	}
+
+	seen += s.zeroCount
+	if seen > rank {
+		return s.clamp(0), true
+	}
+
+	posIndexes := sortedBucketIndexes(s.positives)
+	for _, index := range posIndexes {
+		seen += s.positives[index]
+		if seen > rank {
+			return s.clamp(s.value(index)), true
+		}
+	}
+	return s.max, true
+}
+
+// --------------------------- internal ----------------------------
+func (s *quantileSketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// The value of the bucket whose relative error to any value of the bucket is the smallest.
+func (s *quantileSketch) value(index int) float64 {
+	return 2 * math.Pow(s.gamma, float64(index)) / (s.gamma + 1)
+}
+
+func (s *quantileSketch) clamp(v float64) float64 {
+	return max(s.min, min(s.max, v))
+}
+
+func sortedBucketIndexes(buckets map[int]int64) []int {
+	indexes := make([]int, 0, len(buckets))
+	for index := range buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuantileSketch(t *testing.T) {
+	sketch := newQuantileSketch(sketchRelativeAccuracy)
+	_, ok := sketch.quantile(0.5)
+	assert.False(t, ok)
+
+	// 1..1000 split into 2 sketches, which are merged
+	other := newQuantileSketch(sketchRelativeAccuracy)
+	for v := 1; v <= 1000; v++ {
+		if v%2 == 0 {
+			sketch.add(float64(v))
+		} else {
+			other.add(float64(v))
+		}
+	}
+	sketch.merge(other)
+	sketch.merge(newQuantileSketch(sketchRelativeAccuracy))
+
+	for _, q := range []float64{0.01, 0.5, 0.9, 0.95, 0.99} {
+		// the value of the rank, i.e. the index in the sorted values
+		expected := float64(1 + int(q*999))
+		actual, ok := sketch.quantile(q)
+		assert.True(t, ok)
+		assert.InEpsilon(t, expected, actual, sketchRelativeAccuracy, "quantile %v", q)
+	}
+
+	// the min and max are exact
+	actual, _ := sketch.quantile(0)
+	assert.Equal(t, 1.0, actual)
+	actual, _ = sketch.quantile(1)
+	assert.Equal(t, 1000.0, actual)
+}
+
+func TestQuantileSketchNegativeAndZero(t *testing.T) {
+	sketch := newQuantileSketch(sketchRelativeAccuracy)
+	for _, v := range []float64{-100, -10, 0, 0, 10, 100, math.NaN(), math.Inf(1)} {
+		sketch.add(v)
+	}
+	assert.Equal(t, int64(6), sketch.count)
+
+	actual, _ := sketch.quantile(0)
+	assert.Equal(t, -100.0, actual)
+	actual, _ = sketch.quantile(0.2)
+	assert.InEpsilon(t, -10.0, actual, sketchRelativeAccuracy)
+	actual, _ = sketch.quantile(0.5)
+	assert.Equal(t, 0.0, actual)
+	actual, _ = sketch.quantile(0.8)
+	assert.InEpsilon(t, 10.0, actual, sketchRelativeAccuracy)
+}
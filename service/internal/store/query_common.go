@@ -11,22 +11,47 @@ type columnFilter[T comparable] struct {
 	col    *ColumnInfo
 	op     pb.FilterOp
 	values []T
+	// for the pattern ops of the str filters: the set of the strs matching the pattern instead of
+	// the values, @see Table.newColumnFilters
+	valueSet map[T]bool
+}
+
+// The filters of the columns of each type, which are ANDed together.
+type columnFilters struct {
+	intFilters   []columnFilter[int64]
+	strFilters   []columnFilter[strId]
+	floatFilters []columnFilter[float64]
+	boolFilters  []columnFilter[uint8]
+	// the values are the strs of the set columns
+	strSetFilters []columnFilter[strId]
+}
+
+/**
+ * A tree of filters, @see pb.FilterExpr.
+ * A leaf has the columnFilters of a single filter, AND/OR have at least one child and NOT has
+ * exactly one, which are validated when it's built.
+ */
+type filterExpr struct {
+	op       pb.FilterExprOp
+	leaf     columnFilters
+	children []*filterExpr
 }
 
 type blockFilter struct {
-	minTs      int64
-	maxTs      int64
-	tsFilters  []columnFilter[int64]
-	intFilters []columnFilter[int64]
-	strFilters []columnFilter[strId]
+	minTs     int64
+	maxTs     int64
+	tsFilters []columnFilter[int64]
+	columnFilters
+	// ANDed with the columnFilters, nil if the query has none
+	expr *filterExpr
 }
 
 func newBlockFilter(
 	minTs int64,
 	maxTs int64,
 	tsColInfo *ColumnInfo,
-	intFilters []columnFilter[int64],
-	strFilters []columnFilter[strId],
+	columnFilters columnFilters,
+	expr *filterExpr,
 ) blockFilter {
 	return blockFilter{
 		minTs: minTs,
@@ -43,15 +68,20 @@ func newBlockFilter(
 				values: []int64{maxTs},
 			},
 		},
-		intFilters: intFilters,
-		strFilters: strFilters,
+		columnFilters: columnFilters,
+		expr:          expr,
 	}
 }
 
 type blockQuery struct {
-	filter     blockFilter
-	intColumns []*ColumnInfo
-	strColumns []*ColumnInfo
+	filter        blockFilter
+	intColumns    []*ColumnInfo
+	strColumns    []*ColumnInfo
+	floatColumns  []*ColumnInfo
+	boolColumns   []*ColumnInfo
+	strSetColumns []*ColumnInfo
+	// maps the results to the columns of the query if it has computed columns, nil otherwise
+	projection *computedProjection
 }
 
 type IntResult struct {
@@ -65,10 +95,30 @@ type StrResult struct {
 	hasValue [][]bool
 }
 
+type FloatResult struct {
+	matrix   [][]float64
+	hasValue [][]bool
+}
+
+type BoolResult struct {
+	matrix   [][]bool
+	hasValue [][]bool
+}
+
+// matrix[colIdx][rowIdx] is the sorted strIds of the set
+type StrSetResult struct {
+	strIdSet map[strId]bool
+	matrix   [][][]strId
+	hasValue [][]bool
+}
+
 type BlockQueryResult struct {
-	Count     int
-	IntResult IntResult
-	StrResult StrResult
+	Count        int
+	IntResult    IntResult
+	StrResult    StrResult
+	FloatResult  FloatResult
+	BoolResult   BoolResult
+	StrSetResult StrSetResult
 }
 
 // --------------------------- internal ----------------------------
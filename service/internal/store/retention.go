@@ -0,0 +1,68 @@
+package store
+
+import (
+	"time"
+)
+
+// Sets how long the rows are kept, 0 for keeping them forever.
+func (t *Table) SetRetention(retention time.Duration) {
+	t.tableInfo.retention.Store(retention)
+}
+
+func (t *Table) GetRetention() time.Duration {
+	return t.tableInfo.retention.Load()
+}
+
+/**
+ * Drops the blocks whose maxTs is before `now - retention`, so all their rows are expired.
+ * Blocks with both expired and unexpired rows are kept until all their rows are expired.
+ * Called periodically by the table. Returns the number of rows and bytes reclaimed.
+ */
+func (t *Table) ApplyRetention(now time.Time) (int, int) {
+	retention := t.GetRetention()
+	if retention <= 0 {
+		return 0, 0
+	}
+	cutoffTs := now.Add(-retention).Unix()
+
+	t.blocksLock.Lock()
+	defer func() {
+		t.blocksLock.Unlock()
+	}()
+
+	reclaimedRows := 0
+	reclaimedBytes := 0
+	blocks := make([]*Block, 0, len(t.blocks))
+	for _, block := range t.blocks {
+		if block.maxTs >= cutoffTs {
+			blocks = append(blocks, block)
+			continue
+		}
+
+		reclaimedRows += block.rowCount
+		reclaimedBytes += block.storage.size()
+	}
+	if reclaimedRows == 0 {
+		return 0, 0
+	}
+
+	// blocks are sorted by minTs
+	t.blocks = blocks
+	t.tableInfo.rowCount.Sub(uint32(reclaimedRows))
+	if len(blocks) == 0 {
+		t.tableInfo.minTs.Store(initialMinTs)
+		t.tableInfo.maxTs.Store(initialMaxTs)
+	} else {
+		t.tableInfo.minTs.Store(blocks[0].minTs)
+		maxTs := blocks[0].maxTs
+		for _, block := range blocks {
+			maxTs = max(maxTs, block.maxTs)
+		}
+		t.tableInfo.maxTs.Store(maxTs)
+	}
+
+	t.tableInfo.reclaimedRows.Add(uint64(reclaimedRows))
+	t.tableInfo.reclaimedBytes.Add(uint64(reclaimedBytes))
+	t.ctx.Logger.Infof("dropped %d expired rows (%d bytes) from table %s", reclaimedRows, reclaimedBytes, t.tableInfo.name)
+	return reclaimedRows, reclaimedBytes
+}
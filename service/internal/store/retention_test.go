@@ -0,0 +1,80 @@
+package store
+
+import (
+	"bapi/internal/common"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyRetention(t *testing.T) {
+	table := NewTable(common.NewBapiCtx(), "asd")
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app"},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175609},
+			Str: map[string]string{"event": "publish"},
+		},
+	})
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175608},
+			Str: map[string]string{"event": "init_app"},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175700},
+			Str: map[string]string{"event": "publish"},
+		},
+	})
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175800},
+			Str: map[string]string{"event": "create"},
+		},
+	})
+	firstBlockSize := table.blocks[0].storage.size()
+	assert.Greater(t, firstBlockSize, 0)
+
+	// keeps all the rows without a retention
+	now := time.Unix(1643175810, 0)
+	rows, bytes := table.ApplyRetention(now)
+	assert.Equal(t, 0, rows)
+	assert.Equal(t, 0, bytes)
+
+	// the second block has an expired row but is kept until all its rows are expired
+	table.SetRetention(150 * time.Second)
+	rows, bytes = table.ApplyRetention(now)
+	assert.Equal(t, 2, rows)
+	assert.Equal(t, firstBlockSize, bytes)
+
+	tableInfo := table.GetTableInfo()
+	assert.Equal(t, int64(3), tableInfo.RowCount)
+	assert.Equal(t, int64(1643175608), tableInfo.MinTs)
+	assert.Equal(t, int64(1643175800), tableInfo.MaxTs)
+	assert.Equal(t, int64(150), tableInfo.RetentionSeconds)
+	assert.Equal(t, int64(2), tableInfo.ReclaimedRows)
+	assert.Equal(t, int64(firstBlockSize), tableInfo.ReclaimedBytes)
+
+	// the rows can be ingested again after all the rows are dropped
+	rows, _ = table.ApplyRetention(now.Add(time.Hour))
+	assert.Equal(t, 3, rows)
+	tableInfo = table.GetTableInfo()
+	assert.Equal(t, int64(0), tableInfo.RowCount)
+	assert.Equal(t, int64(5), tableInfo.ReclaimedRows)
+	assert.Equal(t, 0, len(table.blocks))
+
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175900},
+			Str: map[string]string{"event": "create"},
+		},
+	})
+	tableInfo = table.GetTableInfo()
+	assert.Equal(t, int64(1), tableInfo.RowCount)
+	assert.Equal(t, int64(1643175900), tableInfo.MinTs)
+	assert.Equal(t, int64(1643175900), tableInfo.MaxTs)
+}
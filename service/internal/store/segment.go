@@ -0,0 +1,299 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"unsafe"
+)
+
+var segmentMagic = []byte("BAPISEG\x03")
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+const segmentHeaderSize = 16 // segmentMagic + uint32 crc32c of the body + uint32 reserved
+const segmentAlignment = 8
+
+/**
+ * The on-disk format of a sealed block.
+ *
+ * All integers are little endian and every array starts at an offset aligned to 8 bytes,
+ * so a segment loaded into (or mapped to) memory can be used in place: the `matrix` and
+ * `values` of the numericStores are views into the segment instead of copies.
+ *
+ * Layout:
+ * 	header: segmentMagic, uint32 crc32c of the body, uint32 reserved
+ * 	body:
+ * 		int64 minTs, int64 maxTs, uint64 rowCount
+ * 		numericStore section of the int columns
+ * 		numericStore section of the str columns
+ * 		numericStore section of the float columns
+ * 		uint64 strCount, [strCount]uint32 the strIdSet of the block, padding
+ * 		numericStore section of the bool columns
+ * 		numericStore section of the str set columns
+ * 		uint64 offsetCount, [offsetCount]uint32 setOffsets, padding
+ * 		uint64 setStrIdCount, [setStrIdCount]uint32 setStrIds, padding
+ *
+ * 	numericStore section:
+ * 		uint64 colCount
+ * 		[colCount](uint64 columnId, uint64 valueCount), in the order of localColumnId
+ * 		for each local column: [valueCount]T values, padding, [rowCount]uint16 matrix, padding
+ */
+func encodeSegment(bbs *basicBlockStorage) []byte {
+	e := newEncoder()
+	e.buf = append(e.buf, segmentMagic...)
+	e.putUint32(0) // crc32c, filled in at the end
+	e.putUint32(0) // reserved
+
+	e.putUint64(uint64(bbs.minTs))
+	e.putUint64(uint64(bbs.maxTs))
+	e.putUint64(uint64(bbs.rowCount))
+	encodeNumericStore(e, &bbs.intColsStorage.numericStore)
+	encodeNumericStore(e, &bbs.strColsStorage.numericStore)
+	encodeNumericStore(e, &bbs.floatColsStorage.numericStore)
+
+	strIds := make([]strId, 0, len(bbs.strColsStorage.strIdSet))
+	for sid := range bbs.strColsStorage.strIdSet {
+		strIds = append(strIds, sid)
+	}
+	e.putUint64(uint64(len(strIds)))
+	putFixedSlice(e, strIds)
+
+	encodeNumericStore(e, &bbs.boolColsStorage.numericStore)
+	encodeNumericStore(e, &bbs.strSetColsStorage.numericStore)
+	e.putUint64(uint64(len(bbs.strSetColsStorage.setOffsets)))
+	putFixedSlice(e, bbs.strSetColsStorage.setOffsets)
+	e.putUint64(uint64(len(bbs.strSetColsStorage.setStrIds)))
+	putFixedSlice(e, bbs.strSetColsStorage.setStrIds)
+
+	buf := e.bytes()
+	binary.LittleEndian.PutUint32(buf[len(segmentMagic):], crc32.Checksum(buf[segmentHeaderSize:], crc32cTable))
+	return buf
+}
+
+// Rebuilds the storage of a block from a segment. The storage references the given buffer
+// (unless the host is big endian), so the buffer must not be modified afterward.
+func decodeSegment(buf []byte) (*basicBlockStorage, error) {
+	if len(buf) < segmentHeaderSize {
+		return nil, errors.New("segment is too short")
+	}
+	if !bytes.Equal(buf[:len(segmentMagic)], segmentMagic) {
+		return nil, errors.New("not a segment or unsupported segment version")
+	}
+	checksum := binary.LittleEndian.Uint32(buf[len(segmentMagic):])
+	if crc32.Checksum(buf[segmentHeaderSize:], crc32cTable) != checksum {
+		return nil, errors.New("segment checksum mismatch")
+	}
+
+	d := newDecoder(buf)
+	d.offset = segmentHeaderSize
+
+	bbs := &basicBlockStorage{}
+	bbs.minTs = int64(d.uint64())
+	bbs.maxTs = int64(d.uint64())
+	bbs.rowCount = fixedLength(d)
+
+	intStore := decodeNumericStore[int64](d, bbs.rowCount)
+	strStore := decodeNumericStore[strId](d, bbs.rowCount)
+	floatStore := decodeNumericStore[float64](d, bbs.rowCount)
+	strIds := fixedSlice[strId](d, fixedLength(d))
+	boolStore := decodeNumericStore[uint8](d, bbs.rowCount)
+	strSetStore := decodeNumericStore[uint32](d, bbs.rowCount)
+	setOffsets := fixedSlice[uint32](d, fixedLength(d))
+	setStrIds := fixedSlice[strId](d, fixedLength(d))
+	if d.err() != nil {
+		return nil, d.err()
+	}
+	if d.remaining() != 0 {
+		return nil, fmt.Errorf("segment has %d unexpected trailing bytes", d.remaining())
+	}
+
+	strIdSet := make(map[strId]bool, len(strIds))
+	for _, sid := range strIds {
+		strIdSet[sid] = true
+	}
+
+	if !isValidStrSetTable(strSetStore, setOffsets, len(setStrIds)) {
+		return nil, errCorrupted
+	}
+
+	if tsLocalColId, hasTs := intStore.columnIds[columnId(TS_COLUMN_ID)]; !hasTs || tsLocalColId != 0 || bbs.rowCount == 0 {
+		return nil, errors.New("segment has no rows or is missing ts")
+	}
+
+	bbs.intColsStorage = &intColumnsStorage{numericStore: *intStore}
+	bbs.strColsStorage = &strColumnsStorage{numericStore: *strStore, strIdSet: strIdSet}
+	bbs.floatColsStorage = &floatColumnsStorage{numericStore: *floatStore}
+	bbs.boolColsStorage = &boolColumnsStorage{numericStore: *boolStore}
+	bbs.strSetColsStorage = &strSetColumnsStorage{
+		numericStore: *strSetStore,
+		setOffsets:   setOffsets,
+		setStrIds:    setStrIds,
+	}
+	return bbs, nil
+}
+
+// The set indexes and offsets are used as indexes into the set table, so they have to be validated.
+func isValidStrSetTable(ns *numericStore[uint32], setOffsets []uint32, setStrIdCount int) bool {
+	if len(setOffsets) == 0 || setOffsets[0] != 0 || int(setOffsets[len(setOffsets)-1]) != setStrIdCount {
+		return false
+	}
+	for i := 1; i < len(setOffsets); i++ {
+		if setOffsets[i] < setOffsets[i-1] {
+			return false
+		}
+	}
+
+	setCount := len(setOffsets) - 1
+	return every(ns.values, func(setIdxes []uint32) bool {
+		return every(setIdxes, func(setIdx uint32) bool { return int(setIdx) < setCount })
+	})
+}
+
+func encodeNumericStore[T numeric](e *encoder, ns *numericStore[T]) {
+	localColIds := make([]columnId, len(ns.columnIds))
+	for colId, localColId := range ns.columnIds {
+		localColIds[localColId] = colId
+	}
+
+	e.putUint64(uint64(len(localColIds)))
+	for localColId, colId := range localColIds {
+		e.putUint64(uint64(colId))
+		e.putUint64(uint64(len(ns.values[localColId])))
+	}
+
+	for localColId := range localColIds {
+		putFixedSlice(e, ns.values[localColId])
+		putFixedSlice(e, ns.matrix[localColId])
+	}
+}
+
+func decodeNumericStore[T numeric](d *decoder, rowCount int) *numericStore[T] {
+	colCount := fixedLength(d)
+	ns := &numericStore[T]{
+		matrix:    make([][]valueIndex, colCount),
+		values:    make([][]T, colCount),
+		columnIds: make(map[columnId]localColumnId, colCount),
+	}
+
+	valueCounts := make([]int, colCount)
+	for localColId := 0; localColId < colCount; localColId++ {
+		ns.columnIds[columnId(d.uint64())] = localColumnId(localColId)
+		valueCounts[localColId] = fixedLength(d)
+	}
+	if len(ns.columnIds) != colCount {
+		d.e = errCorrupted
+	}
+
+	for localColId := 0; localColId < colCount && d.err() == nil; localColId++ {
+		ns.values[localColId] = fixedSlice[T](d, valueCounts[localColId])
+		ns.matrix[localColId] = fixedSlice[valueIndex](d, rowCount)
+
+		// the matrix is used as index into values, so it has to be validated
+		valueCount := len(ns.values[localColId])
+		for _, valueIdx := range ns.matrix[localColId] {
+			if int(valueIdx) >= valueCount {
+				d.e = errCorrupted
+				break
+			}
+		}
+	}
+
+	return ns
+}
+
+// --------------------------- fixed size arrays ----------------------------
+var nativeLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// Reads a uint64 length, which is bounded by the remaining bytes like decoder.length.
+func fixedLength(d *decoder) int {
+	size := d.uint64()
+	if size > uint64(d.remaining()) {
+		d.e = errCorrupted
+		return 0
+	}
+	return int(size)
+}
+
+// Writes the values in little endian followed by the padding for alignment.
+func putFixedSlice[T numeric](e *encoder, values []T) {
+	var zero T
+	size := int(unsafe.Sizeof(zero))
+	if nativeLittleEndian && len(values) > 0 {
+		e.buf = append(e.buf, unsafe.Slice((*byte)(unsafe.Pointer(&values[0])), len(values)*size)...)
+	} else {
+		for _, v := range values {
+			e.buf = appendFixed(e.buf, v)
+		}
+	}
+
+	for len(e.buf)%segmentAlignment != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// Reads `count` values written by putFixedSlice. When possible, returns a view into the
+// buffer of the decoder instead of a copy.
+func fixedSlice[T numeric](d *decoder, count int) []T {
+	var zero T
+	size := int(unsafe.Sizeof(zero))
+	if count > d.remaining()/size {
+		d.e = errCorrupted
+		return nil
+	}
+
+	b, ok := d.next(count * size)
+	if !ok {
+		return nil
+	}
+	for d.offset%segmentAlignment != 0 && d.err() == nil {
+		d.next(1)
+	}
+
+	if count == 0 {
+		return make([]T, 0)
+	}
+	if nativeLittleEndian && uintptr(unsafe.Pointer(&b[0]))%uintptr(size) == 0 {
+		return unsafe.Slice((*T)(unsafe.Pointer(&b[0])), count)
+	}
+
+	values := make([]T, count)
+	for i := range values {
+		values[i] = readFixed[T](b[i*size:])
+	}
+	return values
+}
+
+func appendFixed[T numeric](buf []byte, v T) []byte {
+	var b [8]byte
+	switch unsafe.Sizeof(v) {
+	case 1:
+		b[0] = *(*uint8)(unsafe.Pointer(&v))
+	case 2:
+		binary.LittleEndian.PutUint16(b[:], *(*uint16)(unsafe.Pointer(&v)))
+	case 4:
+		binary.LittleEndian.PutUint32(b[:], *(*uint32)(unsafe.Pointer(&v)))
+	case 8:
+		binary.LittleEndian.PutUint64(b[:], *(*uint64)(unsafe.Pointer(&v)))
+	}
+	return append(buf, b[:unsafe.Sizeof(v)]...)
+}
+
+func readFixed[T numeric](b []byte) T {
+	var v T
+	switch unsafe.Sizeof(v) {
+	case 1:
+		*(*uint8)(unsafe.Pointer(&v)) = b[0]
+	case 2:
+		*(*uint16)(unsafe.Pointer(&v)) = binary.LittleEndian.Uint16(b)
+	case 4:
+		*(*uint32)(unsafe.Pointer(&v)) = binary.LittleEndian.Uint32(b)
+	case 8:
+		*(*uint64)(unsafe.Pointer(&v)) = binary.LittleEndian.Uint64(b)
+	}
+	return v
+}
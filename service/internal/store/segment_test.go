@@ -0,0 +1,111 @@
+package store
+
+import (
+	"bapi/internal/common"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentRoundTrip(t *testing.T) {
+	table, block := debugBuildTableAndBlockFromIngester([]RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607, "event_index": 12},
+			Str: map[string]string{"event": "init_app"},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175609, "count": -1},
+			Str: map[string]string{"event": "publish"},
+		},
+		{
+			Int:   map[string]int64{"ts": 1643175611, "count": 2},
+			Str:   map[string]string{"event": "create", "source": "toolbar"},
+			Float: map[string]float64{"latency": 0.25},
+		},
+		{
+			Int:    map[string]int64{"ts": 1643175612},
+			Bool:   map[string]bool{"logged_in": true},
+			StrSet: map[string][]string{"tags": {"a", "b"}},
+		},
+	})
+	storage := block.storage.(*basicBlockStorage)
+
+	decoded, err := decodeSegment(encodeSegment(storage))
+	assert.Nil(t, err)
+	assert.Equal(t, storage.minTs, decoded.minTs)
+	assert.Equal(t, storage.maxTs, decoded.maxTs)
+	assert.Equal(t, storage.rowCount, decoded.rowCount)
+	assert.Equal(t, storage.intColsStorage.columnIds, decoded.intColsStorage.columnIds)
+	assert.Equal(t, storage.intColsStorage.matrix, decoded.intColsStorage.matrix)
+	assert.Equal(t, storage.intColsStorage.values, decoded.intColsStorage.values)
+	assert.Equal(t, storage.strColsStorage.columnIds, decoded.strColsStorage.columnIds)
+	assert.Equal(t, storage.strColsStorage.matrix, decoded.strColsStorage.matrix)
+	assert.Equal(t, storage.strColsStorage.values, decoded.strColsStorage.values)
+	assert.Equal(t, storage.strColsStorage.strIdSet, decoded.strColsStorage.strIdSet)
+	assert.Equal(t, storage.floatColsStorage.columnIds, decoded.floatColsStorage.columnIds)
+	assert.Equal(t, storage.floatColsStorage.matrix, decoded.floatColsStorage.matrix)
+	assert.Equal(t, storage.floatColsStorage.values, decoded.floatColsStorage.values)
+	assert.Equal(t, storage.boolColsStorage.numericStore, decoded.boolColsStorage.numericStore)
+	assert.Equal(t, storage.strSetColsStorage.numericStore, decoded.strSetColsStorage.numericStore)
+	assert.Equal(t, storage.strSetColsStorage.setOffsets, decoded.strSetColsStorage.setOffsets)
+	assert.Equal(t, storage.strSetColsStorage.setStrIds, decoded.strSetColsStorage.setStrIds)
+	assert.Nil(t, decoded.intColsStorage.debugInvariantCheck())
+	assert.Nil(t, decoded.strColsStorage.debugInvariantCheck())
+	assert.Nil(t, decoded.floatColsStorage.debugInvariantCheck())
+
+	// the decoded storage can be queried the same way
+	decodedBlock := &Block{minTs: decoded.minTs, maxTs: decoded.maxTs, rowCount: decoded.rowCount, storage: decoded}
+	query := debugNewQuery(t, table, 1643175607, 1643175611,
+		[]debugBlockFilter[int]{debugGt("count", 0)},
+		[]debugBlockFilter[string]{debugNe("event", "publish")},
+		[]string{"ts", "count", "event_index"},
+		[]string{"event", "source"},
+	)
+	ctx := common.NewBapiCtx()
+	expected, _ := block.query(ctx, query)
+	actual, _ := decodedBlock.query(ctx, query)
+	assert.Equal(t, debugToRawJson(table, query, expected), debugToRawJson(table, query, actual))
+}
+
+func TestSegmentCorruption(t *testing.T) {
+	_, block := debugBuildTableAndBlockFromIngester([]RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app"},
+		},
+	})
+	segment := encodeSegment(block.storage.(*basicBlockStorage))
+
+	_, err := decodeSegment(segment[:len(segment)-8])
+	assert.NotNil(t, err)
+
+	flipped := append([]byte{}, segment...)
+	flipped[len(flipped)-8] ^= 1
+	_, err = decodeSegment(flipped)
+	assert.NotNil(t, err)
+
+	unknownVersion := append([]byte{}, segment...)
+	unknownVersion[len(segmentMagic)-1] = 0xFF
+	_, err = decodeSegment(unknownVersion)
+	assert.NotNil(t, err)
+}
+
+func TestFixedSlice(t *testing.T) {
+	e := newEncoder()
+	putFixedSlice(e, []int64{-1, 2, 1 << 40})
+	putFixedSlice(e, []uint16{3})
+	putFixedSlice(e, []strId{})
+	putFixedSlice(e, []float64{1.5})
+	assert.Equal(t, 0, len(e.bytes())%segmentAlignment)
+
+	d := newDecoder(e.bytes())
+	assert.Equal(t, []int64{-1, 2, 1 << 40}, fixedSlice[int64](d, 3))
+	assert.Equal(t, []uint16{3}, fixedSlice[uint16](d, 1))
+	assert.Equal(t, []strId{}, fixedSlice[strId](d, 0))
+	assert.Equal(t, []float64{1.5}, fixedSlice[float64](d, 1))
+	assert.Nil(t, d.err())
+	assert.Equal(t, 0, d.remaining())
+
+	assert.Equal(t, int64(-7), readFixed[int64](appendFixed(nil, int64(-7))))
+	assert.Equal(t, strId(9), readFixed[strId](appendFixed(nil, strId(9))))
+}
@@ -0,0 +1,377 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var snapshotMagic = []byte("BAPISNP\x02")
+
+const snapshotMetaFileName = "meta"
+const snapshotHeaderSize = 12 // snapshotMagic + uint32 crc32c of the payload
+
+/**
+ * A snapshot of a table is a directory of:
+ * 	meta: the walPosition covered by the snapshot, the colInfoStore and the string dictionaries,
+ * 		so the column ids and string ids used in the segments stay valid.
+ * 	<idx>.seg: one segment per block, @see segment.go. Cold blocks are mapped from these files.
+ *
+ * A new snapshot is written to `<dir>.tmp` then swapped with the existing one, so there is
+ * always a complete snapshot on disk: either `<dir>` or, if the server crashed in the middle
+ * of the swap, `<dir>.old`.
+ */
+type snapshotMeta struct {
+	walPosition  walPosition
+	columns      []*ColumnInfo
+	strs         []snapshotStr
+	segmentFiles []string
+}
+
+type snapshotStr struct {
+	colId columnId
+	id    strId
+	str   string
+}
+
+/**
+ * Persists the blocks of the table to the given directory.
+ * Pending partialBlocks are flushed first. Ingestion is paused while the snapshot is written,
+ * so the snapshot together with the wal after it contain every row exactly once. The wal is
+ * reset afterward.
+ * The cold blocks are switched to the segment files of the snapshot, @see mmapBlockStorage.
+ */
+func (t *Table) Snapshot(dir string) error {
+	t.ingestLock.Lock()
+	defer func() {
+		t.ingestLock.Unlock()
+	}()
+
+	if t.closed {
+		return errors.New("cannot snapshot a closed table")
+	}
+	t.flushPartialBlocks()
+
+	t.blocksLock.RLock()
+	blocks := make([]*Block, len(t.blocks))
+	copy(blocks, t.blocks)
+	t.blocksLock.RUnlock()
+
+	meta := &snapshotMeta{
+		columns:      make([]*ColumnInfo, 0),
+		strs:         make([]snapshotStr, 0),
+		segmentFiles: make([]string, 0, len(blocks)),
+	}
+	if t.wal != nil {
+		meta.walPosition = t.wal.position()
+	}
+	for _, columns := range t.colInfoMap.getColumns() {
+		meta.columns = append(meta.columns, columns...)
+	}
+	t.strStore.forEachStr(func(id strId, str string, colId columnId) {
+		meta.strs = append(meta.strs, snapshotStr{colId: colId, id: id, str: str})
+	})
+
+	tmpDir := dir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+
+	for idx, block := range blocks {
+		fileName := fmt.Sprintf("%06d.seg", idx)
+		if err := writeSegment(filepath.Join(tmpDir, fileName), block.storage); err != nil {
+			return err
+		}
+		meta.segmentFiles = append(meta.segmentFiles, fileName)
+	}
+
+	if err := writeFileAndSync(filepath.Join(tmpDir, snapshotMetaFileName), encodeSnapshotMeta(meta)); err != nil {
+		return err
+	}
+
+	if err := swapSnapshotDir(dir, tmpDir); err != nil {
+		return err
+	}
+
+	t.ctx.Logger.Infof("snapshotted %d blocks to %s", len(blocks), dir)
+	t.mapColdBlocks(dir, blocks, meta.segmentFiles)
+	if t.wal != nil {
+		if err := t.wal.reset(); err != nil {
+			return err
+		}
+	}
+
+	// no record in the wal refers to the removed strings anymore
+	t.strStore.releaseStrIds(t.pendingFreeStrIds)
+	t.pendingFreeStrIds = make(map[strId]bool)
+	return nil
+}
+
+/**
+ * Loads the blocks, columns and strings from a snapshot written by `Snapshot`.
+ * Should be called right after the table is created and before `OpenWal`, so that only the
+ * records after the snapshot are replayed from the wal.
+ * Returns an error wrapping os.ErrNotExist if there is no snapshot in the directory.
+ */
+func (t *Table) LoadSnapshot(dir string) error {
+	if t.tableInfo.rowCount.Load() != 0 || t.wal != nil {
+		return errors.New("snapshot can only be loaded to a new table")
+	}
+
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		// crashed in the middle of swapping the snapshots
+		dir = dir + ".old"
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, snapshotMetaFileName))
+	if err != nil {
+		return err
+	}
+	meta, err := decodeSnapshotMeta(content)
+	if err != nil {
+		return fmt.Errorf("invalid snapshot meta in %s: %v", dir, err)
+	}
+
+	for _, colInfo := range meta.columns {
+		if err := t.colInfoMap.restoreColumn(colInfo.Name, colInfo.ColumnType, colInfo.id); err != nil {
+			return err
+		}
+	}
+	for _, s := range meta.strs {
+		if err := t.strStore.restoreStr(s.id, s.str, s.colId); err != nil {
+			return err
+		}
+	}
+
+	for _, fileName := range meta.segmentFiles {
+		block, err := t.loadSegment(filepath.Join(dir, fileName))
+		if err != nil {
+			return fmt.Errorf("invalid segment %s: %v", fileName, err)
+		}
+		t.addBlock(block)
+	}
+
+	t.walStart = meta.walPosition
+	t.ctx.Logger.Infof("loaded %d blocks from snapshot %s", len(meta.segmentFiles), dir)
+	return nil
+}
+
+// --------------------------- internal ----------------------------
+// Returns true if the block is old enough to be kept in its segment file instead of memory.
+func (t *Table) isColdBlock(maxTs int64) bool {
+	return maxTs < time.Now().Unix()-int64(t.ctx.GetColdBlockAge().Seconds())
+}
+
+// Maps the segment if the block is cold, otherwise reads the segment into memory.
+func (t *Table) loadSegment(path string) (*Block, error) {
+	mapped, err := openMmapBlockStorage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block := &Block{
+		minTs:    mapped.minTs,
+		maxTs:    mapped.maxTs,
+		rowCount: mapped.rowCount,
+		storage:  mapped,
+	}
+	if !t.isColdBlock(mapped.maxTs) {
+		// the mapping is released once `mapped` is collected
+		if block.storage, err = decodeSegment(append([]byte{}, mapped.data...)); err != nil {
+			return nil, err
+		}
+	}
+	return block, nil
+}
+
+// Replaces the in memory storage of the cold blocks with the segment files just written to
+// the snapshot, and moves the already mapped blocks to their files in the new snapshot.
+func (t *Table) mapColdBlocks(dir string, blocks []*Block, segmentFiles []string) {
+	mappedBlocks := make(map[*Block]*Block)
+	for idx, block := range blocks {
+		path := filepath.Join(dir, segmentFiles[idx])
+		switch storage := block.storage.(type) {
+		case *mmapBlockStorage:
+			storage.path = path
+		case *basicBlockStorage:
+			if !t.isColdBlock(storage.maxTs) {
+				continue
+			}
+
+			mapped, err := openMmapBlockStorage(path)
+			if err != nil {
+				t.ctx.Logger.Errorf("failed to map segment %s: %v", path, err)
+				continue
+			}
+			mappedBlocks[block] = &Block{
+				minTs:    block.minTs,
+				maxTs:    block.maxTs,
+				rowCount: block.rowCount,
+				storage:  mapped,
+			}
+		}
+	}
+	if len(mappedBlocks) == 0 {
+		return
+	}
+
+	t.blocksLock.Lock()
+	defer func() {
+		t.blocksLock.Unlock()
+	}()
+	for idx, block := range t.blocks {
+		if mappedBlock, ok := mappedBlocks[block]; ok {
+			t.blocks[idx] = mappedBlock
+		}
+	}
+	t.ctx.Logger.Infof("mapped %d cold blocks", len(mappedBlocks))
+}
+
+// Writes the block to a segment file. The segment file of a mapped block is immutable, so it's
+// linked to the new path instead of being encoded again.
+func writeSegment(path string, storage blockStorage) error {
+	switch s := storage.(type) {
+	case *mmapBlockStorage:
+		if err := os.Link(s.path, path); err == nil {
+			return nil
+		}
+		return writeFileAndSync(path, encodeSegment(s.basicBlockStorage))
+	case *basicBlockStorage:
+		return writeFileAndSync(path, encodeSegment(s))
+	default:
+		return fmt.Errorf("unsupported block storage: %T", storage)
+	}
+}
+
+// Replaces the snapshot in dir with the one in tmpDir, @see LoadSnapshot for a crash in between.
+func swapSnapshotDir(dir string, tmpDir string) error {
+	oldDir := dir + ".old"
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		// crashed in the middle of the last swap, so the old snapshot is the only good one
+		if err := os.Rename(oldDir, dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(oldDir); err != nil {
+		return err
+	}
+	if err := os.Rename(dir, oldDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(dir)); err != nil {
+		return err
+	}
+	return os.RemoveAll(oldDir)
+}
+
+func writeFileAndSync(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(content); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return file.Sync()
+}
+
+func encodeSnapshotMeta(meta *snapshotMeta) []byte {
+	e := newEncoder()
+	e.buf = append(e.buf, snapshotMagic...)
+	e.putUint32(0) // crc32c, filled in at the end
+
+	e.putUvarint(meta.walPosition.generation)
+	e.putUvarint(uint64(meta.walPosition.offset))
+
+	e.putUvarint(uint64(len(meta.columns)))
+	for _, colInfo := range meta.columns {
+		e.putUvarint(uint64(colInfo.id))
+		e.putUint8(colInfo.ColumnType)
+		e.putString(colInfo.Name)
+	}
+
+	e.putUvarint(uint64(len(meta.strs)))
+	for _, s := range meta.strs {
+		e.putUvarint(uint64(s.colId))
+		e.putUvarint(uint64(s.id))
+		e.putString(s.str)
+	}
+
+	e.putUvarint(uint64(len(meta.segmentFiles)))
+	for _, fileName := range meta.segmentFiles {
+		e.putString(fileName)
+	}
+
+	buf := e.bytes()
+	binary.LittleEndian.PutUint32(buf[len(snapshotMagic):], crc32.Checksum(buf[snapshotHeaderSize:], crc32cTable))
+	return buf
+}
+
+func decodeSnapshotMeta(buf []byte) (*snapshotMeta, error) {
+	if len(buf) < snapshotHeaderSize || !bytes.Equal(buf[:len(snapshotMagic)], snapshotMagic) {
+		return nil, errors.New("not a snapshot or unsupported snapshot version")
+	}
+	checksum := binary.LittleEndian.Uint32(buf[len(snapshotMagic):])
+	if crc32.Checksum(buf[snapshotHeaderSize:], crc32cTable) != checksum {
+		return nil, errors.New("snapshot checksum mismatch")
+	}
+
+	d := newDecoder(buf)
+	d.offset = snapshotHeaderSize
+
+	meta := &snapshotMeta{}
+	meta.walPosition.generation = d.uvarint()
+	meta.walPosition.offset = int64(d.uvarint())
+
+	meta.columns = make([]*ColumnInfo, d.length())
+	for i := range meta.columns {
+		meta.columns[i] = &ColumnInfo{id: columnId(d.uvarint())}
+		meta.columns[i].ColumnType = d.uint8()
+		meta.columns[i].Name = d.string()
+	}
+
+	meta.strs = make([]snapshotStr, d.length())
+	for i := range meta.strs {
+		meta.strs[i].colId = columnId(d.uvarint())
+		meta.strs[i].id = strId(d.uvarint())
+		meta.strs[i].str = d.string()
+	}
+
+	meta.segmentFiles = make([]string, d.length())
+	for i := range meta.segmentFiles {
+		meta.segmentFiles[i] = d.string()
+	}
+
+	if d.err() != nil {
+		return nil, d.err()
+	}
+	if d.remaining() != 0 {
+		return nil, errCorrupted
+	}
+	return meta, nil
+}
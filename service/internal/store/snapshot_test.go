@@ -0,0 +1,185 @@
+package store
+
+import (
+	"bapi/internal/common"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "snapshot")
+	table := NewTable(common.NewBapiCtx(), "asd")
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app"},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175609, "count": 1},
+			Str: map[string]string{"event": "publish"},
+		},
+	})
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175611, "count": 2},
+			Str: map[string]string{"event": "create", "source": "modal"},
+		},
+	})
+	assert.Nil(t, table.Snapshot(dir))
+
+	loaded := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, loaded.LoadSnapshot(dir))
+	assertTablesEqual(t, table, loaded)
+	vals, ok := loaded.SearchStrValues("event", "i")
+	assert.True(t, ok)
+	assert.ElementsMatch(t, []string{"init_app", "publish"}, vals)
+
+	// a snapshot can only be loaded to a new table
+	assert.NotNil(t, loaded.LoadSnapshot(dir))
+
+	// snapshotting again replaces the previous one
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175612},
+			Str: map[string]string{"event": "discard"},
+		},
+	})
+	assert.Nil(t, table.Snapshot(dir))
+	loadedAgain := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, loadedAgain.LoadSnapshot(dir))
+	assertTablesEqual(t, table, loadedAgain)
+}
+
+func TestSnapshotNotExist(t *testing.T) {
+	table := NewTable(common.NewBapiCtx(), "asd")
+	err := table.LoadSnapshot(filepath.Join(t.TempDir(), "snapshot"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestSnapshotWithWal(t *testing.T) {
+	tableDir := t.TempDir()
+	snapshotDir := filepath.Join(tableDir, "snapshot")
+	walPath := filepath.Join(tableDir, "wal")
+
+	table := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, table.OpenWal(walPath))
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app"},
+		},
+	})
+	assert.Nil(t, table.Snapshot(snapshotDir))
+	// the wal is reset after the snapshot
+	assert.Equal(t, int64(walHeaderSize), debugFileSize(t, walPath))
+
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175609, "count": 1},
+			Str: map[string]string{"event": "publish"},
+		},
+	})
+	assert.Nil(t, table.wal.close())
+
+	restored := debugRestoreTable(t, snapshotDir, walPath)
+	assertTablesEqual(t, table, restored)
+	assert.Equal(t, int64(2), restored.GetTableInfo().RowCount)
+}
+
+// The server may crash after the snapshot is written but before the wal is reset. The records
+// covered by the snapshot must not be replayed again.
+func TestSnapshotCrashBeforeWalReset(t *testing.T) {
+	tableDir := t.TempDir()
+	snapshotDir := filepath.Join(tableDir, "snapshot")
+	walPath := filepath.Join(tableDir, "wal")
+
+	table := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, table.OpenWal(walPath))
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app"},
+		},
+	})
+
+	walContent, _ := os.ReadFile(walPath)
+	assert.Nil(t, table.Snapshot(snapshotDir))
+	assert.Nil(t, table.wal.close())
+	// restores the wal as if it was not reset
+	os.WriteFile(walPath, walContent, 0644)
+
+	restored := debugRestoreTable(t, snapshotDir, walPath)
+	assertTablesEqual(t, table, restored)
+	assert.Equal(t, int64(1), restored.GetTableInfo().RowCount)
+}
+
+// The server may crash in the middle of swapping the snapshots
+func TestSnapshotCrashWhenSwapping(t *testing.T) {
+	snapshotDir := filepath.Join(t.TempDir(), "snapshot")
+	table := NewTable(common.NewBapiCtx(), "asd")
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app"},
+		},
+	})
+	assert.Nil(t, table.Snapshot(snapshotDir))
+	assert.Nil(t, os.Rename(snapshotDir, snapshotDir+".old"))
+
+	loaded := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, loaded.LoadSnapshot(snapshotDir))
+	assertTablesEqual(t, table, loaded)
+
+	// the old snapshot is kept if the next swap fails too
+	assert.NotNil(t, swapSnapshotDir(snapshotDir, snapshotDir+".tmp"))
+	loadedAgain := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, loadedAgain.LoadSnapshot(snapshotDir))
+	assertTablesEqual(t, table, loadedAgain)
+
+	// and replaced once it succeeds
+	debugIngestRows(loaded, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175609},
+			Str: map[string]string{"event": "publish"},
+		},
+	})
+	assert.Nil(t, loaded.Snapshot(snapshotDir))
+	_, err := os.Stat(snapshotDir + ".old")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	loadedAgain = NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, loadedAgain.LoadSnapshot(snapshotDir))
+	assertTablesEqual(t, loaded, loadedAgain)
+}
+
+func TestSnapshotMetaEncoding(t *testing.T) {
+	meta := &snapshotMeta{
+		walPosition: walPosition{generation: 3, offset: 1024},
+		columns: []*ColumnInfo{
+			{Name: "ts", ColumnType: IntColumnType, id: 0},
+			{Name: "event", ColumnType: StrColumnType, id: 1},
+		},
+		strs:         []snapshotStr{{colId: 1, id: 0, str: "init_app"}},
+		segmentFiles: []string{"000000.seg"},
+	}
+
+	encoded := encodeSnapshotMeta(meta)
+	decoded, err := decodeSnapshotMeta(encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, meta, decoded)
+
+	encoded[len(encoded)-1] ^= 1
+	_, err = decodeSnapshotMeta(encoded)
+	assert.NotNil(t, err)
+}
+
+// --------------------------- test util ----------------------------
+func debugRestoreTable(t *testing.T, snapshotDir string, walPath string) *Table {
+	table := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, table.LoadSnapshot(snapshotDir))
+	assert.Nil(t, table.OpenWal(walPath))
+	return table
+}
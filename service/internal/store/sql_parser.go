@@ -0,0 +1,767 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/**
+ * A SELECT statement of the SQL subset of pb.SqlQuery:
+ *
+ *	SELECT * | <expr> [[AS] <alias>], ...
+ *	[FROM <table>]
+ *	[WHERE <condition>]
+ *	[GROUP BY <expr>, ...]
+ *	[ORDER BY <expr> [ASC | DESC], ...]
+ *	[LIMIT <int>]
+ *
+ * The identifiers may be quoted by "" or ``, and the keywords and function names are case
+ * insensitive. It's planned into a query of the table by Table.SqlQuery.
+ */
+type SqlSelect struct {
+	// the default table if there is no FROM
+	TableName string
+
+	query   string
+	items   []*sqlSelectItem
+	where   *sqlExpr
+	groupBy []*sqlExpr
+	orderBy []*sqlOrderBy
+	limit   *sqlExpr
+}
+
+// An error of a SQL query at the token of the offset in the query.
+type SqlError struct {
+	Message string
+	// the byte offset of the token in the query, and its line and column from 1
+	Offset int
+	Line   int
+	Column int
+	// the text of the token, empty at the end of the query
+	Near string
+}
+
+func (e *SqlError) Error() string {
+	if e.Near == "" {
+		return fmt.Sprintf("%s at line %d, column %d", e.Message, e.Line, e.Column)
+	}
+	return fmt.Sprintf("%s at line %d, column %d near %q", e.Message, e.Line, e.Column, e.Near)
+}
+
+func ParseSql(query string) (*SqlSelect, error) {
+	tokens, err := lexSql(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{query: query, tokens: tokens}
+	return p.parseSelect()
+}
+
+// --------------------------- internal ----------------------------
+type sqlTokenKind uint8
+
+const (
+	sqlEOF sqlTokenKind = iota
+	sqlIdent
+	sqlKeyword
+	sqlInt
+	sqlFloat
+	sqlStr
+	sqlOp
+)
+
+// The keywords can't be identifiers unless quoted.
+var sqlKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true, "ORDER": true,
+	"LIMIT": true, "AS": true, "AND": true, "OR": true, "NOT": true, "IN": true, "IS": true,
+	"NULL": true, "LIKE": true, "ASC": true, "DESC": true, "DISTINCT": true, "TRUE": true,
+	"FALSE": true,
+}
+
+/**
+ * A token of a SQL query from the byte offset pos to end. The text of a keyword is in upper case,
+ * and the ones of the quoted identifiers and strs are unquoted.
+ */
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	pos  int
+	end  int
+}
+
+func newSqlError(query string, pos int, end int, format string, args ...interface{}) *SqlError {
+	line, column := 1, 1
+	for _, r := range query[:pos] {
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return &SqlError{
+		Message: fmt.Sprintf(format, args...),
+		Offset:  pos,
+		Line:    line,
+		Column:  column,
+		Near:    query[pos:end],
+	}
+}
+
+func lexSql(query string) ([]sqlToken, error) {
+	tokens := make([]sqlToken, 0)
+	for pos := 0; pos < len(query); {
+		r, size := utf8.DecodeRuneInString(query[pos:])
+		switch {
+		case unicode.IsSpace(r):
+			pos += size
+		case strings.HasPrefix(query[pos:], "--"):
+			// a comment to the end of the line
+			end := strings.IndexByte(query[pos:], '\n')
+			if end == -1 {
+				end = len(query) - pos
+			}
+			pos += end
+		case r == '_' || unicode.IsLetter(r):
+			end := pos
+			for end < len(query) {
+				r, size := utf8.DecodeRuneInString(query[end:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				end += size
+			}
+			token := sqlToken{kind: sqlIdent, text: query[pos:end], pos: pos, end: end}
+			if upper := strings.ToUpper(token.text); sqlKeywords[upper] {
+				token.kind, token.text = sqlKeyword, upper
+			}
+			tokens = append(tokens, token)
+			pos = end
+		case r == '"' || r == '`' || r == '\'':
+			text, end, ok := lexSqlQuoted(query, pos)
+			if !ok {
+				return nil, newSqlError(query, pos, len(query), "unterminated quote")
+			}
+			kind := sqlIdent
+			if r == '\'' {
+				kind = sqlStr
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: text, pos: pos, end: end})
+			pos = end
+		case isAsciiDigit(query[pos]) || (r == '.' && pos+1 < len(query) && isAsciiDigit(query[pos+1])):
+			token, err := lexSqlNumber(query, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+			pos = token.end
+		default:
+			end := pos + size
+			switch op := query[pos:min(pos+2, len(query))]; op {
+			case "!=", "<>", "<=", ">=":
+				end = pos + 2
+			default:
+				if !strings.ContainsRune(",()*+-/%=<>;", r) {
+					return nil, newSqlError(query, pos, end, "unexpected character")
+				}
+			}
+			tokens = append(tokens, sqlToken{kind: sqlOp, text: query[pos:end], pos: pos, end: end})
+			pos = end
+		}
+	}
+	return append(tokens, sqlToken{kind: sqlEOF, pos: len(query), end: len(query)}), nil
+}
+
+// Unquotes the quoted text at pos, in which the quote is escaped by doubling it.
+func lexSqlQuoted(query string, pos int) (string, int, bool) {
+	quote := query[pos]
+	var text strings.Builder
+	for i := pos + 1; i < len(query); i++ {
+		if query[i] != quote {
+			text.WriteByte(query[i])
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == quote {
+			text.WriteByte(quote)
+			i++
+			continue
+		}
+		return text.String(), i + 1, true
+	}
+	return "", 0, false
+}
+
+func lexSqlNumber(query string, pos int) (sqlToken, error) {
+	end := pos
+	isFloat := false
+	for end < len(query) && isAsciiDigit(query[end]) {
+		end++
+	}
+	if end < len(query) && query[end] == '.' {
+		isFloat = true
+		end++
+		for end < len(query) && isAsciiDigit(query[end]) {
+			end++
+		}
+	}
+	if end < len(query) && (query[end] == 'e' || query[end] == 'E') {
+		expEnd := end + 1
+		if expEnd < len(query) && (query[expEnd] == '+' || query[expEnd] == '-') {
+			expEnd++
+		}
+		if expEnd < len(query) && isAsciiDigit(query[expEnd]) {
+			isFloat = true
+			end = expEnd
+			for end < len(query) && isAsciiDigit(query[end]) {
+				end++
+			}
+		}
+	}
+
+	token := sqlToken{kind: sqlInt, text: query[pos:end], pos: pos, end: end}
+	var err error
+	if isFloat {
+		token.kind = sqlFloat
+		_, err = strconv.ParseFloat(token.text, 64)
+	} else {
+		_, err = strconv.ParseInt(token.text, 10, 64)
+	}
+	if err != nil {
+		return sqlToken{}, newSqlError(query, pos, end, "invalid number")
+	}
+	return token, nil
+}
+
+func isAsciiDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+type sqlExprKind uint8
+
+const (
+	sqlColumnExpr sqlExprKind = iota
+	sqlIntExpr
+	sqlFloatExpr
+	sqlStrExpr
+	sqlBoolExpr
+	sqlNullExpr
+	// the `*` of `SELECT *` and `count(*)`
+	sqlStarExpr
+	// of the op: + - * / % = != < > <= >= AND OR
+	sqlBinaryExpr
+	// of the op: - NOT
+	sqlUnaryExpr
+	// a call of the function of the name
+	sqlCallExpr
+	// args[0] [NOT] IN (args[1:])
+	sqlInExpr
+	// args[0] IS [NOT] NULL
+	sqlIsNullExpr
+	// args[0] [NOT] LIKE args[1]
+	sqlLikeExpr
+)
+
+// An expression of a SQL query from the byte offset pos to end.
+type sqlExpr struct {
+	kind sqlExprKind
+	pos  int
+	end  int
+	// the column name, the lower case function name, or the op
+	name     string
+	intVal   int64
+	floatVal float64
+	strVal   string
+	boolVal  bool
+	args     []*sqlExpr
+	// for sqlCallExpr: e.g. count(DISTINCT x)
+	distinct bool
+	// for sqlInExpr, sqlIsNullExpr and sqlLikeExpr
+	negated bool
+}
+
+type sqlSelectItem struct {
+	expr *sqlExpr
+	// empty if not set
+	alias string
+}
+
+type sqlOrderBy struct {
+	expr *sqlExpr
+	desc bool
+}
+
+// The precedence of the binary ops, the higher the tighter.
+var sqlBinaryOpPrecedence = map[string]int{
+	"OR": 1, "AND": 2,
+	"=": 4, "!=": 4, "<": 4, ">": 4, "<=": 4, ">=": 4,
+	"+": 5, "-": 5, "*": 6, "/": 6, "%": 6,
+}
+
+// Formats the expr as SQL, which names the computed columns of the exprs.
+func (e *sqlExpr) String() string {
+	switch e.kind {
+	case sqlColumnExpr:
+		return e.name
+	case sqlIntExpr:
+		return strconv.FormatInt(e.intVal, 10)
+	case sqlFloatExpr:
+		return strconv.FormatFloat(e.floatVal, 'g', -1, 64)
+	case sqlStrExpr:
+		return "'" + strings.ReplaceAll(e.strVal, "'", "''") + "'"
+	case sqlBoolExpr:
+		return strings.ToUpper(strconv.FormatBool(e.boolVal))
+	case sqlNullExpr:
+		return "NULL"
+	case sqlStarExpr:
+		return "*"
+	case sqlBinaryExpr:
+		left, right := e.args[0].String(), e.args[1].String()
+		// parenthesizes the args that bind looser, and the right one of the same precedence
+		if e.args[0].kind == sqlBinaryExpr && sqlBinaryOpPrecedence[e.args[0].name] < sqlBinaryOpPrecedence[e.name] {
+			left = "(" + left + ")"
+		}
+		if e.args[1].kind == sqlBinaryExpr && sqlBinaryOpPrecedence[e.args[1].name] <= sqlBinaryOpPrecedence[e.name] {
+			right = "(" + right + ")"
+		}
+		return left + " " + e.name + " " + right
+	case sqlUnaryExpr:
+		if e.name == "NOT" {
+			return "NOT " + e.args[0].String()
+		}
+		return e.name + e.args[0].String()
+	case sqlCallExpr:
+		args := make([]string, 0, len(e.args))
+		for _, arg := range e.args {
+			args = append(args, arg.String())
+		}
+		distinct := ""
+		if e.distinct {
+			distinct = "DISTINCT "
+		}
+		return e.name + "(" + distinct + strings.Join(args, ", ") + ")"
+	case sqlInExpr:
+		values := make([]string, 0, len(e.args)-1)
+		for _, arg := range e.args[1:] {
+			values = append(values, arg.String())
+		}
+		return e.args[0].String() + negatedSql(e.negated, " NOT") + " IN (" + strings.Join(values, ", ") + ")"
+	case sqlIsNullExpr:
+		return e.args[0].String() + " IS" + negatedSql(e.negated, " NOT") + " NULL"
+	case sqlLikeExpr:
+		return e.args[0].String() + negatedSql(e.negated, " NOT") + " LIKE " + e.args[1].String()
+	}
+	return ""
+}
+
+func negatedSql(negated bool, not string) string {
+	if negated {
+		return not
+	}
+	return ""
+}
+
+// A recursive descent parser of the tokens of a query.
+type sqlParser struct {
+	query  string
+	tokens []sqlToken
+	i      int
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.i]
+}
+
+func (p *sqlParser) next() sqlToken {
+	token := p.tokens[p.i]
+	if token.kind != sqlEOF {
+		p.i++
+	}
+	return token
+}
+
+func (p *sqlParser) isKeyword(keyword string) bool {
+	token := p.peek()
+	return token.kind == sqlKeyword && token.text == keyword
+}
+
+func (p *sqlParser) isOp(op string) bool {
+	token := p.peek()
+	return token.kind == sqlOp && token.text == op
+}
+
+// Consumes the keyword if it's the next token.
+func (p *sqlParser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) acceptOp(op string) bool {
+	if p.isOp(op) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.errorAt(p.peek(), "expected %s", keyword)
+	}
+	return nil
+}
+
+func (p *sqlParser) expectOp(op string) error {
+	if !p.acceptOp(op) {
+		return p.errorAt(p.peek(), "expected %q", op)
+	}
+	return nil
+}
+
+func (p *sqlParser) errorAt(token sqlToken, format string, args ...interface{}) *SqlError {
+	return newSqlError(p.query, token.pos, token.end, format, args...)
+}
+
+func (p *sqlParser) parseSelect() (*SqlSelect, error) {
+	stmt := &SqlSelect{query: p.query}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		stmt.items = append(stmt.items, item)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+
+	if p.acceptKeyword("FROM") {
+		token := p.next()
+		if token.kind != sqlIdent {
+			return nil, p.errorAt(token, "expected a table name")
+		}
+		stmt.TableName = token.text
+	}
+
+	if p.acceptKeyword("WHERE") {
+		where, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.where = where
+	}
+
+	if p.acceptKeyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			groupBy, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.groupBy = append(stmt.groupBy, groupBy)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			orderBy, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			desc := p.acceptKeyword("DESC")
+			if !desc {
+				p.acceptKeyword("ASC")
+			}
+			stmt.orderBy = append(stmt.orderBy, &sqlOrderBy{expr: orderBy, desc: desc})
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		limit, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.limit = limit
+	}
+
+	p.acceptOp(";")
+	if token := p.peek(); token.kind != sqlEOF {
+		return nil, p.errorAt(token, "unexpected %s", describeSqlToken(token))
+	}
+	return stmt, nil
+}
+
+func (p *sqlParser) parseSelectItem() (*sqlSelectItem, error) {
+	if token := p.peek(); token.kind == sqlOp && token.text == "*" {
+		p.next()
+		return &sqlSelectItem{expr: &sqlExpr{kind: sqlStarExpr, pos: token.pos, end: token.end}}, nil
+	}
+
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	item := &sqlSelectItem{expr: expr}
+	if p.acceptKeyword("AS") {
+		token := p.next()
+		if token.kind != sqlIdent {
+			return nil, p.errorAt(token, "expected an alias")
+		}
+		item.alias = token.text
+	} else if token := p.peek(); token.kind == sqlIdent {
+		p.next()
+		item.alias = token.text
+	}
+	return item, nil
+}
+
+func (p *sqlParser) parseExpr() (*sqlExpr, error) {
+	return p.parseBinary(sqlBinaryOpPrecedence["OR"])
+}
+
+/**
+ * Parses the binary ops of the precedence or higher, whose operands are parsed by the next
+ * precedence, i.e. OR, AND, then NOT and the comparisons, then + -, then * / %, then the unary
+ * minus and the primary exprs.
+ */
+func (p *sqlParser) parseBinary(precedence int) (*sqlExpr, error) {
+	switch precedence {
+	case sqlBinaryOpPrecedence["AND"] + 1:
+		return p.parseNot()
+	case sqlBinaryOpPrecedence["*"] + 1:
+		return p.parseUnary()
+	}
+
+	left, err := p.parseBinary(precedence + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token := p.peek()
+		if (token.kind != sqlOp && token.kind != sqlKeyword) || sqlBinaryOpPrecedence[token.text] != precedence {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlExpr{kind: sqlBinaryExpr, pos: left.pos, end: right.end, name: token.text, args: []*sqlExpr{left, right}}
+	}
+}
+
+func (p *sqlParser) parseNot() (*sqlExpr, error) {
+	if token := p.peek(); p.acceptKeyword("NOT") {
+		arg, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlExpr{kind: sqlUnaryExpr, pos: token.pos, end: arg.end, name: "NOT", args: []*sqlExpr{arg}}, nil
+	}
+	return p.parseComparison()
+}
+
+// Parses a comparison, [NOT] IN, [NOT] LIKE or IS [NOT] NULL, which don't chain.
+func (p *sqlParser) parseComparison() (*sqlExpr, error) {
+	left, err := p.parseBinary(sqlBinaryOpPrecedence["+"])
+	if err != nil {
+		return nil, err
+	}
+
+	token := p.peek()
+	if token.kind == sqlOp && sqlBinaryOpPrecedence[token.text] == sqlBinaryOpPrecedence["="] ||
+		token.kind == sqlOp && token.text == "<>" {
+		p.next()
+		right, err := p.parseBinary(sqlBinaryOpPrecedence["+"])
+		if err != nil {
+			return nil, err
+		}
+		op := token.text
+		if op == "<>" {
+			op = "!="
+		}
+		return &sqlExpr{kind: sqlBinaryExpr, pos: left.pos, end: right.end, name: op, args: []*sqlExpr{left, right}}, nil
+	}
+
+	if p.acceptKeyword("IS") {
+		negated := p.acceptKeyword("NOT")
+		end := p.peek().end
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &sqlExpr{kind: sqlIsNullExpr, pos: left.pos, end: end, negated: negated, args: []*sqlExpr{left}}, nil
+	}
+
+	negated := false
+	if p.isKeyword("NOT") {
+		if next := p.tokens[p.i+1]; next.kind != sqlKeyword || (next.text != "IN" && next.text != "LIKE") {
+			return nil, p.errorAt(next, "expected IN or LIKE")
+		}
+		p.next()
+		negated = true
+	}
+
+	if p.acceptKeyword("IN") {
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		args := []*sqlExpr{left}
+		for {
+			value, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, value)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		end := p.peek().end
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return &sqlExpr{kind: sqlInExpr, pos: left.pos, end: end, negated: negated, args: args}, nil
+	}
+
+	if p.acceptKeyword("LIKE") {
+		pattern, err := p.parseBinary(sqlBinaryOpPrecedence["+"])
+		if err != nil {
+			return nil, err
+		}
+		return &sqlExpr{kind: sqlLikeExpr, pos: left.pos, end: pattern.end, negated: negated, args: []*sqlExpr{left, pattern}}, nil
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseUnary() (*sqlExpr, error) {
+	token := p.peek()
+	if !p.acceptOp("-") {
+		return p.parsePrimary()
+	}
+
+	arg, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	// folds the negative literals, e.g. -1
+	switch arg.kind {
+	case sqlIntExpr:
+		return &sqlExpr{kind: sqlIntExpr, pos: token.pos, end: arg.end, intVal: -arg.intVal}, nil
+	case sqlFloatExpr:
+		return &sqlExpr{kind: sqlFloatExpr, pos: token.pos, end: arg.end, floatVal: -arg.floatVal}, nil
+	}
+	return &sqlExpr{kind: sqlUnaryExpr, pos: token.pos, end: arg.end, name: "-", args: []*sqlExpr{arg}}, nil
+}
+
+func (p *sqlParser) parsePrimary() (*sqlExpr, error) {
+	token := p.next()
+	expr := &sqlExpr{pos: token.pos, end: token.end}
+	switch token.kind {
+	case sqlInt:
+		expr.kind = sqlIntExpr
+		expr.intVal, _ = strconv.ParseInt(token.text, 10, 64)
+		return expr, nil
+	case sqlFloat:
+		expr.kind = sqlFloatExpr
+		expr.floatVal, _ = strconv.ParseFloat(token.text, 64)
+		return expr, nil
+	case sqlStr:
+		expr.kind = sqlStrExpr
+		expr.strVal = token.text
+		return expr, nil
+	case sqlKeyword:
+		switch token.text {
+		case "TRUE", "FALSE":
+			expr.kind = sqlBoolExpr
+			expr.boolVal = token.text == "TRUE"
+			return expr, nil
+		case "NULL":
+			expr.kind = sqlNullExpr
+			return expr, nil
+		}
+	case sqlIdent:
+		if !p.acceptOp("(") {
+			expr.kind = sqlColumnExpr
+			expr.name = token.text
+			return expr, nil
+		}
+		return p.parseCall(token)
+	case sqlOp:
+		if token.text == "(" {
+			inner, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			end := p.peek().end
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			inner.pos, inner.end = token.pos, end
+			return inner, nil
+		}
+	}
+	return nil, p.errorAt(token, "unexpected %s", describeSqlToken(token))
+}
+
+// Parses the args of a call after its `(`, e.g. count(*), count(DISTINCT user) or now().
+func (p *sqlParser) parseCall(name sqlToken) (*sqlExpr, error) {
+	call := &sqlExpr{kind: sqlCallExpr, pos: name.pos, name: strings.ToLower(name.text)}
+	if token := p.peek(); token.kind == sqlOp && token.text == "*" {
+		p.next()
+		call.args = append(call.args, &sqlExpr{kind: sqlStarExpr, pos: token.pos, end: token.end})
+	} else if !p.isOp(")") {
+		call.distinct = p.acceptKeyword("DISTINCT")
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+
+	call.end = p.peek().end
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+func describeSqlToken(token sqlToken) string {
+	switch token.kind {
+	case sqlEOF:
+		return "end of the query"
+	case sqlKeyword:
+		return "keyword " + token.text
+	case sqlStr:
+		return "string"
+	case sqlInt, sqlFloat:
+		return "number"
+	case sqlIdent:
+		return "identifier"
+	}
+	return "token"
+}
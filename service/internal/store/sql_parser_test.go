@@ -0,0 +1,66 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSql(t *testing.T) {
+	stmt, err := ParseSql(`
+		select service, count(*) AS cnt, p99(latency) "p99", count(DISTINCT user)
+		FROM events
+		WHERE ts >= now() - 3600 AND (status >= 500 OR NOT path LIKE '/api/%') AND host NOT IN ('a', 'b''c')
+		GROUP BY service
+		ORDER BY cnt DESC, service
+		LIMIT 10;`)
+	assert.Nil(t, err)
+	assert.Equal(t, "events", stmt.TableName)
+
+	items := make([]string, 0)
+	for _, item := range stmt.items {
+		items = append(items, item.expr.String()+" "+item.alias)
+	}
+	assert.Equal(t, []string{"service ", "count(*) cnt", "p99(latency) p99", "count(DISTINCT user) "}, items)
+	assert.Equal(
+		t,
+		"ts >= now() - 3600 AND (status >= 500 OR NOT path LIKE '/api/%') AND host NOT IN ('a', 'b''c')",
+		stmt.where.String(),
+	)
+	assert.Equal(t, "service", stmt.groupBy[0].String())
+	assert.Equal(t, 2, len(stmt.orderBy))
+	assert.True(t, stmt.orderBy[0].desc)
+	assert.False(t, stmt.orderBy[1].desc)
+	assert.Equal(t, int64(10), stmt.limit.intVal)
+
+	// the precedence of the ops
+	stmt, err = ParseSql("SELECT a - b - c, a - (b - c), -a * 2 + b % 3, x IS NOT NULL, 1.5e3, -2")
+	assert.Nil(t, err)
+	items = items[:0]
+	for _, item := range stmt.items {
+		items = append(items, item.expr.String())
+	}
+	assert.Equal(t, []string{"a - b - c", "a - (b - c)", "-a * 2 + b % 3", "x IS NOT NULL", "1500", "-2"}, items)
+	assert.Equal(t, "", stmt.TableName)
+
+	// the errors point at the offending token
+	_, err = ParseSql("SELECT count(* FROM events")
+	assert.Equal(t, &SqlError{Message: `expected ")"`, Offset: 15, Line: 1, Column: 16, Near: "FROM"}, err)
+	assert.Equal(t, `expected ")" at line 1, column 16 near "FROM"`, err.Error())
+
+	_, err = ParseSql("SELECT a\nFROM events\nWHERE a = 'x")
+	assert.Equal(t, &SqlError{Message: "unterminated quote", Offset: 31, Line: 3, Column: 11, Near: "'x"}, err)
+
+	_, err = ParseSql("SELECT a FROM events WHERE")
+	assert.Equal(t, "unexpected end of the query at line 1, column 27", err.Error())
+
+	_, err = ParseSql("SELECT a FROM events LIMIT 10 OFFSET 5")
+	assert.Equal(t, 30, err.(*SqlError).Offset)
+	assert.Equal(t, "OFFSET", err.(*SqlError).Near)
+
+	_, err = ParseSql("SELECT a # b")
+	assert.Equal(t, "unexpected character at line 1, column 10 near \"#\"", err.Error())
+
+	_, err = ParseSql("SELECT a FROM events WHERE a NOT = 1")
+	assert.Equal(t, "=", err.(*SqlError).Near)
+}
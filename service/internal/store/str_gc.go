@@ -0,0 +1,52 @@
+package store
+
+/**
+ * Removes the strings no longer used by any block, e.g. after the blocks are dropped by
+ * retention, so that their ids can be reused by new strings.
+ *
+ * Ingestion is paused during the sweep: the ingesters hold strGcLock from getting the strIds
+ * of the rows until the partialBlock is queued, and the queued partialBlocks are flushed first,
+ * so every string in use is in the strIdSet of some block.
+ *
+ * With the wal enabled, the ids of the removed strings are only reused after the next snapshot
+ * resets the wal: the records before it may still refer to the removed strings, and replaying
+ * them along with the records of the new strings reusing the ids would conflict.
+ * Called periodically by the table. Returns the number of strings removed.
+ */
+func (t *Table) CollectStrs() int {
+	t.strGcLock.Lock()
+	defer func() {
+		t.strGcLock.Unlock()
+	}()
+	t.ingestLock.Lock()
+	defer func() {
+		t.ingestLock.Unlock()
+	}()
+
+	if t.closed {
+		return 0
+	}
+	t.flushPartialBlocks()
+
+	used := make(map[strId]bool)
+	t.blocksLock.RLock()
+	for _, block := range t.blocks {
+		for sid := range block.storage.getStrIdSet() {
+			used[sid] = true
+		}
+	}
+	t.blocksLock.RUnlock()
+
+	removed := t.strStore.removeUnusedStrs(used)
+	if t.wal != nil {
+		for sid := range removed {
+			t.pendingFreeStrIds[sid] = true
+		}
+	}
+	t.strStore.resetFreeStrIds(t.pendingFreeStrIds)
+
+	if len(removed) != 0 {
+		t.ctx.Logger.Infof("removed %d unused strings from table %s", len(removed), t.tableInfo.name)
+	}
+	return len(removed)
+}
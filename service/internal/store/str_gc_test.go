@@ -0,0 +1,100 @@
+package store
+
+import (
+	"bapi/internal/common"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectStrs(t *testing.T) {
+	table := NewTable(common.NewBapiCtx(), "asd")
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app", "source": "modal"},
+		},
+	})
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175800},
+			Str: map[string]string{"event": "publish", "source": "modal"},
+		},
+	})
+	assert.Equal(t, 0, table.CollectStrs())
+	initAppId, _ := table.strStore.getStrId(debugGetColumnId(table, "event"), "init_app")
+
+	table.SetRetention(100 * time.Second)
+	table.ApplyRetention(time.Unix(1643175810, 0))
+	assert.Equal(t, 1, table.CollectStrs())
+
+	_, ok := table.strStore.getStrId(debugGetColumnId(table, "event"), "init_app")
+	assert.False(t, ok)
+	vals, _ := table.SearchStrValues("event", "")
+	assert.Equal(t, []string{"publish"}, vals)
+
+	// the id of the removed string is reused
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175801},
+			Str: map[string]string{"event": "create"},
+		},
+	})
+	id, _ := table.strStore.getStrId(debugGetColumnId(table, "event"), "create")
+	assert.Equal(t, initAppId, id)
+}
+
+func TestCollectStrsWithWal(t *testing.T) {
+	tableDir := t.TempDir()
+	snapshotDir := filepath.Join(tableDir, "snapshot")
+	walPath := filepath.Join(tableDir, "wal")
+
+	table := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, table.OpenWal(walPath))
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app"},
+		},
+	})
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175800},
+			Str: map[string]string{"event": "publish"},
+		},
+	})
+	table.SetRetention(100 * time.Second)
+	table.ApplyRetention(time.Unix(1643175810, 0))
+	assert.Equal(t, 1, table.CollectStrs())
+
+	// the wal still has the removed string, so its id is not reused until the snapshot
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175801},
+			Str: map[string]string{"event": "create"},
+		},
+	})
+	id, _ := table.strStore.getStrId(debugGetColumnId(table, "event"), "create")
+	assert.Equal(t, newStrId(debugGetColumnId(table, "event"), 2), id)
+
+	assert.Nil(t, table.Snapshot(snapshotDir))
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175802},
+			Str: map[string]string{"event": "discard"},
+		},
+	})
+	id, _ = table.strStore.getStrId(debugGetColumnId(table, "event"), "discard")
+	assert.Equal(t, newStrId(debugGetColumnId(table, "event"), 0), id)
+	assert.Nil(t, table.wal.close())
+
+	restored := debugRestoreTable(t, snapshotDir, walPath)
+	assertTablesEqual(t, table, restored)
+}
+
+func debugGetColumnId(table *Table, colName string) columnId {
+	colInfo, _ := table.colInfoMap.getColumnInfo(colName)
+	return colInfo.id
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"bapi/internal/common"
+	"fmt"
 	"strings"
 	"sync"
 
@@ -10,113 +11,115 @@ import (
 
 const nonexistentStr = strId(0xFFFFFFFF)
 
+/**
+ * Each column has its own dictionary, so a column with many distinct strings doesn't use up
+ * the ids of the others. A strId is the columnId in the high bits followed by the id within the
+ * dictionary of the column, so strIds are still unique within a table and the query results can
+ * map them to the strings with a single map.
+ */
+const strIdLocalBits = 23
+const maxStrColumnId = columnId(1<<(32-strIdLocalBits) - 1)
+const maxLocalStrCount = uint32(1<<strIdLocalBits - 1) // the last one is taken by nonexistentStr
+
+func newStrId(colId columnId, localId uint32) strId {
+	return strId(uint32(colId)<<strIdLocalBits | localId)
+}
+
+func (id strId) colId() columnId {
+	return columnId(uint32(id) >> strIdLocalBits)
+}
+
+func (id strId) localId() uint32 {
+	return uint32(id) & (1<<strIdLocalBits - 1)
+}
+
 type readOnlyStrStore interface {
 	search(colId columnId, searchStr string) ([]string, bool)
-	getStrId(str string) (strId, bool)
+	getStrId(colId columnId, str string) (strId, bool)
 	getStr(id strId) (string, bool)
+	matchStrIds(colId columnId, match func(str string) bool) []strId
 }
 
 type strStore interface {
 	readOnlyStrStore
 	getOrInsertStrId(str string, colId columnId) (strId, bool, bool)
+	restoreStr(id strId, str string, colId columnId) error
+	forEachStr(f func(id strId, str string, colId columnId))
+	getStrStats(colId columnId) (int, int)
+	removeUnusedStrs(used map[strId]bool) map[strId]bool
+	resetFreeStrIds(reserved map[strId]bool)
+	releaseStrIds(ids map[strId]bool)
 }
-type colStrLookup struct {
-	m sync.Map // map[colId]*map[strId]bool
-}
-
-func (lookup *colStrLookup) add(sid strId, cid columnId) {
-	strIds, ok := lookup.m.Load(cid)
-	if !ok {
-		strIds, _ = lookup.m.LoadOrStore(cid, &sync.Map{})
-	}
-
-	strIds.(*sync.Map).Store(sid, true)
-}
-
-func (lookup *colStrLookup) search(cid columnId, store readOnlyStrStore, searchStr string) ([]string, bool) {
-	strIds, ok := lookup.m.Load(cid)
-	if !ok {
-		return nil, false
-	}
 
-	matched := make([]string, 0)
-	strIds.(*sync.Map).Range(
-		func(sid, _ interface{}) bool {
-			str, ok := store.getStr(sid.(strId))
-			if !ok {
-				// This shouldn't happen
-				return false
-			}
-
-			if strings.Contains(str, searchStr) {
-				matched = append(matched, str)
-			}
-
-			return true
-		},
-	)
-
-	return matched, len(matched) != 0
+/**
+ * A string store with a strDict per column, @see strIdLocalBits.
+ */
+type basicStrStore struct {
+	ctx   *common.BapiCtx
+	dicts sync.Map // map[columnId]*strDict
 }
 
-type basicStrStore struct {
-	ctx         *common.BapiCtx
+/**
+ * The strings of a column. The ids are handed out in increasing order, up to maxStrCount.
+ * The ids of the removed strings are kept in freeStrIds and are reused before new ids,
+ * @see Table.CollectStrs.
+ */
+type strDict struct {
+	colId       columnId
 	strIdMap    sync.Map // map[strId]string
 	strValueMap sync.Map // map[string]strId
 	strCount    *atomic.Uint32
-	lookup      colStrLookup
+	strBytes    *atomic.Int64
+
+	freeLock   *sync.Mutex
+	freeStrIds []strId
 }
 
 func newBasicStrStore(ctx *common.BapiCtx) *basicStrStore {
 	return &basicStrStore{
-		ctx:         ctx,
-		strIdMap:    sync.Map{},
-		strValueMap: sync.Map{},
-		strCount:    atomic.NewUint32(0),
-		lookup: colStrLookup{
-			m: sync.Map{},
-		},
+		ctx:   ctx,
+		dicts: sync.Map{},
 	}
 }
 
-// Gets the id from the store if exists otherwise inserts it.
-// The colId is used to build a map from col to its vals to support typeahead UI.
+// Gets the id from the dictionary of the column if exists otherwise inserts it.
 // Returns strId, loaded, ok.
 func (s *basicStrStore) getOrInsertStrId(str string, colId columnId) (strId, bool, bool) {
-	if id, loaded := s.strValueMap.Load(str); loaded {
+	dict, ok := s.getOrCreateDict(colId)
+	if !ok {
+		return nonexistentStr, false, false
+	}
+
+	if id, loaded := dict.strValueMap.Load(str); loaded {
 		// happy path: string is already in the store
 		return id.(strId), true, true
 	}
 
-	var strCount uint32
-	for {
-		strCount = s.strCount.Load()
-		if strCount == s.ctx.GetMaxStrCount() {
-			return nonexistentStr, false, false
-		}
-
-		// atomically increase the strCount and make sure we are the only one reserved the
-		// strCount, which will be used as the strId. The strId still can be wasted if the
-		// later insertion fails, which is fine.
-		if swapped := s.strCount.CAS(strCount, strCount+1); swapped {
-			break
-		}
+	reservedStrId, ok := dict.reserveStrId(s.getMaxStrCount())
+	if !ok {
+		return nonexistentStr, false, false
 	}
 
-	reservedStrId := strId(strCount)
 	// we still need to load in case it's stored before we get the lock
-	id, loaded := s.strValueMap.LoadOrStore(str, reservedStrId)
+	id, loaded := dict.strValueMap.LoadOrStore(str, reservedStrId)
 	if !loaded {
-		// stored: also need to insert to strIdMap and update nextStrId
-		s.strIdMap.Store(id, str)
-		s.lookup.add(id.(strId), colId)
+		// stored: also need to insert to strIdMap
+		dict.strIdMap.Store(id, str)
+		dict.strBytes.Add(int64(len(str)))
+	} else {
+		dict.releaseStrIds([]strId{reservedStrId})
 	}
 
 	return id.(strId), loaded, true
 }
 
-func (s *basicStrStore) getStrId(str string) (strId, bool) {
-	if id, loaded := s.strValueMap.Load(str); loaded {
+func (s *basicStrStore) getStrId(colId columnId, str string) (strId, bool) {
+	dict, ok := s.getDict(colId)
+	if !ok {
+		return nonexistentStr, false
+	}
+
+	if id, loaded := dict.strValueMap.Load(str); loaded {
 		return id.(strId), true
 	}
 
@@ -124,13 +127,246 @@ func (s *basicStrStore) getStrId(str string) (strId, bool) {
 }
 
 func (s *basicStrStore) getStr(id strId) (string, bool) {
-	if str, loaded := s.strIdMap.Load(id); loaded {
+	dict, ok := s.getDict(id.colId())
+	if !ok {
+		return "", false
+	}
+
+	if str, loaded := dict.strIdMap.Load(id); loaded {
 		return str.(string), true
 	}
 
 	return "", false
 }
 
+// Returns the strings of the column containing searchStr, to support typeahead UI.
 func (s *basicStrStore) search(colId columnId, searchStr string) ([]string, bool) {
-	return s.lookup.search(colId, s, searchStr)
+	dict, ok := s.getDict(colId)
+	if !ok {
+		return nil, false
+	}
+
+	matched := make([]string, 0)
+	dict.strValueMap.Range(func(str, _ interface{}) bool {
+		if strings.Contains(str.(string), searchStr) {
+			matched = append(matched, str.(string))
+		}
+		return true
+	})
+
+	return matched, len(matched) != 0
+}
+
+// Returns the ids of the strings of the column that match, by scanning the dictionary once.
+func (s *basicStrStore) matchStrIds(colId columnId, match func(str string) bool) []strId {
+	dict, ok := s.getDict(colId)
+	if !ok {
+		return make([]strId, 0)
+	}
+
+	matched := make([]strId, 0)
+	dict.strValueMap.Range(func(str, id interface{}) bool {
+		if match(str.(string)) {
+			matched = append(matched, id.(strId))
+		}
+		return true
+	})
+	return matched
+}
+
+// Inserts a string with a known id, e.g. when replaying the write-ahead log.
+// Returns an error if the string or the id is already taken by a different value.
+func (s *basicStrStore) restoreStr(id strId, str string, colId columnId) error {
+	if id.colId() != colId || id.localId() >= s.getMaxStrCount() {
+		return fmt.Errorf("invalid strId for %s in column %d: %d", str, colId, id)
+	}
+	dict, ok := s.getOrCreateDict(colId)
+	if !ok {
+		return fmt.Errorf("invalid column for strs: %d", colId)
+	}
+
+	if existingStr, loaded := dict.strIdMap.Load(id); loaded {
+		if existingStr.(string) != str {
+			return fmt.Errorf("strId %d is taken by %s", id, existingStr)
+		}
+		return nil
+	}
+	if existingId, loaded := dict.strValueMap.Load(str); loaded && existingId.(strId) != id {
+		return fmt.Errorf("conflicting strId for %s, existing: %d, got: %d", str, existingId, id)
+	}
+	dict.strIdMap.Store(id, str)
+	dict.strValueMap.Store(str, id)
+	dict.strBytes.Add(int64(len(str)))
+
+	for {
+		strCount := dict.strCount.Load()
+		if id.localId() < strCount {
+			break
+		}
+		if swapped := dict.strCount.CAS(strCount, id.localId()+1); swapped {
+			break
+		}
+	}
+	return nil
+}
+
+// Calls f for each string and the column it's inserted for.
+func (s *basicStrStore) forEachStr(f func(id strId, str string, colId columnId)) {
+	s.dicts.Range(func(cid, dict interface{}) bool {
+		dict.(*strDict).strIdMap.Range(func(sid, str interface{}) bool {
+			f(sid.(strId), str.(string), cid.(columnId))
+			return true
+		})
+		return true
+	})
+}
+
+// Returns the number of strings of the column and their total length in bytes.
+func (s *basicStrStore) getStrStats(colId columnId) (int, int) {
+	dict, ok := s.getDict(colId)
+	if !ok {
+		return 0, 0
+	}
+
+	count := 0
+	dict.strIdMap.Range(func(_, _ interface{}) bool {
+		count++
+		return true
+	})
+	return count, int(dict.strBytes.Load())
+}
+
+/**
+ * Removes the strings whose ids are not in `used`. Returns the ids of the removed strings,
+ * which are not reused until being released by `releaseStrIds` or `resetFreeStrIds`.
+ * Must not be called concurrently with getOrInsertStrId, @see Table.CollectStrs.
+ */
+func (s *basicStrStore) removeUnusedStrs(used map[strId]bool) map[strId]bool {
+	removed := make(map[strId]bool)
+	s.dicts.Range(func(_, d interface{}) bool {
+		dict := d.(*strDict)
+		dict.strIdMap.Range(func(id, str interface{}) bool {
+			sid := id.(strId)
+			if used[sid] {
+				return true
+			}
+
+			dict.strIdMap.Delete(sid)
+			dict.strValueMap.Delete(str)
+			dict.strBytes.Sub(int64(len(str.(string))))
+			removed[sid] = true
+			return true
+		})
+		return true
+	})
+	return removed
+}
+
+/**
+ * Makes all the ids not taken by a string, except the reserved ones, free to be reused.
+ * This also recovers the ids lost on restart, e.g. the ones of the strings removed before the
+ * last snapshot. Must not be called concurrently with getOrInsertStrId.
+ */
+func (s *basicStrStore) resetFreeStrIds(reserved map[strId]bool) {
+	s.dicts.Range(func(_, d interface{}) bool {
+		d.(*strDict).resetFreeStrIds(reserved)
+		return true
+	})
+}
+
+// Makes the ids free to be reused.
+func (s *basicStrStore) releaseStrIds(ids map[strId]bool) {
+	idsByCol := make(map[columnId][]strId)
+	for sid := range ids {
+		idsByCol[sid.colId()] = append(idsByCol[sid.colId()], sid)
+	}
+
+	for colId, colIds := range idsByCol {
+		if dict, ok := s.getDict(colId); ok {
+			dict.releaseStrIds(colIds)
+		}
+	}
+}
+
+// --------------------------- internal ----------------------------
+// The limit of the number of strings of each column.
+func (s *basicStrStore) getMaxStrCount() uint32 {
+	return min(s.ctx.GetMaxStrCount(), maxLocalStrCount)
+}
+
+func (s *basicStrStore) getDict(colId columnId) (*strDict, bool) {
+	dict, ok := s.dicts.Load(colId)
+	if !ok {
+		return nil, false
+	}
+	return dict.(*strDict), true
+}
+
+func (s *basicStrStore) getOrCreateDict(colId columnId) (*strDict, bool) {
+	if colId > maxStrColumnId {
+		s.ctx.Logger.DPanicf("column id is too large for strs: %d", colId)
+		return nil, false
+	}
+	if dict, ok := s.getDict(colId); ok {
+		return dict, true
+	}
+
+	dict, _ := s.dicts.LoadOrStore(colId, &strDict{
+		colId:       colId,
+		strIdMap:    sync.Map{},
+		strValueMap: sync.Map{},
+		strCount:    atomic.NewUint32(0),
+		strBytes:    atomic.NewInt64(0),
+		freeLock:    &sync.Mutex{},
+		freeStrIds:  make([]strId, 0),
+	})
+	return dict.(*strDict), true
+}
+
+// Reserves a free strId, or a new one if there is none.
+func (d *strDict) reserveStrId(maxStrCount uint32) (strId, bool) {
+	d.freeLock.Lock()
+	if freeCount := len(d.freeStrIds); freeCount > 0 {
+		id := d.freeStrIds[freeCount-1]
+		d.freeStrIds = d.freeStrIds[:freeCount-1]
+		d.freeLock.Unlock()
+		return id, true
+	}
+	d.freeLock.Unlock()
+
+	for {
+		strCount := d.strCount.Load()
+		if strCount >= maxStrCount {
+			return nonexistentStr, false
+		}
+
+		// atomically increase the strCount and make sure we are the only one reserved the
+		// strCount, which will be used as the local id.
+		if swapped := d.strCount.CAS(strCount, strCount+1); swapped {
+			return newStrId(d.colId, strCount), true
+		}
+	}
+}
+
+func (d *strDict) resetFreeStrIds(reserved map[strId]bool) {
+	freeStrIds := make([]strId, 0)
+	strCount := d.strCount.Load()
+	// in the descending order so the smaller ids are reused first
+	for localId := int64(strCount) - 1; localId >= 0; localId-- {
+		sid := newStrId(d.colId, uint32(localId))
+		if _, taken := d.strIdMap.Load(sid); taken || reserved[sid] {
+			continue
+		}
+		freeStrIds = append(freeStrIds, sid)
+	}
+
+	d.freeLock.Lock()
+	d.freeStrIds = freeStrIds
+	d.freeLock.Unlock()
+}
+
+func (d *strDict) releaseStrIds(ids []strId) {
+	d.freeLock.Lock()
+	d.freeStrIds = append(d.freeStrIds, ids...)
+	d.freeLock.Unlock()
 }
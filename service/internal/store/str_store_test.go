@@ -2,6 +2,7 @@ package store
 
 import (
 	"bapi/internal/common"
+	"fmt"
 	"strconv"
 	"sync"
 	"testing"
@@ -24,10 +25,10 @@ func TestStrStore(t *testing.T) {
 	assert.True(t, loaded)
 	assert.Equal(t, strId(1), id)
 
-	id, ok = s.getStrId("hello")
+	id, ok = s.getStrId(columnId(0), "hello")
 	assert.True(t, ok)
 	assert.Equal(t, strId(1), id)
-	_, ok = s.getStrId("world")
+	_, ok = s.getStrId(columnId(0), "world")
 	assert.False(t, ok)
 
 	str, ok := s.getStr(strId(1))
@@ -124,3 +125,108 @@ func TestConcurrentStressWrite(t *testing.T) {
 	assert.True(t, allSuccess)
 	assert.Equal(t, 1, insertCount)
 }
+
+func TestRestoreStr(t *testing.T) {
+	s := newBasicStrStore(common.NewBapiCtx())
+	assert.Nil(t, s.restoreStr(newStrId(columnId(1), 5), "hi", columnId(1)))
+	assert.Nil(t, s.restoreStr(newStrId(columnId(1), 5), "hi", columnId(1)))
+	assert.NotNil(t, s.restoreStr(newStrId(columnId(1), 5), "hello", columnId(1)))
+	assert.NotNil(t, s.restoreStr(newStrId(columnId(1), 6), "hi", columnId(1)))
+	_, ok := s.getStr(newStrId(columnId(1), 6))
+	assert.False(t, ok)
+
+	str, ok := s.getStr(newStrId(columnId(1), 5))
+	assert.True(t, ok)
+	assert.Equal(t, "hi", str)
+	vals, ok := s.search(columnId(1), "h")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"hi"}, vals)
+
+	// new strings get ids after the restored ones
+	id, loaded, ok := s.getOrInsertStrId("world", columnId(1))
+	assert.True(t, ok)
+	assert.False(t, loaded)
+	assert.Equal(t, newStrId(columnId(1), 6), id)
+}
+
+func TestRemoveUnusedStrs(t *testing.T) {
+	s := newBasicStrStore(common.NewBapiCtx())
+	for _, str := range []string{"a", "b", "c", "d"} {
+		s.getOrInsertStrId(str, columnId(1))
+	}
+
+	removed := s.removeUnusedStrs(map[strId]bool{newStrId(columnId(1), 0): true, newStrId(columnId(1), 3): true})
+	assert.Equal(t, map[strId]bool{newStrId(columnId(1), 1): true, newStrId(columnId(1), 2): true}, removed)
+	_, ok := s.getStr(newStrId(columnId(1), 1))
+	assert.False(t, ok)
+	_, ok = s.getStrId(columnId(1), "c")
+	assert.False(t, ok)
+	vals, _ := s.search(columnId(1), "")
+	assert.ElementsMatch(t, []string{"a", "d"}, vals)
+
+	// the removed ids are not reused until being released
+	id, _, _ := s.getOrInsertStrId("e", columnId(1))
+	assert.Equal(t, newStrId(columnId(1), 4), id)
+
+	s.resetFreeStrIds(map[strId]bool{newStrId(columnId(1), 2): true})
+	id, _, _ = s.getOrInsertStrId("f", columnId(1))
+	assert.Equal(t, newStrId(columnId(1), 1), id)
+	id, _, _ = s.getOrInsertStrId("g", columnId(1))
+	assert.Equal(t, newStrId(columnId(1), 5), id)
+
+	s.releaseStrIds(map[strId]bool{newStrId(columnId(1), 2): true})
+	id, _, _ = s.getOrInsertStrId("h", columnId(1))
+	assert.Equal(t, newStrId(columnId(1), 2), id)
+	str, _ := s.getStr(newStrId(columnId(1), 2))
+	assert.Equal(t, "h", str)
+}
+
+func TestResetFreeStrIdsAfterRestore(t *testing.T) {
+	s := newBasicStrStore(common.NewBapiCtx())
+	assert.Nil(t, s.restoreStr(newStrId(columnId(1), 3), "a", columnId(1)))
+
+	// the ids lost on restart are recovered
+	s.resetFreeStrIds(map[strId]bool{})
+	for _, expected := range []uint32{0, 1, 2, 4} {
+		id, _, _ := s.getOrInsertStrId(fmt.Sprintf("str_%d", expected), columnId(1))
+		assert.Equal(t, newStrId(columnId(1), expected), id)
+	}
+}
+
+func TestStrStorePerColumn(t *testing.T) {
+	s := newBasicStrStore(common.NewBapiCtx())
+	eventId, _, _ := s.getOrInsertStrId("init_app", columnId(1))
+	sourceId, _, _ := s.getOrInsertStrId("modal", columnId(2))
+	sameStrId, loaded, _ := s.getOrInsertStrId("init_app", columnId(2))
+
+	// each column has its own ids
+	assert.Equal(t, newStrId(columnId(1), 0), eventId)
+	assert.Equal(t, newStrId(columnId(2), 0), sourceId)
+	assert.False(t, loaded)
+	assert.Equal(t, newStrId(columnId(2), 1), sameStrId)
+	assert.Equal(t, columnId(2), sameStrId.colId())
+	assert.Equal(t, uint32(1), sameStrId.localId())
+
+	str, _ := s.getStr(sameStrId)
+	assert.Equal(t, "init_app", str)
+	_, ok := s.getStrId(columnId(1), "modal")
+	assert.False(t, ok)
+	_, ok = s.getStrId(columnId(3), "modal")
+	assert.False(t, ok)
+
+	vals, _ := s.search(columnId(2), "")
+	assert.ElementsMatch(t, []string{"modal", "init_app"}, vals)
+	vals, _ = s.search(columnId(1), "")
+	assert.Equal(t, []string{"init_app"}, vals)
+
+	count, bytes := s.getStrStats(columnId(2))
+	assert.Equal(t, 2, count)
+	assert.Equal(t, len("modal")+len("init_app"), bytes)
+	s.removeUnusedStrs(map[strId]bool{eventId: true, sourceId: true})
+	count, bytes = s.getStrStats(columnId(2))
+	assert.Equal(t, 1, count)
+	assert.Equal(t, len("modal"), bytes)
+
+	// the id must match the column
+	assert.NotNil(t, s.restoreStr(newStrId(columnId(1), 5), "hi", columnId(2)))
+}
@@ -5,6 +5,8 @@ import (
 	"bapi/internal/pb"
 	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"sort"
 	"sync"
@@ -20,6 +22,15 @@ import (
  *   A column exists in this table iff the column name is present in this map.
  *   A column is created when the table ingests the first row that has value in this column,
  *   except `ts`, which is created upon the creation of the table.
+ * wal: optional write-ahead log. When enabled, every partialBlock is logged before being
+ *   queued for building blocks, so the table can be rebuilt after a restart.
+ * ingestLock: held (read) while a partialBlock is being logged and queued, and held (write)
+ *   by operations that need a consistent view of the blocks and the wal, e.g. Snapshot.
+ *   It also guards `closed` and `pendingFreeStrIds`.
+ * strGcLock: held (read) by the ingesters from getting the strIds of the rows until the
+ *   partialBlock is queued, and held (write) by CollectStrs.
+ * pendingFreeStrIds: the ids of the strings removed by CollectStrs, which can only be reused
+ *   after the next snapshot when the wal is enabled.
  */
 type Table struct {
 	ctx        *common.BapiCtx
@@ -30,7 +41,15 @@ type Table struct {
 	pbChan       chan pbMessage
 	pbQueue      []*partialBlock
 
-	strStore strStore
+	strStore   strStore
+	wal        *wal
+	walStart   walPosition
+	ingestLock *sync.RWMutex
+	closed     bool
+	closeChan  chan bool
+
+	strGcLock         *sync.RWMutex
+	pendingFreeStrIds map[strId]bool
 
 	blocksLock *sync.RWMutex
 	blocks     []*Block
@@ -41,8 +60,17 @@ type tableInfo struct {
 	rowCount *atomic.Uint32
 	minTs    *atomic.Int64
 	maxTs    *atomic.Int64
+
+	// how long the rows are kept, 0 for keeping them forever, @see ApplyRetention
+	retention      *atomic.Duration
+	reclaimedRows  *atomic.Uint64
+	reclaimedBytes *atomic.Uint64
 }
 
+// The minTs and maxTs of a table without rows
+const initialMinTs = int64(0xFFFFFFFF)
+const initialMaxTs = int64(0)
+
 type pbMessage struct {
 	pb       *partialBlock
 	syncChan chan bool
@@ -56,11 +84,20 @@ func NewTable(ctx *common.BapiCtx, name string) *Table {
 		tableInfo: tableInfo{
 			name:     name,
 			rowCount: atomic.NewUint32(0),
-			minTs:    atomic.NewInt64(0xFFFFFFFF),
-			maxTs:    atomic.NewInt64(0),
+			minTs:    atomic.NewInt64(initialMinTs),
+			maxTs:    atomic.NewInt64(initialMaxTs),
+
+			retention:      atomic.NewDuration(0),
+			reclaimedRows:  atomic.NewUint64(0),
+			reclaimedBytes: atomic.NewUint64(0),
 		},
 
-		strStore: newBasicStrStore(ctx),
+		strStore:   newBasicStrStore(ctx),
+		ingestLock: &sync.RWMutex{},
+		closeChan:  make(chan bool),
+
+		strGcLock:         &sync.RWMutex{},
+		pendingFreeStrIds: make(map[strId]bool),
 
 		blocksLock: &sync.RWMutex{},
 		blocks:     make([]*Block, 0),
@@ -78,10 +115,14 @@ func NewTable(ctx *common.BapiCtx, name string) *Table {
 
 	go func() {
 		ticker := time.NewTicker(table.ctx.GetPartialBlockFlushInterval())
+		retentionTicker := time.NewTicker(table.ctx.GetRetentionInterval())
+		compactionTicker := time.NewTicker(table.ctx.GetCompactionInterval())
 		for {
 			select {
 			case pbMsg := <-table.pbChan:
-				table.pbQueue = append(table.pbQueue, pbMsg.pb)
+				if pbMsg.pb != nil {
+					table.pbQueue = append(table.pbQueue, pbMsg.pb)
+				}
 
 				if len(table.pbQueue) == table.ctx.GetMaxPartialBlocks() || pbMsg.syncChan != nil {
 					success := table.processPbQueue()
@@ -94,6 +135,32 @@ func NewTable(ctx *common.BapiCtx, name string) *Table {
 				if success := table.processPbQueue(); success {
 					table.ctx.Logger.Info("added blocks from peroidic task")
 				}
+
+			case <-retentionTicker.C:
+				table.ApplyRetention(time.Now())
+
+			case <-compactionTicker.C:
+				table.Compact()
+
+			case <-table.closeChan:
+				ticker.Stop()
+				retentionTicker.Stop()
+				compactionTicker.Stop()
+				return
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(table.ctx.GetStrGcInterval())
+		for {
+			select {
+			case <-ticker.C:
+				table.CollectStrs()
+
+			case <-table.closeChan:
+				ticker.Stop()
+				return
 			}
 		}
 	}()
@@ -160,12 +227,27 @@ func (t *Table) addPartialBlock(pb *partialBlock, flushImmediatly bool) bool {
 		return false
 	}
 
+	t.ingestLock.RLock()
+	if t.closed {
+		t.ingestLock.RUnlock()
+		t.ctx.Logger.Errorf("table %s is closed, dropping %d rows", t.tableInfo.name, pb.rowCount)
+		return false
+	}
+	if t.wal != nil {
+		if err := t.wal.append(t.newWalRecord(pb)); err != nil {
+			t.ingestLock.RUnlock()
+			t.ctx.Logger.Errorf("failed to write wal, dropping %d rows: %v", pb.rowCount, err)
+			return false
+		}
+	}
+
 	var syncChan chan bool
 	if flushImmediatly {
 		syncChan = make(chan bool)
 	}
 
 	t.pbChan <- pbMessage{pb, syncChan}
+	t.ingestLock.RUnlock()
 
 	if flushImmediatly {
 		return <-syncChan
@@ -174,13 +256,137 @@ func (t *Table) addPartialBlock(pb *partialBlock, flushImmediatly bool) bool {
 	return true
 }
 
+/**
+ * Replays the write-ahead log at the given path, then logs all the rows ingested afterward to it.
+ * Should be called right after the table is created (or after LoadSnapshot, in which case only
+ * the records not covered by the snapshot are replayed) and before ingesting any rows, since the
+ * column ids and string ids are restored to the ones in the log.
+ */
+func (t *Table) OpenWal(path string) error {
+	if t.wal != nil {
+		return errors.New("wal is already opened")
+	}
+
+	wal, err := openWal(t.ctx, path, t.walStart, t.replayWalRecord)
+	if err != nil {
+		return err
+	}
+
+	t.wal = wal
+	return nil
+}
+
+func (t *Table) newWalRecord(pb *partialBlock) *walRecord {
+	columns := make([]*ColumnInfo, 0, len(pb.intPartialColumns)+len(pb.strPartialColumns))
+	addColumn := func(colId columnId) {
+		if colInfo, ok := t.colInfoMap.getColumnInfoById(colId); ok {
+			columns = append(columns, colInfo)
+		} else {
+			t.ctx.Logger.DPanicf("missing column: %d", colId)
+		}
+	}
+	for colId := range pb.intPartialColumns {
+		addColumn(colId)
+	}
+	for colId := range pb.strPartialColumns {
+		addColumn(colId)
+	}
+	for colId := range pb.floatPartialColumns {
+		addColumn(colId)
+	}
+	for colId := range pb.boolPartialColumns {
+		addColumn(colId)
+	}
+	for colId := range pb.strSetPartialColumns {
+		addColumn(colId)
+	}
+
+	strs := make(map[strId]string, len(pb.strIdSet))
+	for sid := range pb.strIdSet {
+		if str, ok := t.strStore.getStr(sid); ok {
+			strs[sid] = str
+		} else {
+			t.ctx.Logger.DPanicf("missing str: %d", sid)
+		}
+	}
+
+	return &walRecord{
+		columns: columns,
+		strs:    strs,
+		pb:      pb,
+	}
+}
+
+func (t *Table) replayWalRecord(record *walRecord) error {
+	for _, colInfo := range record.columns {
+		if err := t.colInfoMap.restoreColumn(colInfo.Name, colInfo.ColumnType, colInfo.id); err != nil {
+			return err
+		}
+	}
+
+	// the strs of both the str columns and the str set columns, @see strIdLocalBits
+	for sid := range record.pb.strIdSet {
+		str, ok := record.strs[sid]
+		if !ok {
+			return fmt.Errorf("missing str: %d", sid)
+		}
+		if err := t.strStore.restoreStr(sid, str, sid.colId()); err != nil {
+			return err
+		}
+	}
+
+	block, err := record.pb.buildBlock()
+	if err != nil {
+		return err
+	}
+
+	t.addBlock(block)
+	return nil
+}
+
+/**
+ * Builds blocks for the pending rows, then stops the background goroutine and closes the wal.
+ * Rows ingested afterward are dropped, while the blocks already added can still be queried.
+ */
+func (t *Table) Close() error {
+	t.ingestLock.Lock()
+	defer func() {
+		t.ingestLock.Unlock()
+	}()
+
+	if t.closed {
+		return nil
+	}
+
+	t.flushPartialBlocks()
+	close(t.closeChan)
+	t.closed = true
+	if t.wal != nil {
+		return t.wal.close()
+	}
+	return nil
+}
+
+// Builds blocks for all the queued partialBlocks and waits until they are added to the table.
+// Must not be called after the table is closed.
+func (t *Table) flushPartialBlocks() {
+	syncChan := make(chan bool)
+	t.pbChan <- pbMessage{nil, syncChan}
+	<-syncChan
+}
+
 func (table *Table) addBlock(block *Block) bool {
 	if block.rowCount == 0 {
 		table.ctx.Logger.Error("refuse to add an empty block")
 		return false
 	}
 
-	// we probably should update metadata and the blocks atomically, but this is good for now.
+	// metadata is updated under the lock so it's consistent with the blocks dropped by retention
+	table.blocksLock.Lock()
+	defer func() {
+		table.blocksLock.Unlock()
+	}()
+
 	for {
 		oldMinTs := table.tableInfo.minTs.Load()
 		if swapped := table.tableInfo.minTs.CAS(oldMinTs, min(oldMinTs, block.minTs)); swapped {
@@ -196,24 +402,28 @@ func (table *Table) addBlock(block *Block) bool {
 	}
 
 	table.tableInfo.rowCount.Add(uint32(block.rowCount))
-
-	table.blocksLock.Lock()
-	defer func() {
-		table.blocksLock.Unlock()
-	}()
-
 	table.blocks = append(table.blocks, block)
-	sort.Slice(table.blocks, func(i, j int) bool {
-		left, right := table.blocks[i], table.blocks[j]
+	sortBlocks(table.blocks)
+	return true
+}
+
+// Sorts the blocks by minTs then maxTs, which is the order of Table.blocks.
+func sortBlocks(blocks []*Block) {
+	sort.Slice(blocks, func(i, j int) bool {
+		left, right := blocks[i], blocks[j]
 		return left.minTs < right.minTs || (left.minTs == right.minTs && left.maxTs < right.maxTs)
 	})
-	return true
 }
 
 // Reads the given buffer and process the rows until either the buffer is empty
 // or reached max rows per block, then add a new block to the table.
 // *Note* this assumes that Scan was just called on the scanner.
 func (table *Table) ingestBufOneBlock(ingester *ingester, scanner *bufio.Scanner, useServerTs bool) (int, int) {
+	table.strGcLock.RLock()
+	defer func() {
+		table.strGcLock.RUnlock()
+	}()
+
 	ingester.zeroOut()
 	cnt_success := 0
 	cnt_all := 0
@@ -255,6 +465,11 @@ func (table *Table) ingestBufOneBlock(ingester *ingester, scanner *bufio.Scanner
 // @param useServerTs if true, this overrides the `ts` column with time.Now().Unix()
 // 	This should be set to true for production logging cases and set to false for data backfill.
 func (table *Table) IngestJsonRows(rows []*pb.RawRow, useServerTs bool) int {
+	table.strGcLock.RLock()
+	defer func() {
+		table.strGcLock.RUnlock()
+	}()
+
 	ingester := table.ingesterPool.Get().(*ingester)
 	cnt_success := 0
 
@@ -270,8 +485,12 @@ func (table *Table) IngestJsonRows(rows []*pb.RawRow, useServerTs bool) int {
 			cur_block_cnt++
 
 			if err := ingester.ingestRawJson(RawJson{
-				Int: row.Int,
-				Str: row.Str,
+				Int:   row.Int,
+				Str:   row.Str,
+				Float: row.Float,
+				Bool:  row.Bool,
+
+				StrSet: toRawStrSets(row.StrSet),
 			}, useServerTs); err != nil {
 				table.ctx.Logger.Errorf("failed to ingest row: %v", err)
 			}
@@ -297,34 +516,50 @@ func (table *Table) IngestJsonRows(rows []*pb.RawRow, useServerTs bool) int {
 	return cnt_success
 }
 
-func (t *Table) GetTableInfo() *pb.TableInfo {
-	intColumns, strColumns := t.colInfoMap.getColumns()
-
-	pbIntColumns := make([]*pb.ColumnInfo, 0)
-	pbStrColumns := make([]*pb.ColumnInfo, 0)
-
-	for _, colInfo := range intColumns {
-		pbIntColumns = append(pbIntColumns, &pb.ColumnInfo{
-			ColumnName: colInfo.Name,
-			ColumnType: pb.ColumnType_INT,
-		})
+func toRawStrSets(strSets map[string]*pb.StrSet) map[string][]string {
+	rawStrSets := make(map[string][]string, len(strSets))
+	for colName, strSet := range strSets {
+		rawStrSets[colName] = strSet.GetValues()
 	}
+	return rawStrSets
+}
 
-	for _, colInfo := range strColumns {
-		pbStrColumns = append(pbStrColumns, &pb.ColumnInfo{
-			ColumnName: colInfo.Name,
-			ColumnType: pb.ColumnType_STR,
-		})
-	}
+func (t *Table) GetTableInfo() *pb.TableInfo {
+	columns := t.colInfoMap.getColumns()
 
 	return &pb.TableInfo{
 		TableName:  t.tableInfo.name,
 		RowCount:   int64(t.tableInfo.rowCount.Load()),
 		MinTs:      int64(t.tableInfo.minTs.Load()),
 		MaxTs:      int64(t.tableInfo.maxTs.Load()),
-		IntColumns: pbIntColumns,
-		StrColumns: pbStrColumns,
+		IntColumns: t.toPbColumnInfos(columns[IntColumnType], pb.ColumnType_INT),
+		StrColumns: t.toPbColumnInfos(columns[StrColumnType], pb.ColumnType_STR),
+
+		RetentionSeconds: int64(t.tableInfo.retention.Load().Seconds()),
+		ReclaimedRows:    int64(t.tableInfo.reclaimedRows.Load()),
+		ReclaimedBytes:   int64(t.tableInfo.reclaimedBytes.Load()),
+
+		FloatColumns:  t.toPbColumnInfos(columns[FloatColumnType], pb.ColumnType_FLOAT),
+		BoolColumns:   t.toPbColumnInfos(columns[BoolColumnType], pb.ColumnType_BOOL),
+		StrSetColumns: t.toPbColumnInfos(columns[StrSetColumnType], pb.ColumnType_STR_SET),
+	}
+}
+
+func (t *Table) toPbColumnInfos(columns []*ColumnInfo, colType pb.ColumnType) []*pb.ColumnInfo {
+	pbColumns := make([]*pb.ColumnInfo, 0, len(columns))
+	for _, colInfo := range columns {
+		pbColInfo := &pb.ColumnInfo{
+			ColumnName: colInfo.Name,
+			ColumnType: colType,
+		}
+		if colInfo.ColumnType == StrColumnType || colInfo.ColumnType == StrSetColumnType {
+			strCount, strBytes := t.strStore.getStrStats(colInfo.id)
+			pbColInfo.StrCount = int64(strCount)
+			pbColInfo.StrBytes = int64(strBytes)
+		}
+		pbColumns = append(pbColumns, pbColInfo)
 	}
+	return pbColumns
 }
 
 func (t *Table) SearchStrValues(colName string, searchStr string) ([]string, bool) {
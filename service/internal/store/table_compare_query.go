@@ -0,0 +1,267 @@
+package store
+
+import (
+	"bapi/internal/pb"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+/**
+ * Compares the groups of the result to the ones of the ts range shifted by each compare offset,
+ * e.g. this hour to the same hour of the day before. The shifted range is queried for all its
+ * groups, whose aggregations are aligned to the groups of the result by the groupby values.
+ */
+func (t *Table) compareTableQuery(query *pb.TableQuery, result *pb.TableQueryResult) []*pb.TableCompareResult {
+	keys := pbGroupKeys(int(result.Count), result.IntResult, result.IntHasValue, result.StrResult, result.StrHasValue, result.StrIdMap)
+	if result.HasOther {
+		// the other group of the result is not a group of the shifted range
+		keys[len(keys)-1] = ""
+	}
+
+	compareResults := make([]*pb.TableCompareResult, 0, len(query.CompareOffsets))
+	for _, offset := range query.CompareOffsets {
+		shifted := proto.Clone(query).(*pb.TableQuery)
+		shifted.MinTs, shifted.MaxTs = shiftTsRange(query.MinTs, query.MaxTs, offset)
+		shifted.CompareOffsets = nil
+		shifted.OrderBy = nil
+		shifted.Limit = 0
+		shifted.RollupOther = false
+		shifted.Having = nil
+
+		// no shifted result if there is no row in the shifted range
+		shiftedResult, ok := t.tableQuery(shifted)
+		if !ok {
+			shiftedResult = &pb.TableQueryResult{}
+		}
+		rowIdxes := alignGroups(keys, pbGroupKeys(
+			int(shiftedResult.Count),
+			shiftedResult.IntResult, shiftedResult.IntHasValue,
+			shiftedResult.StrResult, shiftedResult.StrHasValue, shiftedResult.StrIdMap,
+		))
+
+		compareResult := &pb.TableCompareResult{Offset: offset}
+		intChanges := compareAggColumns(
+			int(result.Count), result.AggIntResult, result.AggIntHasValue,
+			int(shiftedResult.Count), shiftedResult.AggIntResult, shiftedResult.AggIntHasValue,
+			rowIdxes,
+		)
+		compareResult.AggIntResult, compareResult.AggIntHasValue = intChanges.values, intChanges.hasValue
+		compareResult.AggIntDelta, compareResult.AggIntDeltaHasValue = intChanges.deltas, intChanges.deltaHasValue
+		compareResult.AggIntPctChange, compareResult.AggIntPctChangeHasValue = intChanges.pctChanges, intChanges.pctChangeHasValue
+
+		floatChanges := compareAggColumns(
+			int(result.Count), result.AggFloatResult, result.AggFloatHasValue,
+			int(shiftedResult.Count), shiftedResult.AggFloatResult, shiftedResult.AggFloatHasValue,
+			rowIdxes,
+		)
+		compareResult.AggFloatResult, compareResult.AggFloatHasValue = floatChanges.values, floatChanges.hasValue
+		compareResult.AggFloatDelta, compareResult.AggFloatDeltaHasValue = floatChanges.deltas, floatChanges.deltaHasValue
+		compareResult.AggFloatPctChange, compareResult.AggFloatPctChangeHasValue = floatChanges.pctChanges, floatChanges.pctChangeHasValue
+
+		compareResults = append(compareResults, compareResult)
+	}
+	return compareResults
+}
+
+/**
+ * Compares the timelines of the groups of the result to the ones of the ts range shifted by each
+ * compare offset. The ts buckets of the shifted range are counted from the shifted min ts, so they
+ * are aligned to the ones of the result, e.g. the hour 0 of the day before to the hour 0 of today.
+ */
+func (t *Table) compareTimelineQuery(query *pb.TimelineQuery, result *pb.TimelineQueryResult) []*pb.TimelineCompareResult {
+	keys := pbGroupKeys(int(result.Count), result.IntResult, result.IntHasValue, result.StrResult, result.StrHasValue, result.StrIdMap)
+
+	compareResults := make([]*pb.TimelineCompareResult, 0, len(query.CompareOffsets))
+	for _, offset := range query.CompareOffsets {
+		shifted := proto.Clone(query).(*pb.TimelineQuery)
+		shifted.MinTs, shifted.MaxTs = shiftTsRange(query.MinTs, query.MaxTs, offset)
+		shifted.CompareOffsets = nil
+
+		// the shifted range over the limits has no value, like the one without rows
+		shiftedResult, ok, _ := t.timelineQuery(shifted)
+		if !ok {
+			shiftedResult = &pb.TimelineQueryResult{}
+		}
+		rowIdxes := alignGroups(keys, pbGroupKeys(
+			int(shiftedResult.Count),
+			shiftedResult.IntResult, shiftedResult.IntHasValue,
+			shiftedResult.StrResult, shiftedResult.StrHasValue, shiftedResult.StrIdMap,
+		))
+
+		compareResult := &pb.TimelineCompareResult{
+			Offset:         offset,
+			TimelineGroups: make([]*pb.TimelineGroup, 0, len(result.TimelineGroups)),
+		}
+		for i, group := range result.TimelineGroups {
+			if rowIdxes[i] == -1 {
+				compareResult.TimelineGroups = append(compareResult.TimelineGroups, &pb.TimelineGroup{})
+				continue
+			}
+
+			shiftedGroup := shiftedResult.TimelineGroups[rowIdxes[i]]
+			if result.AggIsFloat {
+				changes := compareTimelineValues(group, group.FloatValues, shiftedGroup, shiftedGroup.FloatValues)
+				shiftedGroup.FloatDeltas = changes.deltas
+				shiftedGroup.DeltaHasValue, shiftedGroup.PctChanges, shiftedGroup.PctChangeHasValue =
+					changes.deltaHasValue, changes.pctChanges, changes.pctChangeHasValue
+			} else {
+				changes := compareTimelineValues(group, group.IntValues, shiftedGroup, shiftedGroup.IntValues)
+				shiftedGroup.IntDeltas = changes.deltas
+				shiftedGroup.DeltaHasValue, shiftedGroup.PctChanges, shiftedGroup.PctChangeHasValue =
+					changes.deltaHasValue, changes.pctChanges, changes.pctChangeHasValue
+			}
+			compareResult.TimelineGroups = append(compareResult.TimelineGroups, shiftedGroup)
+		}
+		compareResults = append(compareResults, compareResult)
+	}
+	return compareResults
+}
+
+// --------------------------- internal ----------------------------
+// The shifted values of a column and the changes of the result from them, @see pb.TableCompareResult
+type valueChanges[T numeric] struct {
+	values            []T
+	hasValue          []bool
+	deltas            []T
+	deltaHasValue     []bool
+	pctChanges        []float64
+	pctChangeHasValue []bool
+}
+
+func (c *valueChanges[T]) append(value T, hasValue bool, shifted T, shiftedHasValue bool) {
+	c.values = append(c.values, shifted)
+	c.hasValue = append(c.hasValue, shiftedHasValue)
+
+	var delta T
+	hasDelta := hasValue && shiftedHasValue
+	if hasDelta {
+		delta = value - shifted
+	}
+	c.deltas = append(c.deltas, delta)
+	c.deltaHasValue = append(c.deltaHasValue, hasDelta)
+
+	pctChange := 0.0
+	hasPctChange := hasDelta && shifted != 0
+	if hasPctChange {
+		pctChange = float64(delta) / math.Abs(float64(shifted)) * 100
+	}
+	c.pctChanges = append(c.pctChanges, pctChange)
+	c.pctChangeHasValue = append(c.pctChangeHasValue, hasPctChange)
+}
+
+// Shifts the ts range by the offset, whose max ts is now if not set.
+func shiftTsRange(minTs int64, maxTs *int64, offset int64) (int64, *int64) {
+	shiftedMaxTs := time.Now().Unix() + offset
+	if maxTs != nil {
+		shiftedMaxTs = *maxTs + offset
+	}
+	return minTs + offset, &shiftedMaxTs
+}
+
+/**
+ * The keys of the groups of a result by their groupby values, whose int and str results are of
+ * the groupby columns one after another. The strs are looked up, as the ids of the computed strs
+ * are not the same in the results.
+ */
+func pbGroupKeys(
+	count int,
+	intResult []int64,
+	intHasValue []bool,
+	strResult []uint32,
+	strHasValue []bool,
+	strIdMap map[uint32]string,
+) []string {
+	keys := make([]string, count)
+	for i := range keys {
+		var key strings.Builder
+		for idx := i; idx < len(intResult); idx += count {
+			if intHasValue[idx] {
+				key.WriteString(strconv.FormatInt(intResult[idx], 10))
+			}
+			key.WriteByte(',')
+		}
+		key.WriteByte(';')
+		for idx := i; idx < len(strResult); idx += count {
+			if strHasValue[idx] {
+				key.WriteString(strconv.Quote(strIdMap[strResult[idx]]))
+			}
+			key.WriteByte(',')
+		}
+		keys[i] = key.String()
+	}
+	return keys
+}
+
+// The indexes of the groups of the keys in the shifted keys, -1 if not found or the key is "".
+func alignGroups(keys []string, shiftedKeys []string) []int {
+	shiftedIdxes := make(map[string]int, len(shiftedKeys))
+	for i, key := range shiftedKeys {
+		shiftedIdxes[key] = i
+	}
+
+	rowIdxes := make([]int, len(keys))
+	for i, key := range keys {
+		rowIdxes[i] = -1
+		if idx, ok := shiftedIdxes[key]; ok && key != "" {
+			rowIdxes[i] = idx
+		}
+	}
+	return rowIdxes
+}
+
+// Compares the agg columns of the result to the shifted ones, whose values are of the groups one
+// after another.
+func compareAggColumns[T numeric](
+	count int,
+	values []T,
+	hasValue []bool,
+	shiftedCount int,
+	shiftedValues []T,
+	shiftedHasValue []bool,
+	rowIdxes []int,
+) valueChanges[T] {
+	changes := valueChanges[T]{}
+	if count == 0 {
+		return changes
+	}
+
+	for colIdx := 0; colIdx < len(values)/count; colIdx++ {
+		for i, rowIdx := range rowIdxes {
+			idx := colIdx*count + i
+			if rowIdx == -1 {
+				changes.append(values[idx], hasValue[idx], 0, false)
+				continue
+			}
+			shiftedIdx := colIdx*shiftedCount + rowIdx
+			changes.append(values[idx], hasValue[idx], shiftedValues[shiftedIdx], shiftedHasValue[shiftedIdx])
+		}
+	}
+	return changes
+}
+
+// Compares the values of the group to the ones of the shifted group, by the ts buckets of the latter.
+func compareTimelineValues[T numeric](
+	group *pb.TimelineGroup,
+	values []T,
+	shiftedGroup *pb.TimelineGroup,
+	shiftedValues []T,
+) valueChanges[T] {
+	valueIdxes := make(map[uint32]int, len(group.TsBuckets))
+	for i, tsBucket := range group.TsBuckets {
+		valueIdxes[tsBucket] = i
+	}
+
+	changes := valueChanges[T]{}
+	for i, tsBucket := range shiftedGroup.TsBuckets {
+		if idx, ok := valueIdxes[tsBucket]; ok {
+			changes.append(values[idx], group.HasValue[idx], shiftedValues[i], shiftedGroup.HasValue[i])
+		} else {
+			changes.append(0, false, shiftedValues[i], shiftedGroup.HasValue[i])
+		}
+	}
+	return changes
+}
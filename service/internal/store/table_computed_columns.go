@@ -0,0 +1,421 @@
+package store
+
+import (
+	"bapi/internal/pb"
+	"sync"
+)
+
+// A column computed from the columns of the table for a query, @see pb.ComputedColumn
+type computedColumn struct {
+	name string
+	expr *expr
+}
+
+// The computed columns of a query by name and the strs of the computed str columns.
+type computedColumns struct {
+	columns  map[string]*computedColumn
+	strStore *computedStrStore
+}
+
+// Returns nil if there is no computed column.
+func (t *Table) newComputedColumns(pbColumns []*pb.ComputedColumn) (*computedColumns, bool) {
+	if len(pbColumns) == 0 {
+		return nil, true
+	}
+
+	columns := make(map[string]*computedColumn, len(pbColumns))
+	for _, pbColumn := range pbColumns {
+		if pbColumn.Name == "" {
+			t.ctx.Logger.Warn("fail to build computed column. missing name")
+			return nil, false
+		}
+		if _, ok := t.colInfoMap.getColumnInfo(pbColumn.Name); ok {
+			t.ctx.Logger.Warnf("fail to build computed column. the name is a column of the table: %s", pbColumn.Name)
+			return nil, false
+		}
+		if _, ok := columns[pbColumn.Name]; ok {
+			t.ctx.Logger.Warnf("fail to build computed column. duplicate name: %s", pbColumn.Name)
+			return nil, false
+		}
+
+		e, ok := t.newExpr(pbColumn.Expr)
+		if !ok {
+			return nil, false
+		}
+		columns[pbColumn.Name] = &computedColumn{name: pbColumn.Name, expr: e}
+	}
+	return &computedColumns{
+		columns:  columns,
+		strStore: newComputedStrStore(t.strStore, t.ctx.GetMaxStrCount()),
+	}, true
+}
+
+func (c *computedColumns) get(colName string) (*computedColumn, bool) {
+	if c == nil {
+		return nil, false
+	}
+	column, ok := c.columns[colName]
+	return column, ok
+}
+
+// The strStore of the strs of the table and the computed strs.
+func (c *computedColumns) getStrStore(tableStrStore readOnlyStrStore) readOnlyStrStore {
+	if c == nil {
+		return tableStrStore
+	}
+	return c.strStore
+}
+
+// The type of the column of the table or computed column, false if neither.
+func (t *Table) getColumnType(colName string, computed *computedColumns) (ColumnType, bool) {
+	if column, ok := computed.get(colName); ok {
+		return column.expr.colType, true
+	}
+	colInfo, ok := t.colInfoMap.getColumnInfo(colName)
+	if !ok {
+		return 0, false
+	}
+	return colInfo.ColumnType, true
+}
+
+// Splits the filters into the ones of the columns of the table and of the computed columns.
+func (c *computedColumns) splitFilters(filters []*pb.Filter) ([]*pb.Filter, []*pb.Filter) {
+	if c == nil {
+		return filters, nil
+	}
+
+	tableFilters := make([]*pb.Filter, 0, len(filters))
+	computedFilters := make([]*pb.Filter, 0)
+	for _, filter := range filters {
+		if _, ok := c.columns[filter.ColumnName]; ok {
+			computedFilters = append(computedFilters, filter)
+		} else {
+			tableFilters = append(tableFilters, filter)
+		}
+	}
+	return tableFilters, computedFilters
+}
+
+/**
+ * Maps the results of the columns queried from the blocks to the columns of a query, which may be
+ * computed from them. The rows are filtered by the filters of the computed columns first, as the
+ * blocks only filter by the columns of the table.
+ */
+type computedProjection struct {
+	filters []computedFilter
+	// the columns of the query of each type, in the order of the query
+	intCols   []projectedColumn
+	floatCols []projectedColumn
+	strCols   []projectedColumn
+	strStore  *computedStrStore
+}
+
+// A column of a query, either a column of the block results or a computed one.
+type projectedColumn struct {
+	srcIdx   int
+	computed *computedColumn
+}
+
+// A filter of a computed column, which matches the values like a having filter or a str filter.
+type computedFilter struct {
+	col       *computedColumn
+	numeric   havingFilter
+	op        pb.FilterOp
+	strVals   []string
+	matchStrs func(string) bool
+}
+
+/**
+ * Builds the projection of the columns of the query of each type, and returns the columns to
+ * query from the blocks instead, which are the ones of the table in the query and the ones the
+ * computed columns are computed from. Returns a nil projection if the query has no computed column.
+ */
+func (t *Table) newComputedProjection(query queryWithFilter) (*computedProjection, [3][]string, bool) {
+	colNames := [3][]string{query.getIntColNames(), query.getFloatColNames(), query.getStrColNames()}
+	if query.computed == nil {
+		return nil, colNames, true
+	}
+
+	projection := &computedProjection{strStore: query.computed.strStore}
+	for _, pbFilters := range [][]*pb.Filter{query.getIntFilters(), query.getFloatFilters(), query.getStrFilters()} {
+		_, pbComputedFilters := query.computed.splitFilters(pbFilters)
+		for _, pbFilter := range pbComputedFilters {
+			filter, ok := t.newComputedFilter(query.computed.columns[pbFilter.ColumnName], pbFilter)
+			if !ok {
+				return nil, colNames, false
+			}
+			projection.filters = append(projection.filters, filter)
+		}
+	}
+
+	srcColNames := [3][]string{make([]string, 0), make([]string, 0), make([]string, 0)}
+	colTypes := [3]ColumnType{IntColumnType, FloatColumnType, StrColumnType}
+	// the index of the column in the source columns of its type, which are queried once
+	srcIdxOf := func(col *ColumnInfo) int {
+		typeIdx := indexOf(colTypes[:], col.ColumnType)
+		srcIdx := indexOf(srcColNames[typeIdx], col.Name)
+		if srcIdx < 0 {
+			srcIdx = len(srcColNames[typeIdx])
+			srcColNames[typeIdx] = append(srcColNames[typeIdx], col.Name)
+		}
+		return srcIdx
+	}
+	// the columns of the table are queried in the order of the query before the sources of the
+	// computed ones, so the results of the columns not computed are the same
+	for typeIdx, names := range colNames {
+		for _, name := range names {
+			if _, ok := query.computed.columns[name]; !ok {
+				srcColNames[typeIdx] = append(srcColNames[typeIdx], name)
+			}
+		}
+	}
+
+	projectedCols := [3]*[]projectedColumn{&projection.intCols, &projection.floatCols, &projection.strCols}
+	for typeIdx, names := range colNames {
+		for _, name := range names {
+			column, ok := query.computed.columns[name]
+			if !ok {
+				*projectedCols[typeIdx] = append(*projectedCols[typeIdx], projectedColumn{srcIdx: indexOf(srcColNames[typeIdx], name)})
+				continue
+			}
+			if column.expr.colType != colTypes[typeIdx] {
+				t.ctx.Logger.Warnf("fail to query computed column %s. not of type %v", name, colTypes[typeIdx])
+				return nil, colNames, false
+			}
+			*projectedCols[typeIdx] = append(*projectedCols[typeIdx], projectedColumn{computed: column})
+		}
+	}
+
+	for _, column := range query.computed.columns {
+		column.expr.forEachColumn(func(e *expr) {
+			e.srcIdx = srcIdxOf(e.col)
+		})
+	}
+	return projection, srcColNames, true
+}
+
+// Filters the rows of the result by the computed filters, and projects its columns to the ones of
+// the query.
+func (p *computedProjection) apply(r *BlockQueryResult) (*BlockQueryResult, bool) {
+	if len(p.filters) != 0 {
+		rows := make([]int, 0, r.Count)
+		filterValues := make([]exprValues, len(p.filters))
+		for i, filter := range p.filters {
+			filterValues[i] = filter.col.expr.eval(r, p.strStore)
+		}
+		for rowIdx := 0; rowIdx < r.Count; rowIdx++ {
+			keep := true
+			for i := range p.filters {
+				if keep = p.filters[i].matches(filterValues[i], rowIdx); !keep {
+					break
+				}
+			}
+			if keep {
+				rows = append(rows, rowIdx)
+			}
+		}
+		if len(rows) == 0 {
+			return nil, false
+		}
+		r = selectRows(r, rows)
+	}
+
+	// the strIdSet is of the strs of the table, as the computed ones are only in the strStore
+	projected := &BlockQueryResult{
+		Count:        r.Count,
+		StrResult:    StrResult{strIdSet: r.StrResult.strIdSet},
+		BoolResult:   r.BoolResult,
+		StrSetResult: r.StrSetResult,
+	}
+	for _, col := range p.intCols {
+		if col.computed == nil {
+			projected.IntResult.matrix = append(projected.IntResult.matrix, r.IntResult.matrix[col.srcIdx])
+			projected.IntResult.hasValue = append(projected.IntResult.hasValue, r.IntResult.hasValue[col.srcIdx])
+			continue
+		}
+		values := col.computed.expr.eval(r, p.strStore)
+		projected.IntResult.matrix = append(projected.IntResult.matrix, values.ints)
+		projected.IntResult.hasValue = append(projected.IntResult.hasValue, values.hasValue)
+	}
+	for _, col := range p.floatCols {
+		if col.computed == nil {
+			projected.FloatResult.matrix = append(projected.FloatResult.matrix, r.FloatResult.matrix[col.srcIdx])
+			projected.FloatResult.hasValue = append(projected.FloatResult.hasValue, r.FloatResult.hasValue[col.srcIdx])
+			continue
+		}
+		values := col.computed.expr.eval(r, p.strStore)
+		projected.FloatResult.matrix = append(projected.FloatResult.matrix, values.floats)
+		projected.FloatResult.hasValue = append(projected.FloatResult.hasValue, values.hasValue)
+	}
+	for _, col := range p.strCols {
+		if col.computed == nil {
+			projected.StrResult.matrix = append(projected.StrResult.matrix, r.StrResult.matrix[col.srcIdx])
+			projected.StrResult.hasValue = append(projected.StrResult.hasValue, r.StrResult.hasValue[col.srcIdx])
+			continue
+		}
+
+		values := col.computed.expr.eval(r, p.strStore)
+		sids := make([]strId, r.Count)
+		for rowIdx, str := range values.strs {
+			if values.hasValue[rowIdx] {
+				sids[rowIdx], values.hasValue[rowIdx] = p.strStore.getOrAddStrId(str)
+			}
+		}
+		projected.StrResult.matrix = append(projected.StrResult.matrix, sids)
+		projected.StrResult.hasValue = append(projected.StrResult.hasValue, values.hasValue)
+	}
+	return projected, true
+}
+
+/**
+ * The strs of the computed str columns of a query on top of the strs of the table. The strIds of
+ * the computed strs are taken from the top of the local ids of the last column, which its dict
+ * never reaches as it has at most maxStrCount strs, @see maxLocalStrCount.
+ */
+type computedStrStore struct {
+	readOnlyStrStore
+	m sync.Mutex
+	// the lowest local id the computed strs can take
+	minLocalId uint32
+	strIds     map[string]strId
+	strs       map[strId]string
+}
+
+func newComputedStrStore(tableStrStore readOnlyStrStore, maxStrCount uint32) *computedStrStore {
+	return &computedStrStore{
+		readOnlyStrStore: tableStrStore,
+		minLocalId:       maxStrCount,
+		strIds:           make(map[string]strId),
+		strs:             make(map[strId]string),
+	}
+}
+
+// Returns false if the local ids of the computed strs are used up.
+func (s *computedStrStore) getOrAddStrId(str string) (strId, bool) {
+	s.m.Lock()
+	defer func() {
+		s.m.Unlock()
+	}()
+
+	if sid, ok := s.strIds[str]; ok {
+		return sid, true
+	}
+	// the last local id is taken by nonexistentStr
+	localId := maxLocalStrCount - 1 - uint32(len(s.strIds))
+	if localId < s.minLocalId {
+		return nonexistentStr, false
+	}
+	sid := newStrId(maxStrColumnId, localId)
+	s.strIds[str] = sid
+	s.strs[sid] = str
+	return sid, true
+}
+
+func (s *computedStrStore) getStr(id strId) (string, bool) {
+	s.m.Lock()
+	str, ok := s.strs[id]
+	s.m.Unlock()
+	if ok {
+		return str, true
+	}
+	return s.readOnlyStrStore.getStr(id)
+}
+
+// --------------------------- internal ----------------------------
+func (t *Table) newComputedFilter(column *computedColumn, pbFilter *pb.Filter) (computedFilter, bool) {
+	filter := computedFilter{col: column, op: pbFilter.FilterOp}
+	hasNoValues := pbFilter.FilterOp == pb.FilterOp_NULL || pbFilter.FilterOp == pb.FilterOp_NONNULL
+
+	if column.expr.colType == StrColumnType {
+		switch pbFilter.FilterOp {
+		case pb.FilterOp_EQ, pb.FilterOp_NE, pb.FilterOp_NULL, pb.FilterOp_NONNULL:
+		case pb.FilterOp_PREFIX, pb.FilterOp_CONTAINS, pb.FilterOp_REGEX, pb.FilterOp_IEQ:
+		default:
+			t.ctx.Logger.Warnf("fail to build filter. unsupported op for str filter: %s", pbFilter.ColumnName)
+			return computedFilter{}, false
+		}
+		if len(pbFilter.StrVals) == 0 && !hasNoValues {
+			t.ctx.Logger.Warnf("fail to build filter. str value missing for str filter: %s", pbFilter.ColumnName)
+			return computedFilter{}, false
+		}
+
+		match, _, err := newStrMatcher(pbFilter.FilterOp, pbFilter.StrVals)
+		if err != nil {
+			t.ctx.Logger.Warnf("fail to build filter. invalid pattern for str filter: %s, %v", pbFilter.ColumnName, err)
+			return computedFilter{}, false
+		}
+		filter.strVals = pbFilter.StrVals
+		filter.matchStrs = match
+		return filter, true
+	}
+
+	if !isNumericFilterOp(pbFilter.FilterOp) {
+		t.ctx.Logger.Warnf("fail to build filter. unsupported op for numeric filter: %s", pbFilter.ColumnName)
+		return computedFilter{}, false
+	}
+	if len(pbFilter.IntVals) == 0 && len(pbFilter.FloatVals) == 0 && !hasNoValues {
+		t.ctx.Logger.Warnf("fail to build filter. value missing for numeric filter: %s", pbFilter.ColumnName)
+		return computedFilter{}, false
+	}
+	filter.numeric = havingFilter{op: pbFilter.FilterOp, intVals: pbFilter.IntVals, floatVals: pbFilter.FloatVals}
+	return filter, true
+}
+
+func (f *computedFilter) matches(values exprValues, rowIdx int) bool {
+	hasValue := values.hasValue[rowIdx]
+	switch f.col.expr.colType {
+	case IntColumnType:
+		return f.numeric.matches(values.ints[rowIdx], 0, false /*isFloat*/, hasValue)
+	case FloatColumnType:
+		return f.numeric.matches(0, values.floats[rowIdx], true /*isFloat*/, hasValue)
+	}
+
+	switch f.op {
+	case pb.FilterOp_NULL:
+		return !hasValue
+	case pb.FilterOp_NONNULL:
+		return hasValue
+	}
+	if !hasValue {
+		return f.op == pb.FilterOp_NE
+	}
+
+	str := values.strs[rowIdx]
+	switch f.op {
+	case pb.FilterOp_EQ:
+		return indexOf(f.strVals, str) >= 0
+	case pb.FilterOp_NE:
+		return indexOf(f.strVals, str) < 0
+	default:
+		return f.matchStrs(str)
+	}
+}
+
+// Keeps the rows of the result, @see repeatRows.
+func selectRows(r *BlockQueryResult, rows []int) *BlockQueryResult {
+	return &BlockQueryResult{
+		Count: len(rows),
+		IntResult: IntResult{
+			matrix:   repeatRows(r.IntResult.matrix, rows),
+			hasValue: repeatRows(r.IntResult.hasValue, rows),
+		},
+		StrResult: StrResult{
+			strIdSet: r.StrResult.strIdSet,
+			matrix:   repeatRows(r.StrResult.matrix, rows),
+			hasValue: repeatRows(r.StrResult.hasValue, rows),
+		},
+		FloatResult: FloatResult{
+			matrix:   repeatRows(r.FloatResult.matrix, rows),
+			hasValue: repeatRows(r.FloatResult.hasValue, rows),
+		},
+		BoolResult: BoolResult{
+			matrix:   repeatRows(r.BoolResult.matrix, rows),
+			hasValue: repeatRows(r.BoolResult.hasValue, rows),
+		},
+		StrSetResult: StrSetResult{
+			strIdSet: r.StrSetResult.strIdSet,
+			matrix:   repeatRows(r.StrSetResult.matrix, rows),
+			hasValue: repeatRows(r.StrSetResult.hasValue, rows),
+		},
+	}
+}
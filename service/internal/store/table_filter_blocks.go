@@ -2,7 +2,9 @@ package store
 
 import (
 	"bapi/internal/pb"
+	"regexp"
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -38,10 +40,19 @@ func (t *Table) queryBlocks(query queryWithFilter) ([]*BlockQueryResult, bool) {
 // A wrapper around pb querys providing getters for filtering related fields
 type queryWithFilter struct {
 	q interface{} // *pb.RowsQuery | *pb.TableQuery | *pb.TimelineQuery
+	// for TableQuery and TimelineQuery: the aggCols to query
+	aggs *tableQueryAggs
+	// for RowsQuery: where the previous rows ended, which narrows the ts range
+	cursor *rowsCursor
+	// for TableQuery and TimelineQuery: the computed columns, @see computedProjection
+	computed *computedColumns
 }
 
 func (q *queryWithFilter) getMinTs() int64 {
 	if query, ok := q.q.(*pb.RowsQuery); ok {
+		if q.cursor != nil && query.TsAscending {
+			return max(query.MinTs, q.cursor.ts)
+		}
 		return query.MinTs
 	}
 	if query, ok := q.q.(*pb.TableQuery); ok {
@@ -55,6 +66,12 @@ func (q *queryWithFilter) getMinTs() int64 {
 
 func (q *queryWithFilter) getMaxTs() (int64, bool) {
 	if query, ok := q.q.(*pb.RowsQuery); ok {
+		if q.cursor != nil && !query.TsAscending {
+			if query.MaxTs != nil {
+				return min(query.GetMaxTs(), q.cursor.ts), true
+			}
+			return q.cursor.ts, true
+		}
 		return query.GetMaxTs(), query.MaxTs != nil
 	}
 	if query, ok := q.q.(*pb.TableQuery); ok {
@@ -92,15 +109,75 @@ func (q *queryWithFilter) getStrFilters() []*pb.Filter {
 	return make([]*pb.Filter, 0)
 }
 
+func (q *queryWithFilter) getFloatFilters() []*pb.Filter {
+	if query, ok := q.q.(*pb.RowsQuery); ok {
+		return query.FloatFilters
+	}
+	if query, ok := q.q.(*pb.TableQuery); ok {
+		return query.FloatFilters
+	}
+	if query, ok := q.q.(*pb.TimelineQuery); ok {
+		return query.FloatFilters
+	}
+	return make([]*pb.Filter, 0)
+}
+
+func (q *queryWithFilter) getBoolFilters() []*pb.Filter {
+	if query, ok := q.q.(*pb.RowsQuery); ok {
+		return query.BoolFilters
+	}
+	if query, ok := q.q.(*pb.TableQuery); ok {
+		return query.BoolFilters
+	}
+	if query, ok := q.q.(*pb.TimelineQuery); ok {
+		return query.BoolFilters
+	}
+	return make([]*pb.Filter, 0)
+}
+
+func (q *queryWithFilter) getStrSetFilters() []*pb.Filter {
+	if query, ok := q.q.(*pb.RowsQuery); ok {
+		return query.StrSetFilters
+	}
+	if query, ok := q.q.(*pb.TableQuery); ok {
+		return query.StrSetFilters
+	}
+	if query, ok := q.q.(*pb.TimelineQuery); ok {
+		return query.StrSetFilters
+	}
+	return make([]*pb.Filter, 0)
+}
+
+func (q *queryWithFilter) getFilterExpr() *pb.FilterExpr {
+	if query, ok := q.q.(*pb.RowsQuery); ok {
+		return query.FilterExpr
+	}
+	if query, ok := q.q.(*pb.TableQuery); ok {
+		return query.FilterExpr
+	}
+	if query, ok := q.q.(*pb.TimelineQuery); ok {
+		return query.FilterExpr
+	}
+	return nil
+}
+
 func (q *queryWithFilter) getIntColNames() []string {
 	if query, ok := q.q.(*pb.RowsQuery); ok {
-		return query.IntColumnNames
+		// the ts col is needed to order the rows, @see rowsTsColIdx
+		return append(append([]string{}, query.IntColumnNames...), TS_COLUMN_NAME)
 	}
 	if query, ok := q.q.(*pb.TableQuery); ok {
-		return append(query.GroupbyIntColumnNames, query.AggIntColumnNames...)
+		colNames := append(append([]string{}, query.GroupbyIntColumnNames...), q.aggs.intColNames...)
+		if q.aggs.byTs {
+			// the ts col is needed to order the values
+			colNames = append(colNames, TS_COLUMN_NAME)
+		}
+		return colNames
 	}
 	if query, ok := q.q.(*pb.TimelineQuery); ok {
-		return append(query.GroupbyIntColumnNames, []string{TS_COLUMN_NAME}...)
+		// the ts col is needed to bucket the values
+		colNames := append(append([]string{}, query.GroupbyIntColumnNames...), q.aggs.intColNames...)
+		return append(colNames, TS_COLUMN_NAME)
 	}
 	return make([]string, 0)
 }
@@ -118,17 +195,41 @@ func (q *queryWithFilter) getStrColNames() []string {
 	return make([]string, 0)
 }
 
+func (q *queryWithFilter) getFloatColNames() []string {
+	if query, ok := q.q.(*pb.RowsQuery); ok {
+		return query.FloatColumnNames
+	}
+	if _, ok := q.q.(*pb.TableQuery); ok {
+		return q.aggs.floatColNames
+	}
+	if _, ok := q.q.(*pb.TimelineQuery); ok {
+		return q.aggs.floatColNames
+	}
+	return make([]string, 0)
+}
+
+func (q *queryWithFilter) getBoolColNames() []string {
+	if query, ok := q.q.(*pb.RowsQuery); ok {
+		return query.BoolColumnNames
+	}
+	return make([]string, 0)
+}
+
+func (q *queryWithFilter) getStrSetColNames() []string {
+	if query, ok := q.q.(*pb.RowsQuery); ok {
+		return query.StrSetColumnNames
+	}
+	if query, ok := q.q.(*pb.TableQuery); ok {
+		return query.GroupbyStrSetColumnNames
+	}
+	return make([]string, 0)
+}
+
 func (t *Table) getBlocksToQuery(query queryWithFilter) ([]*Block, bool) {
 	t.blocksLock.RLock()
 	defer func() {
 		t.blocksLock.RUnlock()
 	}()
-	// first block whose minTs >= query.minTs
-	startBlock := sort.Search(len(t.blocks),
-		func(i int) bool {
-			return t.blocks[i].minTs >= query.getMinTs()
-		})
-
 	endBlock := len(t.blocks) - 1
 	if queryMaxTs, queryHasMaxTs := query.getMaxTs(); queryHasMaxTs {
 		// first block whose minTs > query.maxTs
@@ -139,17 +240,18 @@ func (t *Table) getBlocksToQuery(query queryWithFilter) ([]*Block, bool) {
 		endBlock = firstLarger - 1
 	}
 
-	if startBlock == len(t.blocks) {
-		return nil, false
+	// the blocks are sorted by minTs, so a block starting before query.minTs may still have rows
+	// after it, e.g. the rows after a cursor of a RowsQuery
+	blocksToQuery := make([]*Block, 0, endBlock+1)
+	for _, block := range t.blocks[:endBlock+1] {
+		if block.maxTs >= query.getMinTs() {
+			blocksToQuery = append(blocksToQuery, block)
+		}
 	}
 
-	if startBlock > endBlock {
-		t.ctx.Logger.DPanic("table.blocks is not sorted")
+	if len(blocksToQuery) == 0 {
 		return nil, false
 	}
-
-	blocksToQuery := make([]*Block, endBlock-startBlock+1)
-	copy(blocksToQuery, t.blocks[startBlock:endBlock+1])
 	return blocksToQuery, true
 }
 
@@ -185,36 +287,71 @@ func (t *Table) newBlockQuery(query queryWithFilter) (*blockQuery, bool) {
 		return nil, false
 	}
 
-	intColumns, ok := t.colInfoMap.getColumnInfoSliceForType(query.getIntColNames(), IntColumnType)
+	projection, srcColNames, ok := t.newComputedProjection(query)
+	if !ok {
+		t.ctx.Logger.Info(query)
+		return nil, false
+	}
+
+	intColumns, ok := t.colInfoMap.getColumnInfoSliceForType(srcColNames[0], IntColumnType)
+	if !ok {
+		t.ctx.Logger.Info(query)
+		return nil, false
+	}
+
+	strColumns, ok := t.colInfoMap.getColumnInfoSliceForType(srcColNames[2], StrColumnType)
+	if !ok {
+		t.ctx.Logger.Info(query)
+		return nil, false
+	}
+
+	floatColumns, ok := t.colInfoMap.getColumnInfoSliceForType(srcColNames[1], FloatColumnType)
 	if !ok {
 		t.ctx.Logger.Info(query)
 		return nil, false
 	}
 
-	strColumns, ok := t.colInfoMap.getColumnInfoSliceForType(query.getStrColNames(), StrColumnType)
+	boolColumns, ok := t.colInfoMap.getColumnInfoSliceForType(query.getBoolColNames(), BoolColumnType)
+	if !ok {
+		t.ctx.Logger.Info(query)
+		return nil, false
+	}
+
+	strSetColumns, ok := t.colInfoMap.getColumnInfoSliceForType(query.getStrSetColNames(), StrSetColumnType)
 	if !ok {
 		t.ctx.Logger.Info(query)
 		return nil, false
 	}
 
 	return &blockQuery{
-		filter:     blockFilter,
-		intColumns: intColumns,
-		strColumns: strColumns,
+		filter:        blockFilter,
+		intColumns:    intColumns,
+		strColumns:    strColumns,
+		floatColumns:  floatColumns,
+		boolColumns:   boolColumns,
+		strSetColumns: strSetColumns,
+		projection:    projection,
 	}, true
 }
 
-func (t *Table) newBlockfilter(query queryWithFilter) (blockFilter, bool) {
+// Builds the filters of the columns, which are ANDed together.
+func (t *Table) newColumnFilters(
+	pbIntFilters []*pb.Filter,
+	pbStrFilters []*pb.Filter,
+	pbFloatFilters []*pb.Filter,
+	pbBoolFilters []*pb.Filter,
+	pbStrSetFilters []*pb.Filter,
+) (columnFilters, bool) {
 	intFilters := make([]columnFilter[int64], 0)
-	for _, intFilter := range query.getIntFilters() {
+	for _, intFilter := range pbIntFilters {
 		colInfo, ok := t.colInfoMap.getColumnInfoAndAssertType(intFilter.ColumnName, IntColumnType)
-		if !ok {
-			return blockFilter{}, false
+		if !ok || !isNumericFilterOp(intFilter.FilterOp) {
+			return columnFilters{}, false
 		}
 
 		if intFilter.IntVals == nil || len(intFilter.IntVals) == 0 {
 			t.ctx.Logger.Warnf("fail to build filter. int value missing for int filter: %s", intFilter.ColumnName)
-			return blockFilter{}, false
+			return columnFilters{}, false
 		}
 
 		intFilters = append(intFilters, columnFilter[int64]{
@@ -225,32 +362,223 @@ func (t *Table) newBlockfilter(query queryWithFilter) (blockFilter, bool) {
 	}
 
 	strFilters := make([]columnFilter[strId], 0)
-	for _, strFilter := range query.getStrFilters() {
+	for _, strFilter := range pbStrFilters {
 		colInfo, ok := t.colInfoMap.getColumnInfoAndAssertType(strFilter.ColumnName, StrColumnType)
 		if !ok {
-			return blockFilter{}, false
+			return columnFilters{}, false
+		}
+
+		switch strFilter.FilterOp {
+		case pb.FilterOp_EQ, pb.FilterOp_NE, pb.FilterOp_NULL, pb.FilterOp_NONNULL:
+		case pb.FilterOp_PREFIX, pb.FilterOp_CONTAINS, pb.FilterOp_REGEX, pb.FilterOp_IEQ:
+		default:
+			t.ctx.Logger.Warnf("fail to build filter. unsupported op for str filter: %s", strFilter.ColumnName)
+			return columnFilters{}, false
 		}
 
 		if strFilter.StrVals == nil || len(strFilter.StrVals) == 0 {
 			t.ctx.Logger.Warnf("fail to build filter. str value missing for str filter: %s", strFilter.ColumnName)
-			return blockFilter{}, false
+			return columnFilters{}, false
+		}
+		match, isPattern, err := newStrMatcher(strFilter.FilterOp, strFilter.StrVals)
+		if err != nil {
+			t.ctx.Logger.Warnf("fail to build filter. invalid pattern for str filter: %s, %v", strFilter.ColumnName, err)
+			return columnFilters{}, false
+		}
+
+		filter := columnFilter[strId]{col: colInfo, op: strFilter.FilterOp}
+		if isPattern {
+			// the patterns are resolved to the set of the matching strs once, so the blocks only look
+			// up their strIds in it
+			matched := t.strStore.matchStrIds(colInfo.id, match)
+			filter.valueSet = make(map[strId]bool, len(matched))
+			for _, sid := range matched {
+				filter.valueSet[sid] = true
+			}
+		} else {
+			// If the string does not exist in the store, sid will be `nonexistentStr`. The strColStore
+			// is responsible to handle this.
+			for _, str := range strFilter.StrVals {
+				curSid, _ := t.strStore.getStrId(colInfo.id, str)
+				filter.values = append(filter.values, curSid)
+			}
+		}
+		strFilters = append(strFilters, filter)
+	}
+
+	floatFilters := make([]columnFilter[float64], 0)
+	for _, floatFilter := range pbFloatFilters {
+		colInfo, ok := t.colInfoMap.getColumnInfoAndAssertType(floatFilter.ColumnName, FloatColumnType)
+		if !ok || !isNumericFilterOp(floatFilter.FilterOp) {
+			return columnFilters{}, false
+		}
+
+		if floatFilter.FloatVals == nil || len(floatFilter.FloatVals) == 0 {
+			t.ctx.Logger.Warnf("fail to build filter. float value missing for float filter: %s", floatFilter.ColumnName)
+			return columnFilters{}, false
+		}
+
+		floatFilters = append(floatFilters, columnFilter[float64]{
+			col:    colInfo,
+			op:     floatFilter.FilterOp,
+			values: floatFilter.FloatVals,
+		})
+	}
+
+	boolFilters := make([]columnFilter[uint8], 0)
+	for _, boolFilter := range pbBoolFilters {
+		colInfo, ok := t.colInfoMap.getColumnInfoAndAssertType(boolFilter.ColumnName, BoolColumnType)
+		if !ok {
+			return columnFilters{}, false
+		}
+
+		switch boolFilter.FilterOp {
+		case pb.FilterOp_EQ, pb.FilterOp_NE, pb.FilterOp_NULL, pb.FilterOp_NONNULL:
+		default:
+			t.ctx.Logger.Warnf("fail to build filter. unsupported op for bool filter: %s", boolFilter.ColumnName)
+			return columnFilters{}, false
+		}
+
+		if boolFilter.BoolVals == nil || len(boolFilter.BoolVals) == 0 {
+			t.ctx.Logger.Warnf("fail to build filter. bool value missing for bool filter: %s", boolFilter.ColumnName)
+			return columnFilters{}, false
+		}
+		// stored as 0 and 1, @see boolColumnsStorage
+		boolVals := make([]uint8, 0)
+		for _, value := range boolFilter.BoolVals {
+			if value {
+				boolVals = append(boolVals, 1)
+			} else {
+				boolVals = append(boolVals, 0)
+			}
+		}
+
+		boolFilters = append(boolFilters, columnFilter[uint8]{
+			col:    colInfo,
+			op:     boolFilter.FilterOp,
+			values: boolVals,
+		})
+	}
+
+	strSetFilters := make([]columnFilter[strId], 0)
+	for _, strSetFilter := range pbStrSetFilters {
+		colInfo, ok := t.colInfoMap.getColumnInfoAndAssertType(strSetFilter.ColumnName, StrSetColumnType)
+		if !ok {
+			return columnFilters{}, false
+		}
+
+		switch strSetFilter.FilterOp {
+		case pb.FilterOp_CONTAINS, pb.FilterOp_CONTAINS_ANY, pb.FilterOp_NULL, pb.FilterOp_NONNULL:
+		default:
+			t.ctx.Logger.Warnf("fail to build filter. unsupported op for str set filter: %s", strSetFilter.ColumnName)
+			return columnFilters{}, false
+		}
+
+		if strSetFilter.StrVals == nil || len(strSetFilter.StrVals) == 0 {
+			t.ctx.Logger.Warnf("fail to build filter. str value missing for str set filter: %s", strSetFilter.ColumnName)
+			return columnFilters{}, false
 		}
-		// If the string does not exist in the store, sid will be `nonexistentStr`. The strColStore
-		// is responsible to handle this.
+		// `nonexistentStr` is in no set, so CONTAINS matches nothing and CONTAINS_ANY ignores it
 		strVals := make([]strId, 0)
-		for _, str := range strFilter.StrVals {
-			curSid, _ := t.strStore.getStrId(str)
+		for _, str := range strSetFilter.StrVals {
+			curSid, _ := t.strStore.getStrId(colInfo.id, str)
 			strVals = append(strVals, curSid)
-
 		}
 
-		strFilters = append(strFilters, columnFilter[strId]{
+		strSetFilters = append(strSetFilters, columnFilter[strId]{
 			col:    colInfo,
-			op:     strFilter.FilterOp,
+			op:     strSetFilter.FilterOp,
 			values: strVals,
 		})
 	}
 
+	return columnFilters{
+		intFilters:    intFilters,
+		strFilters:    strFilters,
+		floatFilters:  floatFilters,
+		boolFilters:   boolFilters,
+		strSetFilters: strSetFilters,
+	}, true
+}
+
+/**
+ * Builds the filterExpr from the pb one. A leaf has the columnFilters of its filter, which is
+ * validated the same way as the filters of the query.
+ */
+func (t *Table) newFilterExpr(pbExpr *pb.FilterExpr) (*filterExpr, bool) {
+	expr := &filterExpr{
+		op:       pbExpr.Op,
+		children: make([]*filterExpr, 0, len(pbExpr.Children)),
+	}
+
+	switch pbExpr.Op {
+	case pb.FilterExprOp_LEAF:
+		if pbExpr.Filter == nil || len(pbExpr.Children) != 0 {
+			t.ctx.Logger.Warn("fail to build filter. leaf must have a filter and no children")
+			return nil, false
+		}
+
+		colInfo, ok := t.colInfoMap.getColumnInfo(pbExpr.Filter.ColumnName)
+		if !ok {
+			return nil, false
+		}
+		pbFilters := map[ColumnType][]*pb.Filter{colInfo.ColumnType: {pbExpr.Filter}}
+		expr.leaf, ok = t.newColumnFilters(
+			pbFilters[IntColumnType],
+			pbFilters[StrColumnType],
+			pbFilters[FloatColumnType],
+			pbFilters[BoolColumnType],
+			pbFilters[StrSetColumnType],
+		)
+		return expr, ok
+	case pb.FilterExprOp_AND, pb.FilterExprOp_OR:
+		if len(pbExpr.Children) == 0 {
+			t.ctx.Logger.Warnf("fail to build filter. %s must have children", pbExpr.Op)
+			return nil, false
+		}
+	case pb.FilterExprOp_NOT:
+		if len(pbExpr.Children) != 1 {
+			t.ctx.Logger.Warn("fail to build filter. NOT must have one child")
+			return nil, false
+		}
+	default:
+		t.ctx.Logger.Warnf("fail to build filter. unexpected filter expr op: %d", pbExpr.Op)
+		return nil, false
+	}
+
+	for _, pbChild := range pbExpr.Children {
+		child, ok := t.newFilterExpr(pbChild)
+		if !ok {
+			return nil, false
+		}
+		expr.children = append(expr.children, child)
+	}
+	return expr, true
+}
+
+func (t *Table) newBlockfilter(query queryWithFilter) (blockFilter, bool) {
+	// the filters of the computed columns are applied to the block results, @see computedProjection
+	intFilters, _ := query.computed.splitFilters(query.getIntFilters())
+	strFilters, _ := query.computed.splitFilters(query.getStrFilters())
+	floatFilters, _ := query.computed.splitFilters(query.getFloatFilters())
+	columnFilters, ok := t.newColumnFilters(
+		intFilters,
+		strFilters,
+		floatFilters,
+		query.getBoolFilters(),
+		query.getStrSetFilters(),
+	)
+	if !ok {
+		return blockFilter{}, false
+	}
+
+	var expr *filterExpr
+	if pbExpr := query.getFilterExpr(); pbExpr != nil {
+		if expr, ok = t.newFilterExpr(pbExpr); !ok {
+			return blockFilter{}, false
+		}
+	}
+
 	maxTs := time.Now().Unix()
 	if queryMaxTs, queryHasMaxTs := query.getMaxTs(); queryHasMaxTs {
 		maxTs = queryMaxTs
@@ -266,7 +594,50 @@ func (t *Table) newBlockfilter(query queryWithFilter) (blockFilter, bool) {
 		query.getMinTs(),
 		maxTs,
 		tsColInfo,
-		intFilters,
-		strFilters,
+		columnFilters,
+		expr,
 	), true
 }
+
+// The ops of the int and float columns.
+func isNumericFilterOp(op pb.FilterOp) bool {
+	switch op {
+	case pb.FilterOp_EQ, pb.FilterOp_NE, pb.FilterOp_LT, pb.FilterOp_GT, pb.FilterOp_LE, pb.FilterOp_GE,
+		pb.FilterOp_NULL, pb.FilterOp_NONNULL:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns a function matching a str with any of the patterns if the op is a pattern op, e.g.
+// PREFIX. Returns false if the op is not a pattern op.
+func newStrMatcher(op pb.FilterOp, patterns []string) (func(string) bool, bool, error) {
+	var matchPattern func(str string, pattern string) bool
+	switch op {
+	case pb.FilterOp_PREFIX:
+		matchPattern = strings.HasPrefix
+	case pb.FilterOp_CONTAINS:
+		matchPattern = strings.Contains
+	case pb.FilterOp_IEQ:
+		matchPattern = strings.EqualFold
+	case pb.FilterOp_REGEX:
+		regexps := make([]*regexp.Regexp, 0, len(patterns))
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, true, err
+			}
+			regexps = append(regexps, re)
+		}
+		return func(str string) bool {
+			return some(regexps, func(re *regexp.Regexp) bool { return re.MatchString(str) })
+		}, true, nil
+	default:
+		return nil, false, nil
+	}
+
+	return func(str string) bool {
+		return some(patterns, func(pattern string) bool { return matchPattern(str, pattern) })
+	}, true, nil
+}
@@ -2,79 +2,223 @@ package store
 
 import (
 	"bapi/internal/pb"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 	"unsafe"
 )
 
-// TimelineQuery supports only count aggregation at this time. This is achived via having
-// the `ts` column as the aggIntCol with AggOp_TIMELINE_COUNT.
-func (t *Table) TimeilneQuery(query *pb.TimelineQuery) (*pb.TimelineQueryResult, bool) {
-	blockResults, hasResult := t.queryBlocks(queryWithFilter{query})
-	if !hasResult {
-		return nil, false
+/**
+ * Aggregates the rows of each group by ts bucket of the gran, e.g. the p95 of latency of every 5
+ * minutes by endpoint. The ts buckets are counted from the one of the min_ts of the query.
+ * Returns an error if the timeline is over the limits of the query, i.e. max_buckets and
+ * fill_max_points, which is unlike having no rows.
+ */
+func (t *Table) TimeilneQuery(query *pb.TimelineQuery) (*pb.TimelineQueryResult, bool, error) {
+	result, ok, err := t.timelineQuery(query)
+	if ok && len(query.CompareOffsets) != 0 {
+		result.CompareResults = t.compareTimelineQuery(query, result)
 	}
+	return result, ok, err
+}
 
-	aggIntCols := []string{TS_COLUMN_NAME}
-	intColCnt := len(query.GroupbyIntColumnNames) + len(aggIntCols)
+func (t *Table) timelineQuery(query *pb.TimelineQuery) (*pb.TimelineQueryResult, bool, error) {
+	maxTs := time.Now().Unix()
+	if query.MaxTs != nil {
+		maxTs = query.GetMaxTs()
+	}
+	gran := query.Gran
+	if query.GranSeconds == 0 && gran == pb.TimeGran_AUTO {
+		gran = pickAutoGran(query.MinTs, maxTs)
+	}
+	bucketer, err := newTsBucketer(gran, query.GranSeconds, query.Timezone, query.MinTs)
+	if err != nil {
+		t.ctx.Logger.Warnf("fail to build timeline buckets. %v", err)
+		return nil, false, nil
+	}
+	maxBuckets := timelineDefaultMaxBuckets
+	if query.MaxBuckets != 0 {
+		maxBuckets = int(query.MaxBuckets)
+	}
+	// the result has the start ts of the ts buckets up to the last one with rows, which is at most
+	// the one of the max ts of the table, @see getBucketStartTs
+	lastTs := min(maxTs, t.tableInfo.maxTs.Load())
+	// a count <= 0 of a range with rows is an overflow of an extreme min ts
+	if bucketCnt := bucketer.getBucket(lastTs) + 1; lastTs >= query.MinTs && (bucketCnt <= 0 || bucketCnt > int64(maxBuckets)) {
+		return nil, false, fmt.Errorf("the timeline has more ts buckets than max_buckets %d, try a larger gran or min_ts", maxBuckets)
+	}
+
+	computed, ok := t.newComputedColumns(query.ComputedColumns)
+	if !ok {
+		return nil, false, nil
+	}
+	aggs, ok := t.newTimelineQueryAggs(query, bucketer, computed)
+	if !ok {
+		return nil, false, nil
+	}
+
+	blockResults, hasResult := t.queryBlocks(queryWithFilter{q: query, aggs: aggs, computed: computed})
+	if !hasResult {
+		return nil, false, nil
+	}
 
 	aggregator := newAggregator(&aggCtx{
 		logger:           t.ctx.Logger,
-		op:               pb.AggOp_TIMELINE_COUNT,
 		groupbyIntColCnt: len(query.GroupbyIntColumnNames),
-		intColCnt:        intColCnt,
+		intColCnt:        len(query.GroupbyIntColumnNames) + len(aggs.intColNames),
 		groupbyStrColCnt: len(query.GroupbyStrColumnNames),
 		strColCnt:        len(query.GroupbyStrColumnNames),
+		floatColCnt:      len(aggs.floatColNames),
+		aggSpecs:         aggs.specs,
 
 		groupbyIntColumnNames: query.GroupbyIntColumnNames,
 		groupbyStrColumnNames: query.GroupbyStrColumnNames,
-		aggIntColumnNames:     aggIntCols,
-		strStore:              t.strStore,
+		strStore:              computed.getStrStore(t.strStore),
 
-		isTimelineQuery: true,
-		startTs:         query.MinTs,
-		gran:            uint64(query.Gran),
+		aggByTs: aggs.byTs,
 	})
+	result, ok := aggregator.aggregateForTimeline(blockResults)
+	if !ok {
+		return nil, false, nil
+	}
+
+	maxPoints := timelineFillDefaultMaxPoints
+	if query.FillMaxPoints != 0 {
+		maxPoints = int(query.FillMaxPoints)
+	}
+	if !fillTimelineGroups(result.TimelineGroups, query.Fill, maxPoints, bucketer, maxTs, result.AggIsFloat, aggs.specs[0].op == pb.AggOp_COUNT) {
+		return nil, false, fmt.Errorf(
+			"the filled timeline of %d groups has more ts buckets than fill_max_points %d, try a larger gran or fewer groups",
+			len(result.TimelineGroups), maxPoints,
+		)
+	}
 
-	aggregator.aggregateForTableQuery(blockResults)
-	return nil, false
+	// a timeline has a single aggregation
+	result.ApproxRelativeError = aggs.specs[0].relativeError()
+	if query.GranSeconds != 0 {
+		result.GranSeconds = query.GranSeconds
+	} else {
+		result.Gran = gran
+	}
+	result.BucketStartTs = getBucketStartTs(result.TimelineGroups, bucketer)
+	return result, true, nil
+}
+
+// The start ts of the ts buckets from 0 to the last one of the groups.
+func getBucketStartTs(groups []*pb.TimelineGroup, bucketer tsBucketer) []int64 {
+	bucketCnt := 0
+	for _, group := range groups {
+		if len(group.TsBuckets) != 0 {
+			// the ts buckets are sorted
+			bucketCnt = max(bucketCnt, int(group.TsBuckets[len(group.TsBuckets)-1])+1)
+		}
+	}
+
+	startTs := make([]int64, bucketCnt)
+	for bucket := range startTs {
+		startTs[bucket] = bucketer.getBucketStartTs(int64(bucket))
+	}
+	return startTs
 }
 
 func (t *Table) TableQuery(query *pb.TableQuery) (*pb.TableQueryResult, bool) {
-	if len(query.AggIntColumnNames) == 0 {
+	result, ok := t.tableQuery(query)
+	if ok && len(query.CompareOffsets) != 0 {
+		result.CompareResults = t.compareTableQuery(query, result)
+	}
+	return result, ok
+}
+
+func (t *Table) tableQuery(query *pb.TableQuery) (*pb.TableQueryResult, bool) {
+	computed, ok := t.newComputedColumns(query.ComputedColumns)
+	if !ok {
+		return nil, false
+	}
+	aggs, ok := t.newTableQueryAggs(query, computed)
+	if !ok {
 		return nil, false
 	}
 
-	blockResults, hasResult := t.queryBlocks(queryWithFilter{query})
+	// the exploded str set columns are grouped by like the str columns after them
+	groupbyStrColumnNames := query.GroupbyStrColumnNames
+	if len(query.GroupbyStrSetColumnNames) != 0 {
+		groupbyStrColumnNames = append(append([]string{}, query.GroupbyStrColumnNames...), query.GroupbyStrSetColumnNames...)
+	}
+
+	orderBy, ok := t.newOrderByCols(query.OrderBy, query.GroupbyIntColumnNames, groupbyStrColumnNames, aggs.specs)
+	if !ok {
+		return nil, false
+	}
+	having, ok := t.newHavingFilters(query.Having, aggs.specs)
+	if !ok {
+		return nil, false
+	}
+
+	blockResults, hasResult := t.queryBlocks(queryWithFilter{q: query, aggs: aggs, computed: computed})
 	if !hasResult {
 		return nil, false
 	}
 
+	if len(query.GroupbyStrSetColumnNames) != 0 {
+		for i, result := range blockResults {
+			blockResults[i] = explodeStrSets(result)
+		}
+	}
+
 	aggregator := newAggregator(&aggCtx{
 		logger:           t.ctx.Logger,
-		op:               query.AggOp,
 		groupbyIntColCnt: len(query.GroupbyIntColumnNames), // aggIntCols are after groupByIntCols
-		intColCnt:        len(query.GroupbyIntColumnNames) + len(query.AggIntColumnNames),
-		groupbyStrColCnt: len(query.GroupbyStrColumnNames),
-		strColCnt:        len(query.GroupbyStrColumnNames), // aggby str not currently supported
+		intColCnt:        len(query.GroupbyIntColumnNames) + len(aggs.intColNames),
+		groupbyStrColCnt: len(groupbyStrColumnNames),
+		strColCnt:        len(groupbyStrColumnNames), // aggby str not currently supported
+		floatColCnt:      len(aggs.floatColNames),
+		aggSpecs:         aggs.specs,
 
 		groupbyIntColumnNames: query.GroupbyIntColumnNames,
-		groupbyStrColumnNames: query.GroupbyStrColumnNames,
-		aggIntColumnNames:     query.AggIntColumnNames,
-		strStore:              t.strStore,
+		groupbyStrColumnNames: groupbyStrColumnNames,
+		strStore:              computed.getStrStore(t.strStore),
+
+		aggByTs:     aggs.byTs,
+		orderBy:     orderBy,
+		limit:       int(query.Limit),
+		rollupOther: query.RollupOther,
+		having:      having,
 	})
-	return aggregator.aggregateForTableQuery(blockResults)
+	result, ok := aggregator.aggregateForTableQuery(blockResults)
+	if ok {
+		for _, relativeError := range append(result.AggIntRelativeErrors, result.AggFloatRelativeErrors...) {
+			result.ApproxRelativeError = max(result.ApproxRelativeError, relativeError)
+		}
+	}
+	return result, ok
 }
 
 func (t *Table) RowsQuery(query *pb.RowsQuery) (*pb.RowsQueryResult, bool) {
-	if len(query.IntColumnNames) == 0 && len(query.StrColumnNames) == 0 {
+	if len(query.IntColumnNames) == 0 && len(query.StrColumnNames) == 0 && len(query.FloatColumnNames) == 0 &&
+		len(query.BoolColumnNames) == 0 && len(query.StrSetColumnNames) == 0 {
 		return nil, false
 	}
 
-	blockResults, hasResult := t.queryBlocks(queryWithFilter{query})
+	var cursor *rowsCursor
+	if query.Cursor != "" {
+		var ok bool
+		if cursor, ok = decodeRowsCursor(query.Cursor); !ok {
+			t.ctx.Logger.Warnf("invalid rows query cursor: %s", query.Cursor)
+			return nil, false
+		}
+	}
+
+	rows, nextCursor, hasResult := t.queryRowsPage(query, cursor)
 	if !hasResult {
 		return nil, false
 	}
 
-	return t.toPbRowsQueryResult(query, blockResults)
+	result, ok := t.toPbRowsQueryResult(query, []*BlockQueryResult{rows})
+	if ok && nextCursor != nil {
+		result.NextCursor = nextCursor.encode()
+	}
+	return result, ok
 }
 
 func (t *Table) toPbTableQueryResult(query *pb.TableQuery, blockResults []*BlockQueryResult) (*pb.TableQueryResult, bool) {
@@ -140,6 +284,21 @@ func (t *Table) toPbRowsQueryResult(query *pb.RowsQuery, blockResults []*BlockQu
 		return nil, false
 	}
 
+	floatResult, floatHasValue, ok := t.toPbFloatColResult(rowCount, query.FloatColumnNames, blockResults)
+	if !ok {
+		return nil, false
+	}
+
+	boolResult, boolHasValue, ok := t.toPbBoolColResult(rowCount, query.BoolColumnNames, blockResults)
+	if !ok {
+		return nil, false
+	}
+
+	strSetResult, strSetHasValue, ok := t.toPbStrSetColResult(rowCount, query.StrSetColumnNames, blockResults, strIdMap)
+	if !ok {
+		return nil, false
+	}
+
 	return &pb.RowsQueryResult{
 		Count: int32(rowCount),
 
@@ -151,6 +310,18 @@ func (t *Table) toPbRowsQueryResult(query *pb.RowsQuery, blockResults []*BlockQu
 		StrIdMap:       strIdMap,
 		StrResult:      strResult,
 		StrHasValue:    strHasValue,
+
+		FloatColumnNames: query.FloatColumnNames,
+		FloatResult:      floatResult,
+		FloatHasValue:    floatHasValue,
+
+		BoolColumnNames: query.BoolColumnNames,
+		BoolResult:      boolResult,
+		BoolHasValue:    boolHasValue,
+
+		StrSetColumnNames: query.StrSetColumnNames,
+		StrSetResult:      strSetResult,
+		StrSetHasValue:    strSetHasValue,
 	}, true
 }
 
@@ -183,6 +354,110 @@ func (t *Table) toPbIntColResult(rowCount int, colNames []string, blockResults [
 	return intResult, intHasValue, true
 }
 
+func (t *Table) toPbFloatColResult(rowCount int, colNames []string, blockResults []*BlockQueryResult) ([]float64, []bool, bool) {
+	floatResultLen := rowCount * len(colNames)
+	floatResult := make([]float64, floatResultLen)
+	floatHasValue := make([]bool, floatResultLen)
+	for colIdx := range colNames {
+		rowStartIdx := colIdx * rowCount
+		copied := 0
+
+		for _, result := range blockResults {
+			blockStartIdx := rowStartIdx + copied
+
+			count := copy(floatResult[blockStartIdx:], result.FloatResult.matrix[colIdx])
+			if count != result.Count {
+				t.ctx.Logger.DPanic("invalid result")
+				return nil, nil, false
+			}
+
+			count = copy(floatHasValue[blockStartIdx:], result.FloatResult.hasValue[colIdx])
+			if count != result.Count {
+				t.ctx.Logger.DPanic("invalid result")
+				return nil, nil, false
+			}
+			copied += result.Count
+		}
+	}
+
+	return floatResult, floatHasValue, true
+}
+
+func (t *Table) toPbBoolColResult(rowCount int, colNames []string, blockResults []*BlockQueryResult) ([]bool, []bool, bool) {
+	boolResultLen := rowCount * len(colNames)
+	boolResult := make([]bool, boolResultLen)
+	boolHasValue := make([]bool, boolResultLen)
+	for colIdx := range colNames {
+		rowStartIdx := colIdx * rowCount
+		copied := 0
+
+		for _, result := range blockResults {
+			blockStartIdx := rowStartIdx + copied
+
+			count := copy(boolResult[blockStartIdx:], result.BoolResult.matrix[colIdx])
+			if count != result.Count {
+				t.ctx.Logger.DPanic("invalid result")
+				return nil, nil, false
+			}
+
+			count = copy(boolHasValue[blockStartIdx:], result.BoolResult.hasValue[colIdx])
+			if count != result.Count {
+				t.ctx.Logger.DPanic("invalid result")
+				return nil, nil, false
+			}
+			copied += result.Count
+		}
+	}
+
+	return boolResult, boolHasValue, true
+}
+
+// The strs of the sets are added to the given strIdMap.
+func (t *Table) toPbStrSetColResult(
+	rowCount int,
+	colNames []string,
+	blockResults []*BlockQueryResult,
+	strIdMap map[uint32]string,
+) ([]*pb.StrIdSet, []bool, bool) {
+	strSetResultLen := rowCount * len(colNames)
+	strSetResult := make([]*pb.StrIdSet, strSetResultLen)
+	strSetHasValue := make([]bool, strSetResultLen)
+	for _, result := range blockResults {
+		for sid := range result.StrSetResult.strIdSet {
+			str, _ := t.strStore.getStr(sid)
+			strIdMap[uint32(sid)] = str
+		}
+	}
+
+	for colIdx := range colNames {
+		rowStartIdx := colIdx * rowCount
+		copied := 0
+
+		for _, result := range blockResults {
+			blockStartIdx := rowStartIdx + copied
+
+			sets := result.StrSetResult.matrix[colIdx]
+			if len(sets) != result.Count {
+				t.ctx.Logger.DPanic("invalid result")
+				return nil, nil, false
+			}
+			for rowIdx, set := range sets {
+				// *Note* casting strId to its underline type uint32
+				strSetResult[blockStartIdx+rowIdx] = &pb.StrIdSet{StrIds: *(*[]uint32)(unsafe.Pointer(&set))}
+			}
+
+			count := copy(strSetHasValue[blockStartIdx:], result.StrSetResult.hasValue[colIdx])
+			if count != result.Count {
+				t.ctx.Logger.DPanic("invalid result")
+				return nil, nil, false
+			}
+			copied += result.Count
+		}
+	}
+
+	return strSetResult, strSetHasValue, true
+}
+
 func (t *Table) toPbStrColResult(rowCount int, colNames []string, blockResults []*BlockQueryResult) ([]uint32, []bool, map[uint32]string, bool) {
 	strIdMap := make(map[uint32]string)
 
@@ -219,3 +494,358 @@ func (t *Table) toPbStrColResult(rowCount int, colNames []string, blockResults [
 
 	return strResult, strHasValue, strIdMap, true
 }
+
+// The aggCols of a TableQuery or a TimelineQuery and the aggregations of them.
+type tableQueryAggs struct {
+	intColNames   []string
+	floatColNames []string
+	specs         []aggSpec
+	// whether any aggregation is ts ordered, @see aggCtx.aggByTs
+	byTs bool
+	// the precision of the hyperLogLogs of the approximated aggregations
+	hllPrecision uint8
+}
+
+/**
+ * Builds the aggregations of the query, which are either its aggregations or its agg_op of each
+ * of its agg_*_column_names. The columns of the aggregations are looked up to tell if they are
+ * int or float columns, and the columns aggregated more than once are queried once.
+ */
+func (t *Table) newTableQueryAggs(query *pb.TableQuery, computed *computedColumns) (*tableQueryAggs, bool) {
+	aggs := &tableQueryAggs{
+		intColNames:   make([]string, 0),
+		floatColNames: make([]string, 0),
+		specs:         make([]aggSpec, 0),
+		hllPrecision:  defaultHllPrecision,
+	}
+	if query.HllPrecision != 0 {
+		if query.HllPrecision > maxHllPrecision || !isValidHllPrecision(uint8(query.HllPrecision)) {
+			t.ctx.Logger.Warnf("invalid hll precision: %d", query.HllPrecision)
+			return nil, false
+		}
+		aggs.hllPrecision = uint8(query.HllPrecision)
+	}
+
+	if len(query.Aggregations) == 0 {
+		if !t.addAggColumnsOfOp(aggs, query) {
+			return nil, false
+		}
+	} else {
+		for _, aggregation := range query.Aggregations {
+			if !t.addAggregation(aggs, aggregation, computed) {
+				return nil, false
+			}
+		}
+	}
+
+	if len(aggs.specs) == 0 {
+		return nil, false
+	}
+	for _, spec := range aggs.specs {
+		aggs.byTs = aggs.byTs || isTsOrderedAggOp(spec.op)
+	}
+	return aggs, true
+}
+
+// Builds the aggregation of each ts bucket of the query, whose accumulators are bucketed.
+func (t *Table) newTimelineQueryAggs(
+	query *pb.TimelineQuery,
+	bucketer tsBucketer,
+	computed *computedColumns,
+) (*tableQueryAggs, bool) {
+	aggs := &tableQueryAggs{
+		intColNames:   make([]string, 0),
+		floatColNames: make([]string, 0),
+		specs:         make([]aggSpec, 0, 1),
+		byTs:          true,
+		hllPrecision:  defaultHllPrecision,
+	}
+
+	aggregation := &pb.Aggregation{Op: pb.AggOp_COUNT}
+	if query.Aggregation != nil {
+		aggregation = query.Aggregation
+	}
+	// the timelines only had TIMELINE_COUNT before, which is the COUNT of each ts bucket
+	if aggregation.Op == pb.AggOp_TIMELINE_COUNT {
+		aggregation = &pb.Aggregation{Op: pb.AggOp_COUNT, ColumnName: aggregation.ColumnName, Alias: aggregation.Alias}
+	}
+	if !t.addAggregation(aggs, aggregation, computed) {
+		return nil, false
+	}
+
+	spec := &aggs.specs[0]
+	spec.params.bucketer = bucketer
+	return aggs, true
+}
+
+// Adds the agg_op of each agg column of the query, named by the column.
+func (t *Table) addAggColumnsOfOp(aggs *tableQueryAggs, query *pb.TableQuery) bool {
+	if !isTableAggOp(query.AggOp) {
+		t.ctx.Logger.Warnf("invalid agg op: %v", query.AggOp)
+		return false
+	}
+	if query.AggOp == pb.AggOp_PERCENTILE && !isValidQuantiles(query.Quantiles) {
+		t.ctx.Logger.Warnf("invalid quantiles: %v", query.Quantiles)
+		return false
+	}
+
+	addColumn := func(colName string, isFloat bool, colIdx int) {
+		spec := aggSpec{
+			op:      query.AggOp,
+			params:  accParams{hllPrecision: aggs.hllPrecision},
+			isFloat: isFloat,
+			colIdx:  colIdx,
+			alias:   colName,
+		}
+		if query.AggOp != pb.AggOp_PERCENTILE {
+			aggs.specs = append(aggs.specs, spec)
+			return
+		}
+		// a column per quantile
+		for _, q := range query.Quantiles {
+			spec.params.quantile = q
+			spec.alias = quantileColumnName(colName, q)
+			aggs.specs = append(aggs.specs, spec)
+		}
+	}
+
+	aggs.intColNames = query.AggIntColumnNames
+	aggs.floatColNames = query.AggFloatColumnNames
+	for colIdx, colName := range query.AggIntColumnNames {
+		addColumn(colName, false /*isFloat*/, colIdx)
+	}
+	for colIdx, colName := range query.AggFloatColumnNames {
+		addColumn(colName, true /*isFloat*/, colIdx)
+	}
+	return true
+}
+
+// Adds the aggregation of a column of the table or a computed column.
+func (t *Table) addAggregation(aggs *tableQueryAggs, aggregation *pb.Aggregation, computed *computedColumns) bool {
+	if !isTableAggOp(aggregation.Op) {
+		t.ctx.Logger.Warnf("invalid agg op: %v", aggregation.Op)
+		return false
+	}
+	if aggregation.Op == pb.AggOp_PERCENTILE && !isValidQuantiles([]float64{aggregation.Quantile}) {
+		t.ctx.Logger.Warnf("invalid quantile: %v", aggregation.Quantile)
+		return false
+	}
+
+	colName := aggregation.ColumnName
+	if colName == "" {
+		if aggregation.Op != pb.AggOp_COUNT {
+			t.ctx.Logger.Warnf("missing column of agg op: %v", aggregation.Op)
+			return false
+		}
+		// every row has a ts
+		colName = TS_COLUMN_NAME
+	}
+
+	colType, ok := t.getColumnType(colName, computed)
+	if !ok {
+		t.ctx.Logger.Warnf("column not found: %s", colName)
+		return false
+	}
+	isFloat := colType == FloatColumnType
+	if !isFloat && colType != IntColumnType {
+		t.ctx.Logger.Warnf("fail to aggregate column %s. not an int or float column", colName)
+		return false
+	}
+
+	alias := aggregation.Alias
+	if alias == "" {
+		alias = defaultAggAlias(aggregation)
+	}
+	if some(aggs.specs, func(spec aggSpec) bool { return spec.alias == alias }) {
+		t.ctx.Logger.Warnf("duplicate aggregation alias: %s", alias)
+		return false
+	}
+
+	colNames := &aggs.intColNames
+	if isFloat {
+		colNames = &aggs.floatColNames
+	}
+	colIdx := indexOf(*colNames, colName)
+	if colIdx < 0 {
+		colIdx = len(*colNames)
+		*colNames = append(*colNames, colName)
+	}
+
+	aggs.specs = append(aggs.specs, aggSpec{
+		op:      aggregation.Op,
+		params:  accParams{quantile: aggregation.Quantile, hllPrecision: aggs.hllPrecision},
+		isFloat: isFloat,
+		colIdx:  colIdx,
+		alias:   alias,
+	})
+	return true
+}
+
+// Looks up the columns to order by in the groupby columns, then in the aliases of the aggregations.
+func (t *Table) newOrderByCols(
+	pbOrderBy []*pb.OrderBy,
+	groupbyIntColNames []string,
+	groupbyStrColNames []string,
+	specs []aggSpec,
+) ([]orderByCol, bool) {
+	aliases := make([]string, len(specs))
+	for i, spec := range specs {
+		aliases[i] = spec.alias
+	}
+
+	orderBy := make([]orderByCol, 0, len(pbOrderBy))
+	for _, col := range pbOrderBy {
+		if colIdx := indexOf(groupbyIntColNames, col.ColumnName); colIdx >= 0 {
+			orderBy = append(orderBy, orderByCol{kind: orderByGroupbyInt, colIdx: colIdx, desc: col.Desc})
+		} else if colIdx := indexOf(groupbyStrColNames, col.ColumnName); colIdx >= 0 {
+			orderBy = append(orderBy, orderByCol{kind: orderByGroupbyStr, colIdx: colIdx, desc: col.Desc})
+		} else if specIdx := indexOf(aliases, col.ColumnName); specIdx >= 0 {
+			orderBy = append(orderBy, orderByCol{kind: orderByAgg, colIdx: specIdx, desc: col.Desc})
+		} else {
+			t.ctx.Logger.Warnf("fail to order by %s. not a groupby column or an aggregation", col.ColumnName)
+			return nil, false
+		}
+	}
+	return orderBy, true
+}
+
+// Looks up the aggregations of the having filters by their aliases.
+func (t *Table) newHavingFilters(pbHaving []*pb.Filter, specs []aggSpec) ([]havingFilter, bool) {
+	having := make([]havingFilter, 0, len(pbHaving))
+	for _, filter := range pbHaving {
+		specIdx := -1
+		for i, spec := range specs {
+			if spec.alias == filter.ColumnName {
+				specIdx = i
+				break
+			}
+		}
+		if specIdx < 0 {
+			t.ctx.Logger.Warnf("fail to build having filter. not an aggregation: %s", filter.ColumnName)
+			return nil, false
+		}
+
+		hasValues := len(filter.IntVals) != 0 || len(filter.FloatVals) != 0
+		isNullFilter := filter.FilterOp == pb.FilterOp_NULL || filter.FilterOp == pb.FilterOp_NONNULL
+		if !isNumericFilterOp(filter.FilterOp) || (!hasValues && !isNullFilter) {
+			t.ctx.Logger.Warnf("fail to build having filter. invalid filter op or values for %s", filter.ColumnName)
+			return nil, false
+		}
+
+		having = append(having, havingFilter{
+			specIdx:   specIdx,
+			op:        filter.FilterOp,
+			intVals:   filter.IntVals,
+			floatVals: filter.FloatVals,
+		})
+	}
+	return having, true
+}
+
+// Whether the op aggregates the columns of a query, i.e. all but TIMELINE_COUNT.
+func isTableAggOp(op pb.AggOp) bool {
+	_, ok := newAccumulator[int64](op, accParams{})
+	return ok
+}
+
+// The quantiles of PERCENTILE must be in [0, 1], and there must be at least one.
+func isValidQuantiles(quantiles []float64) bool {
+	return len(quantiles) != 0 && every(quantiles, func(q float64) bool { return q >= 0 && q <= 1 })
+}
+
+// Names the result of the quantile of the column, e.g. latency_p99 or latency_p99.9.
+func quantileColumnName(colName string, q float64) string {
+	// formatted as float32 to drop the rounding errors of the multiplication, e.g. 99.89999999999999
+	return colName + "_p" + strconv.FormatFloat(q*100, 'f', -1, 32)
+}
+
+// e.g. avg(latency), p99(latency) and count() for counting the rows
+func defaultAggAlias(aggregation *pb.Aggregation) string {
+	name := strings.ToLower(aggregation.Op.String())
+	if aggregation.Op == pb.AggOp_PERCENTILE {
+		name = "p" + strconv.FormatFloat(aggregation.Quantile*100, 'f', -1, 32)
+	}
+	return name + "(" + aggregation.ColumnName + ")"
+}
+
+/**
+ * Explodes the str set columns into str columns for grouping by, so a row is counted in the
+ * group of each str in its sets. A row is repeated for every combination of the strs of its
+ * sets, and a row without value in a set column is kept as is, without value in the column.
+ * The str columns of the sets are appended after the str columns of the result, while the
+ * bool and str set results are dropped.
+ */
+func explodeStrSets(r *BlockQueryResult) *BlockQueryResult {
+	setColCnt := len(r.StrSetResult.matrix)
+
+	// sourceRows[i] is the row of the i-th exploded row, whose strs are setStrs[colIdx][i]
+	sourceRows := make([]int, 0, r.Count)
+	setStrs := make([][]strId, setColCnt)
+	setHasStr := make([][]bool, setColCnt)
+	for rowIdx := 0; rowIdx < r.Count; rowIdx++ {
+		combination := make([]int, setColCnt)
+		for {
+			sourceRows = append(sourceRows, rowIdx)
+			for colIdx, indexInSet := range combination {
+				set := r.StrSetResult.matrix[colIdx][rowIdx]
+				hasStr := r.StrSetResult.hasValue[colIdx][rowIdx] && len(set) != 0
+				setHasStr[colIdx] = append(setHasStr[colIdx], hasStr)
+				if hasStr {
+					setStrs[colIdx] = append(setStrs[colIdx], set[indexInSet])
+				} else {
+					setStrs[colIdx] = append(setStrs[colIdx], strId(0))
+				}
+			}
+
+			// advances to the next combination like an odometer
+			colIdx := setColCnt - 1
+			for ; colIdx >= 0; colIdx-- {
+				combination[colIdx]++
+				if combination[colIdx] < len(r.StrSetResult.matrix[colIdx][rowIdx]) {
+					break
+				}
+				combination[colIdx] = 0
+			}
+			if colIdx < 0 {
+				break
+			}
+		}
+	}
+
+	strIdSet := make(map[strId]bool, len(r.StrResult.strIdSet)+len(r.StrSetResult.strIdSet))
+	for sid := range r.StrResult.strIdSet {
+		strIdSet[sid] = true
+	}
+	for sid := range r.StrSetResult.strIdSet {
+		strIdSet[sid] = true
+	}
+
+	return &BlockQueryResult{
+		Count: len(sourceRows),
+		IntResult: IntResult{
+			matrix:   repeatRows(r.IntResult.matrix, sourceRows),
+			hasValue: repeatRows(r.IntResult.hasValue, sourceRows),
+		},
+		StrResult: StrResult{
+			strIdSet: strIdSet,
+			matrix:   append(repeatRows(r.StrResult.matrix, sourceRows), setStrs...),
+			hasValue: append(repeatRows(r.StrResult.hasValue, sourceRows), setHasStr...),
+		},
+		FloatResult: FloatResult{
+			matrix:   repeatRows(r.FloatResult.matrix, sourceRows),
+			hasValue: repeatRows(r.FloatResult.hasValue, sourceRows),
+		},
+	}
+}
+
+// Returns the matrix whose i-th row of each column is the sourceRows[i]-th row of the given one.
+func repeatRows[T any](matrix [][]T, sourceRows []int) [][]T {
+	repeated := make([][]T, len(matrix))
+	for colIdx, values := range matrix {
+		repeated[colIdx] = make([]T, len(sourceRows))
+		for i, rowIdx := range sourceRows {
+			repeated[colIdx][i] = values[rowIdx]
+		}
+	}
+	return repeated
+}
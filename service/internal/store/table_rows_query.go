@@ -0,0 +1,275 @@
+package store
+
+import (
+	"bapi/internal/pb"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"sort"
+)
+
+/**
+ * Where the rows of a RowsQuery ended, @see pb.RowsQuery.cursor. The next rows are the ones after
+ * the row of ts and key in the order of the query, skipping the first `skip` rows of the same ts
+ * and key already returned, which are identical.
+ */
+type rowsCursor struct {
+	ts   int64
+	key  uint64
+	skip int
+}
+
+/**
+ * A row of a block result with its ts, and its key to order the rows of the same ts. The key is
+ * the hash of the values of the row, so the order doesn't depend on the blocks the rows are in,
+ * which the compaction changes between the pages, @see rowKey.
+ */
+type rowRef struct {
+	result *BlockQueryResult
+	rowIdx int
+	ts     int64
+	key    uint64
+}
+
+func (c *rowsCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d:%d", c.ts, c.key, c.skip)))
+}
+
+func decodeRowsCursor(encoded string) (*rowsCursor, bool) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+
+	cursor := &rowsCursor{}
+	if n, err := fmt.Sscanf(string(decoded), "%d:%d:%d", &cursor.ts, &cursor.key, &cursor.skip); err != nil || n != 3 || cursor.skip < 0 {
+		return nil, false
+	}
+	return cursor, true
+}
+
+/**
+ * Queries the blocks for the rows of the query in the ts order, and returns the ones after the
+ * cursor up to the limit in a single result, with the cursor of the rows after them if any.
+ *
+ * The blocks are queried from the ones with the rows first in the order, and the scan stops once
+ * no remaining block can have a row before the last one needed, so a limited query of a long ts
+ * range only queries the blocks of the rows returned.
+ */
+func (t *Table) queryRowsPage(query *pb.RowsQuery, cursor *rowsCursor) (*BlockQueryResult, *rowsCursor, bool) {
+	q := queryWithFilter{q: query, cursor: cursor}
+	blocksQuery, ok := t.newBlockQuery(q)
+	if !ok {
+		t.ctx.Logger.Warn("failed to build query")
+		return nil, nil, false
+	}
+
+	blocks, ok := t.getBlocksToQuery(q)
+	if !ok {
+		return nil, nil, false
+	}
+
+	// one more row than the limit tells if there are more rows
+	needed := 0
+	if query.Limit != 0 {
+		needed = int(query.Limit) + 1
+	}
+
+	isBefore := func(left rowRef, right rowRef) bool {
+		if left.ts != right.ts {
+			if query.TsAscending {
+				return left.ts < right.ts
+			}
+			return left.ts > right.ts
+		}
+		return left.key < right.key
+	}
+	// the rows of the same ts and key are identical, so their order doesn't matter
+	sortRows := func(rows []rowRef) {
+		sort.Slice(rows, func(i, j int) bool { return isBefore(rows[i], rows[j]) })
+	}
+
+	// the blocks are sorted by minTs, so the newest rows may be in any block before the last one
+	maxTsOfBlocksBefore := make([]int64, len(blocks))
+	for i, block := range blocks {
+		maxTsOfBlocksBefore[i] = block.maxTs
+		if i > 0 {
+			maxTsOfBlocksBefore[i] = max(maxTsOfBlocksBefore[i], maxTsOfBlocksBefore[i-1])
+		}
+	}
+
+	rows := make([]rowRef, 0)
+	skipped := 0
+	for i := range blocks {
+		blockIdx := i
+		if !query.TsAscending {
+			blockIdx = len(blocks) - 1 - i
+		}
+
+		if needed != 0 && len(rows) >= needed {
+			lastTs := rows[needed-1].ts
+			if query.TsAscending && blocks[blockIdx].minTs > lastTs {
+				break
+			}
+			if !query.TsAscending && maxTsOfBlocksBefore[blockIdx] < lastTs {
+				break
+			}
+		}
+
+		result, ok := blocks[blockIdx].query(t.ctx, blocksQuery)
+		if !ok {
+			continue
+		}
+		tsVals := result.IntResult.matrix[rowsTsColIdx(query)]
+		for rowIdx := 0; rowIdx < result.Count; rowIdx++ {
+			row := rowRef{result: result, rowIdx: rowIdx, ts: tsVals[rowIdx], key: rowKey(result, rowIdx)}
+			// the rows before the cursor ts are filtered out by the blocks query
+			if cursor != nil && row.ts == cursor.ts {
+				if row.key < cursor.key {
+					continue
+				}
+				if row.key == cursor.key && skipped < cursor.skip {
+					skipped++
+					continue
+				}
+			}
+			rows = append(rows, row)
+		}
+
+		if needed != 0 && len(rows) >= needed {
+			sortRows(rows)
+			rows = rows[:needed]
+		}
+	}
+	sortRows(rows)
+
+	var nextCursor *rowsCursor
+	if query.Limit != 0 && len(rows) > int(query.Limit) {
+		rows = rows[:query.Limit]
+
+		last := rows[len(rows)-1]
+		nextCursor = &rowsCursor{ts: last.ts, key: last.key}
+		for _, row := range rows {
+			if row.ts == last.ts && row.key == last.key {
+				nextCursor.skip++
+			}
+		}
+		if cursor != nil && cursor.ts == last.ts && cursor.key == last.key {
+			nextCursor.skip += cursor.skip
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, nil, false
+	}
+	return gatherRows(rows), nextCursor, true
+}
+
+// The index of the ts col in the int cols queried for the query, @see queryWithFilter.getIntColNames
+func rowsTsColIdx(query *pb.RowsQuery) int {
+	return len(query.IntColumnNames)
+}
+
+// --------------------------- internal ----------------------------
+/**
+ * The hash of the values of the row in the result. The str ids are kept by the compaction and the
+ * snapshots, so the key of a row is the same across the pages. The rows of the same key have the
+ * same values of the queried columns, unless the hash collides.
+ */
+func rowKey(result *BlockQueryResult, rowIdx int) uint64 {
+	key := uint64(0)
+	addValue := func(value uint64, hasValue bool) {
+		key = hash128To64(key, value)
+		if !hasValue {
+			key = hash128To64(key, value)
+		}
+	}
+
+	for colIdx, col := range result.IntResult.matrix {
+		addValue(uint64(col[rowIdx]), result.IntResult.hasValue[colIdx][rowIdx])
+	}
+	for colIdx, col := range result.StrResult.matrix {
+		addValue(uint64(col[rowIdx]), result.StrResult.hasValue[colIdx][rowIdx])
+	}
+	for colIdx, col := range result.FloatResult.matrix {
+		addValue(math.Float64bits(col[rowIdx]), result.FloatResult.hasValue[colIdx][rowIdx])
+	}
+	for colIdx, col := range result.BoolResult.matrix {
+		value := uint64(0)
+		if col[rowIdx] {
+			value = 1
+		}
+		addValue(value, result.BoolResult.hasValue[colIdx][rowIdx])
+	}
+	for colIdx, col := range result.StrSetResult.matrix {
+		// the sets are sorted, @see StrSetResult
+		for _, sid := range col[rowIdx] {
+			key = hash128To64(key, uint64(sid))
+		}
+		addValue(uint64(len(col[rowIdx])), result.StrSetResult.hasValue[colIdx][rowIdx])
+	}
+	return key
+}
+
+// Copies the rows in order into a single result.
+func gatherRows(rows []rowRef) *BlockQueryResult {
+	first := rows[0].result
+	intMatrix, intHasValue := gatherColumns(rows, len(first.IntResult.matrix),
+		func(r *BlockQueryResult) ([][]int64, [][]bool) { return r.IntResult.matrix, r.IntResult.hasValue })
+	strMatrix, strHasValue := gatherColumns(rows, len(first.StrResult.matrix),
+		func(r *BlockQueryResult) ([][]strId, [][]bool) { return r.StrResult.matrix, r.StrResult.hasValue })
+	floatMatrix, floatHasValue := gatherColumns(rows, len(first.FloatResult.matrix),
+		func(r *BlockQueryResult) ([][]float64, [][]bool) { return r.FloatResult.matrix, r.FloatResult.hasValue })
+	boolMatrix, boolHasValue := gatherColumns(rows, len(first.BoolResult.matrix),
+		func(r *BlockQueryResult) ([][]bool, [][]bool) { return r.BoolResult.matrix, r.BoolResult.hasValue })
+	strSetMatrix, strSetHasValue := gatherColumns(rows, len(first.StrSetResult.matrix),
+		func(r *BlockQueryResult) ([][][]strId, [][]bool) {
+			return r.StrSetResult.matrix, r.StrSetResult.hasValue
+		})
+
+	// only the strs of the rows kept
+	strIdSet := make(map[strId]bool)
+	for colIdx, col := range strMatrix {
+		for rowIdx, sid := range col {
+			if strHasValue[colIdx][rowIdx] {
+				strIdSet[sid] = true
+			}
+		}
+	}
+	strSetIdSet := make(map[strId]bool)
+	for _, col := range strSetMatrix {
+		for _, set := range col {
+			for _, sid := range set {
+				strSetIdSet[sid] = true
+			}
+		}
+	}
+
+	return &BlockQueryResult{
+		Count:        len(rows),
+		IntResult:    IntResult{matrix: intMatrix, hasValue: intHasValue},
+		StrResult:    StrResult{strIdSet: strIdSet, matrix: strMatrix, hasValue: strHasValue},
+		FloatResult:  FloatResult{matrix: floatMatrix, hasValue: floatHasValue},
+		BoolResult:   BoolResult{matrix: boolMatrix, hasValue: boolHasValue},
+		StrSetResult: StrSetResult{strIdSet: strSetIdSet, matrix: strSetMatrix, hasValue: strSetHasValue},
+	}
+}
+
+func gatherColumns[T any](
+	rows []rowRef,
+	colCnt int,
+	getColumns func(*BlockQueryResult) ([][]T, [][]bool),
+) ([][]T, [][]bool) {
+	matrix := make([][]T, colCnt)
+	hasValue := make([][]bool, colCnt)
+	for colIdx := 0; colIdx < colCnt; colIdx++ {
+		matrix[colIdx] = make([]T, len(rows))
+		hasValue[colIdx] = make([]bool, len(rows))
+		for i, row := range rows {
+			values, valueHasValue := getColumns(row.result)
+			matrix[colIdx][i] = values[colIdx][row.rowIdx]
+			hasValue[colIdx][i] = valueHasValue[colIdx][row.rowIdx]
+		}
+	}
+	return matrix, hasValue
+}
@@ -0,0 +1,1219 @@
+package store
+
+import (
+	"bapi/internal/pb"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * Plans the statement into a RowsQuery, TableQuery or TimelineQuery of the table and runs it,
+ * @see pb.SqlQuery. The result has the planned query even if there is no row. The errors of the
+ * planning are *SqlError at the offending expr of the statement, while the ones of running the
+ * query, e.g. a timeline of too many ts buckets, are not.
+ */
+func (t *Table) SqlQuery(stmt *SqlSelect) (*pb.SqlQueryResult, bool, error) {
+	p := &sqlPlanner{
+		t:            t,
+		stmt:         stmt,
+		now:          time.Now().Unix(),
+		filters:      make(map[ColumnType][]*pb.Filter),
+		computedCols: make(map[string]string),
+		computedType: make(map[string]ColumnType),
+	}
+	result, err := p.plan()
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasValue := false
+	switch {
+	case result.RowsQuery != nil:
+		result.RowsResult, hasValue = t.RowsQuery(result.RowsQuery)
+	case result.TableQuery != nil:
+		result.TableResult, hasValue = t.TableQuery(result.TableQuery)
+	default:
+		var err error
+		if result.TimelineResult, hasValue, err = t.TimeilneQuery(result.TimelineQuery); err != nil {
+			return result, false, err
+		}
+	}
+	return result, hasValue, nil
+}
+
+// --------------------------- internal ----------------------------
+/**
+ * Plans a statement into a query of the table. The conditions of the WHERE on ts are planned into
+ * the ts range of the query, and the others into the filters of the columns, of which the ones
+ * with OR or NOT are in the filter_expr. The exprs other than columns are computed columns named
+ * by their SQL or alias, which the queries of the rows don't support.
+ */
+type sqlPlanner struct {
+	t    *Table
+	stmt *SqlSelect
+	now  int64
+
+	minTs   int64
+	maxTs   *int64
+	filters map[ColumnType][]*pb.Filter
+	// ANDed together
+	filterExprs []*pb.FilterExpr
+
+	computed []*pb.ComputedColumn
+	// the names of the computed columns by the SQL of their exprs, and their types by name
+	computedCols map[string]string
+	computedType map[string]ColumnType
+}
+
+// A constant of a SQL query, whose colType is IntColumnType, FloatColumnType, StrColumnType or
+// BoolColumnType.
+type sqlConst struct {
+	colType  ColumnType
+	intVal   int64
+	floatVal float64
+	strVal   string
+	boolVal  bool
+}
+
+var sqlCompareOps = map[string]pb.FilterOp{
+	"=": pb.FilterOp_EQ, "!=": pb.FilterOp_NE, "<": pb.FilterOp_LT, ">": pb.FilterOp_GT,
+	"<=": pb.FilterOp_LE, ">=": pb.FilterOp_GE,
+}
+
+// The ops of the comparisons with the operands swapped, e.g. `1 < x` is `x > 1`.
+var sqlFlippedOps = map[string]string{"=": "=", "!=": "!=", "<": ">", ">": "<", "<=": ">=", ">=": "<="}
+
+var sqlAggOps = map[string]pb.AggOp{
+	"count": pb.AggOp_COUNT, "sum": pb.AggOp_SUM, "avg": pb.AggOp_AVG, "min": pb.AggOp_MIN,
+	"max": pb.AggOp_MAX, "first": pb.AggOp_FIRST, "last": pb.AggOp_LAST,
+	"percentile": pb.AggOp_PERCENTILE, "approx_count_distinct": pb.AggOp_APPROX_COUNT_DISTINCT,
+}
+
+// e.g. p99(latency) for percentile(latency, 0.99)
+var sqlPercentileFunc = regexp.MustCompile(`^p([0-9]+)$`)
+
+var sqlExprOps = map[string]pb.ExprOp{
+	"+": pb.ExprOp_ADD, "-": pb.ExprOp_SUB, "*": pb.ExprOp_MUL, "/": pb.ExprOp_DIV, "%": pb.ExprOp_MOD,
+	"abs": pb.ExprOp_ABS, "lower": pb.ExprOp_LOWER, "upper": pb.ExprOp_UPPER, "substr": pb.ExprOp_SUBSTR,
+}
+
+// e.g. '5m', '1h' and '1d' for time_bucket
+var sqlDuration = regexp.MustCompile(`^([0-9]+)(s|m|h|d|w|mo)$`)
+
+func (p *sqlPlanner) errorAt(e *sqlExpr, format string, args ...interface{}) *SqlError {
+	return newSqlError(p.stmt.query, e.pos, e.end, format, args...)
+}
+
+func (p *sqlPlanner) plan() (*pb.SqlQueryResult, error) {
+	exprs := []*sqlExpr{p.stmt.where, p.stmt.limit}
+	for _, item := range p.stmt.items {
+		exprs = append(exprs, item.expr)
+	}
+	for _, orderBy := range p.stmt.orderBy {
+		exprs = append(exprs, orderBy.expr)
+	}
+	for _, e := range append(exprs, p.stmt.groupBy...) {
+		if err := p.checkIntOverflow(e); err != nil {
+			return nil, err
+		}
+	}
+
+	var timeBucket *sqlExpr
+	for _, groupBy := range p.stmt.groupBy {
+		if groupBy = p.resolveAlias(groupBy); isSqlCall(groupBy, "time_bucket") {
+			if timeBucket != nil {
+				return nil, p.errorAt(groupBy, "duplicate time_bucket")
+			}
+			timeBucket = groupBy
+		}
+	}
+
+	hasAggregation := false
+	for _, item := range p.stmt.items {
+		hasAggregation = hasAggregation || p.containsAggregation(item.expr)
+	}
+
+	switch {
+	case timeBucket != nil:
+		query, err := p.planTimelineQuery(timeBucket)
+		return &pb.SqlQueryResult{TimelineQuery: query}, err
+	case hasAggregation || len(p.stmt.groupBy) != 0:
+		query, err := p.planTableQuery()
+		return &pb.SqlQueryResult{TableQuery: query}, err
+	default:
+		query, err := p.planRowsQuery()
+		return &pb.SqlQueryResult{RowsQuery: query}, err
+	}
+}
+
+func (p *sqlPlanner) planRowsQuery() (*pb.RowsQuery, error) {
+	query := &pb.RowsQuery{TableName: p.stmt.TableName}
+	columns := map[ColumnType]*[]string{
+		IntColumnType:    &query.IntColumnNames,
+		StrColumnType:    &query.StrColumnNames,
+		FloatColumnType:  &query.FloatColumnNames,
+		BoolColumnType:   &query.BoolColumnNames,
+		StrSetColumnType: &query.StrSetColumnNames,
+	}
+
+	for _, item := range p.stmt.items {
+		if item.expr.kind == sqlStarExpr {
+			for colType, colInfos := range p.t.colInfoMap.getColumns() {
+				colNames := make([]string, 0, len(colInfos))
+				for _, colInfo := range colInfos {
+					colNames = append(colNames, colInfo.Name)
+				}
+				sort.Strings(colNames)
+				*columns[colType] = append(*columns[colType], colNames...)
+			}
+			continue
+		}
+		if item.expr.kind != sqlColumnExpr {
+			return nil, p.errorAt(item.expr, "expected a column, as only the queries with aggregations have exprs")
+		}
+		if item.alias != "" {
+			return nil, p.errorAt(item.expr, "only the aggregations and group bys can have an alias")
+		}
+		colInfo, ok := p.t.colInfoMap.getColumnInfo(item.expr.name)
+		if !ok {
+			return nil, p.errorAt(item.expr, "unknown column")
+		}
+		*columns[colInfo.ColumnType] = append(*columns[colInfo.ColumnType], colInfo.Name)
+	}
+	for _, orderBy := range p.stmt.orderBy {
+		if orderBy.expr.kind != sqlColumnExpr || orderBy.expr.name != TS_COLUMN_NAME || len(p.stmt.orderBy) != 1 {
+			return nil, p.errorAt(orderBy.expr, "the rows can only be ordered by ts")
+		}
+		query.TsAscending = !orderBy.desc
+	}
+
+	limit, err := p.planLimit()
+	if err != nil {
+		return nil, err
+	}
+	query.Limit = limit
+
+	if err := p.planWhere("the rows can't be filtered by exprs"); err != nil {
+		return nil, err
+	}
+	query.MinTs, query.MaxTs = p.minTs, p.maxTs
+	query.IntFilters, query.StrFilters, query.FloatFilters = p.filters[IntColumnType], p.filters[StrColumnType], p.filters[FloatColumnType]
+	query.BoolFilters, query.StrSetFilters = p.filters[BoolColumnType], p.filters[StrSetColumnType]
+	query.FilterExpr = p.filterExpr()
+	return query, nil
+}
+
+func (p *sqlPlanner) planTableQuery() (*pb.TableQuery, error) {
+	query := &pb.TableQuery{TableName: p.stmt.TableName}
+
+	groupbyNames := make(map[string]string, len(p.stmt.groupBy))
+	for _, groupBy := range p.stmt.groupBy {
+		name, colType, err := p.planGroupBy(groupBy)
+		if err != nil {
+			return nil, err
+		}
+		switch colType {
+		case IntColumnType:
+			query.GroupbyIntColumnNames = append(query.GroupbyIntColumnNames, name)
+		case StrColumnType:
+			query.GroupbyStrColumnNames = append(query.GroupbyStrColumnNames, name)
+		case StrSetColumnType:
+			query.GroupbyStrSetColumnNames = append(query.GroupbyStrSetColumnNames, name)
+		default:
+			return nil, p.errorAt(groupBy, "can only group by an int, str or str set column")
+		}
+		groupbyNames[p.resolveAlias(groupBy).String()] = name
+	}
+
+	for _, item := range p.stmt.items {
+		if item.expr.kind == sqlStarExpr {
+			return nil, p.errorAt(item.expr, "can't select * with aggregations or a GROUP BY")
+		}
+		if p.isAggregation(item.expr) {
+			aggregation, err := p.planAggregation(item.expr, item.alias)
+			if err != nil {
+				return nil, err
+			}
+			query.Aggregations = append(query.Aggregations, aggregation)
+			continue
+		}
+		if err := p.checkGroupedItem(item.expr, groupbyNames); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, orderBy := range p.stmt.orderBy {
+		name, err := p.planOrderBy(orderBy.expr, query, groupbyNames)
+		if err != nil {
+			return nil, err
+		}
+		query.OrderBy = append(query.OrderBy, &pb.OrderBy{ColumnName: name, Desc: orderBy.desc})
+	}
+
+	limit, err := p.planLimit()
+	if err != nil {
+		return nil, err
+	}
+	query.Limit = limit
+
+	if err := p.planWhere(""); err != nil {
+		return nil, err
+	}
+	query.MinTs, query.MaxTs = p.minTs, p.maxTs
+	query.IntFilters, query.StrFilters, query.FloatFilters = p.filters[IntColumnType], p.filters[StrColumnType], p.filters[FloatColumnType]
+	query.BoolFilters, query.StrSetFilters = p.filters[BoolColumnType], p.filters[StrSetColumnType]
+	query.FilterExpr = p.filterExpr()
+	query.ComputedColumns = p.computed
+	return query, nil
+}
+
+func (p *sqlPlanner) planTimelineQuery(timeBucket *sqlExpr) (*pb.TimelineQuery, error) {
+	query := &pb.TimelineQuery{TableName: p.stmt.TableName}
+	if err := p.planTimeBucket(timeBucket, query); err != nil {
+		return nil, err
+	}
+
+	groupbyNames := map[string]string{timeBucket.String(): ""}
+	for _, groupBy := range p.stmt.groupBy {
+		if p.resolveAlias(groupBy) == timeBucket {
+			continue
+		}
+		name, colType, err := p.planGroupBy(groupBy)
+		if err != nil {
+			return nil, err
+		}
+		switch colType {
+		case IntColumnType:
+			query.GroupbyIntColumnNames = append(query.GroupbyIntColumnNames, name)
+		case StrColumnType:
+			query.GroupbyStrColumnNames = append(query.GroupbyStrColumnNames, name)
+		default:
+			return nil, p.errorAt(groupBy, "can only group a timeline by an int or str column")
+		}
+		groupbyNames[p.resolveAlias(groupBy).String()] = name
+	}
+
+	for _, item := range p.stmt.items {
+		if item.expr.kind == sqlStarExpr {
+			return nil, p.errorAt(item.expr, "can't select * with a GROUP BY")
+		}
+		if !p.isAggregation(item.expr) {
+			if err := p.checkGroupedItem(item.expr, groupbyNames); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if query.Aggregation != nil {
+			return nil, p.errorAt(item.expr, "a timeline can only have one aggregation")
+		}
+		aggregation, err := p.planAggregation(item.expr, item.alias)
+		if err != nil {
+			return nil, err
+		}
+		query.Aggregation = aggregation
+	}
+
+	if len(p.stmt.orderBy) != 0 {
+		return nil, p.errorAt(p.stmt.orderBy[0].expr, "a timeline is ordered by the ts buckets")
+	}
+	if p.stmt.limit != nil {
+		return nil, p.errorAt(p.stmt.limit, "a timeline can't have a LIMIT")
+	}
+
+	if err := p.planWhere(""); err != nil {
+		return nil, err
+	}
+	if p.minTs == 0 {
+		return nil, p.errorAt(timeBucket, "time_bucket needs a lower bound of ts in the WHERE, e.g. ts >= now() - 86400")
+	}
+	query.MinTs, query.MaxTs = p.minTs, p.maxTs
+	query.IntFilters, query.StrFilters, query.FloatFilters = p.filters[IntColumnType], p.filters[StrColumnType], p.filters[FloatColumnType]
+	query.BoolFilters, query.StrSetFilters = p.filters[BoolColumnType], p.filters[StrSetColumnType]
+	query.FilterExpr = p.filterExpr()
+	query.ComputedColumns = p.computed
+	return query, nil
+}
+
+/**
+ * Plans time_bucket(gran, ts[, timezone]) into the gran of the timeline. The gran is 'auto', a
+ * TimeGran like 'HOUR_1', a duration like '5m', '1h', '1d', '1w' or '1mo', or a number of seconds.
+ * The days, weeks and months are the calendar ones in the timezone.
+ */
+func (p *sqlPlanner) planTimeBucket(timeBucket *sqlExpr, query *pb.TimelineQuery) error {
+	if len(timeBucket.args) != 2 && len(timeBucket.args) != 3 {
+		return p.errorAt(timeBucket, "expected time_bucket(gran, ts[, timezone])")
+	}
+	if ts := timeBucket.args[1]; ts.kind != sqlColumnExpr || ts.name != TS_COLUMN_NAME {
+		return p.errorAt(ts, "expected ts")
+	}
+	if len(timeBucket.args) == 3 {
+		timezone := timeBucket.args[2]
+		if timezone.kind != sqlStrExpr {
+			return p.errorAt(timezone, "expected the name of a timezone, e.g. 'America/New_York'")
+		}
+		if _, err := time.LoadLocation(timezone.strVal); err != nil {
+			return p.errorAt(timezone, "unknown timezone")
+		}
+		query.Timezone = timezone.strVal
+	}
+
+	gran := timeBucket.args[0]
+	seconds := int64(0)
+	switch gran.kind {
+	case sqlIntExpr:
+		seconds = gran.intVal
+	case sqlStrExpr:
+		name := strings.ToUpper(gran.strVal)
+		if timeGran, ok := pb.TimeGran_value[name]; ok && timeGran != int32(pb.TimeGran_INVALID) {
+			query.Gran = pb.TimeGran(timeGran)
+			return nil
+		}
+		match := sqlDuration.FindStringSubmatch(strings.ToLower(gran.strVal))
+		if match == nil {
+			return p.errorAt(gran, "expected 'auto', a duration like '5m' or a number of seconds")
+		}
+		n, err := strconv.ParseInt(match[1], 10, 32)
+		if err != nil {
+			return p.errorAt(gran, "invalid duration")
+		}
+		switch unit := match[2]; unit {
+		case "d", "w", "mo":
+			if n != 1 {
+				return p.errorAt(gran, "the calendar grans are only '1d', '1w' and '1mo'")
+			}
+			query.Gran = map[string]pb.TimeGran{"d": pb.TimeGran_DAY, "w": pb.TimeGran_WEEK, "mo": pb.TimeGran_MONTH}[unit]
+			return nil
+		default:
+			seconds = n * map[string]int64{"s": 1, "m": 60, "h": 3600}[unit]
+		}
+	default:
+		return p.errorAt(gran, "expected 'auto', a duration like '5m' or a number of seconds")
+	}
+
+	if seconds <= 0 || seconds > math.MaxUint32 {
+		return p.errorAt(gran, "invalid gran")
+	}
+	// the fixed TimeGrans, while the other ones are in gran_seconds
+	switch timeGran := pb.TimeGran(seconds); timeGran {
+	case pb.TimeGran_MIN_1, pb.TimeGran_MIN_5, pb.TimeGran_MIN_15, pb.TimeGran_MIN_30,
+		pb.TimeGran_HOUR_1, pb.TimeGran_HOUR_3, pb.TimeGran_HOUR_12:
+		query.Gran = timeGran
+	default:
+		query.GranSeconds = uint32(seconds)
+	}
+	return nil
+}
+
+// Plans a group by into a column of the table or a computed column, and returns its name and type.
+func (p *sqlPlanner) planGroupBy(groupBy *sqlExpr) (string, ColumnType, error) {
+	resolved := p.resolveAlias(groupBy)
+	if p.containsAggregation(resolved) {
+		return "", 0, p.errorAt(groupBy, "can't group by an aggregation")
+	}
+	if isSqlCall(resolved, "time_bucket") {
+		return "", 0, p.errorAt(groupBy, "time_bucket must be a group by of its own")
+	}
+	if resolved.kind == sqlColumnExpr {
+		colInfo, ok := p.t.colInfoMap.getColumnInfo(resolved.name)
+		if !ok {
+			return "", 0, p.errorAt(groupBy, "unknown column")
+		}
+		return colInfo.Name, colInfo.ColumnType, nil
+	}
+	return p.planComputedColumn(resolved, p.aliasOf(resolved))
+}
+
+// Checks a selected expr other than an aggregation is a group by.
+func (p *sqlPlanner) checkGroupedItem(e *sqlExpr, groupbyNames map[string]string) error {
+	switch _, ok := groupbyNames[e.String()]; {
+	case ok:
+		return nil
+	case p.containsAggregation(e):
+		return p.errorAt(e, "aggregations can't be in exprs")
+	case e.kind == sqlColumnExpr:
+		return p.errorAt(e, "must be in the GROUP BY or an aggregation")
+	}
+	return p.errorAt(e, "only the group bys and the aggregations can be selected")
+}
+
+// Plans the aggregation of the call, e.g. count(*), count(DISTINCT user), p99(latency) or
+// percentile(latency, 0.99). Its arg is a column or an expr of the columns.
+func (p *sqlPlanner) planAggregation(call *sqlExpr, alias string) (*pb.Aggregation, error) {
+	aggregation := &pb.Aggregation{Op: sqlAggOps[call.name], Alias: alias}
+	args := call.args
+	if match := sqlPercentileFunc.FindStringSubmatch(call.name); match != nil {
+		aggregation.Op = pb.AggOp_PERCENTILE
+		// p5, p99 and p100 are percents, while p999 and p995 are 0.999 and 0.995. The other names
+		// of 3+ digits read as either, e.g. p250 as 2.5 or 0.25
+		switch digits := match[1]; {
+		case len(digits) <= 2 || digits == "100":
+			quantile, _ := strconv.ParseFloat(digits, 64)
+			aggregation.Quantile = quantile / 100
+		case strings.HasPrefix(digits, "99"):
+			aggregation.Quantile, _ = strconv.ParseFloat("0."+digits, 64)
+		default:
+			return nil, p.errorAt(call, "ambiguous percentile, expected percentile(column, quantile)")
+		}
+	} else if aggregation.Op == pb.AggOp_PERCENTILE {
+		if len(args) != 2 {
+			return nil, p.errorAt(call, "expected percentile(column, quantile)")
+		}
+		quantile, ok := p.constValue(args[1])
+		if !ok || (quantile.colType != IntColumnType && quantile.colType != FloatColumnType) {
+			return nil, p.errorAt(args[1], "expected a quantile in [0, 1]")
+		}
+		aggregation.Quantile = quantile.floatVal
+		if quantile.colType == IntColumnType {
+			aggregation.Quantile = float64(quantile.intVal)
+		}
+		args = args[:1]
+	}
+	if aggregation.Op == pb.AggOp_PERCENTILE && (aggregation.Quantile < 0 || aggregation.Quantile > 1) {
+		return nil, p.errorAt(call, "the quantile must be in [0, 1]")
+	}
+
+	if call.distinct {
+		if aggregation.Op != pb.AggOp_COUNT {
+			return nil, p.errorAt(call, "only count can be DISTINCT")
+		}
+		aggregation.Op = pb.AggOp_COUNT_DISTINCT
+	}
+
+	switch {
+	case aggregation.Op == pb.AggOp_COUNT && (len(args) == 0 || (len(args) == 1 && args[0].kind == sqlStarExpr)):
+		return aggregation, nil
+	case len(args) != 1 || args[0].kind == sqlStarExpr:
+		return nil, p.errorAt(call, "expected %s(column)", call.name)
+	case p.containsAggregation(args[0]):
+		return nil, p.errorAt(args[0], "aggregations can't be nested")
+	}
+
+	colName, colType, err := p.planFilterColumn(args[0], "")
+	if err != nil {
+		return nil, err
+	}
+	if colType != IntColumnType && colType != FloatColumnType {
+		return nil, p.errorAt(args[0], "can only aggregate an int or float column")
+	}
+	aggregation.ColumnName = colName
+	return aggregation, nil
+}
+
+// Plans an order by into a group by, an alias of an aggregation or an aggregation, which is added
+// to the query if it's not selected.
+func (p *sqlPlanner) planOrderBy(e *sqlExpr, query *pb.TableQuery, groupbyNames map[string]string) (string, error) {
+	if e.kind == sqlColumnExpr {
+		for _, aggregation := range query.Aggregations {
+			if aggregation.Alias == e.name {
+				return e.name, nil
+			}
+		}
+	}
+	if name, ok := groupbyNames[p.resolveAlias(e).String()]; ok {
+		return name, nil
+	}
+	if !p.isAggregation(e) {
+		return "", p.errorAt(e, "must be a group by or an aggregation")
+	}
+
+	aggregation, err := p.planAggregation(e, "")
+	if err != nil {
+		return "", err
+	}
+	alias := defaultAggAlias(aggregation)
+	for _, selected := range query.Aggregations {
+		if selected.Op != aggregation.Op || selected.ColumnName != aggregation.ColumnName ||
+			selected.Quantile != aggregation.Quantile {
+			continue
+		}
+		if selected.Alias != "" {
+			return selected.Alias, nil
+		}
+		return alias, nil
+	}
+	query.Aggregations = append(query.Aggregations, aggregation)
+	return alias, nil
+}
+
+func (p *sqlPlanner) planLimit() (uint32, error) {
+	if p.stmt.limit == nil {
+		return 0, nil
+	}
+	limit, ok := p.constValue(p.stmt.limit)
+	if !ok || limit.colType != IntColumnType || limit.intVal <= 0 || limit.intVal > math.MaxUint32 {
+		return 0, p.errorAt(p.stmt.limit, "expected a positive int")
+	}
+	return uint32(limit.intVal), nil
+}
+
+/**
+ * Plans the conditions ANDed in the WHERE into the ts range and the filters. The exprs are planned
+ * into computed columns unless computedErr is set, which is the error of an expr then.
+ */
+func (p *sqlPlanner) planWhere(computedErr string) error {
+	if p.stmt.where == nil {
+		return nil
+	}
+
+	conditions := make([]*sqlExpr, 0)
+	var splitAnd func(e *sqlExpr)
+	splitAnd = func(e *sqlExpr) {
+		if e.kind == sqlBinaryExpr && e.name == "AND" {
+			splitAnd(e.args[0])
+			splitAnd(e.args[1])
+		} else {
+			conditions = append(conditions, e)
+		}
+	}
+	splitAnd(p.stmt.where)
+
+	for _, condition := range conditions {
+		if ok, err := p.planTsBound(condition); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+
+		if needsFilterExpr(condition) {
+			filterExpr, err := p.planFilterExpr(condition)
+			if err != nil {
+				return err
+			}
+			p.filterExprs = append(p.filterExprs, filterExpr)
+			continue
+		}
+
+		filters, colType, err := p.planFilters(condition, computedErr)
+		if err != nil {
+			return err
+		}
+		p.filters[colType] = append(p.filters[colType], filters...)
+	}
+	return nil
+}
+
+// Plans a comparison of ts to a constant into the ts range, e.g. `ts >= now() - 3600`.
+func (p *sqlPlanner) planTsBound(condition *sqlExpr) (bool, error) {
+	if condition.kind != sqlBinaryExpr || sqlFlippedOps[condition.name] == "" || condition.name == "!=" {
+		return false, nil
+	}
+	column, value, op := condition.args[0], condition.args[1], condition.name
+	if column.kind != sqlColumnExpr {
+		column, value, op = value, column, sqlFlippedOps[op]
+	}
+	if column.kind != sqlColumnExpr || column.name != TS_COLUMN_NAME {
+		return false, nil
+	}
+	ts, ok := p.constValue(value)
+	if !ok || ts.colType != IntColumnType {
+		return false, p.errorAt(value, "expected a constant int ts, e.g. now() - 3600")
+	}
+
+	setMinTs := func(minTs int64) { p.minTs = max(p.minTs, minTs) }
+	setMaxTs := func(maxTs int64) {
+		if p.maxTs == nil || maxTs < *p.maxTs {
+			p.maxTs = &maxTs
+		}
+	}
+	// no ts is beyond the bounds of int64, so the range is empty then
+	setEmpty := func() {
+		setMinTs(math.MaxInt64)
+		setMaxTs(math.MinInt64)
+	}
+	switch op {
+	case "=":
+		setMinTs(ts.intVal)
+		setMaxTs(ts.intVal)
+	case ">":
+		if ts.intVal == math.MaxInt64 {
+			setEmpty()
+		} else {
+			setMinTs(ts.intVal + 1)
+		}
+	case ">=":
+		setMinTs(ts.intVal)
+	case "<":
+		if ts.intVal == math.MinInt64 {
+			setEmpty()
+		} else {
+			setMaxTs(ts.intVal - 1)
+		}
+	case "<=":
+		setMaxTs(ts.intVal)
+	}
+	return true, nil
+}
+
+// Whether the condition is planned into a filter_expr, i.e. it has OR or NOT.
+func needsFilterExpr(condition *sqlExpr) bool {
+	return (condition.kind == sqlBinaryExpr && condition.name == "OR") ||
+		(condition.kind == sqlUnaryExpr && condition.name == "NOT") ||
+		(condition.kind == sqlLikeExpr && condition.negated)
+}
+
+// Plans a condition into a filter_expr, whose leaves are the filters of the columns of the table.
+func (p *sqlPlanner) planFilterExpr(condition *sqlExpr) (*pb.FilterExpr, error) {
+	switch {
+	case condition.kind == sqlBinaryExpr && (condition.name == "AND" || condition.name == "OR"):
+		op := pb.FilterExprOp_AND
+		if condition.name == "OR" {
+			op = pb.FilterExprOp_OR
+		}
+		filterExpr := &pb.FilterExpr{Op: op}
+		for _, arg := range condition.args {
+			child, err := p.planFilterExpr(arg)
+			if err != nil {
+				return nil, err
+			}
+			// flattens the children of the same op, e.g. `a OR b OR c`
+			if child.Op == op {
+				filterExpr.Children = append(filterExpr.Children, child.Children...)
+			} else {
+				filterExpr.Children = append(filterExpr.Children, child)
+			}
+		}
+		return filterExpr, nil
+	case condition.kind == sqlUnaryExpr && condition.name == "NOT":
+		child, err := p.planFilterExpr(condition.args[0])
+		if err != nil {
+			return nil, err
+		}
+		return &pb.FilterExpr{Op: pb.FilterExprOp_NOT, Children: []*pb.FilterExpr{child}}, nil
+	case condition.kind == sqlLikeExpr && condition.negated:
+		like := *condition
+		like.negated = false
+		child, err := p.planFilterExpr(&like)
+		if err != nil {
+			return nil, err
+		}
+		return &pb.FilterExpr{Op: pb.FilterExprOp_NOT, Children: []*pb.FilterExpr{child}}, nil
+	}
+
+	filters, _, err := p.planFilters(condition, "exprs can't be in the conditions with OR or NOT")
+	if err != nil {
+		return nil, err
+	}
+	if len(filters) == 1 {
+		return &pb.FilterExpr{Op: pb.FilterExprOp_LEAF, Filter: filters[0]}, nil
+	}
+	filterExpr := &pb.FilterExpr{Op: pb.FilterExprOp_AND}
+	for _, filter := range filters {
+		filterExpr.Children = append(filterExpr.Children, &pb.FilterExpr{Op: pb.FilterExprOp_LEAF, Filter: filter})
+	}
+	return filterExpr, nil
+}
+
+/**
+ * Plans a condition on a column into its filters, which are ANDed, and returns the type of the
+ * column. A NOT IN is a NE filter per value, as a NE filter of many values matches the values
+ * different from any of them.
+ */
+func (p *sqlPlanner) planFilters(condition *sqlExpr, computedErr string) ([]*pb.Filter, ColumnType, error) {
+	switch condition.kind {
+	case sqlBinaryExpr:
+		op, ok := sqlCompareOps[condition.name]
+		if !ok {
+			return nil, 0, p.errorAt(condition, "expected a condition")
+		}
+		column, value := condition.args[0], condition.args[1]
+		if _, isConst := p.constValue(column); isConst {
+			column, value, op = value, column, sqlCompareOps[sqlFlippedOps[condition.name]]
+		}
+		name, colType, err := p.planFilterColumn(column, computedErr)
+		if err != nil {
+			return nil, 0, err
+		}
+		if op != pb.FilterOp_EQ && op != pb.FilterOp_NE && colType != IntColumnType && colType != FloatColumnType {
+			return nil, 0, p.errorAt(condition, "only = and != can compare a column other than int or float")
+		}
+		if colType == StrSetColumnType {
+			return nil, 0, p.errorAt(condition, "expected contains(column, str, ...) or contains_any(column, str, ...) for a str set column")
+		}
+		filter := &pb.Filter{ColumnName: name, FilterOp: op}
+		return []*pb.Filter{filter}, colType, p.setFilterValues(filter, colType, []*sqlExpr{value})
+
+	case sqlInExpr:
+		name, colType, err := p.planFilterColumn(condition.args[0], computedErr)
+		if err != nil {
+			return nil, 0, err
+		}
+		if colType == StrSetColumnType {
+			return nil, 0, p.errorAt(condition, "expected contains_any(column, str, ...) for a str set column")
+		}
+		if !condition.negated {
+			filter := &pb.Filter{ColumnName: name, FilterOp: pb.FilterOp_EQ}
+			return []*pb.Filter{filter}, colType, p.setFilterValues(filter, colType, condition.args[1:])
+		}
+		filters := make([]*pb.Filter, 0, len(condition.args)-1)
+		for _, value := range condition.args[1:] {
+			filter := &pb.Filter{ColumnName: name, FilterOp: pb.FilterOp_NE}
+			if err := p.setFilterValues(filter, colType, []*sqlExpr{value}); err != nil {
+				return nil, 0, err
+			}
+			filters = append(filters, filter)
+		}
+		return filters, colType, nil
+
+	case sqlIsNullExpr:
+		name, colType, err := p.planFilterColumn(condition.args[0], computedErr)
+		if err != nil {
+			return nil, 0, err
+		}
+		filter := &pb.Filter{ColumnName: name, FilterOp: pb.FilterOp_NULL}
+		if condition.negated {
+			filter.FilterOp = pb.FilterOp_NONNULL
+		}
+		// the filters of the columns of the table must have a value, which is ignored
+		switch colType {
+		case IntColumnType:
+			filter.IntVals = []int64{0}
+		case FloatColumnType:
+			filter.FloatVals = []float64{0}
+		case StrColumnType, StrSetColumnType:
+			filter.StrVals = []string{""}
+		case BoolColumnType:
+			filter.BoolVals = []bool{false}
+		}
+		return []*pb.Filter{filter}, colType, nil
+
+	case sqlLikeExpr:
+		name, colType, err := p.planFilterColumn(condition.args[0], computedErr)
+		if err != nil {
+			return nil, 0, err
+		}
+		if colType != StrColumnType {
+			return nil, 0, p.errorAt(condition.args[0], "only a str column can be LIKE a pattern")
+		}
+		pattern, ok := p.constValue(condition.args[1])
+		if !ok || pattern.colType != StrColumnType {
+			return nil, 0, p.errorAt(condition.args[1], "expected a str pattern")
+		}
+		op, value := likeFilter(pattern.strVal)
+		return []*pb.Filter{{ColumnName: name, FilterOp: op, StrVals: []string{value}}}, colType, nil
+
+	case sqlCallExpr:
+		if condition.name != "contains" && condition.name != "contains_any" {
+			break
+		}
+		if len(condition.args) < 2 || condition.args[0].kind != sqlColumnExpr {
+			return nil, 0, p.errorAt(condition, "expected %s(column, str, ...)", condition.name)
+		}
+		name, colType, err := p.planFilterColumn(condition.args[0], computedErr)
+		if err != nil {
+			return nil, 0, err
+		}
+		if colType != StrSetColumnType {
+			return nil, 0, p.errorAt(condition.args[0], "expected a str set column")
+		}
+		filter := &pb.Filter{ColumnName: name, FilterOp: pb.FilterOp_CONTAINS}
+		if condition.name == "contains_any" {
+			filter.FilterOp = pb.FilterOp_CONTAINS_ANY
+		}
+		return []*pb.Filter{filter}, colType, p.setFilterValues(filter, colType, condition.args[1:])
+
+	case sqlColumnExpr:
+		// a bool column is a condition of its own
+		if colInfo, ok := p.t.colInfoMap.getColumnInfo(condition.name); ok && colInfo.ColumnType == BoolColumnType {
+			return []*pb.Filter{{ColumnName: colInfo.Name, FilterOp: pb.FilterOp_EQ, BoolVals: []bool{true}}}, BoolColumnType, nil
+		}
+	}
+	return nil, 0, p.errorAt(condition, "expected a condition")
+}
+
+// The column of a filter, which is a computed column of the expr unless computedErr is set.
+func (p *sqlPlanner) planFilterColumn(e *sqlExpr, computedErr string) (string, ColumnType, error) {
+	if e.kind == sqlColumnExpr {
+		colInfo, ok := p.t.colInfoMap.getColumnInfo(e.name)
+		if !ok {
+			return "", 0, p.errorAt(e, "unknown column")
+		}
+		return colInfo.Name, colInfo.ColumnType, nil
+	}
+	if p.containsAggregation(e) {
+		return "", 0, p.errorAt(e, "aggregations can't be in the WHERE")
+	}
+	if computedErr != "" {
+		return "", 0, p.errorAt(e, "%s", computedErr)
+	}
+	return p.planComputedColumn(e, "")
+}
+
+// Sets the constant values of the filter of the column of the type.
+func (p *sqlPlanner) setFilterValues(filter *pb.Filter, colType ColumnType, values []*sqlExpr) error {
+	_, isComputed := p.computedType[filter.ColumnName]
+	for _, value := range values {
+		c, ok := p.constValue(value)
+		if !ok {
+			return p.errorAt(value, "expected a constant")
+		}
+
+		switch {
+		case colType == IntColumnType && c.colType == IntColumnType:
+			filter.IntVals = append(filter.IntVals, c.intVal)
+		// the computed columns compare the ints to the floats, @see havingFilter
+		case colType == IntColumnType && c.colType == FloatColumnType && isComputed:
+			filter.FloatVals = append(filter.FloatVals, c.floatVal)
+		case colType == FloatColumnType && c.colType == IntColumnType:
+			filter.FloatVals = append(filter.FloatVals, float64(c.intVal))
+		case colType == FloatColumnType && c.colType == FloatColumnType:
+			filter.FloatVals = append(filter.FloatVals, c.floatVal)
+		case (colType == StrColumnType || colType == StrSetColumnType) && c.colType == StrColumnType:
+			filter.StrVals = append(filter.StrVals, c.strVal)
+		case colType == BoolColumnType && c.colType == BoolColumnType:
+			filter.BoolVals = append(filter.BoolVals, c.boolVal)
+		default:
+			return p.errorAt(value, "expected a %s", sqlTypeName(colType))
+		}
+	}
+	return nil
+}
+
+/**
+ * Plans the expr into a computed column named by the name, or its SQL if not set, and returns its
+ * name and type. The same expr is computed once.
+ */
+func (p *sqlPlanner) planComputedColumn(e *sqlExpr, name string) (string, ColumnType, error) {
+	key := e.String()
+	if existing, ok := p.computedCols[key]; ok {
+		return existing, p.computedType[existing], nil
+	}
+
+	pbExpr, colType, err := p.toPbExpr(e)
+	if err != nil {
+		return "", 0, err
+	}
+	if name == "" {
+		name = key
+	}
+	if _, ok := p.t.colInfoMap.getColumnInfo(name); ok {
+		name = key
+	}
+	p.computed = append(p.computed, &pb.ComputedColumn{Name: name, Expr: pbExpr})
+	p.computedCols[key] = name
+	p.computedType[name] = colType
+	return name, colType, nil
+}
+
+// Converts the expr to a pb.Expr and returns its type, which is checked the same way as Table.newExpr.
+func (p *sqlPlanner) toPbExpr(e *sqlExpr) (*pb.Expr, ColumnType, error) {
+	if c, ok := p.constValue(e); ok {
+		switch c.colType {
+		case IntColumnType:
+			return &pb.Expr{Op: pb.ExprOp_INT_LITERAL, IntVal: c.intVal}, IntColumnType, nil
+		case FloatColumnType:
+			return &pb.Expr{Op: pb.ExprOp_FLOAT_LITERAL, FloatVal: c.floatVal}, FloatColumnType, nil
+		case StrColumnType:
+			return &pb.Expr{Op: pb.ExprOp_STR_LITERAL, StrVal: c.strVal}, StrColumnType, nil
+		}
+		return nil, 0, p.errorAt(e, "expected an int, float or str")
+	}
+
+	switch e.kind {
+	case sqlColumnExpr:
+		colInfo, ok := p.t.colInfoMap.getColumnInfo(e.name)
+		if !ok {
+			return nil, 0, p.errorAt(e, "unknown column")
+		}
+		switch colInfo.ColumnType {
+		case IntColumnType, FloatColumnType, StrColumnType:
+			return &pb.Expr{Op: pb.ExprOp_COLUMN, ColumnName: colInfo.Name}, colInfo.ColumnType, nil
+		}
+		return nil, 0, p.errorAt(e, "only the int, float and str columns can be in exprs")
+	case sqlUnaryExpr:
+		if e.name == "-" {
+			zero := &sqlExpr{kind: sqlIntExpr, pos: e.pos, end: e.pos}
+			return p.toPbExpr(&sqlExpr{kind: sqlBinaryExpr, pos: e.pos, end: e.end, name: "-", args: []*sqlExpr{zero, e.args[0]}})
+		}
+	case sqlBinaryExpr, sqlCallExpr:
+		if p.isAggregation(e) {
+			return nil, 0, p.errorAt(e, "aggregations can't be in exprs")
+		}
+		op, ok := sqlExprOps[e.name]
+		if !ok {
+			if e.kind == sqlCallExpr {
+				return nil, 0, p.errorAt(e, "unknown function %s", e.name)
+			}
+			break
+		}
+
+		pbExpr := &pb.Expr{Op: op}
+		argTypes := make([]ColumnType, 0, len(e.args))
+		for _, arg := range e.args {
+			pbArg, argType, err := p.toPbExpr(arg)
+			if err != nil {
+				return nil, 0, err
+			}
+			pbExpr.Args = append(pbExpr.Args, pbArg)
+			argTypes = append(argTypes, argType)
+		}
+		colType, err := p.exprType(e, argTypes)
+		return pbExpr, colType, err
+	}
+	return nil, 0, p.errorAt(e, "expected an expr of the columns")
+}
+
+// The type of the expr of the op of the arg types, @see Table.newExpr.
+func (p *sqlPlanner) exprType(e *sqlExpr, argTypes []ColumnType) (ColumnType, error) {
+	isNumeric := func(colType ColumnType) bool { return colType == IntColumnType || colType == FloatColumnType }
+	hasArgs := func(cnt int, valid func(ColumnType) bool) bool {
+		return len(argTypes) == cnt && every(argTypes, valid)
+	}
+
+	switch sqlExprOps[e.name] {
+	case pb.ExprOp_ADD, pb.ExprOp_SUB, pb.ExprOp_MUL:
+		if !hasArgs(2, isNumeric) {
+			return 0, p.errorAt(e, "expected int or float operands")
+		}
+		if some(argTypes, func(colType ColumnType) bool { return colType == FloatColumnType }) {
+			return FloatColumnType, nil
+		}
+		return IntColumnType, nil
+	case pb.ExprOp_DIV:
+		if !hasArgs(2, isNumeric) {
+			return 0, p.errorAt(e, "expected int or float operands")
+		}
+		return FloatColumnType, nil
+	case pb.ExprOp_MOD:
+		if !hasArgs(2, func(colType ColumnType) bool { return colType == IntColumnType }) {
+			return 0, p.errorAt(e, "expected int operands")
+		}
+		return IntColumnType, nil
+	case pb.ExprOp_ABS:
+		if !hasArgs(1, isNumeric) {
+			return 0, p.errorAt(e, "expected abs(int or float)")
+		}
+		return argTypes[0], nil
+	case pb.ExprOp_LOWER, pb.ExprOp_UPPER:
+		if !hasArgs(1, func(colType ColumnType) bool { return colType == StrColumnType }) {
+			return 0, p.errorAt(e, "expected %s(str)", e.name)
+		}
+		return StrColumnType, nil
+	default:
+		if (len(argTypes) != 2 && len(argTypes) != 3) || argTypes[0] != StrColumnType ||
+			!every(argTypes[1:], func(colType ColumnType) bool { return colType == IntColumnType }) {
+			return 0, p.errorAt(e, "expected substr(str, start[, length])")
+		}
+		return StrColumnType, nil
+	}
+}
+
+/**
+ * Evaluates the expr if it's a constant, i.e. a literal, now() for the current ts, or an
+ * arithmetic of the constants, e.g. `now() - 3600`. The ints are divided as ints.
+ */
+func (p *sqlPlanner) constValue(e *sqlExpr) (sqlConst, bool) {
+	switch e.kind {
+	case sqlIntExpr:
+		return sqlConst{colType: IntColumnType, intVal: e.intVal}, true
+	case sqlFloatExpr:
+		return sqlConst{colType: FloatColumnType, floatVal: e.floatVal}, true
+	case sqlStrExpr:
+		return sqlConst{colType: StrColumnType, strVal: e.strVal}, true
+	case sqlBoolExpr:
+		return sqlConst{colType: BoolColumnType, boolVal: e.boolVal}, true
+	case sqlCallExpr:
+		if e.name == "now" && len(e.args) == 0 {
+			return sqlConst{colType: IntColumnType, intVal: p.now}, true
+		}
+	case sqlUnaryExpr:
+		if arg, ok := p.constValue(e.args[0]); ok && e.name == "-" {
+			intVal, ok := evalIntConst(e.name, []int64{arg.intVal})
+			arg.intVal, arg.floatVal = intVal, -arg.floatVal
+			return arg, ok && (arg.colType == IntColumnType || arg.colType == FloatColumnType)
+		}
+	case sqlBinaryExpr:
+		op, ok := sqlExprOps[e.name]
+		if !ok {
+			return sqlConst{}, false
+		}
+		left, leftOk := p.constValue(e.args[0])
+		right, rightOk := p.constValue(e.args[1])
+		if !leftOk || !rightOk {
+			return sqlConst{}, false
+		}
+		if left.colType == IntColumnType && right.colType == IntColumnType {
+			if (op == pb.ExprOp_DIV || op == pb.ExprOp_MOD) && right.intVal == 0 {
+				return sqlConst{}, false
+			}
+			intVal, ok := evalIntConst(e.name, []int64{left.intVal, right.intVal})
+			return sqlConst{colType: IntColumnType, intVal: intVal}, ok
+		}
+		toFloat := func(c sqlConst) (float64, bool) {
+			if c.colType == IntColumnType {
+				return float64(c.intVal), true
+			}
+			return c.floatVal, c.colType == FloatColumnType
+		}
+		leftVal, leftOk := toFloat(left)
+		rightVal, rightOk := toFloat(right)
+		if !leftOk || !rightOk || op == pb.ExprOp_MOD || (op == pb.ExprOp_DIV && rightVal == 0) {
+			return sqlConst{}, false
+		}
+		return sqlConst{colType: FloatColumnType, floatVal: evalArithmetic(op, leftVal, rightVal)}, true
+	}
+	return sqlConst{}, false
+}
+
+/**
+ * Fails at the first arithmetic of the int constants in the expr which overflows int64, e.g.
+ * `now() - 9223372036854775807`, which isn't a constant then, @see constValue.
+ */
+func (p *sqlPlanner) checkIntOverflow(e *sqlExpr) error {
+	if e == nil {
+		return nil
+	}
+	for _, arg := range e.args {
+		if err := p.checkIntOverflow(arg); err != nil {
+			return err
+		}
+	}
+	if _, isArithmetic := sqlExprOps[e.name]; !(e.kind == sqlUnaryExpr && e.name == "-") && !(e.kind == sqlBinaryExpr && isArithmetic) {
+		return nil
+	}
+
+	args := make([]int64, 0, len(e.args))
+	for _, arg := range e.args {
+		c, ok := p.constValue(arg)
+		if !ok || c.colType != IntColumnType {
+			return nil
+		}
+		args = append(args, c.intVal)
+	}
+	if len(args) == 2 && args[1] == 0 && (e.name == "/" || e.name == "%") {
+		return nil
+	}
+	if _, ok := evalIntConst(e.name, args); !ok {
+		return p.errorAt(e, "the int constant overflows")
+	}
+	return nil
+}
+
+// Evaluates the unary minus or the arithmetic op of the int constants, or false if it overflows.
+func evalIntConst(name string, args []int64) (int64, bool) {
+	if len(args) == 1 {
+		return -args[0], args[0] != math.MinInt64
+	}
+
+	left, right := args[0], args[1]
+	switch name {
+	case "+":
+		sum := left + right
+		return sum, (sum > left) == (right > 0)
+	case "-":
+		diff := left - right
+		return diff, (diff < left) == (right > 0)
+	case "*":
+		if left == 0 || right == 0 {
+			return 0, true
+		}
+		product := left * right
+		return product, product/right == left && !(left == math.MinInt64 && right == -1)
+	case "/":
+		return left / right, !(left == math.MinInt64 && right == -1)
+	case "%":
+		return left % right, true
+	}
+	return 0, false
+}
+
+// The filter_expr of the conditions with OR or NOT, nil if none.
+func (p *sqlPlanner) filterExpr() *pb.FilterExpr {
+	switch len(p.filterExprs) {
+	case 0:
+		return nil
+	case 1:
+		return p.filterExprs[0]
+	}
+	return &pb.FilterExpr{Op: pb.FilterExprOp_AND, Children: p.filterExprs}
+}
+
+// Resolves a column that is not a column of the table to the selected expr of its alias.
+func (p *sqlPlanner) resolveAlias(e *sqlExpr) *sqlExpr {
+	if e.kind != sqlColumnExpr {
+		return e
+	}
+	if _, ok := p.t.colInfoMap.getColumnInfo(e.name); ok {
+		return e
+	}
+	for _, item := range p.stmt.items {
+		if item.alias == e.name {
+			return item.expr
+		}
+	}
+	return e
+}
+
+// The alias of the selected expr, empty if none.
+func (p *sqlPlanner) aliasOf(e *sqlExpr) string {
+	for _, item := range p.stmt.items {
+		if item.alias != "" && item.expr.String() == e.String() {
+			return item.alias
+		}
+	}
+	return ""
+}
+
+func (p *sqlPlanner) isAggregation(e *sqlExpr) bool {
+	if e.kind != sqlCallExpr {
+		return false
+	}
+	_, ok := sqlAggOps[e.name]
+	return ok || sqlPercentileFunc.MatchString(e.name)
+}
+
+func (p *sqlPlanner) containsAggregation(e *sqlExpr) bool {
+	return p.isAggregation(e) || some(e.args, p.containsAggregation)
+}
+
+func isSqlCall(e *sqlExpr, name string) bool {
+	return e.kind == sqlCallExpr && e.name == name
+}
+
+/**
+ * Converts a LIKE pattern, in which % matches any strs and _ matches a char, to a str filter,
+ * e.g. `abc%` is a PREFIX filter and `%abc%` is a CONTAINS filter.
+ */
+func likeFilter(pattern string) (pb.FilterOp, string) {
+	inner := strings.TrimSuffix(pattern, "%")
+	switch {
+	case !strings.ContainsAny(pattern, "%_"):
+		return pb.FilterOp_EQ, pattern
+	case !strings.ContainsAny(inner, "%_"):
+		return pb.FilterOp_PREFIX, inner
+	case strings.HasPrefix(inner, "%") && !strings.ContainsAny(inner[1:], "%_") && len(inner) < len(pattern):
+		return pb.FilterOp_CONTAINS, inner[1:]
+	}
+
+	var regex strings.Builder
+	regex.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			regex.WriteString(".*")
+		case '_':
+			regex.WriteString(".")
+		default:
+			regex.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	regex.WriteString("$")
+	return pb.FilterOp_REGEX, regex.String()
+}
+
+func sqlTypeName(colType ColumnType) string {
+	switch colType {
+	case IntColumnType:
+		return "int"
+	case FloatColumnType:
+		return "float"
+	case StrColumnType, StrSetColumnType:
+		return "str"
+	case BoolColumnType:
+		return "bool"
+	}
+	return "value"
+}
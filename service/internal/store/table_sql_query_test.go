@@ -0,0 +1,182 @@
+package store
+
+import (
+	"bapi/internal/pb"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSqlQuery(t *testing.T) {
+	rows := []RawJson{
+		{Int: map[string]int64{"ts": 1643175600, "latency": 10, "status": 200}, Str: map[string]string{"service": "api", "path": "/api/a"}},
+		{Int: map[string]int64{"ts": 1643175660, "latency": 30, "status": 500}, Str: map[string]string{"service": "api", "path": "/api/b"}},
+		{Int: map[string]int64{"ts": 1643175720, "latency": 20, "status": 200}, Str: map[string]string{"service": "web", "path": "/index"}},
+		{Int: map[string]int64{"ts": 1643179200, "latency": 40, "status": 404}, Str: map[string]string{"service": "web"}},
+	}
+	table := debugNewPrefilledTable(rows)
+	query := func(sql string) (*pb.SqlQueryResult, bool, error) {
+		stmt, err := ParseSql(sql)
+		assert.Nil(t, err)
+		return table.SqlQuery(stmt)
+	}
+
+	// the rows
+	result, ok, err := query("SELECT ts, service FROM events WHERE ts >= 1643175600 AND ts < 1643179200 AND path LIKE '/api/%' ORDER BY ts LIMIT 1")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1643179199), result.RowsQuery.GetMaxTs())
+	assert.Equal(t, []*pb.Filter{{ColumnName: "path", FilterOp: pb.FilterOp_PREFIX, StrVals: []string{"/api/"}}}, result.RowsQuery.StrFilters)
+	assert.True(t, result.RowsQuery.TsAscending)
+	assert.Equal(t, int32(1), result.RowsResult.Count)
+	assert.Equal(t, "api", result.RowsResult.StrIdMap[result.RowsResult.StrResult[0]])
+
+	result, ok, err = query("SELECT * FROM events WHERE NOT path LIKE '%a%' AND path IS NOT NULL")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"latency", "status", "ts"}, result.RowsResult.IntColumnNames)
+	assert.Equal(t, []string{"path", "service"}, result.RowsResult.StrColumnNames)
+	assert.Equal(t, int32(1), result.RowsResult.Count)
+
+	// the groups
+	result, ok, err = query(`
+		SELECT service, count(*) AS cnt, max(latency), avg(latency / 10) FROM events
+		WHERE ts >= 1643175600 AND (status >= 500 OR path IS NULL) OR status = 200
+		GROUP BY service ORDER BY cnt DESC, service`)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, pb.FilterExprOp_OR, result.TableQuery.FilterExpr.Op)
+	// AND binds tighter than OR
+	assert.Equal(t, 2, len(result.TableQuery.FilterExpr.Children))
+	assert.Equal(t, []*pb.ComputedColumn{{Name: "latency / 10", Expr: &pb.Expr{Op: pb.ExprOp_DIV, Args: []*pb.Expr{
+		{Op: pb.ExprOp_COLUMN, ColumnName: "latency"},
+		{Op: pb.ExprOp_INT_LITERAL, IntVal: 10},
+	}}}}, result.TableQuery.ComputedColumns)
+	assert.Equal(t, []string{"cnt", "max(latency)"}, result.TableResult.AggIntColumnNames)
+	assert.Equal(t, []string{"api", "web"}, []string{
+		result.TableResult.StrIdMap[result.TableResult.StrResult[0]],
+		result.TableResult.StrIdMap[result.TableResult.StrResult[1]],
+	})
+	assert.Equal(t, []int64{2, 2, 30, 40}, result.TableResult.AggIntResult)
+	assert.Equal(t, []float64{2, 3}, result.TableResult.AggFloatResult)
+
+	// the group by of an expr by its alias, and the aggregation to order by
+	result, ok, err = query(`
+		SELECT ts % 3600 AS ts_of_hour, p50(latency) FROM events WHERE ts >= 1643175600 AND status NOT IN (404, 500)
+		GROUP BY ts_of_hour ORDER BY sum(latency) DESC LIMIT 1`)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ts_of_hour"}, result.TableResult.IntColumnNames)
+	assert.Equal(t, 2, len(result.TableQuery.IntFilters))
+	assert.Equal(t, []string{"sum(latency)"}, result.TableResult.AggIntColumnNames)
+	assert.Equal(t, []int64{2520}, result.TableResult.IntResult)
+	assert.Equal(t, []int64{20}, result.TableResult.AggIntResult)
+
+	// the timeline
+	result, ok, err = query(`
+		SELECT time_bucket('1h', ts) AS hour, service, sum(latency) FROM events WHERE ts >= 1643175600
+		GROUP BY hour, service`)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, pb.TimeGran_HOUR_1, result.TimelineQuery.Gran)
+	assert.Equal(t, &pb.Aggregation{Op: pb.AggOp_SUM, ColumnName: "latency"}, result.TimelineQuery.Aggregation)
+	assert.Equal(t, int32(2), result.TimelineResult.Count)
+	// the groups are in no particular order
+	groups := make(map[string]*pb.TimelineGroup)
+	for i, group := range result.TimelineResult.TimelineGroups {
+		groups[result.TimelineResult.StrIdMap[result.TimelineResult.StrResult[i]]] = group
+	}
+	assert.Equal(t, []uint32{0}, groups["api"].TsBuckets)
+	assert.Equal(t, []uint32{0, 1}, groups["web"].TsBuckets)
+
+	result, _, err = query("SELECT count() FROM events WHERE ts >= 1643175600 GROUP BY time_bucket(90, ts, 'America/New_York')")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(90), result.TimelineQuery.GranSeconds)
+	assert.Equal(t, "America/New_York", result.TimelineQuery.Timezone)
+
+	// no row, but the planned query
+	result, ok, err = query("SELECT count(*) FROM events WHERE service = 'db'")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.NotNil(t, result.TableQuery)
+
+	// no ts is beyond the bounds of int64
+	for _, sql := range []string{
+		"SELECT count(*) FROM events WHERE ts > 9223372036854775807",
+		"SELECT count(*) FROM events WHERE ts < -9223372036854775807 - 1",
+		"SELECT ts FROM events WHERE ts > 9223372036854775807",
+		"SELECT count(*) FROM events WHERE ts > 9223372036854775807 GROUP BY time_bucket('1h', ts)",
+	} {
+		_, ok, err = query(sql)
+		assert.Nil(t, err)
+		assert.False(t, ok, sql)
+	}
+
+	// too many ts buckets, which is not an error of the statement
+	_, ok, err = query("SELECT count(*) FROM events WHERE ts >= 1 GROUP BY time_bucket(1, ts)")
+	assert.False(t, ok)
+	if assert.NotNil(t, err) {
+		_, isSqlErr := err.(*SqlError)
+		assert.False(t, isSqlErr)
+	}
+
+	// p100 and p0 are percents, and p999 is 0.999
+	for sql, quantile := range map[string]float64{
+		"SELECT p100(latency) FROM events": 1,
+		"SELECT p0(latency) FROM events":   0,
+		"SELECT p999(latency) FROM events": 0.999,
+	} {
+		result, ok, err = query(sql)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, quantile, result.TableQuery.Aggregations[0].Quantile, sql)
+	}
+	result, _, _ = query("SELECT p100(latency) FROM events")
+	assert.Equal(t, []string{"p100(latency)"}, result.TableResult.AggFloatColumnNames)
+	assert.Equal(t, []float64{40}, result.TableResult.AggFloatResult)
+
+	// the errors point at the offending exprs
+	sqlErr := func(sql string) *SqlError {
+		_, _, err := query(sql)
+		if assert.IsType(t, &SqlError{}, err) {
+			return err.(*SqlError)
+		}
+		return &SqlError{}
+	}
+	assert.Equal(t, "nope", sqlErr("SELECT nope FROM events").Near)
+	assert.Equal(t, "latency + 1", sqlErr("SELECT latency + 1 FROM events").Near)
+	assert.Equal(t, "path", sqlErr("SELECT path, count(*) FROM events GROUP BY service").Near)
+	assert.Equal(t, "path", sqlErr("SELECT sum(path) FROM events").Near)
+	assert.Equal(t, "1", sqlErr("SELECT count(*) FROM events WHERE service = 1 OR status = 200").Near)
+	assert.Equal(t, "service > 'a'", sqlErr("SELECT count(*) FROM events WHERE service > 'a'").Near)
+	assert.Equal(t, "'x'", sqlErr("SELECT count(*) FROM events WHERE latency = 'x'").Near)
+	assert.Equal(t, "latency * 2", sqlErr("SELECT count(*) FROM events WHERE latency * 2 > 1 OR status = 200").Near)
+	assert.Equal(t, "'2h30m'", sqlErr("SELECT count(*) FROM events WHERE ts >= 1 GROUP BY time_bucket('2h30m', ts)").Near)
+	assert.Equal(t, "time_bucket('1h', ts)", sqlErr("SELECT count(*) FROM events GROUP BY time_bucket('1h', ts)").Near)
+	assert.Equal(t, "lower(latency)", sqlErr("SELECT count(*) FROM events GROUP BY lower(latency)").Near)
+	assert.Equal(t, "p250(latency)", sqlErr("SELECT p250(latency) FROM events").Near)
+	// the int constants don't wrap around
+	assert.Equal(t, "1 + 9223372036854775807", sqlErr("SELECT count(*) FROM events WHERE ts >= 1 + 9223372036854775807").Near)
+	assert.Equal(t, "now() + 9223372036854775807", sqlErr("SELECT ts FROM events WHERE ts >= now() + 9223372036854775807").Near)
+	assert.Equal(t, "-(-9223372036854775807 - 1)", sqlErr("SELECT ts FROM events WHERE ts < -(-9223372036854775807 - 1)").Near)
+	assert.Equal(t, "4611686018427387904 * 2", sqlErr("SELECT ts FROM events LIMIT 4611686018427387904 * 2").Near)
+	assert.Equal(
+		t,
+		`can only aggregate an int or float column at line 1, column 12 near "path"`,
+		sqlErr("SELECT avg(path) FROM events").Error(),
+	)
+}
+
+func TestLikeFilter(t *testing.T) {
+	op, value := likeFilter("/api")
+	assert.Equal(t, pb.FilterOp_EQ, op)
+	assert.Equal(t, "/api", value)
+
+	op, value = likeFilter("%api%")
+	assert.Equal(t, pb.FilterOp_CONTAINS, op)
+	assert.Equal(t, "api", value)
+
+	op, value = likeFilter("a_c.%d")
+	assert.Equal(t, pb.FilterOp_REGEX, op)
+	assert.Equal(t, `(?s)^a.c\..*d$`, value)
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"bapi/internal/pb"
+	"math"
+)
+
+// The max number of ts buckets of all the groups of a filled timeline, @see pb.TimelineQuery.fill_max_points
+const timelineFillDefaultMaxPoints = 100_000
+
+/**
+ * Fills the groups of a timeline to all the ts buckets from 0 to the one of the maxTs, as the ts
+ * buckets without rows are not in the groups. The ts buckets without a value are filled by the
+ * fill, @see pb.TimelineFill. Fails if the groups would have more than maxPoints ts buckets.
+ */
+func fillTimelineGroups(
+	groups []*pb.TimelineGroup,
+	fill pb.TimelineFill,
+	maxPoints int,
+	bucketer tsBucketer,
+	maxTs int64,
+	isFloatResult bool,
+	isCount bool,
+) bool {
+	if fill == pb.TimelineFill_FILL_NONE {
+		return true
+	}
+
+	bucketCnt := int(bucketer.getBucket(maxTs)) + 1
+	for _, group := range groups {
+		// the rows are up to the maxTs, but just in case
+		if len(group.TsBuckets) != 0 {
+			bucketCnt = max(bucketCnt, int(group.TsBuckets[len(group.TsBuckets)-1])+1)
+		}
+	}
+	if bucketCnt <= 0 || bucketCnt*len(groups) > maxPoints {
+		return false
+	}
+
+	bucketStartTs := make([]int64, bucketCnt)
+	for bucket := range bucketStartTs {
+		bucketStartTs[bucket] = bucketer.getBucketStartTs(int64(bucket))
+	}
+
+	for _, group := range groups {
+		hasValue := make([]bool, bucketCnt)
+		for i, tsBucket := range group.TsBuckets {
+			hasValue[tsBucket] = group.HasValue[i]
+		}
+		if isFloatResult {
+			group.FloatValues = fillValues(group.TsBuckets, group.FloatValues, hasValue, fill, bucketStartTs)
+		} else {
+			group.IntValues = fillValues(group.TsBuckets, group.IntValues, hasValue, fill, bucketStartTs)
+		}
+
+		group.TsBuckets = make([]uint32, bucketCnt)
+		for bucket := range group.TsBuckets {
+			group.TsBuckets[bucket] = uint32(bucket)
+		}
+		group.HasValue = hasValue
+		if isCount {
+			group.Counts = make([]uint32, bucketCnt)
+			for bucket, count := range group.IntValues {
+				group.Counts[bucket] = uint32(count)
+			}
+		}
+	}
+	return true
+}
+
+// --------------------------- internal ----------------------------
+/**
+ * Spreads the values of the ts buckets to all the ts buckets and fills the ones without a value,
+ * whose hasValue is set once filled.
+ */
+func fillValues[T numeric](
+	tsBuckets []uint32,
+	values []T,
+	hasValue []bool,
+	fill pb.TimelineFill,
+	bucketStartTs []int64,
+) []T {
+	filled := make([]T, len(hasValue))
+	for i, tsBucket := range tsBuckets {
+		filled[tsBucket] = values[i]
+	}
+
+	switch fill {
+	case pb.TimelineFill_FILL_ZERO:
+		for bucket := range hasValue {
+			hasValue[bucket] = true
+		}
+	case pb.TimelineFill_FILL_PREVIOUS:
+		for bucket := 1; bucket < len(hasValue); bucket++ {
+			if !hasValue[bucket] && hasValue[bucket-1] {
+				filled[bucket] = filled[bucket-1]
+				hasValue[bucket] = true
+			}
+		}
+	case pb.TimelineFill_FILL_LINEAR:
+		prev := -1
+		for bucket := range hasValue {
+			if !hasValue[bucket] {
+				continue
+			}
+			if prev != -1 && bucket-prev > 1 {
+				x0, x1 := float64(bucketStartTs[prev]), float64(bucketStartTs[bucket])
+				y0, y1 := float64(filled[prev]), float64(filled[bucket])
+				for i := prev + 1; i < bucket; i++ {
+					y := y0 + (y1-y0)*(float64(bucketStartTs[i])-x0)/(x1-x0)
+					if _, isFloat := any(filled[i]).(float64); !isFloat {
+						y = math.Round(y)
+					}
+					filled[i] = T(y)
+					hasValue[i] = true
+				}
+			}
+			prev = bucket
+		}
+	}
+	return filled
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"bapi/internal/pb"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFillTimelineGroups(t *testing.T) {
+	bucketer := newFixedTsBucketer(0, 10)
+	newGroup := func() *pb.TimelineGroup {
+		return &pb.TimelineGroup{
+			TsBuckets: []uint32{1, 2, 4},
+			IntValues: []int64{10, 0, 20},
+			HasValue:  []bool{true, false, true},
+		}
+	}
+	fill := func(fill pb.TimelineFill) *pb.TimelineGroup {
+		group := newGroup()
+		assert.True(t, fillTimelineGroups([]*pb.TimelineGroup{group}, fill, 100, bucketer, 55, false, false))
+		return group
+	}
+
+	none := fill(pb.TimelineFill_FILL_NONE)
+	assert.Equal(t, newGroup(), none)
+
+	zero := fill(pb.TimelineFill_FILL_ZERO)
+	assert.Equal(t, []uint32{0, 1, 2, 3, 4, 5}, zero.TsBuckets)
+	assert.Equal(t, []int64{0, 10, 0, 0, 20, 0}, zero.IntValues)
+	assert.Equal(t, []bool{true, true, true, true, true, true}, zero.HasValue)
+
+	null := fill(pb.TimelineFill_FILL_NULL)
+	assert.Equal(t, []int64{0, 10, 0, 0, 20, 0}, null.IntValues)
+	assert.Equal(t, []bool{false, true, false, false, true, false}, null.HasValue)
+
+	previous := fill(pb.TimelineFill_FILL_PREVIOUS)
+	assert.Equal(t, []int64{0, 10, 10, 10, 20, 20}, previous.IntValues)
+	assert.Equal(t, []bool{false, true, true, true, true, true}, previous.HasValue)
+
+	linear := fill(pb.TimelineFill_FILL_LINEAR)
+	assert.Equal(t, []int64{0, 10, 13, 17, 20, 0}, linear.IntValues)
+	assert.Equal(t, []bool{false, true, true, true, true, false}, linear.HasValue)
+
+	// the counts follow the values
+	group := &pb.TimelineGroup{TsBuckets: []uint32{1}, IntValues: []int64{3}, HasValue: []bool{true}, Counts: []uint32{3}}
+	assert.True(t, fillTimelineGroups([]*pb.TimelineGroup{group}, pb.TimelineFill_FILL_ZERO, 100, bucketer, 25, false, true))
+	assert.Equal(t, []uint32{0, 3, 0}, group.Counts)
+
+	// the floats are interpolated by the start ts of the ts buckets
+	monthly := newCalendarTsBucketer(0, pb.TimeGran_MONTH, time.UTC)
+	group = &pb.TimelineGroup{TsBuckets: []uint32{0, 2}, FloatValues: []float64{0, 59}, HasValue: []bool{true, true}}
+	assert.True(t, fillTimelineGroups([]*pb.TimelineGroup{group}, pb.TimelineFill_FILL_LINEAR, 100, monthly, 0, true, false))
+	// January has 31 days of the 59 days of January and February 1970
+	assert.Equal(t, []float64{0, 31, 59}, group.FloatValues)
+
+	// over the max points
+	groups := []*pb.TimelineGroup{newGroup(), newGroup()}
+	assert.False(t, fillTimelineGroups(groups, pb.TimelineFill_FILL_ZERO, 11, bucketer, 55, false, false))
+	assert.True(t, fillTimelineGroups(groups, pb.TimelineFill_FILL_ZERO, 12, bucketer, 55, false, false))
+}
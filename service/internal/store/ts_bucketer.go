@@ -0,0 +1,159 @@
+package store
+
+import (
+	"bapi/internal/pb"
+	"fmt"
+	"time"
+	// the timezones are embedded, so the calendar buckets don't depend on the tzdata of the host
+	_ "time/tzdata"
+)
+
+// The max number of ts buckets of the gran picked for TimeGran_AUTO
+const autoGranMaxBuckets = 200
+
+// The max number of ts buckets of a timeline, @see pb.TimelineQuery.max_buckets
+const timelineDefaultMaxBuckets = 100_000
+
+// The grans TimeGran_AUTO picks from, from the smallest
+var autoGrans = []pb.TimeGran{
+	pb.TimeGran_MIN_1,
+	pb.TimeGran_MIN_5,
+	pb.TimeGran_MIN_15,
+	pb.TimeGran_MIN_30,
+	pb.TimeGran_HOUR_1,
+	pb.TimeGran_HOUR_3,
+	pb.TimeGran_HOUR_12,
+	pb.TimeGran_DAY,
+	pb.TimeGran_WEEK,
+	pb.TimeGran_MONTH,
+}
+
+// The smallest autoGran of at most autoGranMaxBuckets buckets from startTs to endTs, or the
+// largest one for a longer range.
+func pickAutoGran(startTs int64, endTs int64) pb.TimeGran {
+	for _, gran := range autoGrans {
+		// the calendar grans are about their nominal seconds
+		if (endTs-startTs)/int64(gran) < autoGranMaxBuckets {
+			return gran
+		}
+	}
+	return autoGrans[len(autoGrans)-1]
+}
+
+// Maps the ts to the ts buckets of a timeline, which are numbered from the one of the startTs.
+type tsBucketer interface {
+	getBucket(ts int64) int64
+	getBucketStartTs(bucket int64) int64
+}
+
+/**
+ * Builds the bucketer of the ts buckets of a timeline from the startTs, which are either of
+ *   - granSeconds if set,
+ *   - a fixed gran of seconds, e.g. MIN_5,
+ *   - or a calendar gran, i.e. DAY, WEEK or MONTH, in the timezone, UTC if not set.
+ * AUTO is expected to be picked before, @see pickAutoGran.
+ */
+func newTsBucketer(gran pb.TimeGran, granSeconds uint32, timezone string, startTs int64) (tsBucketer, error) {
+	if granSeconds != 0 {
+		return newFixedTsBucketer(startTs, int64(granSeconds)), nil
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	switch gran {
+	case pb.TimeGran_INVALID, pb.TimeGran_AUTO:
+		return nil, fmt.Errorf("invalid gran: %v", gran)
+	case pb.TimeGran_DAY, pb.TimeGran_WEEK, pb.TimeGran_MONTH:
+		return newCalendarTsBucketer(startTs, gran, loc), nil
+	default:
+		return newFixedTsBucketer(startTs, int64(gran)), nil
+	}
+}
+
+// --------------------------- fixedTsBucketer ---------------------------
+// The ts buckets of gran seconds from the startTs
+type fixedTsBucketer struct {
+	startTs int64
+	gran    int64
+}
+
+func newFixedTsBucketer(startTs int64, gran int64) *fixedTsBucketer {
+	return &fixedTsBucketer{startTs: startTs, gran: gran}
+}
+
+func (b *fixedTsBucketer) getBucket(ts int64) int64 {
+	return (ts - b.startTs) / b.gran
+}
+
+func (b *fixedTsBucketer) getBucketStartTs(bucket int64) int64 {
+	return b.startTs + bucket*b.gran
+}
+
+// --------------------------- calendarTsBucketer ---------------------------
+/**
+ * The days, weeks or months in the location, which start at the local midnight, so a day is not
+ * always 24 hours, e.g. on the DST changes. The weeks start on Monday. The first bucket is the
+ * one of the startTs, which starts before the startTs unless it's at midnight.
+ */
+type calendarTsBucketer struct {
+	gran pb.TimeGran
+	loc  *time.Location
+	// the calendar index of the first bucket, @see calendarIndex
+	firstIndex int64
+}
+
+func newCalendarTsBucketer(startTs int64, gran pb.TimeGran, loc *time.Location) *calendarTsBucketer {
+	b := &calendarTsBucketer{gran: gran, loc: loc}
+	b.firstIndex = b.calendarIndex(startTs)
+	return b
+}
+
+func (b *calendarTsBucketer) getBucket(ts int64) int64 {
+	return b.calendarIndex(ts) - b.firstIndex
+}
+
+func (b *calendarTsBucketer) getBucketStartTs(bucket int64) int64 {
+	index := b.firstIndex + bucket
+	switch b.gran {
+	case pb.TimeGran_MONTH:
+		return time.Date(int(index/12), time.Month(index%12+1), 1, 0, 0, 0, 0, b.loc).Unix()
+	case pb.TimeGran_WEEK:
+		// the Monday of the week, @see calendarIndex
+		index = index*7 - 3
+	}
+	year, month, day := time.Unix(index*secondsPerDay, 0).UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, b.loc).Unix()
+}
+
+// --------------------------- internal ----------------------------
+const secondsPerDay = 24 * 60 * 60
+
+/**
+ * The index of the calendar day, week or month of the ts in the location, i.e. the days since
+ * 1970-01-01 of the local date, the weeks since the Monday before it, or year * 12 + month - 1.
+ */
+func (b *calendarTsBucketer) calendarIndex(ts int64) int64 {
+	year, month, day := time.Unix(ts, 0).In(b.loc).Date()
+	if b.gran == pb.TimeGran_MONTH {
+		return int64(year)*12 + int64(month) - 1
+	}
+
+	days := floorDiv(time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix(), secondsPerDay)
+	if b.gran == pb.TimeGran_WEEK {
+		// 1970-01-01 is a Thursday, so the days since the Monday before it is days + 3
+		return floorDiv(days+3, 7)
+	}
+	return days
+}
+
+// Rounds down, unlike the / of the negative ints.
+func floorDiv(a int64, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"bapi/internal/pb"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixedTsBucketer(t *testing.T) {
+	bucketer, err := newTsBucketer(pb.TimeGran_MIN_5, 0 /*granSeconds*/, "", 1000)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), bucketer.getBucket(1299))
+	assert.Equal(t, int64(1), bucketer.getBucket(1300))
+	assert.Equal(t, int64(1300), bucketer.getBucketStartTs(1))
+
+	// granSeconds is used instead of the gran
+	bucketer, err = newTsBucketer(pb.TimeGran_INVALID, 7 /*granSeconds*/, "", 1000)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), bucketer.getBucket(1014))
+
+	_, err = newTsBucketer(pb.TimeGran_INVALID, 0 /*granSeconds*/, "", 1000)
+	assert.NotNil(t, err)
+	_, err = newTsBucketer(pb.TimeGran_DAY, 0 /*granSeconds*/, "Not/A_Timezone", 1000)
+	assert.NotNil(t, err)
+}
+
+func TestCalendarTsBucketer(t *testing.T) {
+	loc, _ := time.LoadLocation("America/New_York")
+	at := func(year int, month time.Month, day int, hour int) int64 {
+		return time.Date(year, month, day, hour, 0, 0, 0, loc).Unix()
+	}
+
+	// the DST starts on 2022-03-13, whose day is 23 hours
+	days, err := newTsBucketer(pb.TimeGran_DAY, 0 /*granSeconds*/, "America/New_York", at(2022, 3, 12, 15))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), days.getBucket(at(2022, 3, 12, 23)))
+	assert.Equal(t, int64(1), days.getBucket(at(2022, 3, 13, 0)))
+	assert.Equal(t, int64(1), days.getBucket(at(2022, 3, 13, 23)))
+	assert.Equal(t, int64(2), days.getBucket(at(2022, 3, 14, 0)))
+	assert.Equal(t, at(2022, 3, 12, 0), days.getBucketStartTs(0))
+	assert.Equal(t, int64(23*3600), days.getBucketStartTs(2)-days.getBucketStartTs(1))
+
+	// 2022-03-12 is a Saturday
+	weeks, _ := newTsBucketer(pb.TimeGran_WEEK, 0 /*granSeconds*/, "America/New_York", at(2022, 3, 12, 15))
+	assert.Equal(t, int64(0), weeks.getBucket(at(2022, 3, 13, 23)))
+	assert.Equal(t, int64(1), weeks.getBucket(at(2022, 3, 14, 0)))
+	assert.Equal(t, at(2022, 3, 7, 0), weeks.getBucketStartTs(0))
+	assert.Equal(t, at(2022, 3, 14, 0), weeks.getBucketStartTs(1))
+
+	months, _ := newTsBucketer(pb.TimeGran_MONTH, 0 /*granSeconds*/, "America/New_York", at(2021, 12, 31, 15))
+	assert.Equal(t, int64(1), months.getBucket(at(2022, 1, 1, 0)))
+	assert.Equal(t, int64(3), months.getBucket(at(2022, 3, 31, 23)))
+	assert.Equal(t, at(2021, 12, 1, 0), months.getBucketStartTs(0))
+	assert.Equal(t, at(2022, 3, 1, 0), months.getBucketStartTs(3))
+
+	// the local date is not the UTC one
+	utcDays, _ := newTsBucketer(pb.TimeGran_DAY, 0 /*granSeconds*/, "", at(2022, 3, 12, 15))
+	assert.Equal(t, int64(1), utcDays.getBucket(at(2022, 3, 12, 23)))
+}
+
+func TestPickAutoGran(t *testing.T) {
+	assert.Equal(t, pb.TimeGran_MIN_1, pickAutoGran(0, 3600))
+	assert.Equal(t, pb.TimeGran_MIN_15, pickAutoGran(0, 24*3600))
+	assert.Equal(t, pb.TimeGran_HOUR_12, pickAutoGran(0, 30*24*3600))
+	assert.Equal(t, pb.TimeGran_DAY, pickAutoGran(0, 180*24*3600))
+	assert.Equal(t, pb.TimeGran_MONTH, pickAutoGran(0, 100*365*24*3600))
+}
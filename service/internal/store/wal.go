@@ -0,0 +1,384 @@
+package store
+
+import (
+	"bapi/internal/common"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sync"
+)
+
+var walMagic = []byte("BAPIWAL\x05")
+
+const walHeaderSize = 16     // walMagic + uint64 generation
+const walFrameHeaderSize = 8 // uint32 payload size + uint32 crc32 of the payload
+
+/**
+ * An append-only write-ahead log of the partialBlocks ingested by a table.
+ *
+ * File layout:
+ * 	walMagic, uint64 generation, frame, frame, ...
+ * 	frame: [uint32 size][uint32 crc32][payload of `size` bytes]
+ *
+ * Each payload is a walRecord, which is self-contained: besides the rows, it carries the
+ * definition of every column and string the rows use, so the column ids and string ids can
+ * be restored exactly without relying on the order of the records.
+ *
+ * A crash in the middle of an append leaves a torn frame at the end of the file. On replay,
+ * the log is truncated at the first frame that is incomplete or fails the checksum.
+ *
+ * The generation is bumped every time the log is reset after a snapshot. A snapshot records the
+ * walPosition it covers, so the records already in the snapshot are skipped on replay even if
+ * the server crashed before the log was reset.
+ */
+type wal struct {
+	ctx  *common.BapiCtx
+	path string
+
+	lock       *sync.Mutex
+	file       *os.File
+	generation uint64
+	size       int64
+}
+
+// A position in the wal. Records before the position are covered by a snapshot.
+type walPosition struct {
+	generation uint64
+	offset     int64
+}
+
+type walRecord struct {
+	columns []*ColumnInfo
+	strs    map[strId]string
+	pb      *partialBlock
+}
+
+// Replays the log at the given path (creating it if missing) and opens it for appending.
+// `replay` is called for each valid record after the `start` position in order.
+func openWal(ctx *common.BapiCtx, path string, start walPosition, replay func(*walRecord) error) (*wal, error) {
+	position, err := replayWal(ctx, path, start, replay)
+	if err != nil {
+		return nil, err
+	}
+
+	if position.offset == 0 {
+		// new log, or the log is unusable: it has a torn header or is older than the snapshot
+		if err := writeWalHeader(path, start.generation+1); err != nil {
+			return nil, err
+		}
+		position = walPosition{generation: start.generation + 1, offset: walHeaderSize}
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(position.offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(position.offset, 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &wal{
+		ctx:        ctx,
+		path:       path,
+		lock:       &sync.Mutex{},
+		file:       file,
+		generation: position.generation,
+		size:       position.offset,
+	}, nil
+}
+
+// Appends the record and syncs the file so the record survives a crash once this returns.
+func (w *wal) append(record *walRecord) error {
+	payload := encodeWalRecord(record)
+	frame := make([]byte, walFrameHeaderSize, walFrameHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	frame = append(frame, payload...)
+
+	w.lock.Lock()
+	defer func() {
+		w.lock.Unlock()
+	}()
+
+	n, err := w.file.Write(frame)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// Returns the position right after the last appended record.
+func (w *wal) position() walPosition {
+	w.lock.Lock()
+	defer func() {
+		w.lock.Unlock()
+	}()
+
+	return walPosition{generation: w.generation, offset: w.size}
+}
+
+// Drops all the records and starts the next generation. Called after the records are
+// persisted by a snapshot.
+func (w *wal) reset() error {
+	w.lock.Lock()
+	defer func() {
+		w.lock.Unlock()
+	}()
+
+	tmpPath := w.path + ".tmp"
+	if err := writeWalHeader(tmpPath, w.generation+1); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, w.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(w.path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(walHeaderSize, 0); err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file.Close()
+	w.file = file
+	w.generation++
+	w.size = walHeaderSize
+	return nil
+}
+
+func (w *wal) close() error {
+	w.lock.Lock()
+	defer func() {
+		w.lock.Unlock()
+	}()
+
+	return w.file.Close()
+}
+
+func writeWalHeader(path string, generation uint64) error {
+	header := make([]byte, walHeaderSize)
+	copy(header, walMagic)
+	binary.LittleEndian.PutUint64(header[len(walMagic):], generation)
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(header); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Reads the log and calls `replay` for each valid record after `start`. Returns the position
+// at the end of the valid prefix of the file, whose offset is 0 if the log should be recreated.
+func replayWal(ctx *common.BapiCtx, path string, start walPosition, replay func(*walRecord) error) (walPosition, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return walPosition{}, nil
+	}
+	if err != nil {
+		return walPosition{}, err
+	}
+
+	// a file shorter than the header is only accepted if it's a torn header
+	magicSize := min(len(content), len(walMagic))
+	if !bytes.Equal(content[:magicSize], walMagic[:magicSize]) {
+		return walPosition{}, fmt.Errorf("%s is not a wal file or has an unsupported version", path)
+	}
+	if len(content) < walHeaderSize {
+		ctx.Logger.Warnf("wal %s has a torn header, starting a new log", path)
+		return walPosition{}, nil
+	}
+
+	generation := binary.LittleEndian.Uint64(content[len(walMagic):walHeaderSize])
+	if generation < start.generation {
+		ctx.Logger.Warnf("wal %s of generation %d is covered by the snapshot, starting a new log", path, generation)
+		return walPosition{}, nil
+	}
+
+	offset := walHeaderSize
+	replayed := 0
+	for offset < len(content) {
+		if len(content)-offset < walFrameHeaderSize {
+			break
+		}
+		size := int(binary.LittleEndian.Uint32(content[offset : offset+4]))
+		checksum := binary.LittleEndian.Uint32(content[offset+4 : offset+8])
+		if len(content)-offset-walFrameHeaderSize < size {
+			break
+		}
+
+		payload := content[offset+walFrameHeaderSize : offset+walFrameHeaderSize+size]
+		if crc32.ChecksumIEEE(payload) != checksum {
+			break
+		}
+
+		record, err := decodeWalRecord(payload)
+		if err != nil {
+			break
+		}
+
+		if generation > start.generation || int64(offset) >= start.offset {
+			if err := replay(record); err != nil {
+				return walPosition{}, fmt.Errorf("failed to replay wal %s at offset %d: %v", path, offset, err)
+			}
+			replayed++
+		}
+
+		offset += walFrameHeaderSize + size
+	}
+
+	if offset < len(content) {
+		ctx.Logger.Warnf("wal %s has a torn record at offset %d, dropping %d bytes", path, offset, len(content)-offset)
+	}
+	ctx.Logger.Infof("replayed %d records from wal %s", replayed, path)
+	return walPosition{generation: generation, offset: int64(offset)}, nil
+}
+
+// --------------------------- encoding ----------------------------
+func encodeWalRecord(record *walRecord) []byte {
+	e := newEncoder()
+
+	e.putUvarint(uint64(len(record.columns)))
+	for _, colInfo := range record.columns {
+		e.putUvarint(uint64(colInfo.id))
+		e.putUint8(colInfo.ColumnType)
+		e.putString(colInfo.Name)
+	}
+
+	e.putUvarint(uint64(len(record.strs)))
+	for sid, str := range record.strs {
+		e.putUvarint(uint64(sid))
+		e.putString(str)
+	}
+
+	pb := record.pb
+	e.putUvarint(uint64(pb.rowCount))
+	e.putVarint(pb.minTs)
+	e.putVarint(pb.maxTs)
+	encodePartialColumns(e, pb.intPartialColumns, func(v int64) { e.putVarint(v) })
+	encodePartialColumns(e, pb.strPartialColumns, func(v strId) { e.putUvarint(uint64(v)) })
+	encodePartialColumns(e, pb.floatPartialColumns, func(v float64) { e.putFloat64(v) })
+	encodePartialColumns(e, pb.boolPartialColumns, func(v uint8) { e.putUint8(v) })
+	encodePartialColumns(e, pb.strSetPartialColumns, func(v uint32) { e.putUvarint(uint64(v)) })
+	e.putUvarint(uint64(len(pb.strSets)))
+	for _, set := range pb.strSets {
+		e.putUvarint(uint64(len(set)))
+		for _, sid := range set {
+			e.putUvarint(uint64(sid))
+		}
+	}
+
+	return e.bytes()
+}
+
+func decodeWalRecord(payload []byte) (*walRecord, error) {
+	d := newDecoder(payload)
+
+	columns := make([]*ColumnInfo, d.length())
+	for i := range columns {
+		columns[i] = &ColumnInfo{id: columnId(d.uvarint())}
+		columns[i].ColumnType = d.uint8()
+		columns[i].Name = d.string()
+	}
+
+	strCount := d.length()
+	strs := make(map[strId]string, strCount)
+	strIdSet := make(map[strId]bool, strCount)
+	for i := 0; i < strCount; i++ {
+		sid := strId(d.uvarint())
+		strs[sid] = d.string()
+		strIdSet[sid] = true
+	}
+
+	pb := &partialBlock{strIdSet: strIdSet}
+	pb.rowCount = int(d.uvarint())
+	pb.minTs = d.varint()
+	pb.maxTs = d.varint()
+	pb.intPartialColumns = decodePartialColumns(d, pb.rowCount, func() int64 { return d.varint() })
+	pb.strPartialColumns = decodePartialColumns(d, pb.rowCount, func() strId { return strId(d.uvarint()) })
+	pb.floatPartialColumns = decodePartialColumns(d, pb.rowCount, func() float64 { return d.float64() })
+	pb.boolPartialColumns = decodePartialColumns(d, pb.rowCount, func() uint8 { return d.uint8() })
+	pb.strSetPartialColumns = decodePartialColumns(d, pb.rowCount, func() uint32 { return uint32(d.uvarint()) })
+	pb.strSets = make([][]strId, d.length())
+	for i := range pb.strSets {
+		pb.strSets[i] = make([]strId, d.length())
+		for j := range pb.strSets[i] {
+			pb.strSets[i][j] = strId(d.uvarint())
+			if !strIdSet[pb.strSets[i][j]] {
+				d.e = errCorrupted
+			}
+		}
+	}
+	for _, columnData := range pb.strSetPartialColumns {
+		for setIdx := range columnData {
+			if int(setIdx) >= len(pb.strSets) {
+				d.e = errCorrupted
+			}
+		}
+	}
+
+	if d.err() != nil {
+		return nil, d.err()
+	}
+	if d.remaining() != 0 || pb.rowCount == 0 {
+		return nil, errCorrupted
+	}
+
+	return &walRecord{
+		columns: columns,
+		strs:    strs,
+		pb:      pb,
+	}, nil
+}
+
+func encodePartialColumns[T comparable](e *encoder, columns partialColumns[T], putValue func(T)) {
+	e.putUvarint(uint64(len(columns)))
+	for colId, columnData := range columns {
+		e.putUvarint(uint64(colId))
+		e.putUvarint(uint64(len(columnData)))
+		for value, rowIds := range columnData {
+			putValue(value)
+			e.putUvarint(uint64(len(rowIds)))
+			for _, rowId := range rowIds {
+				e.putUvarint(uint64(rowId))
+			}
+		}
+	}
+}
+
+func decodePartialColumns[T comparable](d *decoder, rowCount int, getValue func() T) partialColumns[T] {
+	columns := newPartialColumns[T]()
+	colCount := d.length()
+	for i := 0; i < colCount && d.err() == nil; i++ {
+		columnData := columns.getOrCreateColumnData(columnId(d.uvarint()))
+		valueCount := d.length()
+		for j := 0; j < valueCount && d.err() == nil; j++ {
+			value := getValue()
+			rowIds := make([]uint32, d.length())
+			for k := range rowIds {
+				rowIds[k] = uint32(d.uvarint())
+				if int(rowIds[k]) >= rowCount {
+					d.e = errCorrupted
+				}
+			}
+			columnData[value] = rowIds
+		}
+	}
+	return columns
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"bapi/internal/common"
+	"bapi/internal/pb"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "table.wal")
+	table := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, table.OpenWal(path))
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app"},
+		},
+		{
+			Int: map[string]int64{"ts": 1643175609, "count": 1},
+			Str: map[string]string{"event": "publish"},
+		},
+	})
+	debugIngestRows(table, []RawJson{
+		{
+			Int:    map[string]int64{"ts": 1643175611, "count": 2},
+			Str:    map[string]string{"event": "create", "source": "modal"},
+			Bool:   map[string]bool{"logged_in": true},
+			StrSet: map[string][]string{"tags": {"a", "b"}},
+		},
+	})
+	assert.Nil(t, table.wal.close())
+
+	replayed := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, replayed.OpenWal(path))
+	assertTablesEqual(t, table, replayed)
+
+	// the replayed table keeps logging to the same wal
+	debugIngestRows(replayed, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175612},
+			Str: map[string]string{"event": "publish", "source": "toolbar"},
+		},
+	})
+	assert.Nil(t, replayed.wal.close())
+
+	replayedAgain := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, replayedAgain.OpenWal(path))
+	assertTablesEqual(t, replayed, replayedAgain)
+	assert.Equal(t, int64(4), replayedAgain.GetTableInfo().RowCount)
+}
+
+func TestWalTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "table.wal")
+	table := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, table.OpenWal(path))
+	debugIngestRows(table, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app"},
+		},
+	})
+	assert.Nil(t, table.wal.close())
+	validSize := debugFileSize(t, path)
+
+	// simulates a crash in the middle of appending the second record
+	otherTable := NewTable(common.NewBapiCtx(), "asd")
+	debugIngestRows(otherTable, []RawJson{
+		{
+			Int: map[string]int64{"ts": 1643175609, "count": 1},
+			Str: map[string]string{"event": "publish"},
+		},
+	})
+	ingester := otherTable.newIngester()
+	ingester.ingestRawJson(RawJson{Int: map[string]int64{"ts": 1643175609}}, false /*useServerTs*/)
+	partialBlock, _ := ingester.buildPartialBlock()
+	payload := encodeWalRecord(otherTable.newWalRecord(partialBlock))
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.Write([]byte{byte(len(payload)), 0, 0, 0, 1, 2, 3, 4})
+	file.Write(payload[:len(payload)/2])
+	file.Close()
+
+	replayed := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, replayed.OpenWal(path))
+	assertTablesEqual(t, table, replayed)
+	assert.Equal(t, validSize, debugFileSize(t, path))
+}
+
+func TestWalRejectsUnknownFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "table.wal")
+	os.WriteFile(path, []byte("not a wal file"), 0644)
+
+	table := NewTable(common.NewBapiCtx(), "asd")
+	assert.NotNil(t, table.OpenWal(path))
+}
+
+func TestTableClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "table.wal")
+	table := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, table.OpenWal(path))
+	rows := []*pb.RawRow{
+		{
+			Int: map[string]int64{"ts": 1643175607},
+			Str: map[string]string{"event": "init_app"},
+		},
+	}
+	// the pending rows are added to the table on close
+	assert.Equal(t, 1, table.IngestJsonRows(rows, false /*useServerTs*/))
+	assert.Nil(t, table.Close())
+	assert.Equal(t, int64(1), table.GetTableInfo().RowCount)
+
+	// rows ingested after close are dropped
+	assert.Equal(t, 0, table.IngestJsonRows(rows, false /*useServerTs*/))
+	assert.NotNil(t, table.Snapshot(filepath.Join(t.TempDir(), "snapshot")))
+	assert.Nil(t, table.Close())
+
+	reopened := NewTable(common.NewBapiCtx(), "asd")
+	assert.Nil(t, reopened.OpenWal(path))
+	assertTablesEqual(t, table, reopened)
+}
+
+func TestWalRecordEncoding(t *testing.T) {
+	table := NewTable(common.NewBapiCtx(), "asd")
+	ingester := table.newIngester()
+	ingester.ingestRawJson(RawJson{
+		Int: map[string]int64{"ts": 1643175607, "count": -3},
+		Str: map[string]string{"event": "init_app"},
+	}, false /*useServerTs*/)
+	ingester.ingestRawJson(RawJson{
+		Int:   map[string]int64{"ts": 1643175609},
+		Str:   map[string]string{"event": "init_app"},
+		Float: map[string]float64{"latency": -0.5},
+	}, false /*useServerTs*/)
+	ingester.ingestRawJson(RawJson{
+		Int:    map[string]int64{"ts": 1643175611},
+		Bool:   map[string]bool{"logged_in": false},
+		StrSet: map[string][]string{"tags": {"a", "b"}},
+	}, false /*useServerTs*/)
+	partialBlock, _ := ingester.buildPartialBlock()
+
+	record := table.newWalRecord(partialBlock)
+	decoded, err := decodeWalRecord(encodeWalRecord(record))
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, record.columns, decoded.columns)
+	assert.Equal(t, record.strs, decoded.strs)
+	assert.Equal(t, partialBlock.rowCount, decoded.pb.rowCount)
+	assert.Equal(t, partialBlock.minTs, decoded.pb.minTs)
+	assert.Equal(t, partialBlock.maxTs, decoded.pb.maxTs)
+	assert.Equal(t, partialBlock.strIdSet, decoded.pb.strIdSet)
+	assert.Equal(t, partialBlock.intPartialColumns, decoded.pb.intPartialColumns)
+	assert.Equal(t, partialBlock.strPartialColumns, decoded.pb.strPartialColumns)
+	assert.Equal(t, partialBlock.floatPartialColumns, decoded.pb.floatPartialColumns)
+	assert.Equal(t, partialBlock.boolPartialColumns, decoded.pb.boolPartialColumns)
+	assert.Equal(t, partialBlock.strSetPartialColumns, decoded.pb.strSetPartialColumns)
+	assert.Equal(t, partialBlock.strSets, decoded.pb.strSets)
+	assert.Equal(t, partialBlock.boolPartialColumns, decoded.pb.boolPartialColumns)
+	assert.Equal(t, partialBlock.strSetPartialColumns, decoded.pb.strSetPartialColumns)
+	assert.Equal(t, partialBlock.strSets, decoded.pb.strSets)
+
+	_, err = decodeWalRecord(encodeWalRecord(record)[1:])
+	assert.NotNil(t, err)
+}
+
+// --------------------------- test util ----------------------------
+func debugIngestRows(table *Table, rawRows []RawJson) {
+	ingester := table.newIngester()
+	for _, rawRow := range rawRows {
+		ingester.ingestRawJson(rawRow, false /*useServerTs*/)
+	}
+
+	pb, _ := ingester.buildPartialBlock()
+	table.addPartialBlock(pb, true /* flushImmediatly */)
+}
+
+func debugFileSize(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	return info.Size()
+}
+
+// Asserts that the tables have the same columns, strings and rows.
+func assertTablesEqual(t *testing.T, expected *Table, actual *Table) {
+	expectedInfo := expected.GetTableInfo()
+	actualInfo := actual.GetTableInfo()
+	assert.Equal(t, expectedInfo.RowCount, actualInfo.RowCount)
+	assert.Equal(t, expectedInfo.MinTs, actualInfo.MinTs)
+	assert.Equal(t, expectedInfo.MaxTs, actualInfo.MaxTs)
+
+	expectedCols := expected.colInfoMap.getColumns()
+	actualCols := actual.colInfoMap.getColumns()
+	assert.Equal(t, len(expectedCols), len(actualCols))
+	colNames := make(map[ColumnType][]string)
+	for colType, columns := range expectedCols {
+		assert.ElementsMatch(t, columns, actualCols[colType])
+		for _, colInfo := range columns {
+			colNames[colType] = append(colNames[colType], colInfo.Name)
+		}
+	}
+
+	query := &pb.RowsQuery{
+		MinTs:          expectedInfo.MinTs,
+		MaxTs:          &expectedInfo.MaxTs,
+		IntColumnNames: colNames[IntColumnType],
+		StrColumnNames: colNames[StrColumnType],
+
+		FloatColumnNames:  colNames[FloatColumnType],
+		BoolColumnNames:   colNames[BoolColumnType],
+		StrSetColumnNames: colNames[StrSetColumnType],
+	}
+	expectedResult, _ := expected.RowsQuery(query)
+	actualResult, _ := actual.RowsQuery(query)
+	assert.Equal(t, expectedResult, actualResult)
+}